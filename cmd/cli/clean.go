@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/workspace"
+	"github.com/urfave/cli/v3"
+)
+
+func cleanCommand() *cli.Command {
+	var dir string
+	var olderThan time.Duration
+	var dryRun bool
+
+	return &cli.Command{
+		Name:  "clean",
+		Usage: "remove work directories left by earlier runs, from the temporary directory by default",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:        "older-than",
+				Usage:       "only remove work directories unused for this long",
+				Value:       24 * time.Hour,
+				Destination: &olderThan,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "list the work directories that would be removed",
+				Destination: &dryRun,
+			},
+		},
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name:        "dir",
+				Destination: &dir,
+			},
+		},
+		Action: func(context.Context, *cli.Command) error {
+			if dir == "" {
+				dir = os.TempDir()
+			}
+
+			stale, err := workspace.Stale(dir, time.Now().Add(-olderThan))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("failed to list work directories: %v", err), 1)
+			}
+
+			for _, w := range stale {
+				if dryRun {
+					fmt.Printf("→ Would remove %s\n", w.Root)
+					continue
+				}
+				if _, err := w.Cleanup(workspace.CleanupAlways, true); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				fmt.Printf("→ Removed %s\n", w.Root)
+			}
+			fmt.Printf("%d stale work directories\n", len(stale))
+
+			return nil
+		},
+	}
+}
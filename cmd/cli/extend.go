@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/openmvg"
+	"github.com/2024-dissertation/openmvgo/internal/openmvs"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/tracing"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"github.com/2024-dissertation/openmvgo/internal/workspace"
+	"github.com/urfave/cli/v3"
+)
+
+// run is the configuration of a pipeline run, kept in its work directory so
+// that the reconstruction can be extended later
+type run struct {
+	OpenMVG openmvg.OpenMVGConfig
+	OpenMVS openmvs.OpenMVSConfig
+}
+
+// saveRun writes run.json to the work directory. The camera database is left
+// out, it is removed at the end of each run.
+func saveRun(workDir string, r run) error {
+	r.OpenMVG.CameraDBFile = nil
+	r.OpenMVG.ExtendDir = ""
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write run configuration: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "run.json"), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write run configuration: %w", err)
+	}
+	return nil
+}
+
+func loadRun(workDir string) (*run, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, "run.json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s holds no completed run: %w", workDir, err)
+	}
+	var r run
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to read run configuration: %w", err)
+	}
+	return &r, nil
+}
+
+// copySidecars copies the reports of the configured OpenMVG steps and the
+// colorized sparse point cloud to the output directory
+func copySidecars(utils utils.UtilsInterface, config openmvg.OpenMVGConfig, outputDir string) {
+	for _, path := range config.Sidecars() {
+		utils.Check(utils.CopyFile(path, filepath.Join(outputDir, filepath.Base(path))))
+	}
+}
+
+// registeredViews returns the number of camera poses of the scene exported
+// to the build directory
+func registeredViews(buildDir string) (int, error) {
+	sfm, err := sfmdata.Load(filepath.Join(buildDir, "sfm_data.json"))
+	if err != nil {
+		return 0, err
+	}
+	return len(sfm.Poses), nil
+}
+
+func extendCommand() *cli.Command {
+	var workDir string
+	var imagesDir string
+	var outputDir string
+	var cameraDBFile string
+	var maxThreads int
+	var tracingOptions tracing.Options
+	var maxMemory string
+	var maxCPUTime time.Duration
+
+	return &cli.Command{
+		Name:  "extend",
+		Usage: "add new images to the reconstruction of a run kept with --work-dir",
+		Description: "Features and matches are computed for the new images only. When new images are registered, the whole OpenMVS\n" +
+			"pipeline runs again: the reconstruction is adjusted with every camera, so the depth maps, mesh and texture of\n" +
+			"the previous run are recomputed rather than updated.",
+		Flags: append(append([]cli.Flag{
+			&cli.IntFlag{
+				Name:        "max-threads",
+				Usage:       "threads of every command, every CPU when 0",
+				Destination: &maxThreads,
+			},
+		}, limitFlags(&maxMemory, &maxCPUTime)...), tracingFlags(&tracingOptions)...),
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name:        "work-dir",
+				Destination: &workDir,
+			},
+			&cli.StringArg{
+				Name:        "images",
+				Destination: &imagesDir,
+			},
+			&cli.StringArg{
+				Name:        "output",
+				Destination: &outputDir,
+			},
+			&cli.StringArg{
+				Name:        "cameraDB",
+				Destination: &cameraDBFile,
+			},
+		},
+		Action: func(ctx context.Context, _ *cli.Command) error {
+			if workDir == "" || imagesDir == "" || outputDir == "" {
+				return cli.Exit("work, images and output directories must be specified", 1)
+			}
+
+			limits, err := parseLimits(maxMemory, maxCPUTime)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			ws, err := workspace.Open(workDir)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			previous, err := loadRun(ws.Root)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			fmt.Printf("Work Directory: %s\n", ws.Root)
+			fmt.Printf("New Images: %s\n", imagesDir)
+			fmt.Printf("Output Directory: %s\n", outputDir)
+			// The resources are planned again, the run may have moved to
+			// another host since
+			budget := planResources(1, maxThreads, limits)
+
+			stopTracing, err := startTracing(ctx, tracingOptions)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			defer stopTracing()
+			ctx, span := tracing.Start(ctx, "extend")
+			defer span.End()
+
+			progress := &progressDisplay{w: os.Stderr}
+			commands := tracing.NewCommands(ctx)
+			tracker := pipeline.NewTracker(pipeline.Observers(progress.Observe, commands.Observe))
+			utils := &utils.UtilsImpl{LogDir: ws.Logs, Output: tracker, Limits: limits, Env: budget.Env(), OnCommand: commands.OnCommand}
+
+			openmvgConfig := previous.OpenMVG
+			openmvgConfig.ExtendDir = imagesDir
+			openmvgConfig.CameraDBFile = &cameraDBFile
+			openmvgConfig.Threads = budget.Threads
+			openmvgService := openmvg.NewOpenMVGService(openmvgConfig, utils)
+
+			openmvsConfig := previous.OpenMVS
+			openmvsConfig.OutputDir = outputDir
+			openmvsConfig.MaxThreads = budget.Threads
+			openmvsConfig.Memory = budget.Memory
+			openmvsConfig.SceneFile = openmvgService.Config.SceneFile()
+			openmvsConfig.GeoreferenceFile = openmvgService.Config.GeoreferenceFile()
+			openmvsService := openmvs.NewOpenMVSService(&openmvsConfig, utils)
+			openmvgService.Observer = tracker.Observe
+			openmvsService.Observer = tracker.Observe
+			openmvgService.Context = ctx
+			openmvsService.Context = ctx
+			progress.total = len(openmvgService.ExtendSteps()) + len(openmvsService.Steps())
+
+			before, err := registeredViews(openmvgConfig.OutputDir)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("failed to read previous reconstruction: %v", err), 1)
+			}
+
+			openmvgService.PopulateTmpDir()
+			if cameraDBFile == "" {
+				defer os.Remove(*openmvgService.Config.CameraDBFile)
+			}
+
+			steps := openmvgService.SfMExtendPipeline()
+
+			after, err := registeredViews(openmvgConfig.OutputDir)
+			utils.Check(err)
+			if after == before {
+				// The dense reconstruction depends on every camera, so it only
+				// changes when new cameras were registered. When it changes, it
+				// is recomputed in full.
+				fmt.Println("No new images could be registered, the previous OpenMVS results are kept")
+				return nil
+			}
+			fmt.Printf("→ Registered %d new images, %d in total\n", after-before, after)
+
+			steps = append(steps, openmvsService.RunPipeline()...)
+			r := run{OpenMVG: openmvgService.Config, OpenMVS: openmvsConfig}
+			copySidecars(utils, openmvgService.Config, outputDir)
+			copyLogs(utils, ws, outputDir)
+			utils.Check(saveRun(ws.Root, r))
+			writeManifest(utils, ws, outputDir, r, steps)
+
+			fmt.Println("OpenMVGO extend completed successfully!")
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/resources"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"github.com/urfave/cli/v3"
+)
+
+// limitFlags bound the resources of every command run by the pipelines
+func limitFlags(memory *string, cpuTime *time.Duration) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "max-memory",
+			Usage:       "memory of a command, e.g. 12G, enforced with cgroup v2 when delegated and as an address space limit otherwise (Linux only)",
+			Destination: memory,
+		},
+		&cli.DurationFlag{
+			Name:        "max-cpu-time",
+			Usage:       "user and system CPU time of a command, e.g. 2h (Linux only)",
+			Destination: cpuTime,
+		},
+	}
+}
+
+// planResources shares the detected CPUs and memory between pipelines
+// running at once, bounded by maxThreads and the memory limit when set
+func planResources(pipelines int, maxThreads int, limits utils.Limits) resources.Budget {
+	budget := resources.Plan(resources.Detect(), pipelines, maxThreads, limits.Memory)
+	memory := "unknown memory"
+	if budget.Memory > 0 {
+		memory = utils.FormatSize(budget.Memory)
+	}
+	fmt.Printf("→ Budget per command: %d threads, %s\n", budget.Threads, memory)
+	return budget
+}
+
+// parseLimits returns the limits set by limitFlags
+func parseLimits(memory string, cpuTime time.Duration) (utils.Limits, error) {
+	limits := utils.Limits{CPUTime: cpuTime}
+	if memory != "" {
+		var err error
+		if limits.Memory, err = utils.ParseSize(memory); err != nil {
+			return utils.Limits{}, err
+		}
+	}
+	return limits, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/2024-dissertation/openmvgo/internal/openmvg"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"github.com/2024-dissertation/openmvgo/internal/workspace"
+	"github.com/urfave/cli/v3"
+)
+
+// localization is the JSON output of the localize command
+type localization struct {
+	Image     string          `json:"image"`
+	Localized bool            `json:"localized"`
+	Rotation  *[3][3]float64  `json:"rotation,omitempty"`
+	Center    *[3]float64     `json:"center,omitempty"`
+	Intrinsic *localIntrinsic `json:"intrinsic,omitempty"`
+	Inliers   int             `json:"inliers"`
+}
+
+type localIntrinsic struct {
+	Model          string     `json:"model"`
+	Width          int        `json:"width"`
+	Height         int        `json:"height"`
+	FocalLength    float64    `json:"focal_length"`
+	PrincipalPoint [2]float64 `json:"principal_point"`
+}
+
+func localizeCommand() *cli.Command {
+	var workDir string
+	var query string
+	var output string
+
+	return &cli.Command{
+		Name:  "localize",
+		Usage: "find the camera poses of query images in the reconstruction of a run kept with --work-dir",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       "write the poses as JSON to this file, otherwise they are printed after the localizer output",
+				Destination: &output,
+			},
+		},
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name:        "work-dir",
+				Destination: &workDir,
+			},
+			&cli.StringArg{
+				Name:        "query",
+				Destination: &query,
+			},
+		},
+		Action: func(context.Context, *cli.Command) error {
+			if workDir == "" || query == "" {
+				return cli.Exit("work directory and query image must be specified", 1)
+			}
+
+			ws, err := workspace.Open(workDir)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			previous, err := loadRun(ws.Root)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			utils := utils.NewUtilsWithLogs(ws.Logs)
+			openmvgService := openmvg.NewOpenMVGService(previous.OpenMVG, utils)
+
+			results, err := openmvgService.Localize(query)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			out := make([]localization, 0, len(results))
+			for _, r := range results {
+				l := localization{Image: r.Image, Localized: r.Pose != nil, Inliers: r.Inliers}
+				if r.Pose != nil {
+					l.Rotation = &r.Pose.Rotation
+					l.Center = &r.Pose.Center
+				}
+				if in := r.Intrinsic; in != nil {
+					l.Intrinsic = &localIntrinsic{
+						Model:          in.Model,
+						Width:          in.Width,
+						Height:         in.Height,
+						FocalLength:    in.FocalLength,
+						PrincipalPoint: in.PrincipalPoint,
+					}
+				}
+				if l.Localized {
+					fmt.Fprintf(os.Stderr, "→ Localized %s with %d inliers\n", r.Image, r.Inliers)
+				} else {
+					fmt.Fprintf(os.Stderr, "→ Could not localize %s\n", r.Image)
+				}
+				out = append(out, l)
+			}
+
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			if output == "" {
+				fmt.Println(string(data))
+				return nil
+			}
+			if err := os.WriteFile(output, data, 0o644); err != nil {
+				return cli.Exit(fmt.Sprintf("failed to write %s: %v", output, err), 1)
+			}
+			return nil
+		},
+	}
+}
@@ -5,11 +5,24 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/2024-dissertation/openmvgo/internal/crop"
+	"github.com/2024-dissertation/openmvgo/internal/geo"
+	"github.com/2024-dissertation/openmvgo/internal/grouping"
+	"github.com/2024-dissertation/openmvgo/internal/metrics"
 	"github.com/2024-dissertation/openmvgo/internal/openmvg"
 	"github.com/2024-dissertation/openmvgo/internal/openmvs"
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/scale"
+	"github.com/2024-dissertation/openmvgo/internal/simplify"
+	"github.com/2024-dissertation/openmvgo/internal/texture"
+	"github.com/2024-dissertation/openmvgo/internal/tracing"
 	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"github.com/2024-dissertation/openmvgo/internal/workspace"
 	"github.com/urfave/cli/v3"
 )
 
@@ -18,6 +31,41 @@ func main() {
 	var outputDir string
 	var cameraDBFile string
 	var maxThreads int
+	var outputFormat string
+	var pointCloudFormat string
+	var lods string
+	var cropBox string
+	var cropAuto bool
+	var cropGround bool
+	var cropStages string
+	var textureSize int
+	var textureFormat string
+	var textureQuality int
+	var textureAtlas bool
+	var scaleDistance string
+	var scaleFile string
+	var georeference string
+	var gcpFile string
+	var sfmEngine string
+	var rotationAveraging string
+	var translationAveraging string
+	var graphSimplification string
+	var graphSimplificationValue int
+	var sfmInitializer string
+	var pairStrategy string
+	var pairWindow int
+	var pairNeighbours int
+	var pairsFile string
+	var groupBy string
+	var groupFile string
+	var intrinsics string
+	var workDir string
+	var keepWork bool
+	var cleanup string
+	var metricsAddr string
+	var tracingOptions tracing.Options
+	var maxMemory string
+	var maxCPUTime time.Duration
 
 	cmd := &cli.Command{
 		Name:  "OpenMVGO",
@@ -25,9 +73,184 @@ func main() {
 		Flags: []cli.Flag{
 			&cli.IntFlag{
 				Name:        "maxThreads",
-				Value:       1,
+				Aliases:     []string{"max-threads"},
+				Usage:       "threads of every command, every CPU when 0",
 				Destination: &maxThreads,
 			},
+			&cli.StringFlag{
+				Name:        "output-format",
+				Usage:       "format of the textured mesh: obj or glb",
+				Value:       openmvs.OutputFormatOBJ,
+				Destination: &outputFormat,
+			},
+			&cli.StringFlag{
+				Name:        "export-pointcloud",
+				Usage:       "also export the dense point cloud, supported formats: las",
+				Destination: &pointCloudFormat,
+			},
+			&cli.StringFlag{
+				Name:        "lod",
+				Usage:       "also export decimated levels of detail, as face counts or ratios, e.g. 100000,20000,5000",
+				Destination: &lods,
+			},
+			&cli.StringFlag{
+				Name:        "crop-box",
+				Usage:       "keep geometry inside minx,miny,minz,maxx,maxy,maxz or cx,cy,cz,sx,sy,sz,rx,ry,rz with rotation in degrees",
+				Destination: &cropBox,
+			},
+			&cli.BoolFlag{
+				Name:        "crop-auto",
+				Usage:       "keep geometry inside a box estimated from the camera positions",
+				Destination: &cropAuto,
+			},
+			&cli.BoolFlag{
+				Name:        "crop-ground",
+				Usage:       "remove geometry below the ground plane",
+				Destination: &cropGround,
+			},
+			&cli.StringFlag{
+				Name:        "crop-stages",
+				Usage:       "where cropping is applied: dense, mesh or dense,mesh",
+				Value:       "dense",
+				Destination: &cropStages,
+			},
+			&cli.IntFlag{
+				Name:        "texture-size",
+				Usage:       "downsize textures, or the atlas, to at most this many pixels per side",
+				Destination: &textureSize,
+			},
+			&cli.StringFlag{
+				Name:        "texture-format",
+				Usage:       "re-encode textures as jpeg or png",
+				Destination: &textureFormat,
+			},
+			&cli.IntFlag{
+				Name:        "texture-quality",
+				Usage:       "jpeg quality of re-encoded textures",
+				Value:       texture.DefaultQuality,
+				Destination: &textureQuality,
+			},
+			&cli.BoolFlag{
+				Name:        "texture-atlas",
+				Usage:       "merge every texture into a single atlas",
+				Destination: &textureAtlas,
+			},
+			&cli.StringFlag{
+				Name:        "scale",
+				Usage:       "scale the reconstruction to meters from a known distance, x1,y1,z1,x2,y2,z2=meters in reconstruction coordinates",
+				Destination: &scaleDistance,
+			},
+			&cli.StringFlag{
+				Name:        "scale-file",
+				Usage:       "scale the reconstruction to meters from a CSV of point observations and known distances",
+				Destination: &scaleFile,
+			},
+			&cli.StringFlag{
+				Name:        "georeference",
+				Usage:       "register the model to the GPS positions of the images in a local enu or utm frame",
+				Destination: &georeference,
+			},
+			&cli.StringFlag{
+				Name:        "gcp-file",
+				Usage:       "register the model to ground control points listed in a CSV of surveyed positions and pixel observations",
+				Destination: &gcpFile,
+			},
+			&cli.StringFlag{
+				Name:        "sfm-engine",
+				Usage:       "SfM engine: incremental, incrementalv2, global or stellar",
+				Value:       openmvg.EngineIncremental,
+				Destination: &sfmEngine,
+			},
+			&cli.StringFlag{
+				Name:        "rotation-averaging",
+				Usage:       "rotation averaging of the global engine: l1 or l2",
+				Destination: &rotationAveraging,
+			},
+			&cli.StringFlag{
+				Name:        "translation-averaging",
+				Usage:       "translation averaging of the global engine: l1, l2 or softl1",
+				Destination: &translationAveraging,
+			},
+			&cli.StringFlag{
+				Name:        "graph-simplification",
+				Usage:       "view graph simplification of the stellar engine: none, mst_x or star_x",
+				Destination: &graphSimplification,
+			},
+			&cli.IntFlag{
+				Name:        "graph-simplification-value",
+				Usage:       "parameter of the stellar graph simplification",
+				Destination: &graphSimplificationValue,
+			},
+			&cli.StringFlag{
+				Name:        "sfm-initializer",
+				Usage:       "initializer of the incrementalv2 engine: existing_pose, max_pair, auto_pair or stellar",
+				Destination: &sfmInitializer,
+			},
+			&cli.StringFlag{
+				Name:        "pair-strategy",
+				Usage:       "image pairs to match: exhaustive, contiguous, gps or file",
+				Value:       pairs.StrategyExhaustive,
+				Destination: &pairStrategy,
+			},
+			&cli.IntFlag{
+				Name:        "pair-window",
+				Usage:       "number of following images each image is matched with by the contiguous strategy",
+				Value:       10,
+				Destination: &pairWindow,
+			},
+			&cli.IntFlag{
+				Name:        "pair-neighbours",
+				Usage:       "number of nearest images by GPS position each image is matched with by the gps strategy",
+				Value:       10,
+				Destination: &pairNeighbours,
+			},
+			&cli.StringFlag{
+				Name:        "pairs-file",
+				Usage:       "file listing the image pairs to match, one image followed by its partners per line",
+				Destination: &pairsFile,
+			},
+			&cli.StringFlag{
+				Name:        "group-by",
+				Usage:       "group images into cameras by camera (EXIF make, model and serial), folder (subdirectories as rig cameras) or file",
+				Destination: &groupBy,
+			},
+			&cli.StringFlag{
+				Name:        "group-file",
+				Usage:       "CSV file mapping image name patterns to groups, one pattern,group row per line",
+				Destination: &groupFile,
+			},
+			&cli.StringFlag{
+				Name:        "intrinsics",
+				Usage:       "intrinsics within a group: shared or separate",
+				Value:       grouping.IntrinsicsShared,
+				Destination: &intrinsics,
+			},
+			&cli.StringFlag{
+				Name:        "work-dir",
+				Usage:       "keep the intermediate files in this directory, so the run can be extended with new images",
+				Destination: &workDir,
+			},
+			&cli.BoolFlag{
+				Name:        "keep-work",
+				Usage:       "keep the temporary work directory and print its path",
+				Destination: &keepWork,
+			},
+			&cli.StringFlag{
+				Name:        "cleanup",
+				Usage:       "when the work directory is removed: always, on-success or never, by default never with --work-dir and always otherwise",
+				Destination: &cleanup,
+			},
+			&cli.StringFlag{
+				Name:        "metrics-addr",
+				Usage:       "serve Prometheus metrics of the run at this address, e.g. :9090",
+				Destination: &metricsAddr,
+			},
+		},
+		Commands: []*cli.Command{
+			extendCommand(),
+			localizeCommand(),
+			cleanCommand(),
+			serveCommand(),
 		},
 		Arguments: []cli.Argument{
 			&cli.StringArg{
@@ -43,53 +266,240 @@ func main() {
 				Destination: &cameraDBFile,
 			},
 		},
-		Action: func(context.Context, *cli.Command) error {
+		Action: func(ctx context.Context, _ *cli.Command) error {
 			if inputDir == "" || outputDir == "" {
 				return cli.Exit("input and output directories must be specified", 1)
 			}
 
+			var lodTargets []simplify.Target
+			if lods != "" {
+				targets, err := simplify.ParseTargets(lods)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				lodTargets = targets
+			}
+
+			cropOptions := crop.Options{AutoBox: cropAuto, Ground: cropGround}
+			if cropBox != "" {
+				box, err := crop.ParseBox(cropBox)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				cropOptions.Box = &box
+			}
+
+			var cropDense, cropMesh bool
+			if cropOptions.Enabled() {
+				for _, stage := range strings.Split(cropStages, ",") {
+					switch strings.TrimSpace(stage) {
+					case "dense":
+						cropDense = true
+					case "mesh":
+						cropMesh = true
+					default:
+						return cli.Exit(fmt.Sprintf("unknown crop stage %q", stage), 1)
+					}
+				}
+			}
+
+			var scaleConstraints *scale.Constraints
+			switch {
+			case scaleDistance != "" && scaleFile != "":
+				return cli.Exit("--scale and --scale-file cannot be combined", 1)
+			case scaleDistance != "":
+				c, err := scale.ParsePoints(scaleDistance)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				scaleConstraints = c
+			case scaleFile != "":
+				c, err := scale.ParseFile(scaleFile)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				scaleConstraints = c
+			}
+
+			switch georeference {
+			case "", geo.FrameENU, geo.FrameUTM:
+			default:
+				return cli.Exit(fmt.Sprintf("unknown georeference frame %q, expected enu or utm", georeference), 1)
+			}
+			registrations := 0
+			for _, set := range []bool{scaleConstraints != nil, georeference != "", gcpFile != ""} {
+				if set {
+					registrations++
+				}
+			}
+			if registrations > 1 {
+				return cli.Exit("only one of --scale, --scale-file, --georeference and --gcp-file can be used", 1)
+			}
+
+			switch {
+			case keepWork && cleanup != "" && cleanup != workspace.CleanupNever:
+				return cli.Exit("--keep-work cannot be combined with --cleanup "+cleanup, 1)
+			case keepWork || (cleanup == "" && workDir != ""):
+				cleanup = workspace.CleanupNever
+			case cleanup == "":
+				cleanup = workspace.CleanupAlways
+			}
+			if err := workspace.ValidatePolicy(cleanup); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			limits, err := parseLimits(maxMemory, maxCPUTime)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
 			fmt.Printf("Input Directory: %s\n", inputDir)
 			fmt.Printf("Output Directory: %s\n", outputDir)
+			budget := planResources(1, maxThreads, limits)
 
-			// Setup Utils
-			utils := utils.NewUtils()
+			// Metrics are optional, a nil registry records nothing
+			var reg *metrics.Registry
+			if metricsAddr != "" {
+				var err error
+				if reg, err = serveMetrics(metricsAddr); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+			}
 
-			timestamp := time.Now().Unix()
+			// Tracing is optional too, the spans are dropped without an endpoint
+			stopTracing, err := startTracing(ctx, tracingOptions)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			defer stopTracing()
+			ctx, span := tracing.Start(ctx, "run")
+			defer span.End()
 
-			// Middle directory creation
-			buildDir, err := os.MkdirTemp("", fmt.Sprintf("%dbuild", timestamp))
+			// Work directory
+			var ws *workspace.Workspace
+			if workDir != "" {
+				ws, err = workspace.New(workDir)
+			} else {
+				ws, err = workspace.Temp()
+			}
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			fmt.Printf("Work Directory: %s\n", ws.Root)
+
+			success := false
+			defer func() {
+				removed, err := ws.Cleanup(cleanup, success)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				} else if !removed {
+					fmt.Printf("→ Kept work directory: %s\n", ws.Root)
+				}
+			}()
+
+			// Setup Utils, the tracker reads the progress of the tools from
+			// their output
+			progress := &progressDisplay{w: os.Stderr}
+			commands := tracing.NewCommands(ctx)
+			tracker := pipeline.NewTracker(pipeline.Observers(progress.Observe, reg.ObserveStep, commands.Observe))
+			utils := &utils.UtilsImpl{LogDir: ws.Logs, Output: tracker, Limits: limits, Env: budget.Env(), OnCommand: func(stats utils.CommandStats) {
+				reg.ObserveCommand(stats)
+				commands.OnCommand(stats)
+			}}
+
+			// Later runs resolve the images from the work directory
+			inputDir, err = filepath.Abs(inputDir)
 			utils.Check(err)
-			defer os.RemoveAll(buildDir)
 
 			// Configure openmvg service
 
+			openmvgConfig := openmvg.NewOpenMVGConfig(
+				inputDir,
+				ws.MVS,
+				&cameraDBFile,
+			)
+			openmvgConfig.MatchesDir = ws.Matches
+			openmvgConfig.ReconstructionDir = ws.Reconstruction
+			openmvgConfig.Scale = scaleConstraints
+			openmvgConfig.Georeference = georeference
+			openmvgConfig.GCPFile = gcpFile
+			if pairsFile != "" && pairStrategy == pairs.StrategyExhaustive {
+				pairStrategy = pairs.StrategyFile
+			}
+			openmvgConfig.Pairs = pairs.Options{
+				Strategy:   pairStrategy,
+				Window:     pairWindow,
+				Neighbours: pairNeighbours,
+				File:       pairsFile,
+			}
+			if groupFile != "" && groupBy == "" {
+				groupBy = grouping.GroupByFile
+			}
+			openmvgConfig.Grouping = grouping.Options{
+				GroupBy:    strings.ToLower(groupBy),
+				File:       groupFile,
+				Intrinsics: strings.ToLower(intrinsics),
+			}
+			openmvgConfig.Engine = openmvg.EngineOptions{
+				Name:                     strings.ToUpper(sfmEngine),
+				RotationAveraging:        strings.ToUpper(rotationAveraging),
+				TranslationAveraging:     strings.ToUpper(translationAveraging),
+				GraphSimplification:      strings.ToUpper(graphSimplification),
+				GraphSimplificationValue: graphSimplificationValue,
+				Initializer:              strings.ToUpper(sfmInitializer),
+			}
+
+			openmvgConfig.Threads = budget.Threads
 			openmvgService := openmvg.NewOpenMVGService(
-				openmvg.NewOpenMVGConfig(
-					inputDir,
-					buildDir,
-					&cameraDBFile,
-				),
+				openmvgConfig,
 				utils,
 			)
 
 			// Configure openmvs service
+			openmvsConfig := openmvs.NewOpenMVSConfig(
+				outputDir,
+				ws.MVS,
+				budget.Threads,
+			)
+			openmvsConfig.Memory = budget.Memory
+			openmvsConfig.SceneFile = openmvgService.Config.SceneFile()
+			openmvsConfig.GeoreferenceFile = openmvgService.Config.GeoreferenceFile()
+			openmvsConfig.OutputFormat = outputFormat
+			openmvsConfig.PointCloudFormat = pointCloudFormat
+			openmvsConfig.LODs = lodTargets
+			openmvsConfig.Crop = cropOptions
+			openmvsConfig.CropDense = cropDense
+			openmvsConfig.CropMesh = cropMesh
+			openmvsConfig.Textures = texture.Options{
+				MaxSize: textureSize,
+				Format:  textureFormat,
+				Quality: textureQuality,
+				Atlas:   textureAtlas,
+			}
+
 			openmvsService := openmvs.NewOpenMVSService(
-				openmvs.NewOpenMVSConfig(
-					outputDir,
-					buildDir,
-					maxThreads,
-				),
+				openmvsConfig,
 				utils,
 			)
 
+			openmvgService.Observer = tracker.Observe
+			openmvsService.Observer = tracker.Observe
+			openmvgService.Context = ctx
+			openmvsService.Context = ctx
+			progress.total = len(openmvgService.SequentialSteps()) + len(openmvsService.Steps())
+
 			// Populate and Run Pipelines
 			openmvgService.PopulateTmpDir()
 			defer os.Remove(*openmvgService.Config.CameraDBFile)
-			defer os.RemoveAll(openmvgService.Config.MatchesDir)
-			defer os.RemoveAll(openmvgService.Config.ReconstructionDir)
 
-			openmvgService.SfMSequentialPipeline()
-			openmvsService.RunPipeline()
+			steps := openmvgService.SfMSequentialPipeline()
+			steps = append(steps, openmvsService.RunPipeline()...)
+
+			r := run{OpenMVG: openmvgService.Config, OpenMVS: *openmvsConfig}
+			copySidecars(utils, openmvgService.Config, outputDir)
+			copyLogs(utils, ws, outputDir)
+			utils.Check(saveRun(ws.Root, r))
+			writeManifest(utils, ws, outputDir, r, steps)
+			success = true
 
 			// Complete
 			fmt.Println("OpenMVGO pipeline completed successfully!")
@@ -98,6 +508,9 @@ func main() {
 		},
 	}
 
+	cmd.Flags = append(cmd.Flags, limitFlags(&maxMemory, &maxCPUTime)...)
+	cmd.Flags = append(cmd.Flags, tracingFlags(&tracingOptions)...)
+
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
 		log.Fatal(err)
 	}
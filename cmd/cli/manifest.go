@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/2024-dissertation/openmvgo/internal/manifest"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"github.com/2024-dissertation/openmvgo/internal/workspace"
+)
+
+// copyLogs copies the command logs of the work directory to the logs
+// directory of the output directory
+func copyLogs(utils utils.UtilsInterface, ws *workspace.Workspace, outputDir string) {
+	logs, err := filepath.Glob(filepath.Join(ws.Logs, "*.log"))
+	utils.Check(err)
+	utils.Check(utils.EnsureDir(filepath.Join(outputDir, "logs")))
+	for _, log := range logs {
+		utils.Check(utils.CopyFile(log, filepath.Join(outputDir, "logs", filepath.Base(log))))
+	}
+}
+
+// writeManifest lists the output directory in manifest.json together with the
+// run configuration, the commands it used and the results of its steps
+func writeManifest(utils utils.UtilsInterface, ws *workspace.Workspace, outputDir string, r run, steps []pipeline.StepResult) {
+	m, err := manifest.Build(outputDir)
+	utils.Check(err)
+	m.Steps = steps
+
+	m.Tools, err = manifest.ToolsFromLogs(ws.Logs)
+	utils.Check(err)
+	utils.Check(m.SetConfig(r))
+
+	path := filepath.Join(outputDir, manifest.FileName)
+	utils.Check(m.Write(path))
+	fmt.Printf("→ Wrote %s listing %d artifacts\n", path, len(m.Artifacts))
+}
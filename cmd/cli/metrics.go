@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/2024-dissertation/openmvgo/internal/metrics"
+)
+
+// serveMetrics serves the metrics of the run at http://<addr>/metrics until
+// the run ends
+func serveMetrics(addr string) (*metrics.Registry, error) {
+	// Listen first so that a bad address fails the run before it starts
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve metrics: %w", err)
+	}
+
+	reg := metrics.New()
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", reg.Handler())
+	go http.Serve(ln, mux)
+
+	fmt.Printf("→ Serving metrics on http://%s/metrics\n", ln.Addr())
+	return reg, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+)
+
+// progressDisplay prints the progress of the pipeline stages, numbering
+// them out of the stages of the run
+type progressDisplay struct {
+	w     io.Writer
+	total int
+
+	index int
+	// tenth is the last printed tenth of the current stage
+	tenth int
+}
+
+func (d *progressDisplay) Observe(e pipeline.Event) {
+	if e.Type == pipeline.StageStarted {
+		d.index++
+		d.tenth = 0
+	}
+
+	stage := fmt.Sprintf("[%d/%d] %s", d.index, d.total, e.Stage)
+	switch e.Type {
+	case pipeline.StageStarted:
+		fmt.Fprintf(d.w, "→ %s\n", stage)
+	case pipeline.StageProgress:
+		// Tools report every percent, a line per tenth is enough
+		if tenth := int(e.Percent) / 10; tenth != d.tenth {
+			d.tenth = tenth
+			fmt.Fprintf(d.w, "→ %s %d%%\n", stage, tenth*10)
+		}
+	case pipeline.StageFinished:
+		fmt.Fprintf(d.w, "→ %s done in %s\n", stage, e.Duration.Round(100*time.Millisecond))
+	case pipeline.StageFailed:
+		fmt.Fprintf(d.w, "→ %s failed after %s\n", stage, e.Duration.Round(100*time.Millisecond))
+	}
+}
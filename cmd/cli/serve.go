@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/metrics"
+	"github.com/2024-dissertation/openmvgo/internal/server"
+	"github.com/2024-dissertation/openmvgo/internal/tracing"
+	"github.com/urfave/cli/v3"
+)
+
+func serveCommand() *cli.Command {
+	var addr string
+	var dataDir string
+	var workers int
+	var queueSize int
+	var maxAttempts int
+	var retryBackoff time.Duration
+	var cameraDBFile string
+	var tracingOptions tracing.Options
+	var maxMemory string
+	var maxCPUTime time.Duration
+
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "run reconstructions submitted to a REST API, with Prometheus metrics at /metrics",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "addr",
+				Usage:       "address to listen on",
+				Value:       ":8080",
+				Destination: &addr,
+			},
+			&cli.StringFlag{
+				Name:        "data-dir",
+				Usage:       "directory keeping the jobs, their uploads and their artifacts",
+				Value:       "openmvgo-data",
+				Destination: &dataDir,
+			},
+			&cli.IntFlag{
+				Name:        "workers",
+				Usage:       "number of jobs run at once",
+				Value:       1,
+				Destination: &workers,
+			},
+			&cli.IntFlag{
+				Name:        "queue-size",
+				Usage:       "number of jobs that can wait for a worker",
+				Value:       server.DefaultQueueSize,
+				Destination: &queueSize,
+			},
+			&cli.IntFlag{
+				Name:        "max-attempts",
+				Usage:       "attempts at a job before it is moved to the dead letter state",
+				Value:       server.DefaultMaxAttempts,
+				Destination: &maxAttempts,
+			},
+			&cli.DurationFlag{
+				Name:        "retry-backoff",
+				Usage:       "delay before retrying a failed job, doubled for each further attempt",
+				Value:       server.DefaultBackoff,
+				Destination: &retryBackoff,
+			},
+			&cli.StringFlag{
+				Name:        "camera-db",
+				Usage:       "camera sensor database, downloaded for each job when not set",
+				Destination: &cameraDBFile,
+			},
+		}, append(limitFlags(&maxMemory, &maxCPUTime), tracingFlags(&tracingOptions)...)...),
+		Action: func(ctx context.Context, _ *cli.Command) error {
+			limits, err := parseLimits(maxMemory, maxCPUTime)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			stopTracing, err := startTracing(ctx, tracingOptions)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			defer stopTracing()
+
+			// The workers run their jobs at once, each gets a share
+			budget := planResources(workers, 0, limits)
+			reg := metrics.New()
+			srv, err := server.New(server.Options{
+				DataDir:     dataDir,
+				Workers:     workers,
+				QueueSize:   queueSize,
+				MaxAttempts: maxAttempts,
+				Backoff:     retryBackoff,
+				Runner: server.PipelineRunner(server.RunnerOptions{
+					CameraDB: cameraDBFile,
+					Limits:   limits,
+					Budget:   budget,
+					Metrics:  reg,
+				}),
+				Metrics: reg,
+			})
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			defer srv.Close()
+
+			// Interrupted jobs are queued again and resume from their last
+			// completed stage on the next start
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			srv.Start(ctx)
+
+			httpServer := &http.Server{Addr: addr, Handler: srv.Handler()}
+			go func() {
+				<-ctx.Done()
+				shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				httpServer.Shutdown(shutdown)
+			}()
+
+			fmt.Printf("→ Listening on %s, jobs are kept in %s\n", addr, dataDir)
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return cli.Exit(err.Error(), 1)
+			}
+			srv.Wait()
+
+			fmt.Println("OpenMVGO server stopped")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/tracing"
+	"github.com/urfave/cli/v3"
+)
+
+// tracingFlags configure the export of the spans to opts
+func tracingFlags(opts *tracing.Options) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "otlp-endpoint",
+			Usage:       "export trace spans to this OTLP/HTTP collector, e.g. localhost:4318, tracing is disabled when not set",
+			Sources:     cli.EnvVars("OTEL_EXPORTER_OTLP_ENDPOINT"),
+			Destination: &opts.Endpoint,
+		},
+		&cli.BoolFlag{
+			Name:        "otlp-insecure",
+			Usage:       "export trace spans over plain HTTP",
+			Destination: &opts.Insecure,
+		},
+	}
+}
+
+// startTracing exports the spans as configured and returns a function
+// flushing them, to be deferred
+func startTracing(ctx context.Context, opts tracing.Options) (func(), error) {
+	shutdown, err := tracing.Setup(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to export trace spans: %v\n", err)
+		}
+	}, nil
+}
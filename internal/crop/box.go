@@ -0,0 +1,137 @@
+package crop
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Box is an oriented bounding box. Axes are the unit directions of the box
+// edges in world coordinates, an axis aligned box uses the identity.
+type Box struct {
+	Center   [3]float64
+	HalfSize [3]float64
+	Axes     [3][3]float64
+}
+
+var identity = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+// NewAABB returns the axis aligned box spanning min to max
+func NewAABB(min, max [3]float64) Box {
+	var b Box
+	for i := range 3 {
+		b.Center[i] = (min[i] + max[i]) / 2
+		b.HalfSize[i] = math.Abs(max[i]-min[i]) / 2
+	}
+	b.Axes = identity
+	return b
+}
+
+// NewOBB returns a box of the given size centred on center and rotated by
+// the XYZ Euler angles in degrees
+func NewOBB(center, size, rotation [3]float64) Box {
+	b := Box{Center: center}
+	for i := range 3 {
+		b.HalfSize[i] = math.Abs(size[i]) / 2
+	}
+
+	rx, ry, rz := rotation[0]*math.Pi/180, rotation[1]*math.Pi/180, rotation[2]*math.Pi/180
+	cx, sx := math.Cos(rx), math.Sin(rx)
+	cy, sy := math.Cos(ry), math.Sin(ry)
+	cz, sz := math.Cos(rz), math.Sin(rz)
+
+	// Columns of Rz * Ry * Rx are the rotated box axes
+	r := [3][3]float64{
+		{cz * cy, cz*sy*sx - sz*cx, cz*sy*cx + sz*sx},
+		{sz * cy, sz*sy*sx + cz*cx, sz*sy*cx - cz*sx},
+		{-sy, cy * sx, cy * cx},
+	}
+	for axis := range 3 {
+		b.Axes[axis] = [3]float64{r[0][axis], r[1][axis], r[2][axis]}
+	}
+	return b
+}
+
+// ParseBox parses "minx,miny,minz,maxx,maxy,maxz" as an axis aligned box or
+// "cx,cy,cz,sx,sy,sz,rx,ry,rz" as a box with centre, size and XYZ Euler
+// rotation in degrees
+func ParseBox(s string) (Box, error) {
+	parts := strings.Split(s, ",")
+	values := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Box{}, fmt.Errorf("invalid crop box %q: %w", s, err)
+		}
+		values[i] = v
+	}
+
+	switch len(values) {
+	case 6:
+		return NewAABB([3]float64(values[0:3]), [3]float64(values[3:6])), nil
+	case 9:
+		return NewOBB([3]float64(values[0:3]), [3]float64(values[3:6]), [3]float64(values[6:9])), nil
+	default:
+		return Box{}, fmt.Errorf("invalid crop box %q, expected 6 or 9 values", s)
+	}
+}
+
+// BoundingBox returns the axis aligned bounds of points enlarged on every
+// side by margin times their largest extent
+func BoundingBox(points [][3]float64, margin float64) (Box, error) {
+	if len(points) == 0 {
+		return Box{}, fmt.Errorf("no points to bound")
+	}
+
+	min, max := points[0], points[0]
+	for _, p := range points[1:] {
+		for i := range 3 {
+			min[i] = math.Min(min[i], p[i])
+			max[i] = math.Max(max[i], p[i])
+		}
+	}
+
+	extent := math.Max(max[0]-min[0], math.Max(max[1]-min[1], max[2]-min[2]))
+	for i := range 3 {
+		min[i] -= margin * extent
+		max[i] += margin * extent
+	}
+	return NewAABB(min, max), nil
+}
+
+// Contains reports whether p lies inside the box
+func (b Box) Contains(p [3]float64) bool {
+	d := sub(p, b.Center)
+	for i := range 3 {
+		if math.Abs(dot(d, b.Axes[i])) > b.HalfSize[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Box) String() string {
+	if b.Axes == identity {
+		return fmt.Sprintf("[%g %g %g]-[%g %g %g]",
+			b.Center[0]-b.HalfSize[0], b.Center[1]-b.HalfSize[1], b.Center[2]-b.HalfSize[2],
+			b.Center[0]+b.HalfSize[0], b.Center[1]+b.HalfSize[1], b.Center[2]+b.HalfSize[2])
+	}
+	return fmt.Sprintf("centre %v half size %v axes %v", b.Center, b.HalfSize, b.Axes)
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
@@ -0,0 +1,214 @@
+package crop
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+)
+
+const (
+	// DefaultMargin enlarges a box estimated from cameras by a quarter of its
+	// largest extent on every side, so an object ringed by cameras at a
+	// similar height keeps its full height
+	DefaultMargin = 0.25
+
+	// DefaultGroundThreshold is the ground plane inlier distance as a fraction
+	// of the diagonal of the cropped geometry
+	DefaultGroundThreshold = 0.005
+
+	groundIterations = 500
+)
+
+// Options describes which geometry to remove
+type Options struct {
+	// Box keeps only geometry inside it
+	Box *Box
+	// AutoBox estimates the box from the camera positions when Box is nil
+	AutoBox bool
+	// Margin enlarges the automatic box, defaults to DefaultMargin
+	Margin float64
+	// Ground removes geometry below the dominant plane, fitted with RANSAC
+	Ground bool
+	// GroundThreshold is the plane inlier distance as a fraction of the
+	// geometry diagonal, defaults to DefaultGroundThreshold. The plane itself
+	// is removed along with everything below it.
+	GroundThreshold float64
+}
+
+// Enabled reports whether the options remove anything
+func (o Options) Enabled() bool {
+	return o.Box != nil || o.AutoBox || o.Ground
+}
+
+// Region is the part of space geometry is kept in
+type Region struct {
+	Box *Box
+	// Ground removes points closer than GroundMargin to the plane or below it
+	Ground       *Plane
+	GroundMargin float64
+}
+
+// Contains reports whether p is kept
+func (r Region) Contains(p [3]float64) bool {
+	if r.Box != nil && !r.Box.Contains(p) {
+		return false
+	}
+	if r.Ground != nil && r.Ground.Distance(p) <= r.GroundMargin {
+		return false
+	}
+	return true
+}
+
+// Region resolves the options against the geometry being cropped and the
+// reconstructed camera positions. The ground plane is oriented so that the
+// cameras are above it, or most of the geometry when there are no cameras.
+func (o Options) Region(points, cameras [][3]float64) (Region, error) {
+	var r Region
+
+	switch {
+	case o.Box != nil:
+		r.Box = o.Box
+	case o.AutoBox:
+		margin := o.Margin
+		if margin == 0 {
+			margin = DefaultMargin
+		}
+		if len(cameras) < 2 {
+			return Region{}, fmt.Errorf("at least 2 reconstructed cameras are needed to estimate a crop box, got %d", len(cameras))
+		}
+		box, err := BoundingBox(cameras, margin)
+		if err != nil {
+			return Region{}, err
+		}
+		r.Box = &box
+	}
+
+	if o.Ground {
+		threshold := o.GroundThreshold
+		if threshold == 0 {
+			threshold = DefaultGroundThreshold
+		}
+		// Fit only what survives the box, so stray geometry far from the
+		// subject can not outvote the floor around it
+		candidates := points
+		if r.Box != nil {
+			candidates = nil
+			for _, p := range points {
+				if r.Box.Contains(p) {
+					candidates = append(candidates, p)
+				}
+			}
+		}
+		diagonal := robustDiagonal(candidates)
+
+		plane, _, err := FitPlane(candidates, threshold*diagonal, groundIterations)
+		if err != nil {
+			return Region{}, fmt.Errorf("failed to fit ground plane: %w", err)
+		}
+
+		reference := cameras
+		if len(reference) == 0 {
+			reference = candidates
+		}
+		above := 0
+		for _, p := range reference {
+			if plane.Distance(p) > 0 {
+				above++
+			} else {
+				above--
+			}
+		}
+		if above < 0 {
+			plane = plane.Flip()
+		}
+
+		r.Ground = &plane
+		r.GroundMargin = threshold * diagonal
+	}
+
+	return r, nil
+}
+
+// robustDiagonal returns the diagonal of the bounds of points ignoring the
+// outermost percent on each axis
+func robustDiagonal(points [][3]float64) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+
+	step := max(1, len(points)/ransacSamples)
+	var sum float64
+	for axis := range 3 {
+		values := make([]float64, 0, len(points)/step+1)
+		for i := 0; i < len(points); i += step {
+			values = append(values, points[i][axis])
+		}
+		slices.Sort(values)
+		lo, hi := values[len(values)/100], values[len(values)-1-len(values)/100]
+		sum += (hi - lo) * (hi - lo)
+	}
+	return math.Sqrt(sum)
+}
+
+// PLY crops the point cloud or mesh at src to the region resolved from opts
+// and writes it to dst. Faces are kept only when all their vertices are kept.
+// It returns the number of vertices kept and in the source.
+func PLY(src, dst string, opts Options, cameras [][3]float64) (int, int, error) {
+	file, err := ply.Read(src)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	positions, err := file.Positions()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", src, err)
+	}
+
+	region, err := opts.Region(positions, cameras)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// remap holds the new index of every kept vertex and -1 otherwise
+	remap := make([]int, len(positions))
+	kept := 0
+	for i, p := range positions {
+		remap[i] = -1
+		if region.Contains(p) {
+			remap[i] = kept
+			kept++
+		}
+	}
+
+	vertex := file.Element("vertex")
+	vertex.Filter(func(row int) bool { return remap[row] >= 0 })
+
+	if face := file.Element("face"); face != nil {
+		indices := face.Property("vertex_indices")
+		if indices == nil {
+			indices = face.Property("vertex_index")
+		}
+		if indices != nil && indices.IsList() {
+			face.Filter(func(row int) bool {
+				for _, v := range indices.Lists[row] {
+					if v < 0 || int(v) >= len(remap) || remap[int(v)] < 0 {
+						return false
+					}
+				}
+				return true
+			})
+			for _, list := range indices.Lists {
+				for j, v := range list {
+					list[j] = float64(remap[int(v)])
+				}
+			}
+		}
+	}
+
+	if err := ply.Write(dst, file); err != nil {
+		return 0, 0, err
+	}
+	return kept, len(positions), nil
+}
@@ -0,0 +1,160 @@
+package crop_test
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/crop"
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+)
+
+// scene returns a 2x2 floor at z=0, an object of points above its centre and
+// a stray point far away
+func scene() [][3]float64 {
+	var points [][3]float64
+	for x := -10; x <= 10; x++ {
+		for y := -10; y <= 10; y++ {
+			points = append(points, [3]float64{float64(x) / 10, float64(y) / 10, 0})
+		}
+	}
+	for z := 1; z <= 5; z++ {
+		for x := -2; x <= 2; x++ {
+			points = append(points, [3]float64{float64(x) / 10, 0, float64(z) / 10})
+		}
+	}
+	return append(points, [3]float64{50, 50, 50})
+}
+
+func writePLY(t *testing.T, points [][3]float64, faces [][]float64) string {
+	t.Helper()
+
+	file := &ply.File{Format: ply.BinaryLittleEndian}
+	vertex := file.AddElement("vertex", len(points))
+	for axis, name := range []string{"x", "y", "z"} {
+		values := make([]float64, len(points))
+		for i, p := range points {
+			values[i] = p[axis]
+		}
+		vertex.AddProperty(name, "float", values)
+	}
+	if faces != nil {
+		file.AddElement("face", len(faces)).AddListProperty("vertex_indices", "uchar", "int", faces)
+	}
+
+	path := filepath.Join(t.TempDir(), "src.ply")
+	if err := ply.Write(path, file); err != nil {
+		t.Fatalf("failed to write ply: %v", err)
+	}
+	return path
+}
+
+func TestParseBox(t *testing.T) {
+	box, err := crop.ParseBox("-1,-1,0,1,1,2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if box.Center != [3]float64{0, 0, 1} || box.HalfSize != [3]float64{1, 1, 1} {
+		t.Errorf("unexpected box %v", box)
+	}
+
+	// A long thin box rotated 45 degrees about Z
+	box, err = crop.ParseBox("0,0,0, 4,0.2,1, 0,0,45")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !box.Contains([3]float64{1, 1, 0}) || box.Contains([3]float64{1, -1, 0}) {
+		t.Errorf("rotated box contains the wrong points")
+	}
+
+	for _, bad := range []string{"", "1,2,3", "a,b,c,d,e,f"} {
+		if _, err := crop.ParseBox(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestFitPlane(t *testing.T) {
+	plane, inliers, err := crop.FitPlane(scene(), 0.01, 200)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if inliers != 21*21 {
+		t.Errorf("expected the floor points as inliers, got %d", inliers)
+	}
+	if math.Abs(math.Abs(plane.Normal[2])-1) > 1e-9 || math.Abs(plane.D) > 1e-9 {
+		t.Errorf("expected the z=0 plane, got %+v", plane)
+	}
+
+	if _, _, err := crop.FitPlane([][3]float64{{0, 0, 0}, {1, 1, 1}}, 0.01, 10); err == nil {
+		t.Errorf("expected error for too few points")
+	}
+}
+
+func TestRegion(t *testing.T) {
+	points := scene()
+	cameras := [][3]float64{{-1, -1, 0.5}, {1, 1, 0.5}}
+
+	r, err := crop.Options{AutoBox: true, Ground: true}.Region(points, cameras)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !r.Contains([3]float64{0, 0, 0.3}) {
+		t.Errorf("expected the object to be kept")
+	}
+	if r.Contains([3]float64{0.5, 0.5, 0}) {
+		t.Errorf("expected the floor to be removed")
+	}
+	if r.Contains([3]float64{50, 50, 50}) {
+		t.Errorf("expected the stray point to be removed")
+	}
+
+	// Cameras below the plane flip which side is kept
+	r, err = crop.Options{Ground: true}.Region(points, [][3]float64{{0, 0, -1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Contains([3]float64{0, 0, 0.3}) || !r.Contains([3]float64{0, 0, -0.3}) {
+		t.Errorf("expected the ground plane to face the cameras")
+	}
+
+	if _, err := (crop.Options{AutoBox: true}).Region(points, nil); err == nil {
+		t.Errorf("expected error estimating a box without cameras")
+	}
+}
+
+func TestPLY(t *testing.T) {
+	points := [][3]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {5, 5, 5}, {1, 1, 0}}
+	faces := [][]float64{{0, 1, 2}, {1, 3, 2}, {1, 4, 2}}
+	src := writePLY(t, points, faces)
+	dst := filepath.Join(t.TempDir(), "dst.ply")
+
+	box := crop.NewAABB([3]float64{-1, -1, -1}, [3]float64{2, 2, 2})
+	kept, total, err := crop.PLY(src, dst, crop.Options{Box: &box}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kept != 4 || total != 5 {
+		t.Errorf("expected 4 of 5 vertices kept, got %d of %d", kept, total)
+	}
+
+	file, err := ply.Read(dst)
+	if err != nil {
+		t.Fatalf("failed to read cropped ply: %v", err)
+	}
+
+	got := file.Faces()
+	want := [][]int{{0, 1, 2}, {1, 3, 2}}
+	if len(got) != len(want) {
+		t.Fatalf("expected faces %v, got %v", want, got)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if got[i][j] != want[i][j] {
+				t.Errorf("expected faces %v, got %v", want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package crop
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// ransacSamples caps the number of points each plane hypothesis is scored on
+const ransacSamples = 50000
+
+// Plane is the set of points p with Normal·p + D = 0, Normal has unit length
+type Plane struct {
+	Normal [3]float64
+	D      float64
+}
+
+// Distance returns the signed distance of p from the plane, positive on the
+// side the normal points to
+func (pl Plane) Distance(p [3]float64) float64 {
+	return dot(pl.Normal, p) + pl.D
+}
+
+// Flip returns the same plane with the opposite orientation
+func (pl Plane) Flip() Plane {
+	return Plane{Normal: [3]float64{-pl.Normal[0], -pl.Normal[1], -pl.Normal[2]}, D: -pl.D}
+}
+
+// FitPlane finds the plane supported by the most points with RANSAC. A point
+// supports a plane when it is within threshold of it. The search is seeded so
+// the same input always gives the same plane.
+func FitPlane(points [][3]float64, threshold float64, iterations int) (Plane, int, error) {
+	if len(points) < 3 {
+		return Plane{}, 0, fmt.Errorf("at least 3 points are needed to fit a plane, got %d", len(points))
+	}
+
+	// Score hypotheses on an evenly spaced subset of large clouds
+	samples := points
+	if len(points) > ransacSamples {
+		step := float64(len(points)) / ransacSamples
+		samples = make([][3]float64, ransacSamples)
+		for i := range samples {
+			samples[i] = points[int(float64(i)*step)]
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	var best Plane
+	bestInliers := 0
+	for range iterations {
+		a, b, c := samples[rng.IntN(len(samples))], samples[rng.IntN(len(samples))], samples[rng.IntN(len(samples))]
+		n := cross(sub(b, a), sub(c, a))
+		l := math.Sqrt(dot(n, n))
+		if l == 0 {
+			continue
+		}
+		pl := Plane{Normal: [3]float64{n[0] / l, n[1] / l, n[2] / l}}
+		pl.D = -dot(pl.Normal, a)
+
+		inliers := 0
+		for _, p := range samples {
+			if math.Abs(pl.Distance(p)) <= threshold {
+				inliers++
+			}
+		}
+		if inliers > bestInliers {
+			best, bestInliers = pl, inliers
+		}
+	}
+
+	if bestInliers == 0 {
+		return Plane{}, 0, fmt.Errorf("no plane found, the points are degenerate")
+	}
+
+	// Report support over every point, not just the scored subset
+	inliers := 0
+	for _, p := range points {
+		if math.Abs(best.Distance(p)) <= threshold {
+			inliers++
+		}
+	}
+	return best, inliers, nil
+}
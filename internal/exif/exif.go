@@ -0,0 +1,328 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Tags of the first IFD
+const (
+	tagMake    = 0x010F
+	tagModel   = 0x0110
+	tagExifIFD = 0x8769
+	tagGPSIFD  = 0x8825
+)
+
+// Tags of the EXIF IFD
+const (
+	tagBodySerialNumber = 0xA431
+)
+
+// GPS tags of the GPS IFD
+const (
+	tagLatitudeRef  = 0x0001
+	tagLatitude     = 0x0002
+	tagLongitudeRef = 0x0003
+	tagLongitude    = 0x0004
+	tagAltitudeRef  = 0x0005
+	tagAltitude     = 0x0006
+)
+
+// TIFF field types
+const (
+	typeByte     = 1
+	typeASCII    = 2
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+)
+
+var typeSizes = map[uint16]int{typeByte: 1, typeASCII: 1, typeShort: 2, typeLong: 4, typeRational: 8}
+
+// ErrNoGPS is returned for images without a GPS position
+var ErrNoGPS = errors.New("no GPS position")
+
+// errNoEXIF is returned by readTIFF for images without EXIF data
+var errNoEXIF = errors.New("no EXIF data")
+
+// GPS is a WGS84 position in degrees and meters above sea level
+type GPS struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	// HasAltitude is false when the image only records a horizontal position
+	HasAltitude bool
+}
+
+// Camera identifies the camera that took an image. Fields missing from the
+// EXIF data are empty.
+type Camera struct {
+	Make   string
+	Model  string
+	Serial string
+}
+
+// ReadGPS returns the GPS position recorded in the EXIF data of a JPEG or
+// TIFF image
+func ReadGPS(path string) (GPS, error) {
+	tiff, err := readFile(path)
+	if errors.Is(err, errNoEXIF) {
+		return GPS{}, fmt.Errorf("%s: %w", path, ErrNoGPS)
+	}
+	if err != nil {
+		return GPS{}, err
+	}
+	gps, err := parseGPS(tiff)
+	if err != nil {
+		return GPS{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return gps, nil
+}
+
+// ReadCamera returns the make, model and body serial number recorded in the
+// EXIF data of a JPEG or TIFF image. An image without EXIF data has an empty
+// Camera.
+func ReadCamera(path string) (Camera, error) {
+	tiff, err := readFile(path)
+	if errors.Is(err, errNoEXIF) {
+		return Camera{}, nil
+	}
+	if err != nil {
+		return Camera{}, err
+	}
+	camera, err := parseCamera(tiff)
+	if err != nil {
+		return Camera{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return camera, nil
+}
+
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", path, err)
+	}
+	defer f.Close()
+
+	tiff, err := readTIFF(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tiff, nil
+}
+
+// readTIFF returns the TIFF structure holding the EXIF data, which is the
+// APP1 segment of a JPEG or the whole file of a TIFF
+func readTIFF(r io.Reader) ([]byte, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if bytes.Equal(head, []byte("II*\x00")) || bytes.Equal(head, []byte("MM\x00*")) {
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return append(head, rest...), nil
+	}
+	if head[0] != 0xFF || head[1] != 0xD8 {
+		return nil, fmt.Errorf("not a JPEG or TIFF image")
+	}
+
+	// Walk the JPEG segments up to the start of scan
+	marker := head[2:4]
+	for {
+		if marker[0] != 0xFF {
+			return nil, fmt.Errorf("corrupt JPEG segment")
+		}
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, errNoEXIF
+		}
+
+		var size uint16
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("failed to read JPEG segment: %w", err)
+		}
+		if size < 2 {
+			return nil, fmt.Errorf("corrupt JPEG segment")
+		}
+		segment := make([]byte, size-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, fmt.Errorf("failed to read JPEG segment: %w", err)
+		}
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+
+		marker = make([]byte, 2)
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, fmt.Errorf("failed to read JPEG segment: %w", err)
+		}
+	}
+}
+
+type entry struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// firstIFD returns the byte order and the first IFD of a TIFF structure
+func firstIFD(tiff []byte) (binary.ByteOrder, map[uint16]entry, error) {
+	if len(tiff) < 8 {
+		return nil, nil, fmt.Errorf("truncated EXIF data")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, nil, fmt.Errorf("invalid EXIF byte order")
+	}
+
+	ifd0, err := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, ifd0, nil
+}
+
+// parseCamera reads the camera tags of the first and the EXIF IFD
+func parseCamera(tiff []byte) (Camera, error) {
+	order, ifd0, err := firstIFD(tiff)
+	if err != nil {
+		return Camera{}, err
+	}
+	camera := Camera{Make: ifd0[tagMake].string(), Model: ifd0[tagModel].string()}
+
+	if pointer, ok := ifd0[tagExifIFD]; ok {
+		tags, err := readIFD(tiff, order, pointer.uint(order))
+		if err != nil {
+			return Camera{}, err
+		}
+		camera.Serial = tags[tagBodySerialNumber].string()
+	}
+	return camera, nil
+}
+
+// parseGPS reads the GPS IFD referenced from the first IFD of a TIFF structure
+func parseGPS(tiff []byte) (GPS, error) {
+	order, ifd0, err := firstIFD(tiff)
+	if err != nil {
+		return GPS{}, err
+	}
+	pointer, ok := ifd0[tagGPSIFD]
+	if !ok {
+		return GPS{}, ErrNoGPS
+	}
+	tags, err := readIFD(tiff, order, pointer.uint(order))
+	if err != nil {
+		return GPS{}, err
+	}
+
+	lat, err := degrees(tags[tagLatitude], order)
+	if err != nil {
+		return GPS{}, err
+	}
+	lon, err := degrees(tags[tagLongitude], order)
+	if err != nil {
+		return GPS{}, err
+	}
+	if ref := tags[tagLatitudeRef]; ref.typ == typeASCII && len(ref.data) > 0 && ref.data[0] == 'S' {
+		lat = -lat
+	}
+	if ref := tags[tagLongitudeRef]; ref.typ == typeASCII && len(ref.data) > 0 && ref.data[0] == 'W' {
+		lon = -lon
+	}
+	gps := GPS{Latitude: lat, Longitude: lon}
+
+	if alt, ok := tags[tagAltitude]; ok && alt.typ == typeRational && alt.count >= 1 {
+		gps.Altitude = rational(alt.data, order)
+		gps.HasAltitude = true
+		// Reference 1 means below sea level
+		if ref := tags[tagAltitudeRef]; ref.typ == typeByte && len(ref.data) > 0 && ref.data[0] == 1 {
+			gps.Altitude = -gps.Altitude
+		}
+	}
+	return gps, nil
+}
+
+// readIFD returns the entries of the image file directory at offset
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) (map[uint16]entry, error) {
+	if int(offset)+2 > len(tiff) {
+		return nil, fmt.Errorf("IFD offset %d out of range", offset)
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(tiff) {
+		return nil, fmt.Errorf("truncated IFD at %d", offset)
+	}
+
+	entries := map[uint16]entry{}
+	for i := range count {
+		raw := tiff[start+i*12 : start+(i+1)*12]
+		e := entry{typ: order.Uint16(raw[2:4]), count: order.Uint32(raw[4:8])}
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+
+		n := size * int(e.count)
+		if n <= 4 {
+			e.data = raw[8 : 8+n]
+		} else {
+			at := int(order.Uint32(raw[8:12]))
+			if at+n > len(tiff) {
+				return nil, fmt.Errorf("tag %#x value out of range", order.Uint16(raw[0:2]))
+			}
+			e.data = tiff[at : at+n]
+		}
+		entries[order.Uint16(raw[0:2])] = e
+	}
+	return entries, nil
+}
+
+// string returns an ASCII value without its terminator and padding
+func (e entry) string() string {
+	if e.typ != typeASCII {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.data), "\x00"))
+}
+
+func (e entry) uint(order binary.ByteOrder) uint32 {
+	switch e.typ {
+	case typeShort:
+		return uint32(order.Uint16(e.data))
+	case typeLong:
+		return order.Uint32(e.data)
+	}
+	return 0
+}
+
+// degrees converts a degrees, minutes, seconds rational triple
+func degrees(e entry, order binary.ByteOrder) (float64, error) {
+	if e.typ != typeRational || e.count != 3 {
+		return 0, ErrNoGPS
+	}
+	d := rational(e.data[0:], order)
+	m := rational(e.data[8:], order)
+	s := rational(e.data[16:], order)
+	return d + m/60 + s/3600, nil
+}
+
+func rational(b []byte, order binary.ByteOrder) float64 {
+	num, den := order.Uint32(b[0:4]), order.Uint32(b[4:8])
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
@@ -0,0 +1,59 @@
+package exif_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/exif"
+)
+
+func TestReadGPS(t *testing.T) {
+	tests := []struct {
+		path string
+		want exif.GPS
+	}{
+		{"testdata/gps.jpg", exif.GPS{Latitude: 51.5073333, Longitude: -0.1276667, Altitude: 35.5, HasAltitude: true}},
+		{"testdata/gps.tif", exif.GPS{Latitude: -33.8666667, Longitude: 151.21, Altitude: -5, HasAltitude: true}},
+	}
+
+	for _, tt := range tests {
+		got, err := exif.ReadGPS(tt.path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.path, err)
+		}
+		if math.Abs(got.Latitude-tt.want.Latitude) > 1e-6 || math.Abs(got.Longitude-tt.want.Longitude) > 1e-6 ||
+			got.Altitude != tt.want.Altitude || got.HasAltitude != tt.want.HasAltitude {
+			t.Errorf("%s: expected %+v, got %+v", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestReadGPS_Missing(t *testing.T) {
+	if _, err := exif.ReadGPS("testdata/nogps.jpg"); !errors.Is(err, exif.ErrNoGPS) {
+		t.Errorf("expected ErrNoGPS, got %v", err)
+	}
+	if _, err := exif.ReadGPS("testdata/missing.jpg"); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+	if _, err := exif.ReadGPS("exif_test.go"); err == nil {
+		t.Errorf("expected error for a file that is not an image")
+	}
+}
+
+func TestReadCamera(t *testing.T) {
+	got, err := exif.ReadCamera("testdata/camera.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (exif.Camera{Make: "Canon", Model: "Canon EOS 5D", Serial: "0123456789"}); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// Images without EXIF data or camera tags have an empty camera
+	for _, path := range []string{"testdata/nogps.jpg", "testdata/gps.jpg"} {
+		if got, err := exif.ReadCamera(path); err != nil || got != (exif.Camera{}) {
+			t.Errorf("%s: expected an empty camera, got %+v %v", path, got, err)
+		}
+	}
+}
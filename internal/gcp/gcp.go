@@ -0,0 +1,275 @@
+package gcp
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/scale"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+)
+
+// Point is a surveyed ground control point and its pixel observations
+type Point struct {
+	Name         string
+	Position     [3]float64
+	Observations []scale.Observation
+	// Check points are left out of the registration and only measure its
+	// accuracy
+	Check bool
+}
+
+// Residual is the difference between the surveyed and the reconstructed
+// position of a point after registration
+type Residual struct {
+	Name         string     `json:"name"`
+	Check        bool       `json:"check"`
+	Observations int        `json:"observations"`
+	Surveyed     [3]float64 `json:"surveyed"`
+	Estimated    [3]float64 `json:"estimated"`
+	Error        [3]float64 `json:"error"`
+	Distance     float64    `json:"distance"`
+}
+
+// Report summarises a registration. RMSE is over the control points and
+// CheckRMSE over the check points.
+type Report struct {
+	// Origin is the surveyed position of the origin of the registered
+	// reconstruction
+	Origin        [3]float64 `json:"origin"`
+	ControlPoints int        `json:"control_points"`
+	CheckPoints   int        `json:"check_points"`
+	RMSE          float64    `json:"rmse"`
+	CheckRMSE     float64    `json:"check_rmse"`
+	Residuals     []Residual `json:"residuals"`
+}
+
+// ParseFile reads ground control points from a CSV file with one row per fact:
+//
+//	gcp,<name>,<x>,<y>,<z>           surveyed control point
+//	check,<name>,<x>,<y>,<z>         surveyed check point
+//	point,<name>,<image>,<x>,<y>     pixel observation of a point
+//
+// Empty lines and lines starting with # are ignored. Points are returned in
+// name order.
+func ParseFile(path string) ([]Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ground control points %s: %w", path, err)
+	}
+	defer f.Close()
+
+	points, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return points, nil
+}
+
+// Parse reads ground control points in the format described by ParseFile
+func Parse(r io.Reader) ([]Point, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	byName := map[string]*Point{}
+	surveyed := map[string]bool{}
+	point := func(name string) *Point {
+		if p, ok := byName[name]; ok {
+			return p
+		}
+		p := &Point{Name: name}
+		byName[name] = p
+		return p
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		kind := strings.ToLower(strings.TrimSpace(record[0]))
+		switch kind {
+		case "gcp", "check":
+			if len(record) != 5 {
+				return nil, fmt.Errorf("line %d: %s needs name, x, y and z", line, kind)
+			}
+			v, err := parseFloats(record[2:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if surveyed[record[1]] {
+				return nil, fmt.Errorf("line %d: point %s is surveyed twice", line, record[1])
+			}
+			surveyed[record[1]] = true
+			p := point(record[1])
+			p.Position = [3]float64{v[0], v[1], v[2]}
+			p.Check = kind == "check"
+		case "point":
+			if len(record) != 5 {
+				return nil, fmt.Errorf("line %d: point needs name, image, x and y", line)
+			}
+			v, err := parseFloats(record[3:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			p := point(record[1])
+			p.Observations = append(p.Observations, scale.Observation{Image: record[2], X: v[0], Y: v[1]})
+		default:
+			return nil, fmt.Errorf("line %d: unknown row type %q", line, record[0])
+		}
+	}
+
+	points := make([]Point, 0, len(byName))
+	for name, p := range byName {
+		if !surveyed[name] {
+			return nil, fmt.Errorf("point %s is observed but has no surveyed position", name)
+		}
+		points = append(points, *p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Name < points[j].Name })
+
+	control := 0
+	for _, p := range points {
+		if !p.Check {
+			control++
+		}
+	}
+	if control < 3 {
+		return nil, fmt.Errorf("at least 3 control points are needed, got %d", control)
+	}
+	return points, nil
+}
+
+// Origin returns the centroid of the control points. Surveyed coordinates,
+// such as those of UTM, are too large for the single precision coordinates
+// of mesh formats, the reconstruction is registered relative to it.
+func Origin(points []Point) [3]float64 {
+	var c [3]float64
+	n := 0
+	for _, p := range points {
+		if p.Check {
+			continue
+		}
+		for i := range c {
+			c[i] += p.Position[i]
+		}
+		n++
+	}
+	if n == 0 {
+		return c
+	}
+	return [3]float64{c[0] / float64(n), c[1] / float64(n), c[2] / float64(n)}
+}
+
+// ControlPoints returns the points in the form sfm_data.json stores them,
+// relative to origin and with images resolved to the views of the scene.
+// Observations of images that are not part of the scene are dropped.
+func ControlPoints(sfm *sfmdata.SfMData, points []Point, origin [3]float64) []sfmdata.ControlPoint {
+	out := make([]sfmdata.ControlPoint, 0, len(points))
+	for i, p := range points {
+		cp := sfmdata.ControlPoint{ID: uint32(i), Position: sub(p.Position, origin)}
+		for _, o := range p.Observations {
+			if view := sfm.ViewByFilename(o.Image); view != nil {
+				cp.Observations = append(cp.Observations, sfmdata.ControlObservation{ViewID: view.ID, X: o.X, Y: o.Y})
+			}
+		}
+		out = append(out, cp)
+	}
+	return out
+}
+
+// Register triangulates the points in the reconstruction and returns the
+// similarity that maps the reconstruction onto the surveyed control points
+// relative to their Origin, with the residual of every point that could be
+// triangulated
+func Register(sfm *sfmdata.SfMData, points []Point) (transform.Similarity, *Report, error) {
+	origin := Origin(points)
+	var src, dst [][3]float64
+	estimated := map[string][3]float64{}
+	for _, p := range points {
+		x, err := scale.Triangulate(sfm, p.Observations)
+		if err != nil {
+			// A point seen in fewer than two registered images is not usable
+			// but should not fail the registration
+			continue
+		}
+		estimated[p.Name] = x
+		if !p.Check {
+			src = append(src, x)
+			dst = append(dst, sub(p.Position, origin))
+		}
+	}
+	if len(src) < 3 {
+		return transform.Similarity{}, nil, fmt.Errorf("only %d control points could be triangulated, at least 3 are needed", len(src))
+	}
+
+	t, err := transform.Fit(src, dst)
+	if err != nil {
+		return transform.Similarity{}, nil, err
+	}
+
+	report := &Report{Origin: origin}
+	var sum, checkSum float64
+	for _, p := range points {
+		x, ok := estimated[p.Name]
+		if !ok {
+			continue
+		}
+		e := add(t.Apply(x), origin)
+		r := Residual{
+			Name:         p.Name,
+			Check:        p.Check,
+			Observations: len(p.Observations),
+			Surveyed:     p.Position,
+			Estimated:    e,
+			Error:        [3]float64{e[0] - p.Position[0], e[1] - p.Position[1], e[2] - p.Position[2]},
+			Distance:     transform.Distance(e, p.Position),
+		}
+		report.Residuals = append(report.Residuals, r)
+		if p.Check {
+			report.CheckPoints++
+			checkSum += r.Distance * r.Distance
+		} else {
+			report.ControlPoints++
+			sum += r.Distance * r.Distance
+		}
+	}
+	report.RMSE = math.Sqrt(sum / float64(report.ControlPoints))
+	if report.CheckPoints > 0 {
+		report.CheckRMSE = math.Sqrt(checkSum / float64(report.CheckPoints))
+	}
+	return t, report, nil
+}
+
+func add(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func parseFloats(fields []string) ([]float64, error) {
+	out := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,169 @@
+package gcp_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/gcp"
+	"github.com/2024-dissertation/openmvgo/internal/scale"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+)
+
+func TestParse(t *testing.T) {
+	points, err := gcp.Parse(strings.NewReader(`# surveyed in EPSG:32630
+gcp, c, 10, 20, 3
+gcp, a, 0, 0, 1
+gcp, b, 5, 0, 2
+check, d, 1, 1, 1
+point, a, IMG_0001.JPG, 100, 200
+point, a, IMG_0002.JPG, 120, 210
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(points) != 4 || points[0].Name != "a" || points[2].Name != "c" {
+		t.Fatalf("expected points sorted by name, got %+v", points)
+	}
+	if len(points[0].Observations) != 2 || points[0].Position != [3]float64{0, 0, 1} {
+		t.Errorf("unexpected point %+v", points[0])
+	}
+	if !points[3].Check || points[2].Check {
+		t.Errorf("expected only d to be a check point")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"too few":    "gcp,a,0,0,0\ngcp,b,1,0,0\ncheck,c,0,1,0\n",
+		"unsurveyed": "gcp,a,0,0,0\ngcp,b,1,0,0\ngcp,c,0,1,0\npoint,d,IMG.JPG,1,2\n",
+		"duplicate":  "gcp,a,0,0,0\ngcp,a,1,0,0\n",
+		"bad number": "gcp,a,0,x,0\n",
+		"unknown":    "distance,a,b,1\n",
+	}
+	for name, input := range tests {
+		if _, err := gcp.Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// scene returns two pinhole cameras looking at the origin from the front and
+// the side
+func scene() *sfmdata.SfMData {
+	return &sfmdata.SfMData{
+		Views: []sfmdata.View{
+			{ID: 0, Filename: "front.jpg", PoseID: 0},
+			{ID: 1, Filename: "side.jpg", PoseID: 1},
+		},
+		Intrinsics: []sfmdata.Intrinsic{
+			{ID: 0, Model: "pinhole", FocalLength: 1000, PrincipalPoint: [2]float64{500, 400}},
+		},
+		Poses: []sfmdata.Pose{
+			{ID: 0, Rotation: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, Center: [3]float64{0, 0, -10}},
+			{ID: 1, Rotation: [3][3]float64{{0, 0, -1}, {0, 1, 0}, {1, 0, 0}}, Center: [3]float64{-10, 0, 0}},
+		},
+	}
+}
+
+func observe(sfm *sfmdata.SfMData, x [3]float64) []scale.Observation {
+	var out []scale.Observation
+	for i, p := range sfm.Poses {
+		var cam [3]float64
+		for r := range 3 {
+			for c := range 3 {
+				cam[r] += p.Rotation[r][c] * (x[c] - p.Center[c])
+			}
+		}
+		out = append(out, scale.Observation{Image: sfm.Views[i].Filename, X: 1000*cam[0]/cam[2] + 500, Y: 1000*cam[1]/cam[2] + 400})
+	}
+	return out
+}
+
+func TestRegister(t *testing.T) {
+	sfm := scene()
+	survey := transform.Similarity{
+		Scale:       3,
+		Rotation:    [3][3]float64{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}},
+		Translation: [3]float64{430000, 5700000, 50},
+	}
+
+	model := map[string][3]float64{"a": {0, 0, 0}, "b": {1, 0, 0}, "c": {0, 1, 0}, "d": {0, 0, 1}, "e": {1, 1, 1}}
+	var points []gcp.Point
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		p := gcp.Point{Name: name, Position: survey.Apply(model[name]), Observations: observe(sfm, model[name])}
+		if name == "e" {
+			// The check point is surveyed 0.3 m off
+			p.Check = true
+			p.Position[2] += 0.3
+		}
+		points = append(points, p)
+	}
+	// A point seen in a single image is skipped
+	points = append(points, gcp.Point{Name: "f", Position: [3]float64{1, 2, 3}, Observations: observe(sfm, model["a"])[:1]})
+
+	got, report, err := gcp.Register(sfm, points)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if math.Abs(got.Scale-3) > 1e-6 {
+		t.Errorf("expected scale 3, got %g", got.Scale)
+	}
+	// The reconstruction is registered relative to the centroid of the
+	// control points, which keeps the coordinates small
+	var want [3]float64
+	for _, name := range []string{"a", "b", "c", "d", "f"} {
+		p := survey.Apply(model[name])
+		if name == "f" {
+			p = [3]float64{1, 2, 3}
+		}
+		for i := range want {
+			want[i] += p[i] / 5
+		}
+	}
+	origin := gcp.Origin(points)
+	if transform.Distance(origin, want) > 1e-6 || report.Origin != origin {
+		t.Errorf("expected origin %v, got %v", want, report.Origin)
+	}
+	if x := got.Apply(model["b"]); transform.Distance(x, [3]float64{points[1].Position[0] - origin[0], points[1].Position[1] - origin[1], points[1].Position[2] - origin[2]}) > 1e-6 {
+		t.Errorf("expected b relative to the origin, got %v", x)
+	}
+	if report.ControlPoints != 4 || report.CheckPoints != 1 || len(report.Residuals) != 5 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.RMSE > 1e-6 {
+		t.Errorf("expected an exact fit, got rmse %g", report.RMSE)
+	}
+	if e := report.Residuals[4]; e.Name != "e" || math.Abs(e.Distance-0.3) > 1e-6 || math.Abs(report.CheckRMSE-0.3) > 1e-6 {
+		t.Errorf("unexpected check point residual %+v", e)
+	}
+}
+
+func TestRegister_TooFew(t *testing.T) {
+	sfm := scene()
+	points := []gcp.Point{
+		{Name: "a", Observations: observe(sfm, [3]float64{0, 0, 0})},
+		{Name: "b", Observations: observe(sfm, [3]float64{1, 0, 0})},
+		{Name: "c", Observations: observe(sfm, [3]float64{0, 1, 0})[:1]},
+	}
+	if _, _, err := gcp.Register(sfm, points); err == nil {
+		t.Errorf("expected error with only 2 usable control points")
+	}
+}
+
+func TestControlPoints(t *testing.T) {
+	sfm := scene()
+	points := []gcp.Point{{
+		Name:         "a",
+		Position:     [3]float64{1, 2, 3},
+		Observations: []scale.Observation{{Image: "side.jpg", X: 1, Y: 2}, {Image: "other.jpg", X: 3, Y: 4}},
+	}}
+
+	cps := gcp.ControlPoints(sfm, points, [3]float64{1, 1, 1})
+	if len(cps) != 1 || len(cps[0].Observations) != 1 || cps[0].Observations[0].ViewID != 1 || cps[0].Position != [3]float64{0, 1, 2} {
+		t.Errorf("unexpected control points %+v", cps)
+	}
+}
@@ -0,0 +1,166 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+)
+
+// Frames a reconstruction can be registered to
+const (
+	FrameENU = "enu"
+	FrameUTM = "utm"
+)
+
+// Frame is a local metric frame. In the ENU frame coordinates are east, north
+// and up of the origin. In the UTM frame they are easting, northing and
+// altitude less those of the origin, which keeps them small enough for the
+// single precision coordinates of mesh formats.
+type Frame struct {
+	Kind   string
+	Origin Position
+	zone   int
+	north  bool
+	offset [3]float64
+}
+
+// NewFrame returns the frame of the given kind centred on origin
+func NewFrame(kind string, origin Position) (*Frame, error) {
+	f := &Frame{Kind: kind, Origin: origin}
+	switch kind {
+	case FrameENU:
+	case FrameUTM:
+		f.zone, f.north = UTMZone(origin)
+		e, n, err := UTM(origin, f.zone, f.north)
+		if err != nil {
+			return nil, err
+		}
+		f.offset = [3]float64{e, n, origin.Altitude}
+	default:
+		return nil, fmt.Errorf("unknown frame %q, expected %s or %s", kind, FrameENU, FrameUTM)
+	}
+	return f, nil
+}
+
+// Local returns the coordinates of p in the frame
+func (f *Frame) Local(p Position) ([3]float64, error) {
+	if f.Kind == FrameENU {
+		return ENU(f.Origin, p), nil
+	}
+	e, n, err := UTM(p, f.zone, f.north)
+	if err != nil {
+		return [3]float64{}, err
+	}
+	return [3]float64{e - f.offset[0], n - f.offset[1], p.Altitude - f.offset[2]}, nil
+}
+
+// CRS names the coordinate reference system of the frame
+func (f *Frame) CRS() string {
+	if f.Kind == FrameENU {
+		return "ENU"
+	}
+	if f.north {
+		return fmt.Sprintf("EPSG:%d", 32600+f.zone)
+	}
+	return fmt.Sprintf("EPSG:%d", 32700+f.zone)
+}
+
+// ToCRS returns the matrix that maps frame coordinates to CRS coordinates
+func (f *Frame) ToCRS() [4][4]float64 {
+	t := transform.Identity()
+	t.Translation = f.offset
+	return t.Matrix()
+}
+
+// Georeference is the sidecar written next to the exported model
+type Georeference struct {
+	// CRS is ENU for a local tangent plane or the EPSG code of a UTM zone,
+	// empty for the unknown CRS of surveyed control points
+	CRS    string   `json:"crs"`
+	Origin Position `json:"origin"`
+	// Transform maps model coordinates to CRS coordinates, row major
+	Transform    [4][4]float64 `json:"transform"`
+	Registration Registration  `json:"registration"`
+}
+
+// Registration describes the fit of the reconstruction to the positions
+type Registration struct {
+	// Source of the positions, such as exif
+	Source string `json:"source"`
+	// Matrix maps the unregistered reconstruction to model coordinates
+	Matrix [4][4]float64 `json:"matrix"`
+	Points int           `json:"points"`
+	RMSE   float64       `json:"rmse"`
+}
+
+// ReadGeoreference loads the sidecar written by Write
+func ReadGeoreference(path string) (*Georeference, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read georeference %s: %w", path, err)
+	}
+	var g Georeference
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to parse georeference %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+// Offset returns the translation of the transform, the CRS coordinates of
+// the origin of the model
+func (g *Georeference) Offset() [3]float64 {
+	return [3]float64{g.Transform[0][3], g.Transform[1][3], g.Transform[2][3]}
+}
+
+// WKT returns the OGC WKT of the CRS of a UTM frame, empty for the local
+// ENU frame which has none
+func (g *Georeference) WKT() string {
+	var code int
+	if _, err := fmt.Sscanf(g.CRS, "EPSG:%d", &code); err != nil {
+		return ""
+	}
+	zone, north := code-32600, true
+	if code > 32700 {
+		zone, north = code-32700, false
+	}
+	if zone < 1 || zone > 60 {
+		return ""
+	}
+	hemisphere, falseNorthing := "N", 0
+	if !north {
+		hemisphere, falseNorthing = "S", 10000000
+	}
+	return fmt.Sprintf(`PROJCS["WGS 84 / UTM zone %d%s",`+
+		`GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],`+
+		`PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]],`+
+		`PROJECTION["Transverse_Mercator"],PARAMETER["latitude_of_origin",0],PARAMETER["central_meridian",%d],`+
+		`PARAMETER["scale_factor",0.9996],PARAMETER["false_easting",500000],PARAMETER["false_northing",%d],`+
+		`UNIT["metre",1,AUTHORITY["EPSG","9001"]],AXIS["Easting",EAST],AXIS["Northing",NORTH],AUTHORITY["EPSG","%d"]]`,
+		zone, hemisphere, zone*6-183, falseNorthing, code)
+}
+
+// Write saves the georeference as JSON
+func (g *Georeference) Write(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write georeference %s: %w", path, err)
+	}
+	return nil
+}
+
+// Centroid returns the mean of the positions, used as the frame origin
+func Centroid(positions []Position) Position {
+	var c Position
+	for _, p := range positions {
+		c.Latitude += p.Latitude
+		c.Longitude += p.Longitude
+		c.Altitude += p.Altitude
+	}
+	n := float64(len(positions))
+	return Position{Latitude: c.Latitude / n, Longitude: c.Longitude / n, Altitude: c.Altitude / n}
+}
@@ -0,0 +1,142 @@
+package geo_test
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/geo"
+)
+
+func TestUTM(t *testing.T) {
+	// CN Tower, Toronto
+	cn := geo.Position{Latitude: 43.642567, Longitude: -79.387139}
+	zone, north := geo.UTMZone(cn)
+	if zone != 17 || !north {
+		t.Fatalf("expected zone 17N, got %d %v", zone, north)
+	}
+	e, n, err := geo.UTM(cn, zone, north)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(e-630084) > 1 || math.Abs(n-4833439) > 1 {
+		t.Errorf("expected 630084 4833439, got %.1f %.1f", e, n)
+	}
+
+	// The central meridian on the equator maps to the false origin
+	e, n, _ = geo.UTM(geo.Position{Longitude: 3}, 31, false)
+	if math.Abs(e-500000) > 1e-6 || math.Abs(n-10000000) > 1e-6 {
+		t.Errorf("expected 500000 10000000, got %f %f", e, n)
+	}
+
+	if _, _, err := geo.UTM(geo.Position{Latitude: 85}, 1, true); err == nil {
+		t.Errorf("expected error for a polar latitude")
+	}
+}
+
+func TestENU(t *testing.T) {
+	origin := geo.Position{Latitude: 51.5, Longitude: -0.12, Altitude: 20}
+
+	if p := geo.ENU(origin, origin); math.Abs(p[0])+math.Abs(p[1])+math.Abs(p[2]) > 1e-6 {
+		t.Errorf("expected the origin at zero, got %v", p)
+	}
+
+	// 0.001 degrees of latitude is about 111 m north
+	p := geo.ENU(origin, geo.Position{Latitude: 51.501, Longitude: -0.12, Altitude: 30})
+	if math.Abs(p[0]) > 1e-3 || math.Abs(p[1]-111.26) > 0.1 || math.Abs(p[2]-10) > 0.01 {
+		t.Errorf("unexpected ENU %v", p)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	origin := geo.Position{Latitude: -33.87, Longitude: 151.21, Altitude: 5}
+
+	f, err := geo.NewFrame(geo.FrameUTM, origin)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.CRS() != "EPSG:32756" {
+		t.Errorf("expected EPSG:32756, got %s", f.CRS())
+	}
+	if p, _ := f.Local(origin); p != [3]float64{} {
+		t.Errorf("expected the origin at zero, got %v", p)
+	}
+
+	e, n, _ := geo.UTM(origin, 56, false)
+	if m := f.ToCRS(); m[0][3] != e || m[1][3] != n || m[2][3] != 5 {
+		t.Errorf("expected the UTM offset in the matrix, got %v", m)
+	}
+
+	enu, _ := geo.NewFrame(geo.FrameENU, origin)
+	if enu.CRS() != "ENU" || enu.ToCRS()[0][3] != 0 {
+		t.Errorf("unexpected ENU frame %s %v", enu.CRS(), enu.ToCRS())
+	}
+
+	if _, err := geo.NewFrame("wgs84", origin); err == nil {
+		t.Errorf("expected error for an unknown frame")
+	}
+}
+
+func TestGeoreference_Write(t *testing.T) {
+	g := geo.Georeference{
+		CRS:          "ENU",
+		Origin:       geo.Centroid([]geo.Position{{Latitude: 1, Longitude: 2, Altitude: 3}, {Latitude: 3, Longitude: 4, Altitude: 5}}),
+		Registration: geo.Registration{Source: "exif", Points: 2},
+	}
+	path := filepath.Join(t.TempDir(), "georeference.json")
+	if err := g.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got geo.Georeference
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Origin != (geo.Position{Latitude: 2, Longitude: 3, Altitude: 4}) || got.Registration.Source != "exif" {
+		t.Errorf("unexpected georeference %+v", got)
+	}
+}
+
+func TestGeoreference_WKT(t *testing.T) {
+	for _, tt := range []struct {
+		crs  string
+		want []string
+	}{
+		{"EPSG:32631", []string{`"WGS 84 / UTM zone 31N"`, `PARAMETER["central_meridian",3]`, `PARAMETER["false_northing",0]`, `AUTHORITY["EPSG","32631"]]`}},
+		{"EPSG:32755", []string{`"WGS 84 / UTM zone 55S"`, `PARAMETER["central_meridian",147]`, `PARAMETER["false_northing",10000000]`}},
+	} {
+		wkt := (&geo.Georeference{CRS: tt.crs}).WKT()
+		for _, want := range tt.want {
+			if !strings.Contains(wkt, want) {
+				t.Errorf("expected the WKT of %s to contain %s, got %s", tt.crs, want, wkt)
+			}
+		}
+	}
+
+	if wkt := (&geo.Georeference{CRS: "ENU"}).WKT(); wkt != "" {
+		t.Errorf("expected no WKT for the ENU frame, got %s", wkt)
+	}
+}
+
+func TestReadGeoreference(t *testing.T) {
+	g := geo.Georeference{CRS: "EPSG:32631", Transform: [4][4]float64{{1, 0, 0, 500000}, {0, 1, 0, 5700000}, {0, 0, 1, 40}, {0, 0, 0, 1}}}
+	path := filepath.Join(t.TempDir(), "georeference.json")
+	if err := g.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := geo.ReadGeoreference(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.CRS != g.CRS || got.Offset() != [3]float64{500000, 5700000, 40} {
+		t.Errorf("unexpected georeference %+v", got)
+	}
+}
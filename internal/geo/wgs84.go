@@ -0,0 +1,107 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// WGS84 ellipsoid
+const (
+	semiMajorAxis = 6378137.0
+	flattening    = 1 / 298.257223563
+	eccentricity2 = flattening * (2 - flattening)
+)
+
+// UTM projection constants
+const (
+	utmScale         = 0.9996
+	utmFalseEasting  = 500000.0
+	utmFalseNorthing = 10000000.0
+)
+
+// Position is a WGS84 position in degrees and meters above the ellipsoid
+type Position struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// ECEF returns the earth centred, earth fixed coordinates of p
+func ECEF(p Position) [3]float64 {
+	lat, lon := radians(p.Latitude), radians(p.Longitude)
+	sinLat := math.Sin(lat)
+	n := semiMajorAxis / math.Sqrt(1-eccentricity2*sinLat*sinLat)
+	return [3]float64{
+		(n + p.Altitude) * math.Cos(lat) * math.Cos(lon),
+		(n + p.Altitude) * math.Cos(lat) * math.Sin(lon),
+		(n*(1-eccentricity2) + p.Altitude) * sinLat,
+	}
+}
+
+// ENU returns the east, north, up coordinates of p in the tangent plane at
+// origin
+func ENU(origin, p Position) [3]float64 {
+	o, x := ECEF(origin), ECEF(p)
+	d := [3]float64{x[0] - o[0], x[1] - o[1], x[2] - o[2]}
+
+	lat, lon := radians(origin.Latitude), radians(origin.Longitude)
+	sinLat, cosLat := math.Sin(lat), math.Cos(lat)
+	sinLon, cosLon := math.Sin(lon), math.Cos(lon)
+	return [3]float64{
+		-sinLon*d[0] + cosLon*d[1],
+		-sinLat*cosLon*d[0] - sinLat*sinLon*d[1] + cosLat*d[2],
+		cosLat*cosLon*d[0] + cosLat*sinLon*d[1] + sinLat*d[2],
+	}
+}
+
+// UTMZone returns the UTM zone of a position and whether it is north of the
+// equator. The Norway and Svalbard exceptions are not applied.
+func UTMZone(p Position) (int, bool) {
+	zone := int(math.Floor((p.Longitude+180)/6)) + 1
+	return min(max(zone, 1), 60), p.Latitude >= 0
+}
+
+// UTM returns the easting and northing of p in the given zone, using the
+// Krüger series which is accurate to well under a millimetre within the zone
+func UTM(p Position, zone int, north bool) (float64, float64, error) {
+	if zone < 1 || zone > 60 {
+		return 0, 0, fmt.Errorf("invalid UTM zone %d", zone)
+	}
+	if math.Abs(p.Latitude) > 84 {
+		return 0, 0, fmt.Errorf("latitude %g is outside the UTM range", p.Latitude)
+	}
+
+	n := flattening / (2 - flattening)
+	a := semiMajorAxis / (1 + n) * (1 + n*n/4 + n*n*n*n/64)
+	alpha := [3]float64{
+		n/2 - 2*n*n/3 + 5*n*n*n/16,
+		13*n*n/48 - 3*n*n*n/5,
+		61 * n * n * n / 240,
+	}
+
+	lat := radians(p.Latitude)
+	dlon := radians(p.Longitude - float64(6*zone-183))
+
+	c := 2 * math.Sqrt(n) / (1 + n)
+	t := math.Sinh(math.Atanh(math.Sin(lat)) - c*math.Atanh(c*math.Sin(lat)))
+	xi := math.Atan2(t, math.Cos(dlon))
+	eta := math.Atanh(math.Sin(dlon) / math.Sqrt(1+t*t))
+
+	e, nn := eta, xi
+	for j, al := range alpha {
+		k := 2 * float64(j+1)
+		e += al * math.Cos(k*xi) * math.Sinh(k*eta)
+		nn += al * math.Sin(k*xi) * math.Cosh(k*eta)
+	}
+
+	easting := utmFalseEasting + utmScale*a*e
+	northing := utmScale * a * nn
+	if !north {
+		northing += utmFalseNorthing
+	}
+	return easting, northing, nil
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
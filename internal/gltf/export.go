@@ -0,0 +1,32 @@
+package gltf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Export converts the OBJ or PLY mesh at src into a self contained GLB at
+// dst, converting it to the Y up frame glTF expects
+func Export(src, dst string) error {
+	var (
+		m   *Mesh
+		err error
+	)
+
+	switch strings.ToLower(filepath.Ext(src)) {
+	case ".obj":
+		m, err = FromOBJ(src)
+	case ".ply":
+		m, err = FromPLY(src)
+	default:
+		return fmt.Errorf("unsupported mesh format %s", src)
+	}
+	if err != nil {
+		return err
+	}
+
+	m.ConvertZUpToYUp()
+
+	return WriteGLB(dst, m)
+}
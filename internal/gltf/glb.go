@@ -0,0 +1,383 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbVersion   = 2
+	chunkJSON    = 0x4E4F534A // "JSON"
+	chunkBIN     = 0x004E4942 // "BIN\x00"
+	arrayBuffer  = 34962
+	elementArray = 34963
+
+	componentUnsignedByte = 5121
+	componentUnsignedInt  = 5125
+	componentFloat        = 5126
+
+	samplerLinear       = 9729
+	samplerLinearMipmap = 9987
+	wrapClampToEdge     = 33071
+)
+
+// The document types mirror the parts of the glTF 2.0 schema this package writes
+
+type document struct {
+	Asset       asset        `json:"asset"`
+	Scene       int          `json:"scene"`
+	Scenes      []scene      `json:"scenes"`
+	Nodes       []node       `json:"nodes"`
+	Meshes      []mesh       `json:"meshes"`
+	Materials   []material   `json:"materials,omitempty"`
+	Textures    []texture    `json:"textures,omitempty"`
+	Images      []image      `json:"images,omitempty"`
+	Samplers    []sampler    `json:"samplers,omitempty"`
+	Accessors   []accessor   `json:"accessors"`
+	BufferViews []bufferView `json:"bufferViews"`
+	Buffers     []buffer     `json:"buffers"`
+}
+
+type asset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type scene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type node struct {
+	Name string `json:"name,omitempty"`
+	Mesh *int   `json:"mesh,omitempty"`
+}
+
+type mesh struct {
+	Name       string      `json:"name,omitempty"`
+	Primitives []primitive `json:"primitives"`
+}
+
+type primitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices,omitempty"`
+	Material   *int           `json:"material,omitempty"`
+	Mode       int            `json:"mode"`
+}
+
+type material struct {
+	Name                 string               `json:"name,omitempty"`
+	PbrMetallicRoughness pbrMetallicRoughness `json:"pbrMetallicRoughness"`
+	DoubleSided          bool                 `json:"doubleSided,omitempty"`
+}
+
+type pbrMetallicRoughness struct {
+	BaseColorFactor  [4]float64   `json:"baseColorFactor"`
+	BaseColorTexture *textureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor   float64      `json:"metallicFactor"`
+	RoughnessFactor  float64      `json:"roughnessFactor"`
+}
+
+type textureInfo struct {
+	Index    int `json:"index"`
+	TexCoord int `json:"texCoord"`
+}
+
+type texture struct {
+	Sampler int `json:"sampler"`
+	Source  int `json:"source"`
+}
+
+type image struct {
+	Name       string `json:"name,omitempty"`
+	BufferView int    `json:"bufferView"`
+	MimeType   string `json:"mimeType"`
+}
+
+type sampler struct {
+	MagFilter int `json:"magFilter"`
+	MinFilter int `json:"minFilter"`
+	WrapS     int `json:"wrapS"`
+	WrapT     int `json:"wrapT"`
+}
+
+type accessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Normalized    bool      `json:"normalized,omitempty"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float64 `json:"min,omitempty"`
+	Max           []float64 `json:"max,omitempty"`
+}
+
+type bufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target,omitempty"`
+}
+
+type buffer struct {
+	ByteLength int `json:"byteLength"`
+}
+
+// WriteGLB encodes m as a binary glTF file at path
+func WriteGLB(path string, m *Mesh) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create glb file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := EncodeGLB(f, m); err != nil {
+		return fmt.Errorf("failed to write glb file %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// EncodeGLB writes m as a self contained binary glTF with embedded textures
+func EncodeGLB(w io.Writer, m *Mesh) error {
+	if len(m.Primitives) == 0 {
+		return fmt.Errorf("mesh has no primitives")
+	}
+
+	e := &encoder{
+		doc: document{
+			Asset:   asset{Version: "2.0", Generator: "openmvgo"},
+			Scenes:  []scene{{Nodes: []int{0}}},
+			Nodes:   []node{{Name: m.Name, Mesh: ptr(0)}},
+			Buffers: []buffer{{}},
+		},
+		materials: map[materialKey]int{},
+		images:    map[*Image]int{},
+	}
+
+	out := mesh{Name: m.Name}
+	for i, p := range m.Primitives {
+		prim, err := e.primitive(p)
+		if err != nil {
+			return fmt.Errorf("primitive %d: %w", i, err)
+		}
+		out.Primitives = append(out.Primitives, prim)
+	}
+	e.doc.Meshes = []mesh{out}
+	e.doc.Buffers[0].ByteLength = e.bin.Len()
+
+	js, err := json.Marshal(e.doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode gltf json: %w", err)
+	}
+
+	// Chunks must be 4 byte aligned, JSON is padded with spaces and BIN with zeros
+	js = pad(js, ' ')
+	bin := pad(e.bin.Bytes(), 0)
+
+	total := 12 + 8 + len(js) + 8 + len(bin)
+	header := make([]byte, 0, 20)
+	header = binary.LittleEndian.AppendUint32(header, glbMagic)
+	header = binary.LittleEndian.AppendUint32(header, glbVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(total))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(js)))
+	header = binary.LittleEndian.AppendUint32(header, chunkJSON)
+
+	for _, chunk := range [][]byte{
+		header,
+		js,
+		binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, uint32(len(bin))), chunkBIN),
+		bin,
+	} {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type materialKey struct {
+	material *Material
+	textured bool
+}
+
+type encoder struct {
+	doc       document
+	bin       bytes.Buffer
+	materials map[materialKey]int
+	images    map[*Image]int
+}
+
+func (e *encoder) primitive(p *Primitive) (primitive, error) {
+	n := len(p.Positions)
+	if n == 0 || len(p.Indices) == 0 || len(p.Indices)%3 != 0 {
+		return primitive{}, fmt.Errorf("expected a non empty triangle list")
+	}
+	if len(p.Normals) != 0 && len(p.Normals) != n {
+		return primitive{}, fmt.Errorf("%d normals for %d positions", len(p.Normals), n)
+	}
+	if len(p.UVs) != 0 && len(p.UVs) != n {
+		return primitive{}, fmt.Errorf("%d texture coordinates for %d positions", len(p.UVs), n)
+	}
+	if len(p.Colors) != 0 && len(p.Colors) != n {
+		return primitive{}, fmt.Errorf("%d colors for %d positions", len(p.Colors), n)
+	}
+	for _, idx := range p.Indices {
+		if int(idx) >= n {
+			return primitive{}, fmt.Errorf("index %d out of range for %d positions", idx, n)
+		}
+	}
+
+	out := primitive{Attributes: map[string]int{}, Mode: 4}
+
+	minP := []float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	maxP := []float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	buf := make([]byte, 0, n*12)
+	for _, v := range p.Positions {
+		for i, c := range v {
+			minP[i] = math.Min(minP[i], float64(c))
+			maxP[i] = math.Max(maxP[i], float64(c))
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(c))
+		}
+	}
+	out.Attributes["POSITION"] = e.accessor(buf, arrayBuffer, accessor{
+		ComponentType: componentFloat, Count: n, Type: "VEC3", Min: minP, Max: maxP,
+	})
+
+	if len(p.Normals) > 0 {
+		buf = buf[:0]
+		for _, v := range p.Normals {
+			for _, c := range v {
+				buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(c))
+			}
+		}
+		out.Attributes["NORMAL"] = e.accessor(buf, arrayBuffer, accessor{
+			ComponentType: componentFloat, Count: n, Type: "VEC3",
+		})
+	}
+
+	if len(p.UVs) > 0 {
+		buf = buf[:0]
+		for _, v := range p.UVs {
+			for _, c := range v {
+				buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(c))
+			}
+		}
+		out.Attributes["TEXCOORD_0"] = e.accessor(buf, arrayBuffer, accessor{
+			ComponentType: componentFloat, Count: n, Type: "VEC2",
+		})
+	}
+
+	if len(p.Colors) > 0 {
+		// Vertex attributes must be 4 byte aligned, so colors are stored as RGBA
+		buf = buf[:0]
+		for _, c := range p.Colors {
+			buf = append(buf, c[0], c[1], c[2], 255)
+		}
+		out.Attributes["COLOR_0"] = e.accessor(buf, arrayBuffer, accessor{
+			ComponentType: componentUnsignedByte, Normalized: true, Count: n, Type: "VEC4",
+		})
+	}
+
+	buf = buf[:0]
+	for _, idx := range p.Indices {
+		buf = binary.LittleEndian.AppendUint32(buf, idx)
+	}
+	out.Indices = ptr(e.accessor(buf, elementArray, accessor{
+		ComponentType: componentUnsignedInt, Count: len(p.Indices), Type: "SCALAR",
+	}))
+
+	if p.Material != nil {
+		out.Material = ptr(e.material(p.Material, len(p.UVs) > 0))
+	}
+
+	return out, nil
+}
+
+// accessor appends data as a new buffer view and returns the index of an
+// accessor describing it
+func (e *encoder) accessor(data []byte, target int, a accessor) int {
+	a.BufferView = e.bufferView(data, target)
+	e.doc.Accessors = append(e.doc.Accessors, a)
+	return len(e.doc.Accessors) - 1
+}
+
+func (e *encoder) bufferView(data []byte, target int) int {
+	for e.bin.Len()%4 != 0 {
+		e.bin.WriteByte(0)
+	}
+	e.doc.BufferViews = append(e.doc.BufferViews, bufferView{
+		ByteOffset: e.bin.Len(),
+		ByteLength: len(data),
+		Target:     target,
+	})
+	e.bin.Write(data)
+	return len(e.doc.BufferViews) - 1
+}
+
+// material returns the index of m, dropping its texture when the primitive
+// has no texture coordinates to sample it with
+func (e *encoder) material(m *Material, hasUVs bool) int {
+	key := materialKey{material: m, textured: hasUVs && m.Texture != nil}
+	if idx, ok := e.materials[key]; ok {
+		return idx
+	}
+
+	out := material{
+		Name: m.Name,
+		PbrMetallicRoughness: pbrMetallicRoughness{
+			BaseColorFactor: m.BaseColor,
+			MetallicFactor:  0,
+			RoughnessFactor: 1,
+		},
+		// Reconstructed surfaces are often open, so show both sides
+		DoubleSided: true,
+	}
+
+	if key.textured {
+		out.PbrMetallicRoughness.BaseColorTexture = &textureInfo{Index: e.texture(m.Texture)}
+	}
+
+	e.doc.Materials = append(e.doc.Materials, out)
+	e.materials[key] = len(e.doc.Materials) - 1
+	return e.materials[key]
+}
+
+func (e *encoder) texture(img *Image) int {
+	if idx, ok := e.images[img]; ok {
+		return idx
+	}
+
+	if len(e.doc.Samplers) == 0 {
+		e.doc.Samplers = []sampler{{
+			MagFilter: samplerLinear,
+			MinFilter: samplerLinearMipmap,
+			WrapS:     wrapClampToEdge,
+			WrapT:     wrapClampToEdge,
+		}}
+	}
+
+	e.doc.Images = append(e.doc.Images, image{
+		Name:       img.Name,
+		BufferView: e.bufferView(img.Data, 0),
+		MimeType:   img.MimeType,
+	})
+	e.doc.Textures = append(e.doc.Textures, texture{Sampler: 0, Source: len(e.doc.Images) - 1})
+
+	e.images[img] = len(e.doc.Textures) - 1
+	return e.images[img]
+}
+
+func pad(b []byte, with byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, with)
+	}
+	return b
+}
+
+func ptr(i int) *int {
+	return &i
+}
@@ -0,0 +1,243 @@
+package gltf_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/gltf"
+)
+
+// readJSON returns the decoded JSON chunk of a GLB file
+func readJSON(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+
+	length := binary.LittleEndian.Uint32(data[12:])
+	var doc map[string]any
+	if err := json.Unmarshal(data[20:20+length], &doc); err != nil {
+		t.Fatalf("failed to decode json chunk: %v", err)
+	}
+	return doc
+}
+
+func TestExport_OBJ(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "final.glb")
+
+	if err := gltf.Export("testdata/quad.obj", dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := gltf.ValidateFile(dst); err != nil {
+		t.Fatalf("exported glb is invalid: %v", err)
+	}
+
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read glb: %v", err)
+	}
+	doc := readJSON(t, data)
+
+	images := doc["images"].([]any)
+	if len(images) != 1 || images[0].(map[string]any)["mimeType"] != "image/png" {
+		t.Errorf("expected one embedded png, got %v", images)
+	}
+
+	prim := doc["meshes"].([]any)[0].(map[string]any)["primitives"].([]any)[0].(map[string]any)
+	attrs := prim["attributes"].(map[string]any)
+	for _, name := range []string{"POSITION", "NORMAL", "TEXCOORD_0"} {
+		if _, ok := attrs[name]; !ok {
+			t.Errorf("expected %s attribute", name)
+		}
+	}
+
+	// The quad lies in the z=0 plane, after the Y up conversion it lies in y=0
+	pos := doc["accessors"].([]any)[int(attrs["POSITION"].(float64))].(map[string]any)
+	min, max := pos["min"].([]any), pos["max"].([]any)
+	if min[1].(float64) != 0 || max[1].(float64) != 0 || min[2].(float64) != -1 || max[2].(float64) != 0 {
+		t.Errorf("unexpected bounds min=%v max=%v", min, max)
+	}
+}
+
+func TestFromOBJ_TexturePaths(t *testing.T) {
+	texture, err := filepath.Abs("testdata/textures/quad_map_Kd.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := os.ReadFile("testdata/quad.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Texture paths written on Windows and absolute ones resolve like they
+	// do for the OBJ export
+	for _, ref := range []string{`..\testdata\textures\quad_map_Kd.png`, texture} {
+		dir := filepath.Join(t.TempDir(), "mesh")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Dir(filepath.Dir(texture)), filepath.Join(filepath.Dir(dir), "testdata")); err != nil {
+			t.Fatal(err)
+		}
+		mtl := "newmtl material_00\nKd 1 1 1\nmap_Kd " + ref + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "quad.mtl"), []byte(mtl), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "quad.obj"), obj, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		mesh, err := gltf.FromOBJ(filepath.Join(dir, "quad.obj"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", ref, err)
+		}
+		if m := mesh.Primitives[0].Material; m == nil || m.Texture == nil {
+			t.Errorf("%s: expected the texture to be loaded", ref)
+		}
+	}
+}
+
+func TestFromOBJ_MissingNormals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quad.obj")
+	// The second face has no normals and the first a degenerate one
+	data := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvn 0 0 2\nvn 0 0 0\nf 1//1 2//1 3//2\nf 1 3 4\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mesh, err := gltf.FromOBJ(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, prim := range mesh.Primitives {
+		for i, n := range prim.Normals {
+			if n != [3]float32{0, 0, 1} {
+				t.Errorf("expected the unit normal of the quad for vertex %d, got %v", i, n)
+			}
+		}
+	}
+}
+
+func TestExport_PLY(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "final.glb")
+
+	if err := gltf.Export("testdata/colored.ply", dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := gltf.ValidateFile(dst); err != nil {
+		t.Fatalf("exported glb is invalid: %v", err)
+	}
+
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read glb: %v", err)
+	}
+	doc := readJSON(t, data)
+
+	prim := doc["meshes"].([]any)[0].(map[string]any)["primitives"].([]any)[0].(map[string]any)
+	if _, ok := prim["attributes"].(map[string]any)["COLOR_0"]; !ok {
+		t.Errorf("expected vertex colors to be exported")
+	}
+
+	// The quad is split into two triangles
+	indices := doc["accessors"].([]any)[int(prim["indices"].(float64))].(map[string]any)
+	if indices["count"].(float64) != 6 {
+		t.Errorf("expected 6 indices, got %v", indices["count"])
+	}
+}
+
+func TestCount(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "final.glb")
+
+	if err := gltf.Export("testdata/colored.ply", dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vertices, triangles, err := gltf.Count(dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vertices != 4 || triangles != 2 {
+		t.Errorf("expected 4 vertices and 2 triangles, got %d and %d", vertices, triangles)
+	}
+
+	if _, _, err := gltf.Count("testdata/quad.obj"); err == nil {
+		t.Error("expected an error for a file that is not a glb")
+	}
+}
+
+func TestValidate_Rejects(t *testing.T) {
+	mesh := &gltf.Mesh{
+		Name: "broken",
+		Primitives: []*gltf.Primitive{{
+			Positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			Indices:   []uint32{0, 1, 2},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := gltf.EncodeGLB(&buf, mesh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := gltf.Validate(buf.Bytes()); err != nil {
+		t.Fatalf("expected valid glb, got %v", err)
+	}
+
+	// Corrupt the asset version in place, keeping the chunk length unchanged
+	data := bytes.Replace(buf.Bytes(), []byte(`"version":"2.0"`), []byte(`"version":"1.0"`), 1)
+	if err := gltf.Validate(data); err == nil || !strings.Contains(err.Error(), "asset.version") {
+		t.Errorf("expected asset.version error, got %v", err)
+	}
+
+	// Point the last index past the end of the vertex data
+	data = bytes.Clone(buf.Bytes())
+	binary.LittleEndian.PutUint32(data[len(data)-4:], 7)
+	if err := gltf.Validate(data); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("expected index out of range error, got %v", err)
+	}
+
+	if err := gltf.EncodeGLB(&buf, &gltf.Mesh{}); err == nil {
+		t.Errorf("expected error encoding an empty mesh")
+	}
+}
+
+// TestExport_Validator checks the exported files with the Khronos glTF
+// validator, which implements the whole specification and its JSON schema
+func TestExport_Validator(t *testing.T) {
+	validator, err := exec.LookPath("gltf_validator")
+	if err != nil {
+		t.Skip("gltf_validator is not installed")
+	}
+
+	for _, src := range []string{"testdata/quad.obj", "testdata/colored.ply"} {
+		dst := filepath.Join(t.TempDir(), "final.glb")
+		if err := gltf.Export(src, dst); err != nil {
+			t.Fatalf("%s: unexpected error: %v", src, err)
+		}
+
+		out, err := exec.Command(validator, "-o", dst).Output()
+		var report struct {
+			Issues struct {
+				NumErrors   int `json:"numErrors"`
+				NumWarnings int `json:"numWarnings"`
+				Messages    []struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+					Pointer string `json:"pointer"`
+				} `json:"messages"`
+			} `json:"issues"`
+		}
+		if jsonErr := json.Unmarshal(out, &report); jsonErr != nil {
+			t.Fatalf("%s: failed to read the validation report: %v %v", src, err, jsonErr)
+		}
+		if report.Issues.NumErrors > 0 || report.Issues.NumWarnings > 0 {
+			t.Errorf("%s: export is not valid glTF: %+v", src, report.Issues.Messages)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package gltf
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/obj"
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+)
+
+// Image is an encoded texture embedded in the GLB
+type Image struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+// Material is the subset of a PBR material photogrammetry meshes need
+type Material struct {
+	Name      string
+	BaseColor [4]float64
+	Texture   *Image
+}
+
+// Primitive is an indexed triangle list drawn with a single material
+type Primitive struct {
+	Positions [][3]float32
+	Normals   [][3]float32
+	UVs       [][2]float32
+	Colors    [][3]uint8
+	Indices   []uint32
+	Material  *Material
+}
+
+// Mesh is a textured triangle mesh ready to be encoded as glTF
+type Mesh struct {
+	Name       string
+	Primitives []*Primitive
+}
+
+// ConvertZUpToYUp rotates the mesh from the Z up frame used by the
+// reconstruction to the Y up frame required by glTF
+func (m *Mesh) ConvertZUpToYUp() {
+	for _, p := range m.Primitives {
+		for i, v := range p.Positions {
+			p.Positions[i] = [3]float32{v[0], v[2], -v[1]}
+		}
+		for i, n := range p.Normals {
+			p.Normals[i] = [3]float32{n[0], n[2], -n[1]}
+		}
+	}
+}
+
+// FromOBJ loads a validated OBJ file with its materials and textures. Polygons
+// are triangulated and faces are grouped into one primitive per material.
+func FromOBJ(path string) (*Mesh, error) {
+	model, err := obj.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	libs, err := obj.Validate(model)
+	if err != nil {
+		return nil, err
+	}
+
+	materials := map[string]*Material{}
+	for _, lib := range libs {
+		for _, m := range lib.Materials {
+			mat := &Material{
+				Name:      m.Name,
+				BaseColor: [4]float64{m.Diffuse[0], m.Diffuse[1], m.Diffuse[2], 1},
+			}
+			if tex, ok := m.Maps["map_Kd"]; ok {
+				img, err := loadImage(obj.ResolvePath(filepath.Dir(lib.Path), tex))
+				if err != nil {
+					return nil, err
+				}
+				// Textures are modulated by the base color, so keep it white
+				mat.BaseColor = [4]float64{1, 1, 1, 1}
+				mat.Texture = img
+			}
+			materials[m.Name] = mat
+		}
+	}
+
+	mesh := &Mesh{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	builders := map[string]*objBuilder{}
+	var order []string
+
+	for _, face := range model.Faces {
+		b, ok := builders[face.Material]
+		if !ok {
+			b = &objBuilder{
+				model:    model,
+				prim:     &Primitive{Material: materials[face.Material]},
+				vertices: map[obj.FaceVertex]uint32{},
+			}
+			builders[face.Material] = b
+			order = append(order, face.Material)
+		}
+
+		// Fan triangulation is exact for the convex polygons OBJ exporters write
+		for i := 1; i+1 < len(face.Vertices); i++ {
+			b.add(face.Vertices[0])
+			b.add(face.Vertices[i])
+			b.add(face.Vertices[i+1])
+		}
+	}
+
+	for _, name := range order {
+		b := builders[name]
+		prim := b.prim
+		switch {
+		case len(model.Normals) == 0:
+			prim.Normals = computeNormals(prim.Positions, prim.Indices)
+		case len(b.missingNormals) > 0:
+			// glTF requires unit normals, compute those the OBJ lacks
+			computed := computeNormals(prim.Positions, prim.Indices)
+			for _, idx := range b.missingNormals {
+				prim.Normals[idx] = computed[idx]
+			}
+		}
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+
+	return mesh, nil
+}
+
+type objBuilder struct {
+	model    *obj.Model
+	prim     *Primitive
+	vertices map[obj.FaceVertex]uint32
+	// missingNormals are the vertices without a usable normal in the OBJ
+	missingNormals []uint32
+}
+
+// add appends the index of fv, creating a new vertex the first time a
+// position, texture coordinate and normal combination is seen
+func (b *objBuilder) add(fv obj.FaceVertex) {
+	idx, ok := b.vertices[fv]
+	if !ok {
+		idx = uint32(len(b.prim.Positions))
+		b.vertices[fv] = idx
+
+		p := b.model.Positions[fv.Position]
+		b.prim.Positions = append(b.prim.Positions, [3]float32{float32(p[0]), float32(p[1]), float32(p[2])})
+
+		if len(b.model.TexCoords) > 0 {
+			var uv [2]float32
+			if fv.TexCoord >= 0 {
+				t := b.model.TexCoords[fv.TexCoord]
+				// OBJ puts the texture origin at the bottom left, glTF at the top left
+				uv = [2]float32{float32(t[0]), float32(1 - t[1])}
+			}
+			b.prim.UVs = append(b.prim.UVs, uv)
+		}
+
+		if len(b.model.Normals) > 0 {
+			var n [3]float32
+			l := 0.0
+			if fv.Normal >= 0 {
+				v := b.model.Normals[fv.Normal]
+				l = math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+				if l > 0 {
+					n = [3]float32{float32(v[0] / l), float32(v[1] / l), float32(v[2] / l)}
+				}
+			}
+			if l == 0 {
+				b.missingNormals = append(b.missingNormals, idx)
+			}
+			b.prim.Normals = append(b.prim.Normals, n)
+		}
+	}
+	b.prim.Indices = append(b.prim.Indices, idx)
+}
+
+// FromPLY loads a PLY mesh as written by OpenMVS. Per face texture
+// coordinates and TextureFile comments are honoured, and vertex colors are
+// kept when the mesh is untextured.
+func FromPLY(path string) (*Mesh, error) {
+	file, err := ply.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := file.Positions()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	faces := file.Faces()
+	if len(faces) == 0 {
+		return nil, fmt.Errorf("%s: mesh has no faces", path)
+	}
+
+	normals := file.Normals()
+	colors := file.Colors()
+	texcoords := file.FaceTexCoords()
+	texnumbers := file.FaceTextures()
+
+	var materials []*Material
+	for _, tex := range file.TextureFiles() {
+		img, err := loadImage(obj.ResolvePath(filepath.Dir(path), tex))
+		if err != nil {
+			return nil, err
+		}
+		materials = append(materials, &Material{
+			Name:      strings.TrimSuffix(tex, filepath.Ext(tex)),
+			BaseColor: [4]float64{1, 1, 1, 1},
+			Texture:   img,
+		})
+	}
+
+	type key struct {
+		vertex int
+		u, v   float64
+	}
+
+	mesh := &Mesh{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	prims := map[int]*Primitive{}
+	lookup := map[int]map[key]uint32{}
+	var order []int
+
+	for f, face := range faces {
+		group := 0
+		if texnumbers != nil {
+			group = texnumbers[f]
+		}
+
+		prim, ok := prims[group]
+		if !ok {
+			prim = &Primitive{}
+			if group >= 0 && group < len(materials) {
+				prim.Material = materials[group]
+			}
+			prims[group] = prim
+			lookup[group] = map[key]uint32{}
+			order = append(order, group)
+		}
+
+		corner := func(c int) (uint32, error) {
+			vi := face[c]
+			if vi < 0 || vi >= len(positions) {
+				return 0, fmt.Errorf("%s: face %d references missing vertex %d", path, f, vi)
+			}
+
+			k := key{vertex: vi}
+			hasUV := texcoords != nil && len(texcoords[f]) >= 2*len(face)
+			if hasUV {
+				k.u, k.v = texcoords[f][2*c], texcoords[f][2*c+1]
+			}
+
+			if idx, ok := lookup[group][k]; ok {
+				return idx, nil
+			}
+
+			idx := uint32(len(prim.Positions))
+			lookup[group][k] = idx
+
+			p := positions[vi]
+			prim.Positions = append(prim.Positions, [3]float32{float32(p[0]), float32(p[1]), float32(p[2])})
+			if normals != nil {
+				n := normals[vi]
+				prim.Normals = append(prim.Normals, [3]float32{float32(n[0]), float32(n[1]), float32(n[2])})
+			}
+			if hasUV {
+				prim.UVs = append(prim.UVs, [2]float32{float32(k.u), float32(1 - k.v)})
+			} else if colors != nil {
+				prim.Colors = append(prim.Colors, colors[vi])
+			}
+			return idx, nil
+		}
+
+		for i := 1; i+1 < len(face); i++ {
+			for _, c := range []int{0, i, i + 1} {
+				idx, err := corner(c)
+				if err != nil {
+					return nil, err
+				}
+				prim.Indices = append(prim.Indices, idx)
+			}
+		}
+	}
+
+	for _, group := range order {
+		prim := prims[group]
+		if len(prim.UVs) > 0 && len(prim.UVs) != len(prim.Positions) {
+			return nil, fmt.Errorf("%s: texture coordinates are missing for some faces", path)
+		}
+		if len(prim.Colors) > 0 && len(prim.Colors) != len(prim.Positions) {
+			prim.Colors = nil
+		}
+		if normals == nil {
+			prim.Normals = computeNormals(prim.Positions, prim.Indices)
+		}
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+
+	return mesh, nil
+}
+
+// computeNormals returns area weighted vertex normals for an indexed triangle list
+func computeNormals(positions [][3]float32, indices []uint32) [][3]float32 {
+	acc := make([][3]float64, len(positions))
+	for i := 0; i+2 < len(indices); i += 3 {
+		a, b, c := positions[indices[i]], positions[indices[i+1]], positions[indices[i+2]]
+		e1 := [3]float64{float64(b[0] - a[0]), float64(b[1] - a[1]), float64(b[2] - a[2])}
+		e2 := [3]float64{float64(c[0] - a[0]), float64(c[1] - a[1]), float64(c[2] - a[2])}
+		n := [3]float64{
+			e1[1]*e2[2] - e1[2]*e2[1],
+			e1[2]*e2[0] - e1[0]*e2[2],
+			e1[0]*e2[1] - e1[1]*e2[0],
+		}
+		for _, idx := range indices[i : i+3] {
+			acc[idx][0] += n[0]
+			acc[idx][1] += n[1]
+			acc[idx][2] += n[2]
+		}
+	}
+
+	out := make([][3]float32, len(positions))
+	for i, n := range acc {
+		l := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+		if l == 0 {
+			// Unreferenced or degenerate vertices still need a unit normal
+			out[i] = [3]float32{0, 0, 1}
+			continue
+		}
+		out[i] = [3]float32{float32(n[0] / l), float32(n[1] / l), float32(n[2] / l)}
+	}
+	return out
+}
+
+func loadImage(path string) (*Image, error) {
+	var mime string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		mime = "image/png"
+	case ".jpg", ".jpeg":
+		mime = "image/jpeg"
+	default:
+		return nil, fmt.Errorf("texture %s: glTF only supports PNG and JPEG images", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read texture %s: %w", path, err)
+	}
+
+	return &Image{
+		Name:     strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		MimeType: mime,
+		Data:     data,
+	}, nil
+}
@@ -0,0 +1,388 @@
+package gltf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// componentSizes are the byte sizes of the accessor component types allowed by the schema
+var componentSizes = map[int]int{
+	5120: 1, 5121: 1, 5122: 2, 5123: 2, 5125: 4, 5126: 4,
+}
+
+// typeComponents are the component counts of the accessor types allowed by the schema
+var typeComponents = map[string]int{
+	"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT2": 4, "MAT3": 9, "MAT4": 16,
+}
+
+// ValidateFile validates the GLB file at path
+func ValidateFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read glb file %s: %w", path, err)
+	}
+	return Validate(data)
+}
+
+// Validate checks the GLB container and the parts of its JSON chunk the
+// exporter writes: required properties, enumerated values, index references
+// and buffer ranges. It also checks that index accessors stay within the
+// vertex count and that POSITION accessors carry correct bounds. It is a
+// sanity check of the export, not a full glTF 2.0 validator.
+func Validate(data []byte) error {
+	if len(data) < 20 {
+		return fmt.Errorf("glb is too short")
+	}
+
+	le := binary.LittleEndian
+	if le.Uint32(data[0:]) != glbMagic {
+		return fmt.Errorf("invalid glb magic")
+	}
+	if le.Uint32(data[4:]) != glbVersion {
+		return fmt.Errorf("unsupported glb version %d", le.Uint32(data[4:]))
+	}
+	if int(le.Uint32(data[8:])) != len(data) {
+		return fmt.Errorf("glb length %d does not match file size %d", le.Uint32(data[8:]), len(data))
+	}
+
+	var js, bin []byte
+	for off := 12; off < len(data); {
+		if off+8 > len(data) {
+			return fmt.Errorf("truncated chunk header at %d", off)
+		}
+		length := int(le.Uint32(data[off:]))
+		kind := le.Uint32(data[off+4:])
+		if length%4 != 0 {
+			return fmt.Errorf("chunk at %d is not 4 byte aligned", off)
+		}
+		if off+8+length > len(data) {
+			return fmt.Errorf("chunk at %d overruns the file", off)
+		}
+		chunk := data[off+8 : off+8+length]
+		switch {
+		case kind == chunkJSON && js == nil && off == 12:
+			js = chunk
+		case kind == chunkBIN && bin == nil && js != nil:
+			bin = chunk
+		default:
+			return fmt.Errorf("unexpected chunk 0x%08x at %d", kind, off)
+		}
+		off += 8 + length
+	}
+	if js == nil {
+		return fmt.Errorf("missing JSON chunk")
+	}
+
+	var doc document
+	if err := json.Unmarshal(js, &doc); err != nil {
+		return fmt.Errorf("invalid gltf json: %w", err)
+	}
+
+	v := &validator{doc: &doc, bin: bin}
+	v.validate()
+	if len(v.problems) > 0 {
+		return fmt.Errorf("invalid gltf: %s", strings.Join(v.problems, "; "))
+	}
+	return nil
+}
+
+type validator struct {
+	doc      *document
+	bin      []byte
+	problems []string
+}
+
+func (v *validator) fail(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) validate() {
+	d := v.doc
+
+	if d.Asset.Version != "2.0" {
+		v.fail("asset.version must be 2.0, got %q", d.Asset.Version)
+	}
+
+	if d.Scene < 0 || d.Scene >= len(d.Scenes) {
+		v.fail("scene %d does not exist", d.Scene)
+	}
+	for i, s := range d.Scenes {
+		for _, n := range s.Nodes {
+			if n < 0 || n >= len(d.Nodes) {
+				v.fail("scenes[%d] references missing node %d", i, n)
+			}
+		}
+	}
+	for i, n := range d.Nodes {
+		if n.Mesh != nil && (*n.Mesh < 0 || *n.Mesh >= len(d.Meshes)) {
+			v.fail("nodes[%d] references missing mesh %d", i, *n.Mesh)
+		}
+	}
+
+	for i, b := range d.Buffers {
+		if b.ByteLength < 1 {
+			v.fail("buffers[%d].byteLength must be at least 1", i)
+		}
+	}
+	if len(d.Buffers) > 0 && d.Buffers[0].ByteLength > len(v.bin) {
+		v.fail("buffers[0].byteLength %d exceeds BIN chunk of %d bytes", d.Buffers[0].ByteLength, len(v.bin))
+	}
+
+	for i, bv := range d.BufferViews {
+		if bv.Buffer < 0 || bv.Buffer >= len(d.Buffers) {
+			v.fail("bufferViews[%d] references missing buffer %d", i, bv.Buffer)
+			continue
+		}
+		if bv.ByteLength < 1 || bv.ByteOffset < 0 {
+			v.fail("bufferViews[%d] has an invalid range", i)
+		}
+		if bv.ByteOffset+bv.ByteLength > d.Buffers[bv.Buffer].ByteLength {
+			v.fail("bufferViews[%d] overruns buffer %d", i, bv.Buffer)
+		}
+		if bv.Target != 0 && bv.Target != arrayBuffer && bv.Target != elementArray {
+			v.fail("bufferViews[%d].target %d is not allowed", i, bv.Target)
+		}
+	}
+
+	for i, a := range d.Accessors {
+		size, ok := componentSizes[a.ComponentType]
+		if !ok {
+			v.fail("accessors[%d].componentType %d is not allowed", i, a.ComponentType)
+			continue
+		}
+		comps, ok := typeComponents[a.Type]
+		if !ok {
+			v.fail("accessors[%d].type %q is not allowed", i, a.Type)
+			continue
+		}
+		if a.Count < 1 {
+			v.fail("accessors[%d].count must be at least 1", i)
+		}
+		if a.BufferView < 0 || a.BufferView >= len(d.BufferViews) {
+			v.fail("accessors[%d] references missing bufferView %d", i, a.BufferView)
+			continue
+		}
+		bv := d.BufferViews[a.BufferView]
+		if bv.ByteOffset%size != 0 {
+			v.fail("accessors[%d] is not aligned to its component size", i)
+		}
+		if a.Count*comps*size > bv.ByteLength {
+			v.fail("accessors[%d] overruns bufferView %d", i, a.BufferView)
+		}
+		if (len(a.Min) != 0 && len(a.Min) != comps) || (len(a.Max) != 0 && len(a.Max) != comps) {
+			v.fail("accessors[%d] min/max must have %d components", i, comps)
+		}
+	}
+
+	for i, m := range d.Meshes {
+		if len(m.Primitives) == 0 {
+			v.fail("meshes[%d] has no primitives", i)
+		}
+		for j, p := range m.Primitives {
+			v.primitive(fmt.Sprintf("meshes[%d].primitives[%d]", i, j), p)
+		}
+	}
+
+	for i, m := range d.Materials {
+		for j, c := range m.PbrMetallicRoughness.BaseColorFactor {
+			if c < 0 || c > 1 {
+				v.fail("materials[%d].baseColorFactor[%d] is outside [0, 1]", i, j)
+			}
+		}
+		if t := m.PbrMetallicRoughness.BaseColorTexture; t != nil && (t.Index < 0 || t.Index >= len(d.Textures)) {
+			v.fail("materials[%d] references missing texture %d", i, t.Index)
+		}
+	}
+
+	for i, t := range d.Textures {
+		if t.Source < 0 || t.Source >= len(d.Images) {
+			v.fail("textures[%d] references missing image %d", i, t.Source)
+		}
+		if t.Sampler < 0 || t.Sampler >= len(d.Samplers) {
+			v.fail("textures[%d] references missing sampler %d", i, t.Sampler)
+		}
+	}
+
+	for i, img := range d.Images {
+		if img.MimeType != "image/png" && img.MimeType != "image/jpeg" {
+			v.fail("images[%d].mimeType %q is not allowed", i, img.MimeType)
+		}
+		if img.BufferView < 0 || img.BufferView >= len(d.BufferViews) {
+			v.fail("images[%d] references missing bufferView %d", i, img.BufferView)
+		}
+	}
+}
+
+func (v *validator) primitive(path string, p primitive) {
+	d := v.doc
+
+	if p.Mode < 0 || p.Mode > 6 {
+		v.fail("%s.mode %d is not allowed", path, p.Mode)
+	}
+	if p.Material != nil && (*p.Material < 0 || *p.Material >= len(d.Materials)) {
+		v.fail("%s references missing material %d", path, *p.Material)
+	}
+
+	pos, ok := p.Attributes["POSITION"]
+	if !ok || pos < 0 || pos >= len(d.Accessors) {
+		v.fail("%s has no valid POSITION attribute", path)
+		return
+	}
+
+	count := d.Accessors[pos].Count
+	for name, idx := range p.Attributes {
+		if idx < 0 || idx >= len(d.Accessors) {
+			v.fail("%s attribute %s references missing accessor %d", path, name, idx)
+			continue
+		}
+		a := d.Accessors[idx]
+		if a.Count != count {
+			v.fail("%s attribute %s has %d elements, POSITION has %d", path, name, a.Count, count)
+		}
+		if a.BufferView >= 0 && a.BufferView < len(d.BufferViews) && d.BufferViews[a.BufferView].Target != arrayBuffer {
+			v.fail("%s attribute %s must use an ARRAY_BUFFER bufferView", path, name)
+		}
+	}
+
+	if t, ok := p.Attributes["TEXCOORD_0"]; ok && t >= 0 && t < len(d.Accessors) && d.Accessors[t].Type != "VEC2" {
+		v.fail("%s TEXCOORD_0 must be VEC2", path)
+	}
+
+	if p.Material != nil && *p.Material >= 0 && *p.Material < len(d.Materials) {
+		if d.Materials[*p.Material].PbrMetallicRoughness.BaseColorTexture != nil {
+			if _, ok := p.Attributes["TEXCOORD_0"]; !ok {
+				v.fail("%s samples a texture but has no TEXCOORD_0", path)
+			}
+		}
+	}
+
+	v.positionBounds(path, d.Accessors[pos])
+
+	if p.Indices != nil {
+		if *p.Indices < 0 || *p.Indices >= len(d.Accessors) {
+			v.fail("%s references missing indices accessor %d", path, *p.Indices)
+			return
+		}
+		v.indices(path, d.Accessors[*p.Indices], count)
+	}
+}
+
+// positionBounds checks that POSITION min and max are present and match the data
+func (v *validator) positionBounds(path string, a accessor) {
+	if a.Type != "VEC3" || a.ComponentType != componentFloat {
+		v.fail("%s POSITION must be a float VEC3", path)
+		return
+	}
+	if len(a.Min) != 3 || len(a.Max) != 3 {
+		v.fail("%s POSITION must define min and max", path)
+		return
+	}
+
+	data := v.view(a.BufferView)
+	if data == nil || len(data) < a.Count*12 {
+		return
+	}
+
+	for i := 0; i < a.Count; i++ {
+		for c := 0; c < 3; c++ {
+			x := float64(math.Float32frombits(binary.LittleEndian.Uint32(data[(i*3+c)*4:])))
+			if x < a.Min[c] || x > a.Max[c] {
+				v.fail("%s POSITION %d lies outside min/max", path, i)
+				return
+			}
+		}
+	}
+}
+
+// indices checks that an index accessor is an unsigned scalar whose values
+// address existing vertices
+func (v *validator) indices(path string, a accessor, vertices int) {
+	if a.Type != "SCALAR" || (a.ComponentType != 5121 && a.ComponentType != 5123 && a.ComponentType != componentUnsignedInt) {
+		v.fail("%s indices must be an unsigned integer SCALAR", path)
+		return
+	}
+	data := v.view(a.BufferView)
+	if data == nil {
+		return
+	}
+	if v.doc.BufferViews[a.BufferView].Target != elementArray {
+		v.fail("%s indices must use an ELEMENT_ARRAY_BUFFER bufferView", path)
+	}
+
+	size := componentSizes[a.ComponentType]
+	if len(data) < a.Count*size {
+		return
+	}
+	for i := 0; i < a.Count; i++ {
+		var idx int
+		switch size {
+		case 1:
+			idx = int(data[i])
+		case 2:
+			idx = int(binary.LittleEndian.Uint16(data[i*2:]))
+		default:
+			idx = int(binary.LittleEndian.Uint32(data[i*4:]))
+		}
+		if idx >= vertices {
+			v.fail("%s index %d out of range for %d vertices", path, idx, vertices)
+			return
+		}
+	}
+}
+
+// view returns the bytes of a buffer view, or nil if its range is invalid
+func (v *validator) view(idx int) []byte {
+	if idx < 0 || idx >= len(v.doc.BufferViews) {
+		return nil
+	}
+	bv := v.doc.BufferViews[idx]
+	if bv.Buffer != 0 || bv.ByteOffset < 0 || bv.ByteLength < 0 || bv.ByteOffset+bv.ByteLength > len(v.bin) {
+		return nil
+	}
+	return v.bin[bv.ByteOffset : bv.ByteOffset+bv.ByteLength]
+}
+
+// Count returns the number of vertices and triangles of the meshes in the GLB
+// file at path
+func Count(path string) (vertices, triangles int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read glb file %s: %w", path, err)
+	}
+
+	le := binary.LittleEndian
+	if len(data) < 20 || le.Uint32(data[0:]) != glbMagic || le.Uint32(data[16:]) != chunkJSON {
+		return 0, 0, fmt.Errorf("%s is not a glb file", path)
+	}
+	length := int(le.Uint32(data[12:]))
+	if 20+length > len(data) {
+		return 0, 0, fmt.Errorf("%s has a truncated JSON chunk", path)
+	}
+
+	var doc document
+	if err := json.Unmarshal(data[20:20+length], &doc); err != nil {
+		return 0, 0, fmt.Errorf("invalid gltf json: %w", err)
+	}
+
+	accessorCount := func(i int) int {
+		if i < 0 || i >= len(doc.Accessors) {
+			return 0
+		}
+		return doc.Accessors[i].Count
+	}
+	for _, m := range doc.Meshes {
+		for _, p := range m.Primitives {
+			if pos, ok := p.Attributes["POSITION"]; ok {
+				vertices += accessorCount(pos)
+			}
+			if p.Indices != nil {
+				triangles += accessorCount(*p.Indices) / 3
+			}
+		}
+	}
+	return vertices, triangles, nil
+}
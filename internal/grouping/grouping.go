@@ -0,0 +1,306 @@
+package grouping
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/exif"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+// Grouping rules
+const (
+	// GroupByCamera groups images by EXIF make, model and serial number
+	GroupByCamera = "camera"
+	// GroupByFolder groups images by the subdirectory of the input they are
+	// in. Each subdirectory is treated as one camera of a rig and images with
+	// the same file name in different subdirectories as one rig shot.
+	GroupByFolder = "folder"
+	// GroupByFile groups images by the patterns of a mapping file
+	GroupByFile = "file"
+)
+
+// Intrinsic handling within a group
+const (
+	// IntrinsicsShared gives all images of a group one intrinsic
+	IntrinsicsShared = "shared"
+	// IntrinsicsSeparate gives every image of a group its own intrinsic
+	IntrinsicsSeparate = "separate"
+)
+
+// imageExtensions are the files staged from subdirectories
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".tif", ".tiff"}
+
+// Options select how images are grouped and how intrinsics are shared
+type Options struct {
+	// GroupBy is one of the GroupBy constants, grouping is off when empty
+	GroupBy string
+	// File maps images to groups for GroupByFile, see ParseFile
+	File string
+	// Intrinsics is one of the Intrinsics constants, shared when empty
+	Intrinsics string
+}
+
+// Enabled reports whether images are grouped
+func (o Options) Enabled() bool {
+	return o.GroupBy != ""
+}
+
+// Validate reports missing or invalid options
+func (o Options) Validate() error {
+	switch o.GroupBy {
+	case "", GroupByCamera, GroupByFolder:
+		if o.File != "" {
+			return fmt.Errorf("a grouping file needs the %s grouping", GroupByFile)
+		}
+	case GroupByFile:
+		if o.File == "" {
+			return fmt.Errorf("the %s grouping needs a mapping file", GroupByFile)
+		}
+	default:
+		return fmt.Errorf("unknown grouping %q, expected camera, folder or file", o.GroupBy)
+	}
+
+	switch o.Intrinsics {
+	case "", IntrinsicsShared, IntrinsicsSeparate:
+	default:
+		return fmt.Errorf("unknown intrinsic handling %q, expected shared or separate", o.Intrinsics)
+	}
+	return nil
+}
+
+// Rule assigns images whose file name matches Pattern to Group
+type Rule struct {
+	Pattern string
+	Group   string
+}
+
+// ParseFile reads a mapping file with one pattern,group row per rule. The
+// pattern is a file name or a filepath.Match glob, and the first matching
+// rule wins. Empty lines and lines starting with # are ignored.
+func ParseFile(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open grouping file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	rules, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Parse reads rules in the format described by ParseFile
+func Parse(r io.Reader) ([]Rule, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rules []Rule
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if len(record) != 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("line %d: expected pattern,group", line)
+		}
+		if _, err := filepath.Match(record[0], ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %q", line, record[0])
+		}
+		rules = append(rules, Rule{Pattern: record[0], Group: record[1]})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules given")
+	}
+	return rules, nil
+}
+
+// Stage links the images of dir and of its direct subdirectories into
+// staging, since OpenMVG only lists the top level of its input. Images of a
+// subdirectory are linked as <subdirectory>_<name>.
+func Stage(dir, staging string) (int, error) {
+	if err := os.MkdirAll(staging, 0o755); err != nil {
+		return 0, err
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	link := func(src, name string) error {
+		if !slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(name))) {
+			return nil
+		}
+		count++
+		return os.Symlink(src, filepath.Join(staging, name))
+	}
+
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			if err := link(filepath.Join(abs, e.Name()), e.Name()); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		sub, err := os.ReadDir(filepath.Join(abs, e.Name()))
+		if err != nil {
+			return 0, err
+		}
+		for _, f := range sub {
+			if f.IsDir() {
+				continue
+			}
+			if err := link(filepath.Join(abs, e.Name(), f.Name()), e.Name()+"_"+f.Name()); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// Assignment places one view in a group. Rig and SubPose are -1 unless the
+// view belongs to a rig.
+type Assignment struct {
+	ViewID  uint32
+	Group   string
+	Camera  exif.Camera
+	Rig     int
+	SubPose int
+}
+
+// Assign groups the views of an image listing whose images are in dir
+func Assign(sfm *sfmdata.SfMData, dir string, opts Options) ([]Assignment, error) {
+	var rules []Rule
+	if opts.GroupBy == GroupByFile {
+		var err error
+		if rules, err = ParseFile(opts.File); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Assignment, 0, len(sfm.Views))
+	for _, v := range sfm.Views {
+		path := filepath.Join(dir, v.LocalPath, v.Filename)
+		// Images OpenMVG listed but without readable EXIF data, such as
+		// PNGs, are from an unknown camera
+		camera, _ := exif.ReadCamera(path)
+		a := Assignment{ViewID: v.ID, Camera: camera, Rig: -1, SubPose: -1}
+
+		switch opts.GroupBy {
+		case GroupByCamera:
+			a.Group = cameraName(camera)
+		case GroupByFolder:
+			// Staged images of a subdirectory are named <subdirectory>_<name>
+			a.Group = "."
+			if target, err := os.Readlink(path); err == nil {
+				sub := filepath.Base(filepath.Dir(target))
+				if v.Filename == sub+"_"+filepath.Base(target) {
+					a.Group = sub
+				}
+			}
+		case GroupByFile:
+			for _, r := range rules {
+				if ok, _ := filepath.Match(r.Pattern, v.Filename); ok {
+					a.Group = r.Group
+					break
+				}
+			}
+			if a.Group == "" {
+				return nil, fmt.Errorf("image %s matches no grouping rule", v.Filename)
+			}
+		}
+		out = append(out, a)
+	}
+
+	if opts.GroupBy == GroupByFolder {
+		assignRigs(sfm, out)
+	}
+	return out, nil
+}
+
+// Rigs returns the rig and sub-pose of the views that belong to a rig, keyed
+// by view id
+func Rigs(assignments []Assignment) map[uint32]sfmdata.ViewRig {
+	rigs := map[uint32]sfmdata.ViewRig{}
+	for _, a := range assignments {
+		if a.Rig >= 0 && a.SubPose >= 0 {
+			rigs[a.ViewID] = sfmdata.ViewRig{Rig: uint32(a.Rig), SubPose: uint32(a.SubPose)}
+		}
+	}
+	return rigs
+}
+
+// assignRigs numbers the subdirectories as sub-poses and the file names
+// shared across subdirectories as rig shots
+func assignRigs(sfm *sfmdata.SfMData, assignments []Assignment) {
+	var groups []string
+	for _, a := range assignments {
+		if a.Group != "." && !slices.Contains(groups, a.Group) {
+			groups = append(groups, a.Group)
+		}
+	}
+	if len(groups) < 2 {
+		return
+	}
+	sort.Strings(groups)
+
+	shots := map[string]int{}
+	var names []string
+	for i, a := range assignments {
+		if a.Group == "." {
+			continue
+		}
+		name := strings.TrimPrefix(sfm.Views[i].Filename, a.Group+"_")
+		if _, ok := shots[name]; !ok {
+			shots[name] = 0
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		shots[name] = i
+	}
+
+	for i := range assignments {
+		a := &assignments[i]
+		if a.Group == "." {
+			continue
+		}
+		a.SubPose = slices.Index(groups, a.Group)
+		a.Rig = shots[strings.TrimPrefix(sfm.Views[i].Filename, a.Group+"_")]
+	}
+}
+
+func cameraName(c exif.Camera) string {
+	var parts []string
+	for _, p := range []string{c.Make, c.Model, c.Serial} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return "unknown"
+	}
+	return strings.Join(parts, " ")
+}
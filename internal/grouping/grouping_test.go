@@ -0,0 +1,146 @@
+package grouping_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/grouping"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+// listing returns the views OpenMVG lists with -g 0, one intrinsic per view
+func listing(names ...string) *sfmdata.SfMData {
+	sfm := &sfmdata.SfMData{}
+	for i, name := range names {
+		sfm.Views = append(sfm.Views, sfmdata.View{
+			ID: uint32(i), Filename: name, Width: 64, Height: 48, IntrinsicID: uint32(i), PoseID: uint32(i),
+		})
+	}
+	return sfm
+}
+
+func TestAssign_Camera(t *testing.T) {
+	sfm := listing("a.jpg", "b.jpg", "c.jpg")
+	opts := grouping.Options{GroupBy: grouping.GroupByCamera}
+
+	assignments, err := grouping.Assign(sfm, "testdata/cameras", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var groups []string
+	for _, a := range assignments {
+		groups = append(groups, a.Group)
+	}
+	want := []string{"Canon Canon EOS 5D 1001", "Canon Canon EOS 5D 1001", "Canon Canon EOS 5D 1002"}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("expected groups %v, got %v", want, groups)
+	}
+
+	plan, report := grouping.Plan(sfm, assignments, opts)
+	if want := map[uint32]uint32{0: 0, 1: 0, 2: 2}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("expected shared plan %v, got %v", want, plan)
+	}
+	if len(report.Groups) != 2 || report.Groups[0].Intrinsics != 1 || len(report.Errors) != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	opts.Intrinsics = grouping.IntrinsicsSeparate
+	plan, _ = grouping.Plan(sfm, assignments, opts)
+	if want := map[uint32]uint32{0: 0, 1: 1, 2: 2}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("expected separate plan %v, got %v", want, plan)
+	}
+}
+
+func TestAssign_Folder(t *testing.T) {
+	staging := t.TempDir()
+	n, err := grouping.Stage("testdata/rig", staging)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 staged images, got %d", n)
+	}
+
+	sfm := listing("left_0001.jpg", "left_0002.jpg", "right_0001.jpg")
+	opts := grouping.Options{GroupBy: grouping.GroupByFolder}
+	assignments, err := grouping.Assign(sfm, staging, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []grouping.Assignment{
+		{ViewID: 0, Group: "left", Rig: 0, SubPose: 0},
+		{ViewID: 1, Group: "left", Rig: 1, SubPose: 0},
+		{ViewID: 2, Group: "right", Rig: 0, SubPose: 1},
+	}
+	for i, a := range assignments {
+		a.Camera = want[i].Camera
+		if a != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], a)
+		}
+	}
+
+	_, report := grouping.Plan(sfm, assignments, opts)
+	if report.Rigs == nil || report.Rigs.SubPoses != 2 || report.Rigs.Shots != 2 {
+		t.Fatalf("unexpected rig report %+v", report.Rigs)
+	}
+	if !reflect.DeepEqual(report.Rigs.Incomplete, []string{"0002.jpg"}) || len(report.Warnings) != 1 {
+		t.Errorf("expected shot 0002.jpg to be incomplete, got %+v", report)
+	}
+}
+
+func TestAssign_File(t *testing.T) {
+	sfm := listing("a.jpg", "b.jpg", "c.jpg")
+	sfm.Views[2].Width = 128
+
+	rules, err := grouping.Parse(strings.NewReader("# mapping\nc.jpg, wide\n*.jpg, main\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 2 || rules[0] != (grouping.Rule{Pattern: "c.jpg", Group: "wide"}) {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	// Sharing an intrinsic between image sizes is an error
+	opts := grouping.Options{GroupBy: grouping.GroupByFile, File: "testdata/mixed.csv"}
+	assignments, err := grouping.Assign(sfm, "testdata/cameras", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, report := grouping.Plan(sfm, assignments, opts)
+	if len(report.Groups) != 1 || len(report.Errors) != 1 {
+		t.Errorf("expected one group with an error, got %+v", report)
+	}
+
+	for _, input := range []string{"", "a.jpg\n", "[, main\n"} {
+		if _, err := grouping.Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	valid := []grouping.Options{
+		{},
+		{GroupBy: grouping.GroupByCamera, Intrinsics: grouping.IntrinsicsSeparate},
+		{GroupBy: grouping.GroupByFolder},
+		{GroupBy: grouping.GroupByFile, File: "groups.csv"},
+	}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", o, err)
+		}
+	}
+
+	invalid := []grouping.Options{
+		{GroupBy: "lens"},
+		{GroupBy: grouping.GroupByFile},
+		{GroupBy: grouping.GroupByCamera, File: "groups.csv"},
+		{Intrinsics: "per-image"},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%+v: expected error", o)
+		}
+	}
+}
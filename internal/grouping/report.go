@@ -0,0 +1,165 @@
+package grouping
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+// Report is the pre-flight check of a grouping, written to preflight.json
+// before features are computed
+type Report struct {
+	GroupBy    string        `json:"group_by"`
+	Intrinsics string        `json:"intrinsics"`
+	Groups     []GroupReport `json:"groups"`
+	Rigs       *RigReport    `json:"rigs,omitempty"`
+	Errors     []string      `json:"errors"`
+	Warnings   []string      `json:"warnings"`
+}
+
+// GroupReport describes one group of views
+type GroupReport struct {
+	Name  string `json:"name"`
+	Views int    `json:"views"`
+	// Intrinsics is the number of intrinsics the views of the group use
+	Intrinsics int      `json:"intrinsics"`
+	Cameras    []string `json:"cameras"`
+	// Sizes lists the image sizes of the group as WIDTHxHEIGHT
+	Sizes   []string `json:"sizes"`
+	SubPose int      `json:"sub_pose"`
+}
+
+// RigReport describes the rig found by folder grouping. The rig and sub-pose
+// of every view are written to sfm_data.json, but OpenMVG does not enforce
+// rig constraints in its reconstruction.
+type RigReport struct {
+	SubPoses int `json:"sub_poses"`
+	Shots    int `json:"shots"`
+	// Incomplete lists the shots missing an image of some sub-pose
+	Incomplete []string `json:"incomplete"`
+}
+
+// Plan returns the intrinsic of every view under the grouping and the
+// pre-flight report. Views without an intrinsic, for lack of a focal length,
+// keep none. The plan should not be applied when the report has errors.
+func Plan(sfm *sfmdata.SfMData, assignments []Assignment, opts Options) (map[uint32]uint32, *Report) {
+	report := &Report{
+		GroupBy:    opts.GroupBy,
+		Intrinsics: opts.Intrinsics,
+		Groups:     []GroupReport{},
+		Errors:     []string{},
+		Warnings:   []string{},
+	}
+	if report.Intrinsics == "" {
+		report.Intrinsics = IntrinsicsShared
+	}
+
+	views := map[uint32]sfmdata.View{}
+	for _, v := range sfm.Views {
+		views[v.ID] = v
+	}
+
+	var names []string
+	members := map[string][]Assignment{}
+	for _, a := range assignments {
+		if _, ok := members[a.Group]; !ok {
+			names = append(names, a.Group)
+		}
+		members[a.Group] = append(members[a.Group], a)
+	}
+	sort.Strings(names)
+
+	plan := map[uint32]uint32{}
+	for _, name := range names {
+		group := GroupReport{Name: name, Views: len(members[name]), Cameras: []string{}, Sizes: []string{}, SubPose: -1}
+
+		shared := uint32(sfmdata.UndefinedID)
+		var missing []string
+		for _, a := range members[name] {
+			v := views[a.ViewID]
+			group.SubPose = a.SubPose
+
+			if camera := cameraName(a.Camera); !slices.Contains(group.Cameras, camera) {
+				group.Cameras = append(group.Cameras, camera)
+			}
+			if size := fmt.Sprintf("%dx%d", v.Width, v.Height); !slices.Contains(group.Sizes, size) {
+				group.Sizes = append(group.Sizes, size)
+			}
+
+			if v.IntrinsicID == sfmdata.UndefinedID {
+				missing = append(missing, v.Filename)
+				continue
+			}
+			if shared == sfmdata.UndefinedID {
+				shared = v.IntrinsicID
+			}
+			if report.Intrinsics == IntrinsicsShared {
+				plan[v.ID] = shared
+			} else {
+				plan[v.ID] = v.IntrinsicID
+			}
+		}
+
+		intrinsics := map[uint32]bool{}
+		for _, a := range members[name] {
+			if id, ok := plan[a.ViewID]; ok {
+				intrinsics[id] = true
+			}
+		}
+		group.Intrinsics = len(intrinsics)
+
+		if report.Intrinsics == IntrinsicsShared && len(group.Sizes) > 1 {
+			report.Errors = append(report.Errors, fmt.Sprintf("group %s shares one intrinsic between image sizes %v", name, group.Sizes))
+		}
+		if len(group.Cameras) > 1 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("group %s mixes cameras %v", name, group.Cameras))
+		}
+		if len(missing) > 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("group %s has %d images without a focal length: %v", name, len(missing), missing))
+		}
+		report.Groups = append(report.Groups, group)
+	}
+
+	report.Rigs = rigReport(sfm, assignments)
+	if report.Rigs != nil && len(report.Rigs.Incomplete) > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d rig shots miss the image of a sub-pose", len(report.Rigs.Incomplete)))
+	}
+	return plan, report
+}
+
+// rigReport counts the sub-poses and shots of the views in a rig, nil when
+// there is no rig
+func rigReport(sfm *sfmdata.SfMData, assignments []Assignment) *RigReport {
+	subPoses := map[int]bool{}
+	shots := map[int][]Assignment{}
+	for _, a := range assignments {
+		if a.Rig < 0 {
+			continue
+		}
+		subPoses[a.SubPose] = true
+		shots[a.Rig] = append(shots[a.Rig], a)
+	}
+	if len(subPoses) == 0 {
+		return nil
+	}
+
+	rig := &RigReport{SubPoses: len(subPoses), Shots: len(shots), Incomplete: []string{}}
+	filenames := map[uint32]string{}
+	for _, v := range sfm.Views {
+		filenames[v.ID] = v.Filename
+	}
+	ids := make([]int, 0, len(shots))
+	for id := range shots {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if len(shots[id]) < len(subPoses) {
+			a := shots[id][0]
+			rig.Incomplete = append(rig.Incomplete, filenames[a.ViewID][len(a.Group)+1:])
+		}
+	}
+	return rig
+}
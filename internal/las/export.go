@@ -0,0 +1,86 @@
+package las
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+)
+
+// FromPLY converts the vertices of a PLY point cloud to LAS points. Colors
+// are widened to 16 bits and, unless the cloud carries its own intensity,
+// intensity is derived from the color luminance. Classification is read from
+// a classification property when present.
+func FromPLY(path string) ([]Point, error) {
+	file, err := ply.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := file.Positions()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	vertex := file.Element("vertex")
+	colors := file.Colors()
+	intensity := scalar(vertex, "intensity", "scalar_intensity")
+	classification := scalar(vertex, "classification", "class", "scalar_classification")
+
+	points := make([]Point, len(positions))
+	for i, p := range positions {
+		pt := Point{X: p[0], Y: p[1], Z: p[2], Classification: ClassUnclassified}
+
+		if colors != nil {
+			c := colors[i]
+			pt.Red, pt.Green, pt.Blue = uint16(c[0])*257, uint16(c[1])*257, uint16(c[2])*257
+			luminance := 0.299*float64(c[0]) + 0.587*float64(c[1]) + 0.114*float64(c[2])
+			pt.Intensity = uint16(luminance * 257)
+		}
+		if intensity != nil {
+			pt.Intensity = uint16(intensity[i])
+		}
+		if classification != nil {
+			pt.Classification = uint8(classification[i])
+		}
+
+		points[i] = pt
+	}
+
+	return points, nil
+}
+
+// Export converts the PLY point cloud at src to the LAS file at dst
+func Export(src, dst string, opts Options) error {
+	switch strings.ToLower(filepath.Ext(dst)) {
+	case ".las":
+	case ".laz":
+		return fmt.Errorf("laz compression is not supported, export las and compress it with laszip")
+	default:
+		return fmt.Errorf("unsupported point cloud format %s", dst)
+	}
+
+	points, err := FromPLY(src)
+	if err != nil {
+		return err
+	}
+	if m := opts.Transform; m != nil {
+		for i, p := range points {
+			points[i].X = m[0][0]*p.X + m[0][1]*p.Y + m[0][2]*p.Z + m[0][3]
+			points[i].Y = m[1][0]*p.X + m[1][1]*p.Y + m[1][2]*p.Z + m[1][3]
+			points[i].Z = m[2][0]*p.X + m[2][1]*p.Y + m[2][2]*p.Z + m[2][3]
+		}
+	}
+
+	return WriteFile(dst, points, opts)
+}
+
+func scalar(e *ply.Element, names ...string) []float64 {
+	for _, name := range names {
+		if p := e.Property(name); p != nil && !p.IsList() {
+			return p.Values
+		}
+	}
+	return nil
+}
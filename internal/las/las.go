@@ -0,0 +1,276 @@
+package las
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	headerSize      = 375
+	vlrHeaderSize   = 54
+	pointFormat     = 7
+	pointRecordSize = 36
+
+	// globalEncodingWKT marks the CRS as OGC WKT, mandatory for point formats 6 to 10
+	globalEncodingWKT = 1 << 4
+
+	// ClassUnclassified is the ASPRS class for points that were never classified
+	ClassUnclassified = 1
+)
+
+// Point is a single LAS point with color and classification
+type Point struct {
+	X, Y, Z        float64
+	Intensity      uint16
+	Classification uint8
+	// Red, Green and Blue are 16 bit channels as required by LAS
+	Red, Green, Blue uint16
+}
+
+// Options controls the header of the written file
+type Options struct {
+	// Scale is the resolution of the stored coordinates, defaults to 1mm
+	Scale [3]float64
+	// Offset is subtracted from every coordinate before scaling. When nil the
+	// minimum of the bounds, rounded down to the scale, is used.
+	Offset *[3]float64
+	// WKT is the OGC WKT of the coordinate reference system. When set it is
+	// written as a LASF_Projection variable length record.
+	WKT string
+	// SystemIdentifier and GeneratingSoftware fill the matching header fields
+	SystemIdentifier   string
+	GeneratingSoftware string
+	// Transform maps the coordinates of the source of Export to those
+	// written, row major. It moves the points of a local frame to their CRS.
+	Transform *[4][4]float64
+}
+
+// Header is the subset of the LAS 1.4 header needed to read files back
+type Header struct {
+	VersionMajor, VersionMinor uint8
+	GlobalEncoding             uint16
+	PointFormat                uint8
+	PointRecordLength          uint16
+	PointDataOffset            uint32
+	NumberOfVLRs               uint32
+	NumberOfPoints             uint64
+	Scale, Offset              [3]float64
+	Min, Max                   [3]float64
+	WKT                        string
+}
+
+// WriteFile writes points to path as LAS 1.4 with point data record format 7
+func WriteFile(path string, points []Point, opts Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create las file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	if err := Encode(w, points, opts); err != nil {
+		return fmt.Errorf("failed to write las file %s: %w", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write las file %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Encode writes points as LAS 1.4 with point data record format 7
+func Encode(w io.Writer, points []Point, opts Options) error {
+	scale := opts.Scale
+	if scale == [3]float64{} {
+		scale = [3]float64{0.001, 0.001, 0.001}
+	}
+
+	min := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range points {
+		for i, v := range [3]float64{p.X, p.Y, p.Z} {
+			min[i] = math.Min(min[i], v)
+			max[i] = math.Max(max[i], v)
+		}
+	}
+	if len(points) == 0 {
+		min, max = [3]float64{}, [3]float64{}
+	}
+
+	var offset [3]float64
+	if opts.Offset != nil {
+		offset = *opts.Offset
+	} else {
+		for i := range offset {
+			offset[i] = math.Floor(min[i]/scale[i]) * scale[i]
+		}
+	}
+
+	// Coordinates are stored as 32 bit integers relative to the offset
+	for i := range min {
+		lo := math.Round((min[i] - offset[i]) / scale[i])
+		hi := math.Round((max[i] - offset[i]) / scale[i])
+		if lo < math.MinInt32 || hi > math.MaxInt32 {
+			return fmt.Errorf("coordinates do not fit the las integer range with scale %g and offset %g", scale[i], offset[i])
+		}
+	}
+
+	var vlrs []byte
+	numVLRs := 0
+	if len(opts.WKT) >= math.MaxUint16 {
+		return fmt.Errorf("crs wkt of %d bytes does not fit a variable length record", len(opts.WKT))
+	}
+	if opts.WKT != "" {
+		vlrs = appendVLR(vlrs, "LASF_Projection", 2112, "OGC WKT", append([]byte(opts.WKT), 0))
+		numVLRs++
+	}
+
+	le := binary.LittleEndian
+	h := make([]byte, 0, headerSize)
+	h = append(h, "LASF"...)
+	h = le.AppendUint16(h, 0)                 // file source id
+	h = le.AppendUint16(h, globalEncodingWKT) // global encoding
+	h = append(h, make([]byte, 16)...)        // project guid
+	h = append(h, 1, 4)                       // version 1.4
+	h = appendString(h, opts.SystemIdentifier, 32)
+	h = appendString(h, opts.GeneratingSoftware, 32)
+	now := time.Now().UTC()
+	h = le.AppendUint16(h, uint16(now.YearDay()))
+	h = le.AppendUint16(h, uint16(now.Year()))
+	h = le.AppendUint16(h, headerSize)
+	h = le.AppendUint32(h, uint32(headerSize+len(vlrs)))
+	h = le.AppendUint32(h, uint32(numVLRs))
+	h = append(h, pointFormat)
+	h = le.AppendUint16(h, pointRecordSize)
+	// Legacy point counts must be zero for point formats 6 and above
+	h = append(h, make([]byte, 4+5*4)...)
+	for _, v := range scale {
+		h = le.AppendUint64(h, math.Float64bits(v))
+	}
+	for _, v := range offset {
+		h = le.AppendUint64(h, math.Float64bits(v))
+	}
+	for i := range 3 {
+		h = le.AppendUint64(h, math.Float64bits(max[i]))
+		h = le.AppendUint64(h, math.Float64bits(min[i]))
+	}
+	h = le.AppendUint64(h, 0) // start of waveform data
+	h = le.AppendUint64(h, 0) // start of first extended vlr
+	h = le.AppendUint32(h, 0) // number of extended vlrs
+	h = le.AppendUint64(h, uint64(len(points)))
+	// Every point is a single return
+	h = le.AppendUint64(h, uint64(len(points)))
+	h = append(h, make([]byte, 14*8)...)
+
+	if _, err := w.Write(h); err != nil {
+		return err
+	}
+	if _, err := w.Write(vlrs); err != nil {
+		return err
+	}
+
+	rec := make([]byte, 0, pointRecordSize)
+	for _, p := range points {
+		rec = rec[:0]
+		for i, v := range [3]float64{p.X, p.Y, p.Z} {
+			rec = le.AppendUint32(rec, uint32(int32(math.Round((v-offset[i])/scale[i]))))
+		}
+		rec = le.AppendUint16(rec, p.Intensity)
+		rec = append(rec, 0x11) // return 1 of 1
+		rec = append(rec, 0)    // classification flags, channel, scan direction, edge
+		rec = append(rec, p.Classification)
+		rec = append(rec, 0)          // user data
+		rec = le.AppendUint16(rec, 0) // scan angle
+		rec = le.AppendUint16(rec, 0) // point source id
+		rec = le.AppendUint64(rec, 0) // gps time
+		rec = le.AppendUint16(rec, p.Red)
+		rec = le.AppendUint16(rec, p.Green)
+		rec = le.AppendUint16(rec, p.Blue)
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadHeader reads the header and projection record of the LAS file at path
+func ReadHeader(path string) (*Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open las file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, fmt.Errorf("failed to read las header %s: %w", path, err)
+	}
+	if string(buf[0:4]) != "LASF" {
+		return nil, fmt.Errorf("%s is not a las file", path)
+	}
+
+	le := binary.LittleEndian
+	h := &Header{
+		GlobalEncoding:    le.Uint16(buf[6:]),
+		VersionMajor:      buf[24],
+		VersionMinor:      buf[25],
+		PointDataOffset:   le.Uint32(buf[96:]),
+		NumberOfVLRs:      le.Uint32(buf[100:]),
+		PointFormat:       buf[104],
+		PointRecordLength: le.Uint16(buf[105:]),
+		NumberOfPoints:    le.Uint64(buf[247:]),
+	}
+	for i := range 3 {
+		h.Scale[i] = math.Float64frombits(le.Uint64(buf[131+i*8:]))
+		h.Offset[i] = math.Float64frombits(le.Uint64(buf[155+i*8:]))
+		h.Max[i] = math.Float64frombits(le.Uint64(buf[179+i*16:]))
+		h.Min[i] = math.Float64frombits(le.Uint64(buf[187+i*16:]))
+	}
+
+	for range h.NumberOfVLRs {
+		vh := make([]byte, vlrHeaderSize)
+		if _, err := io.ReadFull(f, vh); err != nil {
+			return nil, fmt.Errorf("failed to read las vlr %s: %w", path, err)
+		}
+		body := make([]byte, le.Uint16(vh[20:]))
+		if _, err := io.ReadFull(f, body); err != nil {
+			return nil, fmt.Errorf("failed to read las vlr %s: %w", path, err)
+		}
+		if trimNull(vh[2:18]) == "LASF_Projection" && le.Uint16(vh[18:]) == 2112 {
+			h.WKT = trimNull(body)
+		}
+	}
+
+	return h, nil
+}
+
+func appendVLR(b []byte, userID string, recordID uint16, description string, body []byte) []byte {
+	le := binary.LittleEndian
+	b = le.AppendUint16(b, 0)
+	b = appendString(b, userID, 16)
+	b = le.AppendUint16(b, recordID)
+	b = le.AppendUint16(b, uint16(len(body)))
+	b = appendString(b, description, 32)
+	return append(b, body...)
+}
+
+// appendString appends s truncated or null padded to exactly n bytes
+func appendString(b []byte, s string, n int) []byte {
+	field := make([]byte, n)
+	copy(field, s)
+	return append(b, field...)
+}
+
+func trimNull(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
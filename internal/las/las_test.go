@@ -0,0 +1,103 @@
+package las_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/las"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloud.las")
+	wkt := `PROJCS["WGS 84 / UTM zone 30N"]`
+	offset := [3]float64{500000, 5700000, 0}
+
+	points := []las.Point{
+		{X: 500001.5, Y: 5700002.25, Z: 10, Classification: las.ClassUnclassified, Red: 65535},
+		{X: 500003, Y: 5700001, Z: 12.5, Classification: 2, Intensity: 100},
+	}
+
+	if err := las.WriteFile(path, points, las.Options{Offset: &offset, WKT: wkt}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h, err := las.ReadHeader(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if h.VersionMajor != 1 || h.VersionMinor != 4 || h.PointFormat != 7 || h.PointRecordLength != 36 {
+		t.Errorf("unexpected header %+v", h)
+	}
+	if h.GlobalEncoding&(1<<4) == 0 {
+		t.Errorf("expected the WKT global encoding bit to be set")
+	}
+	if h.NumberOfPoints != 2 || h.NumberOfVLRs != 1 || h.WKT != wkt {
+		t.Errorf("unexpected counts or wkt %+v", h)
+	}
+	if h.Offset != offset || h.Scale != [3]float64{0.001, 0.001, 0.001} {
+		t.Errorf("unexpected scale %v or offset %v", h.Scale, h.Offset)
+	}
+	if h.Min != [3]float64{500001.5, 5700001, 10} || h.Max != [3]float64{500003, 5700002.25, 12.5} {
+		t.Errorf("unexpected bounds min=%v max=%v", h.Min, h.Max)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read las: %v", err)
+	}
+	if len(data) != int(h.PointDataOffset)+2*36 {
+		t.Fatalf("unexpected file size %d", len(data))
+	}
+
+	// The first point is stored relative to the offset in millimetres
+	rec := data[h.PointDataOffset:]
+	if x := int32(binary.LittleEndian.Uint32(rec)); x != 1500 {
+		t.Errorf("expected x of 1500, got %d", x)
+	}
+	if class := rec[36+16]; class != 2 {
+		t.Errorf("expected class 2 for the second point, got %d", class)
+	}
+}
+
+func TestExport(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "dense.las")
+
+	if err := las.Export("testdata/dense.ply", dst, las.Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h, err := las.ReadHeader(dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.NumberOfPoints != 3 || h.WKT != "" {
+		t.Errorf("unexpected header %+v", h)
+	}
+
+	// Without an explicit offset the minimum is used, rounded down to the scale
+	if h.Offset != [3]float64{-1, 0, -2} {
+		t.Errorf("unexpected offset %v", h.Offset)
+	}
+
+	points, err := las.FromPLY("testdata/dense.ply")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if points[0].Red != 65535 || points[0].Intensity != 65535 || points[1].Intensity != 0 {
+		t.Errorf("unexpected color or intensity %+v %+v", points[0], points[1])
+	}
+	if points[2].Classification != las.ClassUnclassified {
+		t.Errorf("expected unclassified points, got %d", points[2].Classification)
+	}
+}
+
+func TestExport_LAZ(t *testing.T) {
+	err := las.Export("testdata/dense.ply", filepath.Join(t.TempDir(), "dense.laz"), las.Options{})
+	if err == nil || !strings.Contains(err.Error(), "laz") {
+		t.Errorf("expected laz to be rejected, got %v", err)
+	}
+}
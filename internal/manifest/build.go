@@ -0,0 +1,173 @@
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/gltf"
+	"github.com/2024-dissertation/openmvgo/internal/las"
+	"github.com/2024-dissertation/openmvgo/internal/obj"
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+)
+
+// lodName matches the levels of detail exported next to the final mesh
+var lodName = regexp.MustCompile(`^final_lod\d+\.`)
+
+// Build lists every file of the output directory dir, except a previous
+// manifest
+func Build(dir string) (*Manifest, error) {
+	m := &Manifest{Version: Version, CreatedAt: time.Now().UTC(), Tools: []Tool{}, Artifacts: []Artifact{}}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == FileName {
+			return nil
+		}
+
+		a, err := describe(path, rel)
+		if err != nil {
+			return err
+		}
+		m.Artifacts = append(m.Artifacts, a)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	return m, nil
+}
+
+func describe(path, rel string) (Artifact, error) {
+	size, sum, err := hashFile(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	a := Artifact{
+		Path:   rel,
+		Role:   role(rel),
+		Format: strings.TrimPrefix(strings.ToLower(filepath.Ext(rel)), "."),
+		Size:   size,
+		SHA256: sum,
+	}
+
+	var vertices, faces int
+	switch a.Format {
+	case "obj":
+		model, err := obj.Parse(path)
+		if err != nil {
+			return Artifact{}, err
+		}
+		vertices, faces = len(model.Positions), len(model.Faces)
+		a.Vertices, a.Faces = &vertices, &faces
+	case "glb":
+		if vertices, faces, err = gltf.Count(path); err != nil {
+			return Artifact{}, err
+		}
+		a.Vertices, a.Faces = &vertices, &faces
+	case "ply":
+		file, err := ply.ReadHeader(path)
+		if err != nil {
+			return Artifact{}, err
+		}
+		if e := file.Element("vertex"); e != nil {
+			vertices = e.Count
+			a.Vertices = &vertices
+		}
+		if e := file.Element("face"); e != nil {
+			faces = e.Count
+			a.Faces = &faces
+		}
+	case "las":
+		h, err := las.ReadHeader(path)
+		if err != nil {
+			return Artifact{}, err
+		}
+		vertices = int(h.NumberOfPoints)
+		a.Vertices = &vertices
+	}
+	return a, nil
+}
+
+// role tells the artifacts apart by the names the pipeline gives them
+func role(rel string) string {
+	name := filepath.Base(rel)
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case strings.HasPrefix(rel, "logs/") && ext == ".log":
+		return RoleLog
+	case lodName.MatchString(name) && (ext == ".obj" || ext == ".glb"):
+		return RoleLOD
+	case name == "final.obj" || name == "final.glb":
+		return RoleMesh
+	case ext == ".mtl":
+		return RoleMaterial
+	case ext == ".png" || ext == ".jpg" || ext == ".jpeg":
+		return RoleTexture
+	case strings.HasPrefix(name, "dense."):
+		return RoleDenseCloud
+	case name == "colorized.ply":
+		return RoleSparseCloud
+	case ext == ".json":
+		return RoleReport
+	}
+	return RoleOther
+}
+
+// openMVSVersion matches the banner OpenMVS commands print when they start,
+// e.g. "OpenMVS x64 v2.3.0"
+var openMVSVersion = regexp.MustCompile(`OpenMVS \S+ v(\d+(?:\.\d+)+)`)
+
+// ToolsFromLogs returns the commands whose output was kept as <command>.log
+// in logDir, with the version found in their output
+func ToolsFromLogs(logDir string) ([]Tool, error) {
+	logs, err := filepath.Glob(filepath.Join(logDir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(logs)
+
+	tools := []Tool{}
+	for _, log := range logs {
+		t := Tool{Name: strings.TrimSuffix(filepath.Base(log), ".log")}
+		if path, err := exec.LookPath(t.Name); err == nil {
+			t.Path = path
+		}
+		t.Version = findVersion(log)
+		tools = append(tools, t)
+	}
+	return tools, nil
+}
+
+// findVersion returns the first version printed in log, a log that cannot be
+// read just leaves the version unknown
+func findVersion(log string) string {
+	f, err := os.Open(log)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if m := openMVSVersion.FindStringSubmatch(scanner.Text()); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+)
+
+// FileName is the name of the manifest in the output directory
+const FileName = "manifest.json"
+
+// Version is the version of the manifest format
+const Version = 1
+
+// Roles of the artifacts of a run
+const (
+	RoleMesh        = "mesh"
+	RoleLOD         = "lod"
+	RoleMaterial    = "material"
+	RoleTexture     = "texture"
+	RoleDenseCloud  = "dense_cloud"
+	RoleSparseCloud = "sparse_cloud"
+	RoleReport      = "report"
+	RoleLog         = "log"
+	RoleOther       = "other"
+)
+
+// Manifest lists the artifacts a run wrote to its output directory
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Config is the configuration of the run
+	Config json.RawMessage `json:"config,omitempty"`
+	// Tools are the external commands the run used
+	Tools []Tool `json:"tools"`
+	// Steps are the results of the pipeline steps the run went through,
+	// with the metrics parsed from the output of their commands
+	Steps     []pipeline.StepResult `json:"steps,omitempty"`
+	Artifacts []Artifact            `json:"artifacts"`
+}
+
+// Tool is an external command and the version it reports, which is empty
+// when the command does not print one
+type Tool struct {
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// Artifact is a file of the output directory
+type Artifact struct {
+	// Path is relative to the output directory, with forward slashes
+	Path   string `json:"path"`
+	Role   string `json:"role"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Vertices is the vertex count of meshes and the point count of point
+	// clouds
+	Vertices *int `json:"vertices,omitempty"`
+	Faces    *int `json:"faces,omitempty"`
+}
+
+// Load reads the manifest at path
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if m.Version > Version {
+		return nil, fmt.Errorf("manifest %s has unsupported version %d", path, m.Version)
+	}
+	return &m, nil
+}
+
+// Write writes the manifest to path
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+	return nil
+}
+
+// SetConfig stores the JSON encoding of config in the manifest
+func (m *Manifest) SetConfig(config any) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode run configuration: %w", err)
+	}
+	m.Config = data
+	return nil
+}
+
+// ByRole returns the artifacts with the given role
+func (m *Manifest) ByRole(role string) []Artifact {
+	var artifacts []Artifact
+	for _, a := range m.Artifacts {
+		if a.Role == role {
+			artifacts = append(artifacts, a)
+		}
+	}
+	return artifacts
+}
+
+// Verify checks that every artifact is in dir with the listed size and hash
+func (m *Manifest) Verify(dir string) error {
+	for _, a := range m.Artifacts {
+		path := filepath.Join(dir, filepath.FromSlash(a.Path))
+		size, sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if size != a.Size || sum != a.SHA256 {
+			return fmt.Errorf("%s does not match the manifest", a.Path)
+		}
+	}
+	return nil
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,143 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/las"
+	"github.com/2024-dissertation/openmvgo/internal/manifest"
+)
+
+// writeOutput writes the files of a small run to dir
+func writeOutput(t *testing.T, dir string) {
+	t.Helper()
+
+	files := map[string]string{
+		"final.obj":                    "mtllib final.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nusemtl material_00\nf 1 2 3\nf 2 4 3\n",
+		"final.mtl":                    "newmtl material_00\nmap_Kd final_material_00_map_Kd.png\n",
+		"final_lod1.obj":               "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+		"final_material_00_map_Kd.png": "png",
+		"colorized.ply":                "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n1 1 1\n",
+		"scale.json":                   "{}",
+		"logs/DensifyPointCloud.log":   "13:02:11 [App     ] OpenMVS x64 v2.3.0\n",
+		"logs/openMVG_main_SfM.log":    "Sequential/Incremental reconstruction\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	points := []las.Point{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 1, Z: 1}, {X: 2, Y: 2, Z: 2}}
+	if err := las.WriteFile(filepath.Join(dir, "dense.las"), points, las.Options{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	writeOutput(t, dir)
+
+	m, err := manifest.Build(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	roles := map[string]string{}
+	for _, a := range m.Artifacts {
+		roles[a.Path] = a.Role
+	}
+	want := map[string]string{
+		"final.obj":                    manifest.RoleMesh,
+		"final.mtl":                    manifest.RoleMaterial,
+		"final_lod1.obj":               manifest.RoleLOD,
+		"final_material_00_map_Kd.png": manifest.RoleTexture,
+		"colorized.ply":                manifest.RoleSparseCloud,
+		"dense.las":                    manifest.RoleDenseCloud,
+		"scale.json":                   manifest.RoleReport,
+		"logs/DensifyPointCloud.log":   manifest.RoleLog,
+		"logs/openMVG_main_SfM.log":    manifest.RoleLog,
+	}
+	for path, role := range want {
+		if roles[path] != role {
+			t.Errorf("expected %s to have role %s, got %q", path, role, roles[path])
+		}
+	}
+	if len(m.Artifacts) != len(want) {
+		t.Errorf("expected %d artifacts, got %d", len(want), len(m.Artifacts))
+	}
+
+	mesh := m.ByRole(manifest.RoleMesh)[0]
+	if mesh.Format != "obj" || *mesh.Vertices != 4 || *mesh.Faces != 2 || len(mesh.SHA256) != 64 {
+		t.Errorf("unexpected mesh artifact %+v", mesh)
+	}
+	sparse := m.ByRole(manifest.RoleSparseCloud)[0]
+	if *sparse.Vertices != 2 || sparse.Faces != nil {
+		t.Errorf("unexpected sparse cloud artifact %+v", sparse)
+	}
+	dense := m.ByRole(manifest.RoleDenseCloud)[0]
+	if *dense.Vertices != 3 {
+		t.Errorf("expected 3 dense points, got %d", *dense.Vertices)
+	}
+
+	tools, err := manifest.ToolsFromLogs(filepath.Join(dir, "logs"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tools) != 2 || tools[0].Name != "DensifyPointCloud" || tools[0].Version != "2.3.0" || tools[1].Version != "" {
+		t.Errorf("unexpected tools %+v", tools)
+	}
+}
+
+func TestWriteLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeOutput(t, dir)
+
+	m, err := manifest.Build(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.SetConfig(map[string]int{"MaxThreads": 4}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, manifest.FileName)
+	if err := m.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := manifest.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.Version != manifest.Version || len(loaded.Artifacts) != len(m.Artifacts) {
+		t.Errorf("unexpected manifest %+v", loaded)
+	}
+	var config map[string]int
+	if err := json.Unmarshal(loaded.Config, &config); err != nil || config["MaxThreads"] != 4 {
+		t.Errorf("unexpected config %s", loaded.Config)
+	}
+	if err := loaded.Verify(dir); err != nil {
+		t.Errorf("unexpected error verifying: %v", err)
+	}
+
+	// Rebuilding leaves the manifest itself out
+	rebuilt, err := manifest.Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rebuilt.Artifacts) != len(m.Artifacts) {
+		t.Errorf("expected the manifest not to list itself")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "scale.json"), []byte(`{"scale": 2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Verify(dir); err == nil {
+		t.Error("expected a modified artifact to fail verification")
+	}
+}
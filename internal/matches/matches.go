@@ -0,0 +1,142 @@
+package matches
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+)
+
+// Match pairs feature I of the first view with feature J of the second
+type Match struct {
+	I, J uint32
+}
+
+// PairWise holds the matches of every image pair, as in the
+// matches.<model>.bin files OpenMVG writes
+type PairWise map[pairs.Pair][]Match
+
+// Pairs returns the matched pairs in order
+func (m PairWise) Pairs() []pairs.Pair {
+	s := pairs.Set{}
+	for p := range m {
+		s[p] = struct{}{}
+	}
+	return s.Sorted()
+}
+
+// Count returns the total number of matches
+func (m PairWise) Count() int {
+	n := 0
+	for _, matches := range m {
+		n += len(matches)
+	}
+	return n
+}
+
+// Merge adds the matches of other, replacing those of pairs in both
+func (m PairWise) Merge(other PairWise) {
+	for p, matches := range other {
+		m[p] = matches
+	}
+}
+
+// Load reads a matches file in the cereal portable binary format
+func Load(path string) (PairWise, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open matches %s: %w", path, err)
+	}
+	defer f.Close()
+
+	m, err := Read(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read matches %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Read decodes the std::map<Pair, std::vector<IndMatch>> serialisation of a
+// cereal portable binary archive: an endianness flag, the 64 bit map size and
+// per pair the two view ids, the 64 bit match count and the feature indices
+func Read(r io.Reader) (PairWise, error) {
+	var flag uint8
+	if err := binary.Read(r, binary.LittleEndian, &flag); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if flag == 0 {
+		order = binary.BigEndian
+	}
+
+	var size uint64
+	if err := binary.Read(r, order, &size); err != nil {
+		return nil, err
+	}
+	m := PairWise{}
+	for range size {
+		var pair [2]uint32
+		var count uint64
+		if err := binary.Read(r, order, &pair); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, order, &count); err != nil {
+			return nil, err
+		}
+		// Guard the allocation against a corrupt count
+		if count > 1<<28 {
+			return nil, fmt.Errorf("pair %d %d: invalid match count %d", pair[0], pair[1], count)
+		}
+		matches := make([]Match, count)
+		if err := binary.Read(r, order, matches); err != nil {
+			return nil, err
+		}
+		m[pairs.Pair{I: pair[0], J: pair[1]}] = matches
+	}
+	return m, nil
+}
+
+// Save writes matches in the format read by Load
+func Save(path string, m PairWise) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create matches %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	err = Write(w, m)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write matches %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Write encodes matches as a little endian archive in the format read by Read
+func Write(w io.Writer, m PairWise) error {
+	if err := binary.Write(w, binary.LittleEndian, uint8(1)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(m))); err != nil {
+		return err
+	}
+	for _, p := range m.Pairs() {
+		matches := m[p]
+		if err := binary.Write(w, binary.LittleEndian, [2]uint32{p.I, p.J}); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint64(len(matches))); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, matches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package matches_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/matches"
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+)
+
+func TestReadWrite(t *testing.T) {
+	m := matches.PairWise{
+		{I: 0, J: 1}: {{I: 3, J: 4}, {I: 5, J: 6}},
+		{I: 0, J: 2}: {},
+	}
+
+	var buf bytes.Buffer
+	if err := matches.Write(&buf, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var want bytes.Buffer
+	want.WriteByte(1)
+	binary.Write(&want, binary.LittleEndian, uint64(2))
+	binary.Write(&want, binary.LittleEndian, []uint32{0, 1})
+	binary.Write(&want, binary.LittleEndian, uint64(2))
+	binary.Write(&want, binary.LittleEndian, []uint32{3, 4, 5, 6})
+	binary.Write(&want, binary.LittleEndian, []uint32{0, 2})
+	binary.Write(&want, binary.LittleEndian, uint64(0))
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Errorf("unexpected archive %v", buf.Bytes())
+	}
+
+	got, err := matches.Read(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("expected %v, got %v", m, got)
+	}
+
+	// A truncated archive is an error rather than fewer matches
+	if _, err := matches.Read(bytes.NewReader(want.Bytes()[:20])); err == nil {
+		t.Errorf("expected error for a truncated archive")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	old := matches.PairWise{{I: 0, J: 1}: {{I: 1, J: 1}}, {I: 1, J: 2}: {{I: 2, J: 2}}}
+	if err := matches.Save(filepath.Join(dir, "matches.f.bin"), old); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m, err := matches.Load(filepath.Join(dir, "matches.f.bin"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.Merge(matches.PairWise{{I: 1, J: 2}: {}, {I: 2, J: 3}: {{I: 7, J: 8}, {I: 9, J: 9}}})
+
+	if want := []pairs.Pair{{I: 0, J: 1}, {I: 1, J: 2}, {I: 2, J: 3}}; !reflect.DeepEqual(m.Pairs(), want) {
+		t.Errorf("expected pairs %v, got %v", want, m.Pairs())
+	}
+	if m.Count() != 3 {
+		t.Errorf("expected 3 matches, got %d", m.Count())
+	}
+}
@@ -0,0 +1,189 @@
+// Package metrics exposes the pipeline and job statistics in the Prometheus
+// format. A nil *Registry is valid and records nothing, so the metrics stay
+// optional.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "openmvgo"
+
+// Status label values
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	// StatusLimitExceeded counts the commands killed for exceeding their
+	// resource limits
+	StatusLimitExceeded = "limit_exceeded"
+)
+
+// Registry holds the metrics of a process
+type Registry struct {
+	registry *prometheus.Registry
+
+	commandDuration *prometheus.HistogramVec
+	commands        *prometheus.CounterVec
+	commandCPU      *prometheus.CounterVec
+	commandRSS      *prometheus.HistogramVec
+	steps           *prometheus.CounterVec
+	jobs            *prometheus.CounterVec
+	activeJobs      prometheus.Gauge
+	images          prometheus.Histogram
+}
+
+// New returns a registry with the pipeline metrics and those of the Go
+// runtime and process
+func New() *Registry {
+	r := &Registry{
+		registry: prometheus.NewRegistry(),
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "command_duration_seconds",
+			Help:      "Wall time of the OpenMVG and OpenMVS commands.",
+			// From a second to about 9 hours
+			Buckets: prometheus.ExponentialBuckets(1, 2.5, 12),
+		}, []string{"command"}),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_total",
+			Help:      "Commands run, by command and status.",
+		}, []string{"command", "status"}),
+		commandCPU: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "command_cpu_seconds_total",
+			Help:      "CPU time of the commands, by command and user or system mode.",
+		}, []string{"command", "mode"}),
+		commandRSS: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "command_peak_rss_bytes",
+			Help:      "Peak resident set size of the commands.",
+			// From 64 MiB to 64 GiB
+			Buckets: prometheus.ExponentialBuckets(64<<20, 2, 11),
+		}, []string{"command"}),
+		steps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "steps_total",
+			Help:      "Pipeline steps run, by step and status.",
+		}, []string{"step", "status"}),
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_total",
+			Help:      "Jobs finished, by status.",
+		}, []string{"status"}),
+		activeJobs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_jobs",
+			Help:      "Jobs running.",
+		}),
+		images: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_images",
+			Help:      "Images listed per job.",
+			Buckets:   prometheus.ExponentialBuckets(8, 2, 10),
+		}),
+	}
+	r.registry.MustRegister(
+		r.commandDuration, r.commands, r.commandCPU, r.commandRSS,
+		r.steps, r.jobs, r.activeJobs, r.images,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return r
+}
+
+// Handler serves the metrics
+func (r *Registry) Handler() http.Handler {
+	if r == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveCommand records a finished command, it is meant for
+// utils.UtilsImpl.OnCommand
+func (r *Registry) ObserveCommand(s utils.CommandStats) {
+	if r == nil {
+		return
+	}
+	r.commandDuration.WithLabelValues(s.Name).Observe(s.Duration.Seconds())
+	commandStatus := status(s.Err == nil)
+	var limitErr *utils.LimitError
+	if errors.As(s.Err, &limitErr) {
+		commandStatus = StatusLimitExceeded
+	}
+	r.commands.WithLabelValues(s.Name, commandStatus).Inc()
+	r.commandCPU.WithLabelValues(s.Name, "user").Add(s.UserTime.Seconds())
+	r.commandCPU.WithLabelValues(s.Name, "system").Add(s.SystemTime.Seconds())
+	if s.PeakRSS > 0 {
+		r.commandRSS.WithLabelValues(s.Name).Observe(float64(s.PeakRSS))
+	}
+}
+
+// ObserveStep records the finished and failed steps of a pipeline, and the
+// images its image listing found
+func (r *Registry) ObserveStep(e pipeline.Event) {
+	if r == nil {
+		return
+	}
+	switch e.Type {
+	case pipeline.StageFinished, pipeline.StageFailed:
+		r.steps.WithLabelValues(e.Stage, status(e.Type == pipeline.StageFinished)).Inc()
+	default:
+		return
+	}
+	if e.Stage == "image_listing" && e.Result != nil && e.Result.Metrics.Images > 0 {
+		r.images.Observe(float64(e.Result.Metrics.Images))
+	}
+}
+
+// JobStarted records a job starting
+func (r *Registry) JobStarted() {
+	if r == nil {
+		return
+	}
+	r.activeJobs.Inc()
+}
+
+// JobStopped records a job stopping, whether it finished or will be retried
+func (r *Registry) JobStopped() {
+	if r == nil {
+		return
+	}
+	r.activeJobs.Dec()
+}
+
+// JobFinished records a job finishing with a status, such as those of the
+// server jobs
+func (r *Registry) JobFinished(status string) {
+	if r == nil {
+		return
+	}
+	r.jobs.WithLabelValues(status).Inc()
+}
+
+// WatchQueue exposes the number of jobs waiting, read on every scrape
+func (r *Registry) WatchQueue(depth func() int) {
+	if r == nil {
+		return
+	}
+	r.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Jobs waiting for a worker.",
+	}, func() float64 { return float64(depth()) }))
+}
+
+func status(ok bool) string {
+	if ok {
+		return StatusSuccess
+	}
+	return StatusFailure
+}
@@ -0,0 +1,78 @@
+package metrics_test
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/metrics"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/toolout"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+)
+
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	data, _ := io.ReadAll(rec.Body)
+	return string(data)
+}
+
+func TestRegistry(t *testing.T) {
+	reg := metrics.New()
+	reg.ObserveCommand(utils.CommandStats{Name: "DensifyPointCloud", Duration: 3 * time.Second, UserTime: 5 * time.Second, PeakRSS: 2 << 30})
+	reg.ObserveCommand(utils.CommandStats{Name: "DensifyPointCloud", Err: errors.New("killed")})
+	reg.ObserveCommand(utils.CommandStats{Name: "DensifyPointCloud", Err: &utils.LimitError{Resource: utils.ResourceMemory}})
+	reg.ObserveStep(pipeline.Event{Type: pipeline.StageStarted, Stage: "image_listing"})
+	reg.ObserveStep(pipeline.Event{
+		Type:   pipeline.StageFinished,
+		Stage:  "image_listing",
+		Result: &pipeline.StepResult{Metrics: toolout.Metrics{Images: 12}},
+	})
+	reg.JobStarted()
+	reg.JobStarted()
+	reg.JobStopped()
+	reg.JobFinished("succeeded")
+	reg.WatchQueue(func() int { return 4 })
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		`openmvgo_command_duration_seconds_count{command="DensifyPointCloud"} 3`,
+		`openmvgo_commands_total{command="DensifyPointCloud",status="success"} 1`,
+		`openmvgo_commands_total{command="DensifyPointCloud",status="failure"} 1`,
+		`openmvgo_commands_total{command="DensifyPointCloud",status="limit_exceeded"} 1`,
+		`openmvgo_command_cpu_seconds_total{command="DensifyPointCloud",mode="user"} 5`,
+		`openmvgo_command_peak_rss_bytes_count{command="DensifyPointCloud"} 1`,
+		`openmvgo_steps_total{status="success",step="image_listing"} 1`,
+		`openmvgo_job_images_sum 12`,
+		`openmvgo_active_jobs 1`,
+		`openmvgo_jobs_total{status="succeeded"} 1`,
+		`openmvgo_queue_depth 4`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the metrics", want)
+		}
+	}
+}
+
+func TestRegistry_Nil(t *testing.T) {
+	// A nil registry records nothing
+	var reg *metrics.Registry
+	reg.ObserveCommand(utils.CommandStats{Name: "TextureMesh"})
+	reg.ObserveStep(pipeline.Event{Type: pipeline.StageFailed, Stage: "texture"})
+	reg.JobStarted()
+	reg.JobStopped()
+	reg.JobFinished("failed")
+	reg.WatchQueue(func() int { return 0 })
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 404 {
+		t.Errorf("expected no metrics to be served, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,199 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Export validates the OBJ file at src and writes it to dstDir as name.obj
+// together with its material libraries and every texture they reference.
+// Material libraries are renamed after the model and texture references are
+// rewritten to paths relative to dstDir, so the exported files can be moved
+// as a unit. It returns the paths of every file written.
+func Export(src, dstDir, name string) ([]string, error) {
+	model, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	libs, err := Validate(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dstDir, err)
+	}
+
+	var written []string
+
+	// Give every texture a unique file name inside dstDir
+	textures := map[string]string{}
+	taken := map[string]bool{}
+	for _, lib := range libs {
+		for _, tex := range lib.TexturePaths() {
+			if _, ok := textures[tex]; ok {
+				continue
+			}
+			base := uniqueName(filepath.Base(tex), taken)
+			textures[tex] = base
+
+			dst := filepath.Join(dstDir, base)
+			if err := copyFile(tex, dst); err != nil {
+				return written, err
+			}
+			written = append(written, dst)
+		}
+	}
+
+	libNames := make([]string, len(libs))
+	for i, lib := range libs {
+		libNames[i] = name + ".mtl"
+		if i > 0 {
+			libNames[i] = fmt.Sprintf("%s_%d.mtl", name, i)
+		}
+
+		dst := filepath.Join(dstDir, libNames[i])
+		if err := rewriteMTL(lib.Path, dst, textures); err != nil {
+			return written, err
+		}
+		written = append(written, dst)
+	}
+
+	dst := filepath.Join(dstDir, name+".obj")
+	if err := rewriteOBJ(src, dst, libNames); err != nil {
+		return written, err
+	}
+	written = append(written, dst)
+
+	return written, nil
+}
+
+// rewriteOBJ copies src to dst replacing every mtllib statement with a single
+// statement listing libNames.
+func rewriteOBJ(src, dst string, libNames []string) error {
+	emitted := false
+	return rewriteLines(src, dst, func(line string) (string, bool) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "mtllib" {
+			return line, true
+		}
+		if emitted || len(libNames) == 0 {
+			return "", false
+		}
+		emitted = true
+		return "mtllib " + strings.Join(libNames, " "), true
+	})
+}
+
+// rewriteMTL copies src to dst pointing texture statements at the names in
+// textures, which is keyed by the resolved source path.
+func rewriteMTL(src, dst string, textures map[string]string) error {
+	dir := filepath.Dir(src)
+	return rewriteLines(src, dst, func(line string) (string, bool) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !textureStatements[fields[0]] {
+			return line, true
+		}
+		name, ok := textures[ResolvePath(dir, fields[len(fields)-1])]
+		if !ok {
+			return line, true
+		}
+		fields[len(fields)-1] = name
+		return strings.Join(fields, " "), true
+	})
+}
+
+func rewriteLines(src, dst string, rewrite func(string) (string, bool)) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	// Write through a temporary file so src and dst may be the same path
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line, keep := rewrite(scanner.Text())
+		if !keep {
+			continue
+		}
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			return fmt.Errorf("failed to write %s: %w", dst, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", tmp, dst, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	if sameFile(src, dst) {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	return out.Close()
+}
+
+func uniqueName(base string, taken map[string]bool) string {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	name := base
+	for i := 1; taken[name]; i++ {
+		name = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
+	taken[name] = true
+	return name
+}
+
+func sameFile(a, b string) bool {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	sb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(sa, sb)
+}
@@ -0,0 +1,292 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FaceVertex references a position, texture coordinate and normal by their
+// zero based index. TexCoord and Normal are -1 when the face omits them.
+type FaceVertex struct {
+	Position int
+	TexCoord int
+	Normal   int
+}
+
+// Face is a single polygon together with the material active when it was declared
+type Face struct {
+	Vertices []FaceVertex
+	Material string
+}
+
+// Model is a parsed Wavefront OBJ file
+type Model struct {
+	Path         string
+	Positions    [][3]float64
+	TexCoords    [][2]float64
+	Normals      [][3]float64
+	Faces        []Face
+	MaterialLibs []string
+}
+
+// Material is a single newmtl block of an MTL file
+type Material struct {
+	Name    string
+	Diffuse [3]float64
+	// Maps holds texture statements such as map_Kd keyed by statement name,
+	// with the referenced path exactly as written in the file.
+	Maps map[string]string
+}
+
+// MaterialLibrary is a parsed MTL file
+type MaterialLibrary struct {
+	Path      string
+	Materials []Material
+}
+
+// textureStatements are the MTL statements that reference an image file
+var textureStatements = map[string]bool{
+	"map_Ka":   true,
+	"map_Kd":   true,
+	"map_Ks":   true,
+	"map_Ke":   true,
+	"map_Ns":   true,
+	"map_d":    true,
+	"map_bump": true,
+	"bump":     true,
+	"disp":     true,
+	"decal":    true,
+	"refl":     true,
+	"norm":     true,
+}
+
+// Parse reads the OBJ file at path
+func Parse(path string) (*Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open obj file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	m := &Model{Path: path}
+	material := ""
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			v, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid vertex: %w", path, line, err)
+			}
+			m.Positions = append(m.Positions, [3]float64{v[0], v[1], v[2]})
+		case "vt":
+			v, err := parseFloats(fields[1:], 2)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid texture coordinate: %w", path, line, err)
+			}
+			m.TexCoords = append(m.TexCoords, [2]float64{v[0], v[1]})
+		case "vn":
+			v, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid normal: %w", path, line, err)
+			}
+			m.Normals = append(m.Normals, [3]float64{v[0], v[1], v[2]})
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("%s:%d: face needs at least 3 vertices", path, line)
+			}
+			face := Face{Material: material}
+			for _, token := range fields[1:] {
+				fv, err := m.parseFaceVertex(token)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid face vertex %q: %w", path, line, token, err)
+				}
+				face.Vertices = append(face.Vertices, fv)
+			}
+			m.Faces = append(m.Faces, face)
+		case "mtllib":
+			m.MaterialLibs = append(m.MaterialLibs, fields[1:]...)
+		case "usemtl":
+			if len(fields) > 1 {
+				material = fields[1]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read obj file %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// parseFaceVertex parses v, v/vt, v//vn or v/vt/vn, resolving negative indices
+// against the elements declared so far.
+func (m *Model) parseFaceVertex(token string) (FaceVertex, error) {
+	parts := strings.Split(token, "/")
+	if len(parts) > 3 {
+		return FaceVertex{}, fmt.Errorf("too many components")
+	}
+
+	fv := FaceVertex{Position: -1, TexCoord: -1, Normal: -1}
+	counts := []int{len(m.Positions), len(m.TexCoords), len(m.Normals)}
+	targets := []*int{&fv.Position, &fv.TexCoord, &fv.Normal}
+
+	for i, part := range parts {
+		if part == "" {
+			if i == 0 {
+				return FaceVertex{}, fmt.Errorf("missing position index")
+			}
+			continue
+		}
+		idx, err := strconv.Atoi(part)
+		if err != nil {
+			return FaceVertex{}, err
+		}
+		switch {
+		case idx > 0:
+			*targets[i] = idx - 1
+		case idx < 0:
+			*targets[i] = counts[i] + idx
+		default:
+			return FaceVertex{}, fmt.Errorf("index 0 is not valid")
+		}
+	}
+
+	return fv, nil
+}
+
+// MaterialLibPaths returns the material libraries referenced by the model,
+// resolved relative to the OBJ file.
+func (m *Model) MaterialLibPaths() []string {
+	paths := make([]string, 0, len(m.MaterialLibs))
+	for _, lib := range m.MaterialLibs {
+		paths = append(paths, ResolvePath(filepath.Dir(m.Path), lib))
+	}
+	return paths
+}
+
+// ParseMTL reads the MTL file at path
+func ParseMTL(path string) (*MaterialLibrary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mtl file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	lib := &MaterialLibrary{Path: path}
+	var current *Material
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] == "newmtl" {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%s:%d: newmtl without a name", path, line)
+			}
+			lib.Materials = append(lib.Materials, Material{
+				Name:    fields[1],
+				Diffuse: [3]float64{1, 1, 1},
+				Maps:    map[string]string{},
+			})
+			current = &lib.Materials[len(lib.Materials)-1]
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		switch {
+		case fields[0] == "Kd":
+			v, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid Kd: %w", path, line, err)
+			}
+			current.Diffuse = [3]float64{v[0], v[1], v[2]}
+		case textureStatements[fields[0]]:
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%s:%d: %s without a file", path, line, fields[0])
+			}
+			// Options such as -s or -bm precede the file name, which is always last
+			current.Maps[fields[0]] = fields[len(fields)-1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mtl file %s: %w", path, err)
+	}
+
+	return lib, nil
+}
+
+// Material returns the material with the given name
+func (l *MaterialLibrary) Material(name string) (*Material, bool) {
+	for i := range l.Materials {
+		if l.Materials[i].Name == name {
+			return &l.Materials[i], true
+		}
+	}
+	return nil, false
+}
+
+// TexturePaths returns every texture referenced by the library, resolved
+// relative to the MTL file and without duplicates.
+func (l *MaterialLibrary) TexturePaths() []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, mat := range l.Materials {
+		for _, key := range slices.Sorted(maps.Keys(mat.Maps)) {
+			p := ResolvePath(filepath.Dir(l.Path), mat.Maps[key])
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+func parseFloats(fields []string, n int) ([]float64, error) {
+	if len(fields) < n {
+		return nil, fmt.Errorf("expected %d values, got %d", n, len(fields))
+	}
+	out := make([]float64, n)
+	for i := 0; i < n; i++ {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// ResolvePath resolves a file referenced from dir, such as a map_Kd texture of
+// an MTL file. The reference may be absolute or use backslashes.
+func ResolvePath(dir, ref string) string {
+	ref = filepath.FromSlash(strings.ReplaceAll(ref, "\\", "/"))
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(dir, ref)
+}
@@ -0,0 +1,169 @@
+package obj_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/obj"
+)
+
+func TestParse(t *testing.T) {
+	model, err := obj.Parse("testdata/quad.obj")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(model.Positions) != 4 || len(model.TexCoords) != 4 || len(model.Normals) != 1 {
+		t.Errorf("unexpected element counts: %d positions, %d uvs, %d normals", len(model.Positions), len(model.TexCoords), len(model.Normals))
+	}
+
+	if len(model.Faces) != 2 {
+		t.Fatalf("expected 2 faces, got %d", len(model.Faces))
+	}
+
+	// Negative indices are relative to the elements declared so far
+	last := model.Faces[1].Vertices[2]
+	if last.Position != 3 || last.TexCoord != 3 || last.Normal != 0 {
+		t.Errorf("unexpected resolved face vertex %+v", last)
+	}
+
+	if model.Faces[0].Material != "material_00" {
+		t.Errorf("expected material_00, got %q", model.Faces[0].Material)
+	}
+}
+
+func TestParseMTL(t *testing.T) {
+	lib, err := obj.ParseMTL("testdata/quad.mtl")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mat, ok := lib.Material("material_00")
+	if !ok {
+		t.Fatalf("expected material_00 to be defined")
+	}
+
+	if mat.Maps["map_Kd"] != "textures/quad_map_Kd.png" {
+		t.Errorf("unexpected map_Kd %q", mat.Maps["map_Kd"])
+	}
+
+	paths := lib.TexturePaths()
+	if len(paths) != 1 || paths[0] != filepath.Join("testdata", "textures", "quad_map_Kd.png") {
+		t.Errorf("unexpected texture paths %v", paths)
+	}
+}
+
+func TestValidate_MissingTexture(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "mesh.obj"), "mtllib mesh.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl a\nusemtl b\nf 1 2 3\nf 1 2 4\n")
+	writeFile(t, filepath.Join(dir, "mesh.mtl"), "newmtl b\nmap_Kd missing.jpg\n")
+
+	model, err := obj.Parse(filepath.Join(dir, "mesh.obj"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = obj.Validate(model)
+
+	var verr *obj.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	if len(verr.Problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", verr.Problems)
+	}
+	if !strings.Contains(verr.Problems[0], "1 faces reference missing") {
+		t.Errorf("unexpected problem %q", verr.Problems[0])
+	}
+	if !strings.Contains(verr.Problems[1], "missing.jpg is missing") {
+		t.Errorf("unexpected problem %q", verr.Problems[1])
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+
+	written, err := obj.Export("testdata/quad.obj", dir, "final")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(written) != 3 {
+		t.Errorf("expected 3 files written, got %v", written)
+	}
+
+	objData, err := os.ReadFile(filepath.Join(dir, "final.obj"))
+	if err != nil {
+		t.Fatalf("failed to read exported obj: %v", err)
+	}
+	if !strings.Contains(string(objData), "mtllib final.mtl\n") {
+		t.Errorf("expected mtllib to reference final.mtl, got:\n%s", objData)
+	}
+
+	mtlData, err := os.ReadFile(filepath.Join(dir, "final.mtl"))
+	if err != nil {
+		t.Fatalf("failed to read exported mtl: %v", err)
+	}
+	if !strings.Contains(string(mtlData), "map_Kd quad_map_Kd.png\n") {
+		t.Errorf("expected map_Kd to be rewritten, got:\n%s", mtlData)
+	}
+
+	// The exported model must validate on its own
+	model, err := obj.Parse(filepath.Join(dir, "final.obj"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := obj.Validate(model); err != nil {
+		t.Errorf("exported model is invalid: %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	model, err := obj.Parse("testdata/quad.obj")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lib, err := obj.ParseMTL("testdata/quad.mtl")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	model.MaterialLibs = []string{"copy.mtl"}
+	if err := obj.Write(filepath.Join(dir, "copy.obj"), model); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := obj.WriteMTL(filepath.Join(dir, "copy.mtl"), lib); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := obj.Parse(filepath.Join(dir, "copy.obj"))
+	if err != nil {
+		t.Fatalf("failed to parse written model: %v", err)
+	}
+	if len(got.Positions) != len(model.Positions) || len(got.TexCoords) != len(model.TexCoords) || len(got.Normals) != len(model.Normals) {
+		t.Errorf("unexpected element counts: %d positions, %d uvs, %d normals", len(got.Positions), len(got.TexCoords), len(got.Normals))
+	}
+	if len(got.Faces) != 2 || got.Faces[1].Vertices[2] != model.Faces[1].Vertices[2] || got.Faces[0].Material != "material_00" {
+		t.Errorf("unexpected faces %+v", got.Faces)
+	}
+
+	gotLib, err := obj.ParseMTL(filepath.Join(dir, "copy.mtl"))
+	if err != nil {
+		t.Fatalf("failed to parse written library: %v", err)
+	}
+	if len(gotLib.Materials) != 1 || gotLib.Materials[0].Maps["map_Kd"] != lib.Materials[0].Maps["map_Kd"] {
+		t.Errorf("unexpected materials %+v", gotLib.Materials)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
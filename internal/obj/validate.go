@@ -0,0 +1,98 @@
+package obj
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ValidationError lists every problem found in a model and its materials
+type ValidationError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid obj %s: %s", e.Path, strings.Join(e.Problems, "; "))
+}
+
+// Validate checks that every face index is in range, that every material
+// library and texture referenced by the model exists and that every material
+// used by a face is defined. It returns the parsed material libraries so
+// callers do not need to read them a second time.
+func Validate(m *Model) ([]*MaterialLibrary, error) {
+	var problems []string
+
+	if len(m.Faces) == 0 {
+		problems = append(problems, "model has no faces")
+	}
+
+	badFaces, firstBad := 0, -1
+	for i, face := range m.Faces {
+		if !faceInRange(m, face) {
+			if firstBad < 0 {
+				firstBad = i
+			}
+			badFaces++
+		}
+	}
+	if badFaces > 0 {
+		problems = append(problems, fmt.Sprintf("%d faces reference missing vertices, texture coordinates or normals (first is face %d)", badFaces, firstBad+1))
+	}
+
+	var libs []*MaterialLibrary
+	for _, path := range m.MaterialLibPaths() {
+		lib, err := ParseMTL(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		libs = append(libs, lib)
+
+		for _, tex := range lib.TexturePaths() {
+			if _, err := os.Stat(tex); err != nil {
+				problems = append(problems, fmt.Sprintf("texture %s is missing", tex))
+			}
+		}
+	}
+
+	used := map[string]bool{}
+	for _, face := range m.Faces {
+		if face.Material != "" {
+			used[face.Material] = true
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(used)) {
+		if !hasMaterial(libs, name) {
+			problems = append(problems, fmt.Sprintf("material %s is not defined", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return libs, &ValidationError{Path: m.Path, Problems: problems}
+	}
+	return libs, nil
+}
+
+func hasMaterial(libs []*MaterialLibrary, name string) bool {
+	for _, lib := range libs {
+		if _, ok := lib.Material(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func faceInRange(m *Model, face Face) bool {
+	for _, fv := range face.Vertices {
+		if fv.Position < 0 || fv.Position >= len(m.Positions) {
+			return false
+		}
+		if fv.TexCoord < -1 || fv.TexCoord >= len(m.TexCoords) || fv.Normal < -1 || fv.Normal >= len(m.Normals) {
+			return false
+		}
+	}
+	return true
+}
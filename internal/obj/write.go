@@ -0,0 +1,85 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Write saves the model to path. Material libraries are written as the
+// mtllib references held by the model.
+func Write(path string, m *Model) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create obj file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	if len(m.MaterialLibs) > 0 {
+		fmt.Fprintf(w, "mtllib %s\n", strings.Join(m.MaterialLibs, " "))
+	}
+	for _, p := range m.Positions {
+		fmt.Fprintf(w, "v %s %s %s\n", formatFloat(p[0]), formatFloat(p[1]), formatFloat(p[2]))
+	}
+	for _, uv := range m.TexCoords {
+		fmt.Fprintf(w, "vt %s %s\n", formatFloat(uv[0]), formatFloat(uv[1]))
+	}
+	for _, n := range m.Normals {
+		fmt.Fprintf(w, "vn %s %s %s\n", formatFloat(n[0]), formatFloat(n[1]), formatFloat(n[2]))
+	}
+
+	material := ""
+	for _, face := range m.Faces {
+		if face.Material != material && face.Material != "" {
+			fmt.Fprintf(w, "usemtl %s\n", face.Material)
+		}
+		material = face.Material
+
+		w.WriteString("f")
+		for _, fv := range face.Vertices {
+			w.WriteString(" " + strconv.Itoa(fv.Position+1))
+			switch {
+			case fv.TexCoord >= 0 && fv.Normal >= 0:
+				fmt.Fprintf(w, "/%d/%d", fv.TexCoord+1, fv.Normal+1)
+			case fv.TexCoord >= 0:
+				fmt.Fprintf(w, "/%d", fv.TexCoord+1)
+			case fv.Normal >= 0:
+				fmt.Fprintf(w, "//%d", fv.Normal+1)
+			}
+		}
+		w.WriteString("\n")
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write obj file %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// WriteMTL saves the material library to path. Only the diffuse color and
+// texture statements are written.
+func WriteMTL(path string, lib *MaterialLibrary) error {
+	var b strings.Builder
+	for _, mat := range lib.Materials {
+		fmt.Fprintf(&b, "newmtl %s\n", mat.Name)
+		fmt.Fprintf(&b, "Kd %s %s %s\n", formatFloat(mat.Diffuse[0]), formatFloat(mat.Diffuse[1]), formatFloat(mat.Diffuse[2]))
+		for _, key := range slices.Sorted(maps.Keys(mat.Maps)) {
+			fmt.Fprintf(&b, "%s %s\n", key, mat.Maps[key])
+		}
+		b.WriteString("\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write mtl file %s: %w", path, err)
+	}
+	return nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,135 @@
+package openmvg
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// SfM engines of openMVG_main_SfM
+const (
+	EngineIncremental   = "INCREMENTAL"
+	EngineIncrementalV2 = "INCREMENTALV2"
+	EngineGlobal        = "GLOBAL"
+	EngineStellar       = "STELLAR"
+)
+
+// Geometric models of openMVG_main_GeometricFilter
+const (
+	ModelFundamental = "f"
+	ModelEssential   = "e"
+)
+
+// Rotation averaging methods of the GLOBAL engine
+var rotationAveraging = map[string]string{"L1": "1", "L2": "2"}
+
+// Translation averaging methods of the GLOBAL engine
+var translationAveraging = map[string]string{"L1": "1", "L2": "2", "SOFTL1": "3"}
+
+var graphSimplifications = []string{"NONE", "MST_X", "STAR_X"}
+
+var initializers = []string{"EXISTING_POSE", "MAX_PAIR", "AUTO_PAIR", "STELLAR"}
+
+// EngineOptions select the SfM engine and its engine specific options. Empty
+// fields keep the OpenMVG defaults.
+type EngineOptions struct {
+	// Name is one of the Engine constants, INCREMENTAL when empty
+	Name string
+	// RotationAveraging is L1 or L2, GLOBAL only
+	RotationAveraging string
+	// TranslationAveraging is L1, L2 or SOFTL1, GLOBAL only
+	TranslationAveraging string
+	// GraphSimplification is NONE, MST_X or STAR_X, STELLAR only
+	GraphSimplification      string
+	GraphSimplificationValue int
+	// Initializer picks the initial pair or triplet, INCREMENTALV2 only
+	Initializer string
+}
+
+// Engine returns the name of the engine
+func (o EngineOptions) Engine() string {
+	if o.Name == "" {
+		return EngineIncremental
+	}
+	return o.Name
+}
+
+// Validate reports options that OpenMVG would reject or that do not apply to
+// the engine
+func (o EngineOptions) Validate() error {
+	engine := o.Engine()
+	switch engine {
+	case EngineIncremental, EngineIncrementalV2, EngineGlobal, EngineStellar:
+	default:
+		return fmt.Errorf("unknown SfM engine %q", o.Name)
+	}
+
+	if o.RotationAveraging != "" {
+		if engine != EngineGlobal {
+			return fmt.Errorf("rotation averaging only applies to the %s engine", EngineGlobal)
+		}
+		if _, ok := rotationAveraging[o.RotationAveraging]; !ok {
+			return fmt.Errorf("unknown rotation averaging %q, expected L1 or L2", o.RotationAveraging)
+		}
+	}
+	if o.TranslationAveraging != "" {
+		if engine != EngineGlobal {
+			return fmt.Errorf("translation averaging only applies to the %s engine", EngineGlobal)
+		}
+		if _, ok := translationAveraging[o.TranslationAveraging]; !ok {
+			return fmt.Errorf("unknown translation averaging %q, expected L1, L2 or SOFTL1", o.TranslationAveraging)
+		}
+	}
+	if o.GraphSimplification != "" || o.GraphSimplificationValue != 0 {
+		if engine != EngineStellar {
+			return fmt.Errorf("graph simplification only applies to the %s engine", EngineStellar)
+		}
+		if o.GraphSimplification != "" && !slices.Contains(graphSimplifications, o.GraphSimplification) {
+			return fmt.Errorf("unknown graph simplification %q, expected NONE, MST_X or STAR_X", o.GraphSimplification)
+		}
+		if o.GraphSimplificationValue < 0 {
+			return fmt.Errorf("graph simplification value must not be negative")
+		}
+	}
+	if o.Initializer != "" {
+		if engine != EngineIncrementalV2 {
+			return fmt.Errorf("the SfM initializer only applies to the %s engine", EngineIncrementalV2)
+		}
+		if !slices.Contains(initializers, o.Initializer) {
+			return fmt.Errorf("unknown SfM initializer %q", o.Initializer)
+		}
+	}
+	return nil
+}
+
+// GeometricModel returns the model the matches have to be filtered with. The
+// GLOBAL and STELLAR engines work on relative motions, which need the
+// essential matrix; openMVG_main_SfM then reads matches.e.bin by default.
+func (o EngineOptions) GeometricModel() string {
+	switch o.Engine() {
+	case EngineGlobal, EngineStellar:
+		return ModelEssential
+	}
+	return ModelFundamental
+}
+
+// Args returns the engine specific openMVG_main_SfM arguments
+func (o EngineOptions) Args() []string {
+	var args []string
+	if o.RotationAveraging != "" {
+		args = append(args, "--rotationAveraging", rotationAveraging[o.RotationAveraging])
+	}
+	if o.TranslationAveraging != "" {
+		args = append(args, "--translationAveraging", translationAveraging[o.TranslationAveraging])
+	}
+	if o.GraphSimplification != "" {
+		args = append(args, "--graph_simplification", o.GraphSimplification)
+	}
+	if o.GraphSimplificationValue != 0 {
+		args = append(args, "--graph_simplification_value", strconv.Itoa(o.GraphSimplificationValue))
+	}
+	if o.Initializer != "" {
+		args = append(args, "--sfm_initializer", o.Initializer)
+	}
+	return args
+}
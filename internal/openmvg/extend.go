@@ -0,0 +1,220 @@
+package openmvg
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/matches"
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+// SfMExtendPipeline adds the images of ExtendDir to the reconstruction of a
+// previous run. Features and matches are computed for the new images only and
+// the previous camera poses seed an incremental reconstruction, which is then
+// registered and exported like the result of SfMSequentialPipeline.
+func (s *AppFileServiceImpl) SfMExtendPipeline() []pipeline.StepResult {
+	return pipeline.Run(s.Context, "SfMExtendPipeline", s.ExtendSteps(), s.Observer)
+}
+
+// ExtendSteps returns the steps of SfMExtendPipeline
+func (s *AppFileServiceImpl) ExtendSteps() []pipeline.Step {
+	return []pipeline.Step{
+		{Name: "image_listing", Run: s.RunSfMExtendImageListing},
+		{Name: "control_points", Run: s.RunSfMInjectControlPoints},
+		{Name: "features", Run: s.RunSfMComputeFeatures},
+		{Name: "matches", Run: s.RunSfMExtendMatches},
+		{Name: "reconstruction", Run: s.RunSfMExtendReconstruction},
+		{Name: "export_json", Run: s.RunSfMExportJSON},
+		{Name: "scale", Run: s.RunSfMScale},
+		{Name: "gcp_registration", Run: s.RunSfMControlPointRegistration},
+		{Name: "georeference", Run: s.RunSfMGeoreference},
+		{Name: "color", Run: s.RunSfMComputeSfMDataColor},
+		{Name: "openmvs_export", Run: s.RunOpenMVG2OpenMVS},
+	}
+}
+
+// RunSfMExtendImageListing replaces the image listing with the previous
+// reconstruction and appends the images of ExtendDir to it
+func (s *AppFileServiceImpl) RunSfMExtendImageListing() {
+	listing := filepath.Join(s.Config.MatchesDir, "sfm_data.json")
+	if !s.run("openMVG_main_ConvertSfM_DataFormat", []string{
+		"-i", s.Config.ReconstructionDir + "/sfm_data.bin",
+		"-o", listing,
+		"-V", "-I", "-E",
+	}, []string{listing}) {
+		return
+	}
+
+	extendDir := filepath.Join(s.Config.MatchesDir, "extend")
+	args := []string{
+		"-i", s.Config.ExtendDir,
+		"-o", extendDir,
+		"-d", *s.Config.CameraDBFile,
+		"-f", "2304",
+	}
+	if s.Config.Georeference != "" {
+		args = append(args, "-P")
+	}
+	extension := filepath.Join(extendDir, "sfm_data.json")
+	if !s.run("openMVG_main_SfMInit_ImageListing", args, []string{extension}) {
+		return
+	}
+
+	if err := s.appendViews(listing, extension); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to add new images: %w", err))
+		return
+	}
+}
+
+func (s *AppFileServiceImpl) appendViews(listing, extension string) error {
+	doc, err := sfmdata.ReadDocument(listing)
+	if err != nil {
+		return err
+	}
+	other, err := sfmdata.ReadDocument(extension)
+	if err != nil {
+		return err
+	}
+	sfm, err := doc.Decode()
+	if err != nil {
+		return err
+	}
+	added, err := other.Decode()
+	if err != nil {
+		return err
+	}
+	if len(added.Views) == 0 {
+		return fmt.Errorf("no images in %s", s.Config.ExtendDir)
+	}
+
+	// Features are stored by image name without its extension, so a new
+	// image must not share it with a previous one
+	var stems []string
+	for _, v := range sfm.Views {
+		stems = append(stems, strings.TrimSuffix(v.Filename, filepath.Ext(v.Filename)))
+	}
+	for _, v := range added.Views {
+		if slices.Contains(stems, strings.TrimSuffix(v.Filename, filepath.Ext(v.Filename))) {
+			return fmt.Errorf("image %s is already part of the reconstruction", v.Filename)
+		}
+	}
+
+	// The new images are found relative to the root of the previous ones
+	root, err := filepath.Abs(sfm.RootPath)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(s.Config.ExtendDir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+
+	ids, err := doc.AppendViews(other, filepath.ToSlash(rel)+"/")
+	if err != nil {
+		return err
+	}
+	if err := doc.Write(listing); err != nil {
+		return err
+	}
+	s.newViews = ids
+
+	fmt.Printf("→ Added %d images to the %d of the previous reconstruction\n", len(ids), len(sfm.Views))
+	return nil
+}
+
+// RunSfMExtendMatches matches the pairs of the configured strategy that
+// include a new image and merges them with the previous matches
+func (s *AppFileServiceImpl) RunSfMExtendMatches() {
+	sfm, err := sfmdata.Load(filepath.Join(s.Config.MatchesDir, "sfm_data.json"))
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to generate pairs: %w", err))
+		return
+	}
+	all, err := s.pairSet(sfm)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to generate pairs: %w", err))
+		return
+	}
+	set := pairs.Set{}
+	for p := range all {
+		if slices.Contains(s.newViews, p.I) || slices.Contains(s.newViews, p.J) {
+			set[p] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		s.Utils.Check(fmt.Errorf("failed to generate pairs: no pair includes a new image"))
+		return
+	}
+
+	pairsFile := s.Config.MatchesDir + "/pairs.extend.txt"
+	if err := pairs.Write(pairsFile, set); err != nil {
+		s.Utils.Check(err)
+		return
+	}
+	fmt.Printf("→ Generated %d pairs for %d new images\n", len(set), len(s.newViews))
+
+	putative := s.Config.MatchesDir + "/matches.extend.putative.bin"
+	if !s.run("openMVG_main_ComputeMatches", []string{
+		"-i", s.Config.MatchesDir + "/sfm_data.json",
+		"-p", pairsFile,
+		"-o", putative,
+	}, []string{putative}) {
+		return
+	}
+
+	model := s.Config.Engine.GeometricModel()
+	filtered := s.Config.MatchesDir + "/matches.extend." + model + ".bin"
+	if !s.run("openMVG_main_GeometricFilter", []string{
+		"-i", s.Config.MatchesDir + "/sfm_data.json",
+		"-m", putative,
+		"-g", model,
+		"-o", filtered,
+	}, []string{filtered}) {
+		return
+	}
+
+	path := s.Config.MatchesDir + "/matches." + model + ".bin"
+	previous, err := matches.Load(path)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to merge matches: %w", err))
+		return
+	}
+	added, err := matches.Load(filtered)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to merge matches: %w", err))
+		return
+	}
+	previous.Merge(added)
+	if err := matches.Save(path, previous); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to merge matches: %w", err))
+		return
+	}
+
+	fmt.Printf("→ Merged %d new matches over %d pairs\n", added.Count(), len(added))
+}
+
+// RunSfMExtendReconstruction resumes the reconstruction from the previous
+// camera poses, registering the new images and adjusting the whole scene
+func (s *AppFileServiceImpl) RunSfMExtendReconstruction() {
+	args := []string{
+		"--sfm_engine", EngineIncrementalV2,
+		"--sfm_initializer", "EXISTING_POSE",
+		"--input_file", s.Config.MatchesDir + "/sfm_data.json",
+		"--match_dir", s.Config.MatchesDir,
+		"--match_file", "matches." + s.Config.Engine.GeometricModel() + ".bin",
+		"--output_dir", s.Config.ReconstructionDir,
+	}
+	if s.Config.Georeference != "" {
+		args = append(args, "--prior_usage")
+	}
+
+	s.run("openMVG_main_SfM", args, []string{s.Config.ReconstructionDir + "/sfm_data.bin"})
+}
@@ -0,0 +1,102 @@
+package openmvg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+// Localization is the camera of a query image found in a reconstruction
+type Localization struct {
+	Image string
+	// Pose is nil when the image could not be localized
+	Pose      *sfmdata.Pose
+	Intrinsic *sfmdata.Intrinsic
+	// Inliers is the number of 2D-3D correspondences supporting the pose
+	Inliers int
+}
+
+// Localize finds the camera poses of query images in the reconstruction of
+// a previous run kept in MatchesDir and ReconstructionDir. The query is an
+// image or a directory of images. Poses are in the frame of the registered
+// scene when scaling or registration is configured.
+func (s *AppFileServiceImpl) Localize(query string) ([]Localization, error) {
+	info, err := os.Stat(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query: %w", err)
+	}
+
+	work, err := os.MkdirTemp(s.Config.MatchesDir, "localize")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create localization directory: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	// openMVG_main_SfM_Localization reads a directory of query images
+	queryDir := query
+	if !info.IsDir() {
+		queryDir = filepath.Join(work, "query")
+		abs, err := filepath.Abs(query)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(queryDir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.Symlink(abs, filepath.Join(queryDir, filepath.Base(query))); err != nil {
+			return nil, fmt.Errorf("failed to stage query image: %w", err)
+		}
+	}
+	entries, err := os.ReadDir(queryDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query: %w", err)
+	}
+	var images []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			images = append(images, e.Name())
+		}
+	}
+
+	outDir := filepath.Join(work, "out")
+	args := []string{
+		"-i", s.sfmDataFile(),
+		"-m", s.Config.MatchesDir,
+		"-o", outDir,
+		"-u", filepath.Join(work, "matches"),
+		"-q", queryDir,
+		// Keeps the inliers of each pose in the structure, where they are
+		// counted
+		"-e",
+	}
+	if err := s.Utils.RunCommand("openMVG_main_SfM_Localization", args); err != nil {
+		return nil, fmt.Errorf("failed to localize: %w", err)
+	}
+
+	sfm, err := sfmdata.Load(filepath.Join(outDir, "sfm_data_expanded.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read localization: %w", err)
+	}
+
+	// The query views are added after those of the reconstruction, so the
+	// last view of each file name is the query
+	views := map[string]sfmdata.View{}
+	for _, v := range sfm.Views {
+		views[v.Filename] = v
+	}
+	results := make([]Localization, 0, len(images))
+	for _, image := range images {
+		result := Localization{Image: image}
+		if v, ok := views[image]; ok {
+			result.Pose = sfm.Pose(v.PoseID)
+			result.Intrinsic = sfm.Intrinsic(v.IntrinsicID)
+			if result.Pose != nil {
+				result.Inliers = sfm.Observations[v.ID]
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
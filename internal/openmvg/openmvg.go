@@ -1,15 +1,30 @@
 package openmvg
 
+import "github.com/2024-dissertation/openmvgo/internal/pipeline"
+
 //go:generate mockgen -source=./openmvg.go -destination=../../mocks/mock_openmvg.go -package=mocks
 type OpenMVGServiceInterface interface {
 	RunHealthCheck()
-	SfMSequentialPipeline()
+	SfMSequentialPipeline() []pipeline.StepResult
+	SequentialSteps() []pipeline.Step
+	SfMExtendPipeline() []pipeline.StepResult
+	ExtendSteps() []pipeline.Step
 	RunSfMInitImageListing()
+	RunSfMGroupIntrinsics()
+	RunSfMInjectControlPoints()
 	RunSfMComputeFeatures()
 	RunSfMPairGenerator()
 	RunSfMComputeMatches()
 	RunSfMGeometricFilter()
 	RunSfMReconstruction()
 	RunSfMComputeSfMDataColor()
+	RunSfMExportJSON()
+	RunSfMScale()
+	RunSfMControlPointRegistration()
+	RunSfMGeoreference()
+	RunSfMExtendImageListing()
+	RunSfMExtendMatches()
+	RunSfMExtendReconstruction()
+	Localize(query string) ([]Localization, error)
 	PopulateTmpDir()
 }
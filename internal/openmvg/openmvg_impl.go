@@ -1,13 +1,31 @@
 package openmvg
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/2024-dissertation/openmvgo/internal/exif"
+	"github.com/2024-dissertation/openmvgo/internal/gcp"
+	"github.com/2024-dissertation/openmvgo/internal/geo"
+	"github.com/2024-dissertation/openmvgo/internal/grouping"
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/scale"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/transform"
 	"github.com/2024-dissertation/openmvgo/internal/utils"
 )
 
+// DefaultCameraDBURL is the sensor width database of OpenMVG
+const DefaultCameraDBURL = "https://raw.githubusercontent.com/openMVG/openMVG/refs/heads/develop/src/openMVG/exif/sensor_width_database/sensor_width_camera_database.txt"
+
 // Config for running the OpenMVG pipeline
 type OpenMVGConfig struct {
 	InputDir          string
@@ -15,6 +33,36 @@ type OpenMVGConfig struct {
 	MatchesDir        string
 	ReconstructionDir string
 	CameraDBFile      *string
+	// CameraDBURL is downloaded by PopulateTmpDir when CameraDBFile is not
+	// set, DefaultCameraDBURL when empty
+	CameraDBURL string
+	// Scale brings the reconstruction to metric units when set
+	Scale *scale.Constraints
+	// Georeference registers the reconstruction to the GPS positions of the
+	// images in a geo.FrameENU or geo.FrameUTM frame when set
+	Georeference string
+	// GCPFile lists ground control points the reconstruction is registered
+	// to, in the format read by gcp.ParseFile
+	GCPFile string
+	// Engine selects the SfM engine, INCREMENTAL by default
+	Engine EngineOptions
+	// Pairs selects the image pairs that are matched, exhaustive by default
+	Pairs pairs.Options
+	// Grouping assigns the images to intrinsic groups and rigs when set,
+	// otherwise OpenMVG groups images by camera model and focal length
+	Grouping grouping.Options
+	// ExtendDir holds new images that SfMExtendPipeline adds to the
+	// reconstruction kept in MatchesDir and ReconstructionDir by a previous run
+	ExtendDir string
+	// Threads bounds the threads of openMVG_main_ComputeFeatures when set,
+	// the other commands follow OMP_NUM_THREADS
+	Threads int
+}
+
+// QualityReport is written to quality.json after the reconstruction is
+// registered
+type QualityReport struct {
+	ControlPoints *gcp.Report `json:"control_points,omitempty"`
 }
 
 // Create an OpenMVG config. Handles creating tempory directories for mvs and reconstruction
@@ -26,9 +74,46 @@ func NewOpenMVGConfig(inputDir string, outputDir string, cameraDBFile *string) O
 	}
 }
 
+// SceneFile returns the OpenMVS scene exported by RunOpenMVG2OpenMVS
+func (c OpenMVGConfig) SceneFile() string {
+	return c.OutputDir + "/scene.mvs"
+}
+
+// GeoreferenceFile returns the frame written by RunSfMGeoreference or
+// RunSfMControlPointRegistration
+func (c OpenMVGConfig) GeoreferenceFile() string {
+	return c.OutputDir + "/georeference.json"
+}
+
+// Sidecars returns the colorized sparse point cloud and the reports of the
+// configured steps, which are published next to the OpenMVS results
+func (c OpenMVGConfig) Sidecars() []string {
+	paths := []string{c.ReconstructionDir + "/colorized.ply"}
+	if c.Scale != nil {
+		paths = append(paths, c.OutputDir+"/scale.json")
+	}
+	if c.Georeference != "" || c.GCPFile != "" {
+		paths = append(paths, c.GeoreferenceFile())
+	}
+	if c.GCPFile != "" {
+		paths = append(paths, c.OutputDir+"/quality.json")
+	}
+	if c.Grouping.Enabled() {
+		paths = append(paths, c.OutputDir+"/preflight.json")
+	}
+	return paths
+}
+
 type AppFileServiceImpl struct {
 	Utils  utils.UtilsInterface
 	Config OpenMVGConfig
+	// Observer receives the progress of the pipelines, if set
+	Observer pipeline.Observer
+	// Context parents the trace spans of the pipelines, if set
+	Context context.Context
+
+	// newViews are the views added by RunSfMExtendImageListing
+	newViews []uint32
 }
 
 func NewOpenMVGService(config OpenMVGConfig, utils utils.UtilsInterface) AppFileServiceImpl {
@@ -46,6 +131,24 @@ func NewOpenMVGService(config OpenMVGConfig, utils utils.UtilsInterface) AppFile
 		utils.Check(fmt.Errorf("failed to ensure output directory: %w", err))
 	}
 
+	if err := config.Engine.Validate(); err != nil {
+		utils.Check(fmt.Errorf("invalid SfM engine options: %w", err))
+	}
+
+	if err := config.Pairs.Validate(); err != nil {
+		utils.Check(fmt.Errorf("invalid pair options: %w", err))
+	}
+
+	if err := config.Grouping.Validate(); err != nil {
+		utils.Check(fmt.Errorf("invalid grouping options: %w", err))
+	}
+
+	if config.GCPFile != "" {
+		if _, err := gcp.ParseFile(config.GCPFile); err != nil {
+			utils.Check(fmt.Errorf("invalid ground control points: %w", err))
+		}
+	}
+
 	return AppFileServiceImpl{
 		Utils:  utils,
 		Config: config,
@@ -55,51 +158,161 @@ func NewOpenMVGService(config OpenMVGConfig, utils utils.UtilsInterface) AppFile
 func (s *AppFileServiceImpl) PopulateTmpDir() {
 	// Ensure the camera database file is set, if not download it
 	if s.Config.CameraDBFile == nil || *s.Config.CameraDBFile == "" {
-		f, err := s.Utils.DownloadFile("https://raw.githubusercontent.com/openMVG/openMVG/refs/heads/develop/src/openMVG/exif/sensor_width_database/sensor_width_camera_database.txt")
-		s.Utils.Check(err)
+		url := s.Config.CameraDBURL
+		if url == "" {
+			url = DefaultCameraDBURL
+		}
+		f, err := s.Utils.DownloadFile(url)
+		if err != nil {
+			s.Utils.Check(err)
+			return
+		}
 		s.Config.CameraDBFile = &f
 	}
 
 	timestamp := time.Now().Unix()
 
-	// Matches dir
-	matchesDir, err := os.MkdirTemp("", fmt.Sprintf("%dmatches", timestamp))
-	s.Utils.Check(err)
+	// Matches dir, unless kept in a work directory
+	if s.Config.MatchesDir == "" {
+		matchesDir, err := os.MkdirTemp("", fmt.Sprintf("%dmatches", timestamp))
+		s.Utils.Check(err)
 
-	s.Config.MatchesDir = matchesDir
+		s.Config.MatchesDir = matchesDir
+	}
 
-	// Reconstruction dir
-	reconstructionDir, err := os.MkdirTemp("", fmt.Sprintf("%dreconstruction", timestamp))
-	s.Utils.Check(err)
+	// Reconstruction dir, unless kept in a work directory
+	if s.Config.ReconstructionDir == "" {
+		reconstructionDir, err := os.MkdirTemp("", fmt.Sprintf("%dreconstruction", timestamp))
+		s.Utils.Check(err)
 
-	s.Config.ReconstructionDir = reconstructionDir
+		s.Config.ReconstructionDir = reconstructionDir
+	}
+}
 
+func (s *AppFileServiceImpl) SfMSequentialPipeline() []pipeline.StepResult {
+	return pipeline.Run(s.Context, "SfMSequentialPipeline", s.SequentialSteps(), s.Observer)
 }
 
-func (s *AppFileServiceImpl) SfMSequentialPipeline() {
-	s.RunSfMInitImageListing()
-	s.RunSfMComputeFeatures()
-	s.RunSfMPairGenerator()
-	s.RunSfMComputeMatches()
-	s.RunSfMGeometricFilter()
-	s.RunSfMReconstruction()
-	s.RunSfMComputeSfMDataColor()
-	s.RunOpenMVG2OpenMVS()
+// SequentialSteps returns the steps of SfMSequentialPipeline
+func (s *AppFileServiceImpl) SequentialSteps() []pipeline.Step {
+	return []pipeline.Step{
+		{Name: "image_listing", Run: s.RunSfMInitImageListing},
+		{Name: "group_intrinsics", Run: s.RunSfMGroupIntrinsics},
+		{Name: "control_points", Run: s.RunSfMInjectControlPoints},
+		{Name: "features", Run: s.RunSfMComputeFeatures},
+		{Name: "pairs", Run: s.RunSfMPairGenerator},
+		{Name: "matches", Run: s.RunSfMComputeMatches},
+		{Name: "geometric_filter", Run: s.RunSfMGeometricFilter},
+		{Name: "reconstruction", Run: s.RunSfMReconstruction},
+		{Name: "export_json", Run: s.RunSfMExportJSON},
+		{Name: "scale", Run: s.RunSfMScale},
+		{Name: "gcp_registration", Run: s.RunSfMControlPointRegistration},
+		{Name: "georeference", Run: s.RunSfMGeoreference},
+		{Name: "color", Run: s.RunSfMComputeSfMDataColor},
+		{Name: "openmvs_export", Run: s.RunOpenMVG2OpenMVS},
+	}
 }
 
 func (s *AppFileServiceImpl) RunHealthCheck() {
-	s.Utils.RunCommand("Tests", []string{})
+	s.run("Tests", []string{}, nil)
 }
 
 func (s *AppFileServiceImpl) RunSfMInitImageListing() {
+	if s.Config.Grouping.GroupBy == grouping.GroupByFolder {
+		// OpenMVG only lists the top level of the input, so the images of
+		// the subdirectories are linked next to each other
+		staging := filepath.Join(s.Config.MatchesDir, "images")
+		n, err := grouping.Stage(s.Config.InputDir, staging)
+		if err != nil {
+			s.Utils.Check(fmt.Errorf("failed to stage images: %w", err))
+			return
+		}
+		s.Config.InputDir = staging
+		fmt.Printf("→ Staged %d images from the input folders\n", n)
+	}
+
 	args := []string{
 		"-i", s.Config.InputDir,
 		"-o", s.Config.MatchesDir,
 		"-d", *s.Config.CameraDBFile,
 		"-f", "2304", // 2304 is the focal length, adjust as necessary
 	}
+	if s.Config.Georeference != "" {
+		// Store the EXIF GPS positions as pose priors
+		args = append(args, "-P")
+	}
+	if s.Config.Grouping.Enabled() {
+		// One intrinsic per image, which RunSfMGroupIntrinsics then groups
+		args = append(args, "-g", "0")
+	}
 
-	s.Utils.RunCommand("openMVG_main_SfMInit_ImageListing", args)
+	s.run("openMVG_main_SfMInit_ImageListing", args, []string{s.Config.MatchesDir + "/sfm_data.json"})
+}
+
+// RunSfMGroupIntrinsics assigns the listed images to the intrinsic groups of
+// the grouping options and writes the pre-flight report to preflight.json.
+// The pipeline stops if the report has errors.
+func (s *AppFileServiceImpl) RunSfMGroupIntrinsics() {
+	if !s.Config.Grouping.Enabled() {
+		return
+	}
+
+	path := filepath.Join(s.Config.MatchesDir, "sfm_data.json")
+	doc, err := sfmdata.ReadDocument(path)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to group intrinsics: %w", err))
+		return
+	}
+	sfm, err := doc.Decode()
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to group intrinsics: %w", err))
+		return
+	}
+
+	assignments, err := grouping.Assign(sfm, s.Config.InputDir, s.Config.Grouping)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to group intrinsics: %w", err))
+		return
+	}
+	plan, report := grouping.Plan(sfm, assignments, s.Config.Grouping)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to write pre-flight report: %w", err))
+		return
+	}
+	if err := os.WriteFile(filepath.Join(s.Config.OutputDir, "preflight.json"), data, 0o644); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to write pre-flight report: %w", err))
+		return
+	}
+
+	for _, g := range report.Groups {
+		fmt.Printf("→ Group %s: %d images, %d intrinsics\n", g.Name, g.Views, g.Intrinsics)
+	}
+	for _, w := range report.Warnings {
+		fmt.Printf("→ Warning: %s\n", w)
+	}
+	if len(report.Errors) > 0 {
+		s.Utils.Check(fmt.Errorf("pre-flight check failed: %s", strings.Join(report.Errors, "; ")))
+		return
+	}
+
+	if err := doc.SetViewIntrinsics(plan); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to group intrinsics: %w", err))
+		return
+	}
+	if err := doc.SetViewRigs(grouping.Rigs(assignments)); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to group intrinsics: %w", err))
+		return
+	}
+	if err := doc.RemoveUnusedIntrinsics(); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to group intrinsics: %w", err))
+		return
+	}
+	if err := doc.Write(path); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to group intrinsics: %w", err))
+		return
+	}
 }
 
 func (s *AppFileServiceImpl) RunSfMComputeFeatures() {
@@ -108,66 +321,479 @@ func (s *AppFileServiceImpl) RunSfMComputeFeatures() {
 		"-o", s.Config.MatchesDir,
 		"-m", "SIFT",
 	}
+	if s.Config.Threads > 0 {
+		args = append(args, "-n", strconv.Itoa(s.Config.Threads))
+	}
 
-	s.Utils.RunCommand("openMVG_main_ComputeFeatures", args)
+	s.run("openMVG_main_ComputeFeatures", args, []string{s.Config.MatchesDir + "/image_describer.json"})
 }
 
+// RunSfMPairGenerator lists the image pairs to match. Exhaustive matching is
+// left to openMVG_main_PairGenerator, the other strategies are generated here
+// and written to pairs.txt.
 func (s *AppFileServiceImpl) RunSfMPairGenerator() {
+	if s.generatesPairs() {
+		s.generatePairs()
+		return
+	}
+
 	args := []string{
 		"-i", s.Config.MatchesDir + "/sfm_data.json",
 		"-o", s.Config.MatchesDir + "/pairs.bin",
 	}
 
-	s.Utils.RunCommand("openMVG_main_PairGenerator", args)
+	s.run("openMVG_main_PairGenerator", args, []string{s.Config.MatchesDir + "/pairs.bin"})
+}
+
+func (s *AppFileServiceImpl) generatePairs() {
+	sfm, err := sfmdata.Load(filepath.Join(s.Config.MatchesDir, "sfm_data.json"))
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to generate pairs: %w", err))
+		return
+	}
+	set, err := s.pairSet(sfm)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to generate pairs: %w", err))
+		return
+	}
+
+	if err := pairs.Write(s.pairsFile(), set); err != nil {
+		s.Utils.Check(err)
+		return
+	}
+
+	fmt.Printf("→ Generated %d %s pairs for %d images\n", len(set), s.Config.Pairs.Strategy, len(sfm.Views))
+}
+
+// pairSet returns the pairs of the configured strategy
+func (s *AppFileServiceImpl) pairSet(sfm *sfmdata.SfMData) (pairs.Set, error) {
+	ids := make([]uint32, len(sfm.Views))
+	for i, v := range sfm.Views {
+		ids[i] = v.ID
+	}
+
+	switch s.Config.Pairs.Strategy {
+	case pairs.StrategyContiguous:
+		return pairs.Contiguous(ids, s.Config.Pairs.Window), nil
+	case pairs.StrategyGPS:
+		return s.gpsPairs(sfm)
+	case pairs.StrategyFile:
+		return pairs.ParseFile(s.Config.Pairs.File, sfm)
+	}
+	return pairs.Exhaustive(ids), nil
+}
+
+// gpsPairs pairs every image with its nearest neighbours by EXIF position.
+// Images without a position are paired with the images next to them in
+// sequence instead.
+func (s *AppFileServiceImpl) gpsPairs(sfm *sfmdata.SfMData) (pairs.Set, error) {
+	k := s.Config.Pairs.Neighbours
+
+	var fixes []geo.Position
+	var located []uint32
+	var unlocated []int
+	for i, v := range sfm.Views {
+		gps, err := exif.ReadGPS(filepath.Join(s.Config.InputDir, v.LocalPath, v.Filename))
+		if errors.Is(err, exif.ErrNoGPS) {
+			unlocated = append(unlocated, i)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fixes = append(fixes, geo.Position{Latitude: gps.Latitude, Longitude: gps.Longitude, Altitude: gps.Altitude})
+		located = append(located, v.ID)
+	}
+
+	set := pairs.Set{}
+	if len(fixes) > 0 {
+		origin := geo.Centroid(fixes)
+		positions := map[uint32][3]float64{}
+		for i, id := range located {
+			positions[id] = geo.ENU(origin, fixes[i])
+		}
+		set = pairs.Nearest(positions, k)
+	}
+	for _, i := range unlocated {
+		for j := max(0, i-k); j <= min(len(sfm.Views)-1, i+k); j++ {
+			set.Add(sfm.Views[i].ID, sfm.Views[j].ID)
+		}
+	}
+	if len(unlocated) > 0 {
+		fmt.Printf("→ %d images have no GPS position and are paired in sequence\n", len(unlocated))
+	}
+	return set, nil
+}
+
+// generatesPairs reports whether the pairs are generated here rather than by
+// openMVG_main_PairGenerator
+func (s *AppFileServiceImpl) generatesPairs() bool {
+	return s.Config.Pairs.Strategy != "" && s.Config.Pairs.Strategy != pairs.StrategyExhaustive
+}
+
+// pairsFile returns the pairs file openMVG_main_ComputeMatches reads
+func (s *AppFileServiceImpl) pairsFile() string {
+	if s.generatesPairs() {
+		return s.Config.MatchesDir + "/pairs.txt"
+	}
+	return s.Config.MatchesDir + "/pairs.bin"
 }
 
 func (s *AppFileServiceImpl) RunSfMComputeMatches() {
 	args := []string{
 		"-i", s.Config.MatchesDir + "/sfm_data.json",
-		"-p", s.Config.MatchesDir + "/pairs.bin",
+		"-p", s.pairsFile(),
 		"-o", s.Config.MatchesDir + "/matches.putative.bin",
 	}
 
-	s.Utils.RunCommand("openMVG_main_ComputeMatches", args)
+	s.run("openMVG_main_ComputeMatches", args, []string{s.Config.MatchesDir + "/matches.putative.bin"})
 }
 
+// RunSfMGeometricFilter filters the putative matches with the geometric
+// model the configured SfM engine expects
 func (s *AppFileServiceImpl) RunSfMGeometricFilter() {
+	model := s.Config.Engine.GeometricModel()
 	args := []string{
 		"-i", s.Config.MatchesDir + "/sfm_data.json",
 		"-m", s.Config.MatchesDir + "/matches.putative.bin",
-		"-g", "f",
-		"-o", s.Config.MatchesDir + "/matches.f.bin",
+		"-g", model,
+		"-o", s.Config.MatchesDir + "/matches." + model + ".bin",
 	}
 
-	s.Utils.RunCommand("openMVG_main_GeometricFilter", args)
+	s.run("openMVG_main_GeometricFilter", args, []string{s.Config.MatchesDir + "/matches." + model + ".bin"})
 }
 
 func (s *AppFileServiceImpl) RunSfMReconstruction() {
 	args := []string{
-		"--sfm_engine", "INCREMENTAL",
+		"--sfm_engine", s.Config.Engine.Engine(),
 		"--input_file", s.Config.MatchesDir + "/sfm_data.json",
 		"--match_dir", s.Config.MatchesDir,
+		// Read the matches RunSfMGeometricFilter wrote rather than rely on
+		// the default file of the engine
+		"--match_file", "matches." + s.Config.Engine.GeometricModel() + ".bin",
 		"--output_dir", s.Config.ReconstructionDir,
 	}
+	args = append(args, s.Config.Engine.Args()...)
+	if s.Config.Georeference != "" {
+		args = append(args, "--prior_usage")
+	}
 
-	s.Utils.RunCommand("openMVG_main_SfM", args)
+	s.run("openMVG_main_SfM", args, []string{s.Config.ReconstructionDir + "/sfm_data.bin"})
 }
 
 func (s *AppFileServiceImpl) RunSfMComputeSfMDataColor() {
 	args := []string{
-		"-i", s.Config.ReconstructionDir + "/sfm_data.bin",
+		"-i", s.sfmDataFile(),
 		"-o", s.Config.ReconstructionDir + "/colorized.ply",
 	}
 
-	s.Utils.RunCommand("openMVG_main_ComputeSfM_DataColor", args)
+	s.run("openMVG_main_ComputeSfM_DataColor", args, []string{s.Config.ReconstructionDir + "/colorized.ply"})
 }
 
-func (s *AppFileServiceImpl) RunOpenMVG2OpenMVS() {
+// RunSfMExportJSON writes the views, intrinsics and poses of the reconstruction
+// as sfm_data.json next to the OpenMVS scene
+func (s *AppFileServiceImpl) RunSfMExportJSON() {
 	args := []string{
 		"-i", s.Config.ReconstructionDir + "/sfm_data.bin",
-		"-o", s.Config.OutputDir + "/scene.mvs",
+		"-o", s.Config.OutputDir + "/sfm_data.json",
+		"-V", "-I", "-E",
+	}
+	if s.rewritesScene() {
+		// The rewritten scene replaces sfm_data.bin, so it needs the structure too
+		args = append(args, "-S", "-C")
+	}
+
+	s.run("openMVG_main_ConvertSfM_DataFormat", args, []string{s.Config.OutputDir + "/sfm_data.json"})
+}
+
+// RunSfMScale scales sfm_data.json so the reconstruction is in meters and
+// writes the scale and the residual of every distance to scale.json
+func (s *AppFileServiceImpl) RunSfMScale() {
+	if s.Config.Scale == nil {
+		return
+	}
+
+	path := filepath.Join(s.Config.OutputDir, "sfm_data.json")
+	doc, err := sfmdata.ReadDocument(path)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to scale reconstruction: %w", err))
+		return
+	}
+	sfm, err := doc.Decode()
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to scale reconstruction: %w", err))
+		return
+	}
+
+	result, err := scale.Estimate(sfm, s.Config.Scale)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to estimate scale: %w", err))
+		return
+	}
+	if err := doc.Transform(result.Similarity()); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to scale reconstruction: %w", err))
+		return
+	}
+	if err := doc.Write(path); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to scale reconstruction: %w", err))
+		return
+	}
+
+	report, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to write scale report: %w", err))
+		return
+	}
+	if err := os.WriteFile(filepath.Join(s.Config.OutputDir, "scale.json"), report, 0o644); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to write scale report: %w", err))
+		return
+	}
+
+	fmt.Printf("→ Scaled reconstruction by %g\n", result.Scale)
+	for _, r := range result.Residuals {
+		fmt.Printf("→ Distance %s-%s: %.4f m, residual %+.4f m\n", r.A, r.B, r.Expected, r.Error)
+	}
+}
+
+// RunSfMInjectControlPoints adds the ground control points to the
+// control_points section of the image listing
+func (s *AppFileServiceImpl) RunSfMInjectControlPoints() {
+	if s.Config.GCPFile == "" {
+		return
+	}
+
+	points, err := gcp.ParseFile(s.Config.GCPFile)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to inject control points: %w", err))
+		return
+	}
+
+	path := filepath.Join(s.Config.MatchesDir, "sfm_data.json")
+	doc, err := sfmdata.ReadDocument(path)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to inject control points: %w", err))
+		return
+	}
+	sfm, err := doc.Decode()
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to inject control points: %w", err))
+		return
+	}
+
+	doc.SetControlPoints(gcp.ControlPoints(sfm, points, gcp.Origin(points)))
+	if err := doc.Write(path); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to inject control points: %w", err))
+		return
+	}
+
+	fmt.Printf("→ Injected %d control points\n", len(points))
+}
+
+// RunSfMControlPointRegistration triangulates the ground control points in
+// sfm_data.json, registers the reconstruction to their surveyed positions
+// relative to their centroid, writes the residual of every point to
+// quality.json and the centroid to georeference.json
+func (s *AppFileServiceImpl) RunSfMControlPointRegistration() {
+	if s.Config.GCPFile == "" {
+		return
+	}
+
+	points, err := gcp.ParseFile(s.Config.GCPFile)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to register control points: %w", err))
+		return
+	}
+
+	path := filepath.Join(s.Config.OutputDir, "sfm_data.json")
+	doc, err := sfmdata.ReadDocument(path)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to register control points: %w", err))
+		return
+	}
+	sfm, err := doc.Decode()
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to register control points: %w", err))
+		return
+	}
+
+	t, report, err := gcp.Register(sfm, points)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to register control points: %w", err))
+		return
+	}
+	if err := doc.Transform(t); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to register control points: %w", err))
+		return
+	}
+	// The control points themselves stay at their surveyed positions
+	doc.SetControlPoints(gcp.ControlPoints(sfm, points, report.Origin))
+	if err := doc.Write(path); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to register control points: %w", err))
+		return
+	}
+
+	data, err := json.MarshalIndent(QualityReport{ControlPoints: report}, "", "  ")
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to write quality report: %w", err))
+		return
+	}
+	if err := os.WriteFile(filepath.Join(s.Config.OutputDir, "quality.json"), data, 0o644); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to write quality report: %w", err))
+		return
+	}
+
+	// The exports add the origin back to return to the surveyed coordinates
+	toSurvey := transform.Identity()
+	toSurvey.Translation = report.Origin
+	georef := geo.Georeference{
+		Transform: toSurvey.Matrix(),
+		Registration: geo.Registration{
+			Source: "gcp",
+			Matrix: t.Matrix(),
+			Points: report.ControlPoints,
+			RMSE:   report.RMSE,
+		},
+	}
+	if err := georef.Write(s.Config.GeoreferenceFile()); err != nil {
+		s.Utils.Check(err)
+		return
+	}
+
+	fmt.Printf("→ Registered to %d control points, RMSE %.3f m\n", report.ControlPoints, report.RMSE)
+	for _, r := range report.Residuals {
+		kind := "GCP"
+		if r.Check {
+			kind = "Check point"
+		}
+		fmt.Printf("→ %s %s: residual %.3f m\n", kind, r.Name, r.Distance)
+	}
+}
+
+// RunSfMGeoreference registers sfm_data.json to the EXIF GPS positions of the
+// registered images and writes the frame to georeference.json
+func (s *AppFileServiceImpl) RunSfMGeoreference() {
+	if s.Config.Georeference == "" {
+		return
+	}
+
+	path := filepath.Join(s.Config.OutputDir, "sfm_data.json")
+	doc, err := sfmdata.ReadDocument(path)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %w", err))
+		return
+	}
+	sfm, err := doc.Decode()
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %w", err))
+		return
+	}
+
+	var centers [][3]float64
+	var positions []geo.Position
+	for _, view := range sfm.Views {
+		pose := sfm.Pose(view.PoseID)
+		if pose == nil {
+			continue
+		}
+		gps, err := exif.ReadGPS(filepath.Join(s.Config.InputDir, view.LocalPath, view.Filename))
+		if errors.Is(err, exif.ErrNoGPS) {
+			continue
+		}
+		if err != nil {
+			s.Utils.Check(fmt.Errorf("failed to read GPS position: %w", err))
+			return
+		}
+		centers = append(centers, pose.Center)
+		positions = append(positions, geo.Position{Latitude: gps.Latitude, Longitude: gps.Longitude, Altitude: gps.Altitude})
+	}
+	if len(positions) < 3 {
+		s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %d registered images have a GPS position, at least 3 are needed", len(positions)))
+		return
+	}
+
+	frame, err := geo.NewFrame(s.Config.Georeference, geo.Centroid(positions))
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %w", err))
+		return
+	}
+	targets := make([][3]float64, len(positions))
+	for i, p := range positions {
+		if targets[i], err = frame.Local(p); err != nil {
+			s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %w", err))
+			return
+		}
+	}
+
+	t, err := transform.Fit(centers, targets)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %w", err))
+		return
+	}
+	if err := doc.Transform(t); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %w", err))
+		return
+	}
+	if err := doc.Write(path); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to georeference reconstruction: %w", err))
+		return
+	}
+
+	georef := geo.Georeference{
+		CRS:       frame.CRS(),
+		Origin:    frame.Origin,
+		Transform: frame.ToCRS(),
+		Registration: geo.Registration{
+			Source: "exif",
+			Matrix: t.Matrix(),
+			Points: len(centers),
+			RMSE:   transform.RMSE(t, centers, targets),
+		},
+	}
+	if err := georef.Write(s.Config.GeoreferenceFile()); err != nil {
+		s.Utils.Check(err)
+		return
+	}
+
+	fmt.Printf("→ Registered %d cameras to %s, RMSE %.3f m\n", georef.Registration.Points, georef.CRS, georef.Registration.RMSE)
+}
+
+// rewritesScene reports whether sfm_data.json is transformed after the
+// reconstruction, in which case it replaces sfm_data.bin
+func (s *AppFileServiceImpl) rewritesScene() bool {
+	return s.Config.Scale != nil || s.Config.Georeference != "" || s.Config.GCPFile != ""
+}
+
+// sfmDataFile returns the scene the later OpenMVG steps read, the transformed
+// sfm_data.json when scaling or registration is configured
+func (s *AppFileServiceImpl) sfmDataFile() string {
+	if s.rewritesScene() {
+		return s.Config.OutputDir + "/sfm_data.json"
+	}
+	return s.Config.ReconstructionDir + "/sfm_data.bin"
+}
+
+func (s *AppFileServiceImpl) RunOpenMVG2OpenMVS() {
+	args := []string{
+		"-i", s.sfmDataFile(),
+		"-o", s.Config.SceneFile(),
 		"-d", s.Config.OutputDir,
 	}
 
-	s.Utils.RunCommand("openMVG_main_openMVG2openMVS", args)
+	s.run("openMVG_main_openMVG2openMVS", args, []string{s.Config.SceneFile()})
+}
+
+// run runs an OpenMVG command and checks that it wrote its outputs, a failed
+// command fails the step so that the pipeline stops. It tells if the command
+// succeeded, for steps that go on after it.
+func (s *AppFileServiceImpl) run(name string, args, outputs []string) bool {
+	if err := s.Utils.RunCommand(name, args); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to run %s: %w", name, err))
+		return false
+	}
+
+	if err := utils.RequireFiles(outputs); err != nil {
+		s.Utils.Check(fmt.Errorf("%s did not write its output: %w", name, err))
+		return false
+	}
+	return true
 }
@@ -1,9 +1,25 @@
 package openmvg_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/2024-dissertation/openmvgo/internal/geo"
+	"github.com/2024-dissertation/openmvgo/internal/grouping"
+	"github.com/2024-dissertation/openmvgo/internal/matches"
 	"github.com/2024-dissertation/openmvgo/internal/openmvg"
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/scale"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
 	"github.com/2024-dissertation/openmvgo/mocks"
 	"go.uber.org/mock/gomock"
 )
@@ -47,6 +63,7 @@ func TestRunSfMInitImageListing(t *testing.T) {
 	config := openmvg.OpenMVGConfig{
 		InputDir:     "input",
 		OutputDir:    "output",
+		MatchesDir:   t.TempDir(),
 		CameraDBFile: &cameraDBFile,
 	}
 
@@ -64,7 +81,7 @@ func TestRunSfMInitImageListing(t *testing.T) {
 
 	mockUtils.EXPECT().
 		RunCommand("openMVG_main_SfMInit_ImageListing", expectedArgs).
-		Return(nil)
+		DoAndReturn(writesOutputs(t, config.MatchesDir+"/sfm_data.json"))
 
 	service.RunSfMInitImageListing()
 }
@@ -78,8 +95,9 @@ func TestRunSfMComputeFeatures(t *testing.T) {
 	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
 
 	config := openmvg.OpenMVGConfig{
-		InputDir:  "input",
-		OutputDir: "output",
+		InputDir:   "input",
+		OutputDir:  "output",
+		MatchesDir: t.TempDir(),
 	}
 
 	service := openmvg.NewOpenMVGService(
@@ -95,11 +113,123 @@ func TestRunSfMComputeFeatures(t *testing.T) {
 
 	mockUtils.EXPECT().
 		RunCommand("openMVG_main_ComputeFeatures", expectedArgs).
-		Return(nil)
+		DoAndReturn(writesOutputs(t, config.MatchesDir+"/image_describer.json"))
+
+	service.RunSfMComputeFeatures()
+}
+
+func TestRunSfMComputeFeatures_Threads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	config := openmvg.OpenMVGConfig{
+		InputDir:   "input",
+		OutputDir:  "output",
+		MatchesDir: t.TempDir(),
+		Threads:    8,
+	}
+
+	service := openmvg.NewOpenMVGService(
+		config,
+		mockUtils,
+	)
+
+	expectedArgs := []string{
+		"-i", config.MatchesDir + "/sfm_data.json",
+		"-o", config.MatchesDir,
+		"-m", "SIFT",
+		"-n", "8",
+	}
+
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_ComputeFeatures", expectedArgs).
+		DoAndReturn(writesOutputs(t, config.MatchesDir+"/image_describer.json"))
+
+	service.RunSfMComputeFeatures()
+}
+
+func TestRunSfMComputeFeatures_LimitExceeded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: "output", MatchesDir: t.TempDir()},
+		mockUtils,
+	)
+
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_ComputeFeatures", gomock.Any()).
+		Return(&utils.LimitError{Name: "openMVG_main_ComputeFeatures", Resource: utils.ResourceMemory})
+
+	// The pipeline fails the job for good on a *LimitError, which must
+	// reach it
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			var limitErr *utils.LimitError
+			if !errors.As(err, &limitErr) {
+				t.Errorf("expected the *LimitError to be checked, got %v", err)
+			}
+		})
 
 	service.RunSfMComputeFeatures()
 }
 
+func TestSequentialSteps_FailedCommand(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_ComputeFeatures", gomock.Any()).
+		Return(errors.New("exit status 1"))
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err != nil {
+				panic(err)
+			}
+		})
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: "output", MatchesDir: t.TempDir()},
+		mockUtils,
+	)
+	var step pipeline.Step
+	for _, s := range service.SequentialSteps() {
+		if s.Name == "features" {
+			step = s
+		}
+	}
+
+	var events []pipeline.Event
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected the failed command to fail the step")
+		}
+		if len(events) != 2 || events[1].Type != pipeline.StageFailed {
+			t.Fatalf("expected the step to be reported failed, got %+v", events)
+		}
+		if !strings.Contains(events[1].Error, "openMVG_main_ComputeFeatures") {
+			t.Errorf("expected the failed command to be reported, got %q", events[1].Error)
+		}
+	}()
+
+	pipeline.RunStep(context.Background(), step, func(e pipeline.Event) {
+		events = append(events, e)
+	})
+}
+
 func TestRunSfMComputeMatches(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -109,8 +239,9 @@ func TestRunSfMComputeMatches(t *testing.T) {
 	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
 
 	config := openmvg.OpenMVGConfig{
-		InputDir:  "input",
-		OutputDir: "output",
+		InputDir:   "input",
+		OutputDir:  "output",
+		MatchesDir: t.TempDir(),
 	}
 
 	service := openmvg.NewOpenMVGService(
@@ -126,7 +257,7 @@ func TestRunSfMComputeMatches(t *testing.T) {
 
 	mockUtils.EXPECT().
 		RunCommand("openMVG_main_ComputeMatches", expectedArgs).
-		Return(nil)
+		DoAndReturn(writesOutputs(t, config.MatchesDir+"/matches.putative.bin"))
 
 	service.RunSfMComputeMatches()
 }
@@ -140,8 +271,10 @@ func TestRunSfMReconstruction(t *testing.T) {
 	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
 
 	config := openmvg.OpenMVGConfig{
-		InputDir:  "input",
-		OutputDir: "output",
+		InputDir:          "input",
+		OutputDir:         "output",
+		MatchesDir:        t.TempDir(),
+		ReconstructionDir: t.TempDir(),
 	}
 
 	service := openmvg.NewOpenMVGService(
@@ -153,12 +286,13 @@ func TestRunSfMReconstruction(t *testing.T) {
 		"--sfm_engine", "INCREMENTAL",
 		"--input_file", config.MatchesDir + "/sfm_data.json",
 		"--match_dir", config.MatchesDir,
+		"--match_file", "matches.f.bin",
 		"--output_dir", config.ReconstructionDir,
 	}
 
 	mockUtils.EXPECT().
 		RunCommand("openMVG_main_SfM", expectedArgs).
-		Return(nil)
+		DoAndReturn(writesOutputs(t, config.ReconstructionDir+"/sfm_data.bin"))
 
 	service.RunSfMReconstruction()
 }
@@ -172,8 +306,9 @@ func TestRunSfMComputeSfMDataColor(t *testing.T) {
 	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
 
 	config := openmvg.OpenMVGConfig{
-		InputDir:  "input",
-		OutputDir: "output",
+		InputDir:          "input",
+		OutputDir:         "output",
+		ReconstructionDir: t.TempDir(),
 	}
 
 	service := openmvg.NewOpenMVGService(
@@ -188,11 +323,42 @@ func TestRunSfMComputeSfMDataColor(t *testing.T) {
 
 	mockUtils.EXPECT().
 		RunCommand("openMVG_main_ComputeSfM_DataColor", expectedArgs).
-		Return(nil)
+		DoAndReturn(writesOutputs(t, config.ReconstructionDir+"/colorized.ply"))
 
 	service.RunSfMComputeSfMDataColor()
 }
 
+func TestRunSfMExportJSON(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	config := openmvg.OpenMVGConfig{
+		InputDir:  "input",
+		OutputDir: t.TempDir(),
+	}
+
+	service := openmvg.NewOpenMVGService(
+		config,
+		mockUtils,
+	)
+
+	expectedArgs := []string{
+		"-i", config.ReconstructionDir + "/sfm_data.bin",
+		"-o", config.OutputDir + "/sfm_data.json",
+		"-V", "-I", "-E",
+	}
+
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_ConvertSfM_DataFormat", expectedArgs).
+		DoAndReturn(writesOutputs(t, config.OutputDir+"/sfm_data.json"))
+
+	service.RunSfMExportJSON()
+}
+
 func TestRunOpenMVG2OpenMVS(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -203,7 +369,7 @@ func TestRunOpenMVG2OpenMVS(t *testing.T) {
 
 	config := openmvg.OpenMVGConfig{
 		InputDir:  "input",
-		OutputDir: "output",
+		OutputDir: t.TempDir(),
 	}
 
 	service := openmvg.NewOpenMVGService(
@@ -219,7 +385,7 @@ func TestRunOpenMVG2OpenMVS(t *testing.T) {
 
 	mockUtils.EXPECT().
 		RunCommand("openMVG_main_openMVG2openMVS", expectedArgs).
-		Return(nil)
+		DoAndReturn(writesOutputs(t, config.OutputDir+"/scene.mvs"))
 
 	service.RunOpenMVG2OpenMVS()
 }
@@ -249,6 +415,20 @@ func TestRunHealthCheck(t *testing.T) {
 	service.RunHealthCheck()
 }
 
+// writesOutputs stubs a command that writes its outputs
+func writesOutputs(t *testing.T, paths ...string) func(string, []string) error {
+	t.Helper()
+
+	return func(string, []string) error {
+		for _, path := range paths {
+			if err := os.WriteFile(path, []byte("output"), 0o644); err != nil {
+				t.Fatalf("failed to write %s: %v", path, err)
+			}
+		}
+		return nil
+	}
+}
+
 func TestSfMSequentialPipeline(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -259,9 +439,11 @@ func TestSfMSequentialPipeline(t *testing.T) {
 
 	cameraDBFile := "camera_db.txt"
 	config := openmvg.OpenMVGConfig{
-		InputDir:     "input",
-		OutputDir:    "output",
-		CameraDBFile: &cameraDBFile,
+		InputDir:          "input",
+		OutputDir:         t.TempDir(),
+		MatchesDir:        t.TempDir(),
+		ReconstructionDir: t.TempDir(),
+		CameraDBFile:      &cameraDBFile,
 	}
 
 	service := openmvg.NewOpenMVGService(
@@ -269,14 +451,1011 @@ func TestSfMSequentialPipeline(t *testing.T) {
 		mockUtils,
 	)
 
-	mockUtils.EXPECT().RunCommand("openMVG_main_SfMInit_ImageListing", gomock.Any()).Return(nil)
-	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeFeatures", gomock.Any()).Return(nil)
-	mockUtils.EXPECT().RunCommand("openMVG_main_PairGenerator", gomock.Any()).Return(nil)
-	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeMatches", gomock.Any()).Return(nil)
-	mockUtils.EXPECT().RunCommand("openMVG_main_GeometricFilter", gomock.Any()).Return(nil)
-	mockUtils.EXPECT().RunCommand("openMVG_main_SfM", gomock.Any()).Return(nil)
-	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeSfM_DataColor", gomock.Any()).Return(nil)
-	mockUtils.EXPECT().RunCommand("openMVG_main_openMVG2openMVS", gomock.Any()).Return(nil)
+	matchesDir, reconstructionDir := config.MatchesDir, config.ReconstructionDir
+	mockUtils.EXPECT().RunCommand("openMVG_main_SfMInit_ImageListing", gomock.Any()).DoAndReturn(writesOutputs(t, matchesDir+"/sfm_data.json"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeFeatures", gomock.Any()).DoAndReturn(writesOutputs(t, matchesDir+"/image_describer.json"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_PairGenerator", gomock.Any()).DoAndReturn(writesOutputs(t, matchesDir+"/pairs.bin"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeMatches", gomock.Any()).DoAndReturn(writesOutputs(t, matchesDir+"/matches.putative.bin"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_GeometricFilter", gomock.Any()).DoAndReturn(writesOutputs(t, matchesDir+"/matches.f.bin"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_SfM", gomock.Any()).DoAndReturn(writesOutputs(t, reconstructionDir+"/sfm_data.bin"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeSfM_DataColor", gomock.Any()).DoAndReturn(writesOutputs(t, reconstructionDir+"/colorized.ply"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_ConvertSfM_DataFormat", gomock.Any()).DoAndReturn(writesOutputs(t, config.OutputDir+"/sfm_data.json"))
+	mockUtils.EXPECT().RunCommand("openMVG_main_openMVG2openMVS", gomock.Any()).DoAndReturn(writesOutputs(t, config.OutputDir+"/scene.mvs"))
 
 	service.SfMSequentialPipeline()
 }
+
+func TestRunSfMExportJSON_Scaled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	outputDir, reconstructionDir := t.TempDir(), t.TempDir()
+	config := openmvg.OpenMVGConfig{
+		InputDir:          "input",
+		OutputDir:         outputDir,
+		ReconstructionDir: reconstructionDir,
+		Scale:             &scale.Constraints{},
+	}
+
+	service := openmvg.NewOpenMVGService(
+		config,
+		mockUtils,
+	)
+
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_ConvertSfM_DataFormat", []string{
+			"-i", reconstructionDir + "/sfm_data.bin",
+			"-o", outputDir + "/sfm_data.json",
+			"-V", "-I", "-E", "-S", "-C",
+		}).
+		DoAndReturn(writesOutputs(t, outputDir+"/sfm_data.json"))
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_openMVG2openMVS", []string{
+			"-i", outputDir + "/sfm_data.json",
+			"-o", outputDir + "/scene.mvs",
+			"-d", outputDir,
+		}).
+		DoAndReturn(writesOutputs(t, outputDir+"/scene.mvs"))
+
+	service.RunSfMExportJSON()
+	service.RunOpenMVG2OpenMVS()
+}
+
+func TestRunSfMScale_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	outputDir := t.TempDir()
+	data, err := os.ReadFile("../sfmdata/testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "sfm_data.json"), data, 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	constraints, err := scale.ParsePoints("0,0,0,0,0,2=3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: outputDir, Scale: constraints},
+		mockUtils,
+	)
+
+	service.RunSfMScale()
+
+	sfm, err := sfmdata.Load(filepath.Join(outputDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("failed to load scaled scene: %v", err)
+	}
+	if c := sfm.CameraCenters(); c[1] != [3]float64{3, -0.75, 4.5} {
+		t.Errorf("expected camera centers scaled by 1.5, got %v", c)
+	}
+
+	var report scale.Result
+	data, err = os.ReadFile(filepath.Join(outputDir, "scale.json"))
+	if err != nil {
+		t.Fatalf("expected scale.json: %v", err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil || report.Scale != 1.5 || len(report.Residuals) != 1 {
+		t.Errorf("unexpected scale report %s", data)
+	}
+	// The report uses the snake_case keys of the other reports
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil || fields["scale"] != 1.5 {
+		t.Errorf("expected a scale key, got %s", data)
+	}
+	if r := fields["residuals"].([]any)[0].(map[string]any); r["a"] != "a" || r["b"] != "b" || r["expected"] != 3.0 {
+		t.Errorf("expected snake_case residual keys, got %s", data)
+	}
+}
+
+func TestRunSfMScale_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "failed to scale reconstruction") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: t.TempDir(), Scale: &scale.Constraints{}},
+		mockUtils,
+	)
+
+	service.RunSfMScale()
+}
+
+func TestRunSfMGeoreference_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	// The EXIF positions of the fixture images
+	positions := []geo.Position{
+		{Latitude: 51.5, Longitude: -0.12, Altitude: 30},
+		{Latitude: 51.5002, Longitude: -0.12, Altitude: 32},
+		{Latitude: 51.5, Longitude: -0.1197, Altitude: 31},
+		{Latitude: 51.5002, Longitude: -0.1197, Altitude: 35},
+	}
+	origin := geo.Centroid(positions)
+
+	// Place the cameras in an arbitrary frame, the fifth image has no GPS
+	sfmFrame := transform.Similarity{Scale: 0.2, Rotation: [3][3]float64{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}}, Translation: [3]float64{4, 5, 6}}
+	var want, centers [][3]float64
+	for _, p := range positions {
+		enu := geo.ENU(origin, p)
+		want = append(want, enu)
+		centers = append(centers, sfmFrame.Apply(enu))
+	}
+	centers = append(centers, [3]float64{100, 100, 100})
+
+	outputDir := t.TempDir()
+	writeScene(t, filepath.Join(outputDir, "sfm_data.json"), centers)
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "testdata/images", OutputDir: outputDir, Georeference: geo.FrameENU},
+		mockUtils,
+	)
+
+	service.RunSfMGeoreference()
+
+	sfm, err := sfmdata.Load(filepath.Join(outputDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("failed to load georeferenced scene: %v", err)
+	}
+	for i, c := range sfm.CameraCenters()[:4] {
+		if transform.Distance(c, want[i]) > 1e-6 {
+			t.Errorf("camera %d: expected %v, got %v", i, want[i], c)
+		}
+	}
+
+	var georef geo.Georeference
+	data, err := os.ReadFile(filepath.Join(outputDir, "georeference.json"))
+	if err != nil {
+		t.Fatalf("expected georeference.json: %v", err)
+	}
+	if err := json.Unmarshal(data, &georef); err != nil {
+		t.Fatalf("failed to decode georeference.json: %v", err)
+	}
+	if georef.CRS != "ENU" || georef.Origin != origin || georef.Registration.Points != 4 || georef.Registration.RMSE > 1e-6 {
+		t.Errorf("unexpected georeference %+v", georef)
+	}
+}
+
+func TestRunSfMGeoreference_TooFewPositions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "at least 3 are needed") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	outputDir := t.TempDir()
+	writeScene(t, filepath.Join(outputDir, "sfm_data.json"), [][3]float64{{0, 0, 0}, {1, 0, 0}})
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "testdata/images", OutputDir: outputDir, Georeference: geo.FrameUTM},
+		mockUtils,
+	)
+
+	service.RunSfMGeoreference()
+}
+
+func TestRunSfMReconstruction_Georeference(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	cameraDBFile := "camera_db.txt"
+	matchesDir, reconstructionDir := t.TempDir(), t.TempDir()
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: "output", MatchesDir: matchesDir, ReconstructionDir: reconstructionDir, CameraDBFile: &cameraDBFile, Georeference: geo.FrameENU},
+		mockUtils,
+	)
+
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfMInit_ImageListing", gomock.Any()).
+		DoAndReturn(func(name string, args []string) error {
+			if args[len(args)-1] != "-P" {
+				t.Errorf("expected pose priors to be enabled, got %v", args)
+			}
+			return writesOutputs(t, matchesDir+"/sfm_data.json")(name, args)
+		})
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfM", gomock.Any()).
+		DoAndReturn(func(name string, args []string) error {
+			if args[len(args)-1] != "--prior_usage" {
+				t.Errorf("expected pose priors to be used, got %v", args)
+			}
+			return writesOutputs(t, reconstructionDir+"/sfm_data.bin")(name, args)
+		})
+
+	service.RunSfMInitImageListing()
+	service.RunSfMReconstruction()
+}
+
+// writeScene writes an sfm_data.json with one view of IMG_000<n>.JPG and one
+// pose per camera center
+func writeScene(t *testing.T, path string, centers [][3]float64) {
+	t.Helper()
+
+	var views, extrinsics []string
+	for i, c := range centers {
+		views = append(views, fmt.Sprintf(`{"key": %d, "value": {"polymorphic_id": 1073741824, "ptr_wrapper": {"id": %d, "data": {
+			"local_path": "", "filename": "IMG_%04d.JPG", "width": 8, "height": 8, "id_view": %d, "id_intrinsic": 0, "id_pose": %d}}}}`,
+			i, 2147483649+i, i+1, i, i))
+		extrinsics = append(extrinsics, fmt.Sprintf(`{"key": %d, "value": {"rotation": [[1, 0, 0], [0, 1, 0], [0, 0, 1]], "center": [%g, %g, %g]}}`,
+			i, c[0], c[1], c[2]))
+	}
+
+	scene := fmt.Sprintf(`{"sfm_data_version": "0.3", "root_path": "testdata/images", "views": [%s], "intrinsics": [], "extrinsics": [%s]}`,
+		strings.Join(views, ","), strings.Join(extrinsics, ","))
+	if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+		t.Fatalf("failed to write scene: %v", err)
+	}
+}
+
+func TestRunSfMControlPointRegistration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	matchesDir, outputDir := t.TempDir(), t.TempDir()
+	for _, dir := range []string{matchesDir, outputDir} {
+		data, err := os.ReadFile("testdata/gcp/sfm_data.json")
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "sfm_data.json"), data, 0o644); err != nil {
+			t.Fatalf("failed to write fixture: %v", err)
+		}
+	}
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: outputDir, MatchesDir: matchesDir, GCPFile: "testdata/gcp/gcp.csv"},
+		mockUtils,
+	)
+
+	service.RunSfMInjectControlPoints()
+
+	doc, err := sfmdata.ReadDocument(filepath.Join(matchesDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cps := doc.Root.Field("control_points"); cps == nil || len(cps.Items) != 4 || len(cps.Items[0].Path("value", "observations").Items) != 2 {
+		t.Errorf("expected 4 injected control points with 2 observations each")
+	}
+
+	service.RunSfMControlPointRegistration()
+
+	// The scene is registered relative to the centroid of the control points
+	origin := [3]float64{302.0 / 3, 602.0 / 3, 10}
+	local := func(p [3]float64) [3]float64 {
+		return [3]float64{p[0] - origin[0], p[1] - origin[1], p[2] - origin[2]}
+	}
+
+	sfm, err := sfmdata.Load(filepath.Join(outputDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("failed to load registered scene: %v", err)
+	}
+	if c := sfm.CameraCenters()[0]; transform.Distance(c, local([3]float64{100, 200, -10})) > 1e-6 {
+		t.Errorf("expected the front camera at [100 200 -10] less the origin, got %v", c)
+	}
+
+	doc, err = sfmdata.ReadDocument(filepath.Join(outputDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if x, _ := doc.Root.Field("control_points").Items[1].Path("value", "X").Vec3(); transform.Distance(x, local([3]float64{102, 200, 10})) > 1e-9 {
+		t.Errorf("expected control point b to keep its surveyed position, got %v", x)
+	}
+
+	georef, err := geo.ReadGeoreference(filepath.Join(outputDir, "georeference.json"))
+	if err != nil {
+		t.Fatalf("expected georeference.json: %v", err)
+	}
+	if transform.Distance(georef.Offset(), origin) > 1e-9 || georef.Registration.Source != "gcp" || georef.Registration.Points != 3 {
+		t.Errorf("expected the origin to be recorded, got %+v", georef)
+	}
+
+	var report openmvg.QualityReport
+	data, err := os.ReadFile(filepath.Join(outputDir, "quality.json"))
+	if err != nil {
+		t.Fatalf("expected quality.json: %v", err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("failed to decode quality.json: %v", err)
+	}
+	if r := report.ControlPoints; r == nil || r.ControlPoints != 3 || r.CheckPoints != 1 || len(r.Residuals) != 4 || r.RMSE > 1e-6 || r.CheckRMSE > 1e-6 {
+		t.Errorf("unexpected quality report %s", data)
+	}
+	if r := report.ControlPoints.Residuals[1]; transform.Distance(r.Estimated, [3]float64{102, 200, 10}) > 1e-6 {
+		t.Errorf("expected the residuals in surveyed coordinates, got %+v", r)
+	}
+}
+
+func TestNewOpenMVGService_InvalidGCPFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "invalid ground control points") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: "output", GCPFile: "testdata/gcp/missing.csv"},
+		mockUtils,
+	)
+}
+
+func TestRunSfMReconstruction_Global(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	matchesDir, reconstructionDir := t.TempDir(), t.TempDir()
+	config := openmvg.OpenMVGConfig{
+		InputDir:          "input",
+		OutputDir:         "output",
+		MatchesDir:        matchesDir,
+		ReconstructionDir: reconstructionDir,
+		Engine: openmvg.EngineOptions{
+			Name:                 openmvg.EngineGlobal,
+			RotationAveraging:    "L1",
+			TranslationAveraging: "SOFTL1",
+		},
+	}
+
+	service := openmvg.NewOpenMVGService(
+		config,
+		mockUtils,
+	)
+
+	// The global engine needs matches filtered with the essential matrix
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_GeometricFilter", []string{
+			"-i", matchesDir + "/sfm_data.json",
+			"-m", matchesDir + "/matches.putative.bin",
+			"-g", "e",
+			"-o", matchesDir + "/matches.e.bin",
+		}).
+		DoAndReturn(writesOutputs(t, matchesDir+"/matches.e.bin"))
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfM", []string{
+			"--sfm_engine", "GLOBAL",
+			"--input_file", matchesDir + "/sfm_data.json",
+			"--match_dir", matchesDir,
+			"--match_file", "matches.e.bin",
+			"--output_dir", reconstructionDir,
+			"--rotationAveraging", "1",
+			"--translationAveraging", "3",
+		}).
+		DoAndReturn(writesOutputs(t, reconstructionDir+"/sfm_data.bin"))
+
+	service.RunSfMGeometricFilter()
+	service.RunSfMReconstruction()
+}
+
+func TestEngineOptions(t *testing.T) {
+	tests := []struct {
+		options openmvg.EngineOptions
+		model   string
+		args    []string
+		valid   bool
+	}{
+		{openmvg.EngineOptions{}, "f", nil, true},
+		{openmvg.EngineOptions{Name: openmvg.EngineIncrementalV2, Initializer: "STELLAR"}, "f", []string{"--sfm_initializer", "STELLAR"}, true},
+		{openmvg.EngineOptions{Name: openmvg.EngineStellar, GraphSimplification: "MST_X", GraphSimplificationValue: 5}, "e", []string{"--graph_simplification", "MST_X", "--graph_simplification_value", "5"}, true},
+		{openmvg.EngineOptions{Name: "SEQUENTIAL"}, "f", nil, false},
+		{openmvg.EngineOptions{RotationAveraging: "L1"}, "f", nil, false},
+		{openmvg.EngineOptions{Name: openmvg.EngineGlobal, TranslationAveraging: "L3"}, "e", nil, false},
+		{openmvg.EngineOptions{Name: openmvg.EngineGlobal, GraphSimplification: "MST_X"}, "e", nil, false},
+		{openmvg.EngineOptions{Name: openmvg.EngineIncrementalV2, Initializer: "AUTO_PAIR"}, "f", []string{"--sfm_initializer", "AUTO_PAIR"}, true},
+		{openmvg.EngineOptions{Name: openmvg.EngineIncrementalV2, Initializer: "AUTO"}, "f", nil, false},
+		{openmvg.EngineOptions{Name: openmvg.EngineIncrementalV2, Initializer: "RANDOM"}, "f", nil, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.options.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid %v, got %v", tt.options, tt.valid, err)
+			continue
+		}
+		if !tt.valid {
+			continue
+		}
+		if model := tt.options.GeometricModel(); model != tt.model {
+			t.Errorf("%+v: expected model %s, got %s", tt.options, tt.model, model)
+		}
+		if args := tt.options.Args(); strings.Join(args, " ") != strings.Join(tt.args, " ") {
+			t.Errorf("%+v: expected args %v, got %v", tt.options, tt.args, args)
+		}
+	}
+}
+
+func TestRunSfMPairGenerator_GPS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	matchesDir := t.TempDir()
+	writeScene(t, filepath.Join(matchesDir, "sfm_data.json"), make([][3]float64, 5))
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:   "testdata/images",
+			OutputDir:  "output",
+			MatchesDir: matchesDir,
+			Pairs:      pairs.Options{Strategy: pairs.StrategyGPS, Neighbours: 1},
+		},
+		mockUtils,
+	)
+
+	// No PairGenerator command is run, the pairs are written directly
+	service.RunSfMPairGenerator()
+
+	// Images 1 and 3 are 21 m apart east-west, 2 and 4 likewise, and image
+	// 5 has no GPS so it is paired with the image before it
+	data, err := os.ReadFile(filepath.Join(matchesDir, "pairs.txt"))
+	if err != nil {
+		t.Fatalf("expected pairs.txt: %v", err)
+	}
+	if string(data) != "0 2\n1 3\n3 4\n" {
+		t.Errorf("unexpected pairs %q", data)
+	}
+
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_ComputeMatches", []string{
+			"-i", matchesDir + "/sfm_data.json",
+			"-p", matchesDir + "/pairs.txt",
+			"-o", matchesDir + "/matches.putative.bin",
+		}).
+		DoAndReturn(writesOutputs(t, matchesDir+"/matches.putative.bin"))
+
+	service.RunSfMComputeMatches()
+}
+
+func TestRunSfMPairGenerator_InvalidFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "failed to generate pairs") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	matchesDir := t.TempDir()
+	writeScene(t, filepath.Join(matchesDir, "sfm_data.json"), make([][3]float64, 2))
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:   "input",
+			OutputDir:  "output",
+			MatchesDir: matchesDir,
+			Pairs:      pairs.Options{Strategy: pairs.StrategyFile, File: "testdata/missing.txt"},
+		},
+		mockUtils,
+	)
+
+	service.RunSfMPairGenerator()
+}
+
+func TestRunSfMGroupIntrinsics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	matchesDir, outputDir := t.TempDir(), t.TempDir()
+	data, err := os.ReadFile("testdata/grouping/sfm_data.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(matchesDir, "sfm_data.json"), data, 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	cameraDBFile := "camera_db.txt"
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:     "testdata/images",
+			OutputDir:    outputDir,
+			MatchesDir:   matchesDir,
+			CameraDBFile: &cameraDBFile,
+			Grouping:     grouping.Options{GroupBy: grouping.GroupByFile, File: "testdata/grouping/groups.csv"},
+		},
+		mockUtils,
+	)
+
+	// The listing gives every image its own intrinsic to be grouped
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfMInit_ImageListing", []string{
+			"-i", "testdata/images",
+			"-o", matchesDir,
+			"-d", cameraDBFile,
+			"-f", "2304",
+			"-g", "0",
+		}).
+		Return(nil)
+
+	service.RunSfMInitImageListing()
+	service.RunSfMGroupIntrinsics()
+
+	sfm, err := sfmdata.Load(filepath.Join(matchesDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("failed to load grouped scene: %v", err)
+	}
+	if len(sfm.Intrinsics) != 2 {
+		t.Errorf("expected 2 intrinsics, got %d", len(sfm.Intrinsics))
+	}
+	for i, want := range []uint32{0, 0, 2} {
+		if got := sfm.Views[i].IntrinsicID; got != want {
+			t.Errorf("view %d: expected intrinsic %d, got %d", i, want, got)
+		}
+	}
+
+	var report grouping.Report
+	data, err = os.ReadFile(filepath.Join(outputDir, "preflight.json"))
+	if err != nil {
+		t.Fatalf("expected preflight.json: %v", err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("failed to decode preflight.json: %v", err)
+	}
+	if len(report.Groups) != 2 || report.Groups[0].Name != "main" || report.Groups[0].Views != 2 || len(report.Errors) != 0 {
+		t.Errorf("unexpected pre-flight report %s", data)
+	}
+}
+
+func TestRunSfMGroupIntrinsics_Rig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	// A two camera rig, the right camera missed the second shot
+	rigDir, inputDir := t.TempDir(), t.TempDir()
+	for _, image := range []struct{ src, dst string }{
+		{"IMG_0001.JPG", "left/0001.jpg"},
+		{"IMG_0002.JPG", "left/0002.jpg"},
+		{"IMG_0003.JPG", "right/0001.jpg"},
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata/images", image.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(rigDir, image.dst)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dst, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := grouping.Stage(rigDir, inputDir); err != nil {
+		t.Fatalf("failed to stage the rig: %v", err)
+	}
+
+	matchesDir := t.TempDir()
+	data, err := os.ReadFile("testdata/grouping/sfm_data.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	listing := strings.NewReplacer("IMG_0001.JPG", "left_0001.jpg", "IMG_0002.JPG", "left_0002.jpg", "IMG_0003.JPG", "right_0001.jpg").Replace(string(data))
+	if err := os.WriteFile(filepath.Join(matchesDir, "sfm_data.json"), []byte(listing), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:   inputDir,
+			OutputDir:  t.TempDir(),
+			MatchesDir: matchesDir,
+			Grouping:   grouping.Options{GroupBy: grouping.GroupByFolder},
+		},
+		mockUtils,
+	)
+
+	service.RunSfMGroupIntrinsics()
+
+	sfm, err := sfmdata.Load(filepath.Join(matchesDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("failed to load grouped scene: %v", err)
+	}
+	for i, want := range []sfmdata.ViewRig{{Rig: 0, SubPose: 0}, {Rig: 1, SubPose: 0}, {Rig: 0, SubPose: 1}} {
+		v := sfm.Views[i]
+		if v.Rig == nil || *v.Rig != want {
+			t.Errorf("view %s: expected rig %+v, got %+v", v.Filename, want, v.Rig)
+		}
+		// The cameras of a shot keep their own pose
+		if v.PoseID != uint32(i) {
+			t.Errorf("view %s: expected pose %d, got %d", v.Filename, i, v.PoseID)
+		}
+	}
+}
+
+func TestRunSfMGroupIntrinsics_PreflightError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "pre-flight check failed") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	matchesDir := t.TempDir()
+	data, err := os.ReadFile("testdata/grouping/sfm_data.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	path := filepath.Join(matchesDir, "sfm_data.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	// One shared intrinsic for images of different sizes
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:   "testdata/images",
+			OutputDir:  t.TempDir(),
+			MatchesDir: matchesDir,
+			Grouping:   grouping.Options{GroupBy: grouping.GroupByFile, File: "testdata/grouping/mixed.csv"},
+		},
+		mockUtils,
+	)
+
+	service.RunSfMGroupIntrinsics()
+
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Errorf("expected the scene to be left unchanged")
+	}
+}
+
+func TestSfMExtendPipeline_Steps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	matchesDir, reconstructionDir := t.TempDir(), t.TempDir()
+	previous := matches.PairWise{{I: 0, J: 1}: {{I: 1, J: 1}}}
+	if err := matches.Save(filepath.Join(matchesDir, "matches.f.bin"), previous); err != nil {
+		t.Fatalf("failed to write matches: %v", err)
+	}
+	copyFixture := func(src, dst string) {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(dst, data, 0o644); err != nil {
+			t.Fatalf("failed to write fixture: %v", err)
+		}
+	}
+
+	cameraDBFile := "camera_db.txt"
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:          "input",
+			OutputDir:         "output",
+			MatchesDir:        matchesDir,
+			ReconstructionDir: reconstructionDir,
+			CameraDBFile:      &cameraDBFile,
+			ExtendDir:         "testdata/extend",
+		},
+		mockUtils,
+	)
+
+	// The previous reconstruction of front.jpg and side.jpg and the listing
+	// of back.jpg
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_ConvertSfM_DataFormat", []string{
+			"-i", reconstructionDir + "/sfm_data.bin",
+			"-o", filepath.Join(matchesDir, "sfm_data.json"),
+			"-V", "-I", "-E",
+		}).
+		Do(func(string, []string) {
+			copyFixture("testdata/gcp/sfm_data.json", filepath.Join(matchesDir, "sfm_data.json"))
+		}).
+		Return(nil)
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfMInit_ImageListing", []string{
+			"-i", "testdata/extend",
+			"-o", filepath.Join(matchesDir, "extend"),
+			"-d", cameraDBFile,
+			"-f", "2304",
+		}).
+		Do(func(string, []string) {
+			copyFixture("testdata/extend/sfm_data.json", filepath.Join(matchesDir, "extend", "sfm_data.json"))
+		}).
+		Return(nil)
+
+	service.RunSfMExtendImageListing()
+
+	sfm, err := sfmdata.Load(filepath.Join(matchesDir, "sfm_data.json"))
+	if err != nil {
+		t.Fatalf("failed to load extended listing: %v", err)
+	}
+	if len(sfm.Views) != 3 || len(sfm.Poses) != 2 {
+		t.Fatalf("expected 3 views and the 2 previous poses, got %d and %d", len(sfm.Views), len(sfm.Poses))
+	}
+	if v := sfm.Views[2]; v.ID != 2 || v.Filename != "back.jpg" || v.LocalPath != "testdata/extend/" || v.IntrinsicID != 1 {
+		t.Errorf("unexpected new view %+v", v)
+	}
+
+	// Only the pairs with the new view are matched
+	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeMatches", gomock.Any()).DoAndReturn(writesOutputs(t, matchesDir+"/matches.extend.putative.bin"))
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_GeometricFilter", gomock.Any()).
+		Do(func(_ string, args []string) {
+			added := matches.PairWise{{I: 0, J: 2}: {{I: 2, J: 2}, {I: 3, J: 3}}, {I: 1, J: 2}: {}}
+			if err := matches.Save(args[len(args)-1], added); err != nil {
+				t.Errorf("failed to write matches: %v", err)
+			}
+		}).
+		Return(nil)
+
+	service.RunSfMExtendMatches()
+
+	if data, _ := os.ReadFile(filepath.Join(matchesDir, "pairs.extend.txt")); string(data) != "0 2\n1 2\n" {
+		t.Errorf("unexpected pairs %q", data)
+	}
+	merged, err := matches.Load(filepath.Join(matchesDir, "matches.f.bin"))
+	if err != nil {
+		t.Fatalf("failed to load merged matches: %v", err)
+	}
+	if len(merged) != 3 || merged.Count() != 3 {
+		t.Errorf("expected the previous and new matches, got %v", merged)
+	}
+
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfM", []string{
+			"--sfm_engine", "INCREMENTALV2",
+			"--sfm_initializer", "EXISTING_POSE",
+			"--input_file", matchesDir + "/sfm_data.json",
+			"--match_dir", matchesDir,
+			"--match_file", "matches.f.bin",
+			"--output_dir", reconstructionDir,
+		}).
+		DoAndReturn(writesOutputs(t, reconstructionDir+"/sfm_data.bin"))
+
+	service.RunSfMExtendReconstruction()
+}
+
+func TestRunSfMExtendImageListing_MissingOutput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "openMVG_main_ConvertSfM_DataFormat did not write its output") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	cameraDBFile := "camera_db.txt"
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:          "input",
+			OutputDir:         "output",
+			MatchesDir:        t.TempDir(),
+			ReconstructionDir: t.TempDir(),
+			CameraDBFile:      &cameraDBFile,
+			ExtendDir:         "testdata/extend",
+		},
+		mockUtils,
+	)
+
+	// The previous reconstruction could not be converted, the new images
+	// are not listed
+	mockUtils.EXPECT().RunCommand("openMVG_main_ConvertSfM_DataFormat", gomock.Any()).Return(nil)
+
+	service.RunSfMExtendImageListing()
+}
+
+func TestRunSfMExtendImageListing_Duplicate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "already part of the reconstruction") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	matchesDir := t.TempDir()
+	data, err := os.ReadFile("testdata/gcp/sfm_data.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	cameraDBFile := "camera_db.txt"
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{
+			InputDir:          "input",
+			OutputDir:         "output",
+			MatchesDir:        matchesDir,
+			ReconstructionDir: t.TempDir(),
+			CameraDBFile:      &cameraDBFile,
+			ExtendDir:         "testdata/gcp",
+		},
+		mockUtils,
+	)
+
+	// Listing the previous images again
+	mockUtils.EXPECT().RunCommand(gomock.Any(), gomock.Any()).
+		Do(func(name string, args []string) {
+			dst := args[3]
+			if name == "openMVG_main_SfMInit_ImageListing" {
+				dst = filepath.Join(dst, "sfm_data.json")
+			}
+			os.MkdirAll(filepath.Dir(dst), 0o755)
+			os.WriteFile(dst, data, 0o644)
+		}).
+		Return(nil).
+		Times(2)
+
+	service.RunSfMExtendImageListing()
+}
+
+func TestLocalize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	matchesDir, reconstructionDir := t.TempDir(), t.TempDir()
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: "output", MatchesDir: matchesDir, ReconstructionDir: reconstructionDir},
+		mockUtils,
+	)
+
+	// The localizer adds the pose of query.jpg and not that of miss.jpg
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfM_Localization", gomock.Any()).
+		DoAndReturn(func(_ string, args []string) error {
+			if args[1] != reconstructionDir+"/sfm_data.bin" || args[3] != matchesDir || args[9] != "testdata/localize/query" {
+				t.Errorf("unexpected arguments %v", args)
+			}
+			data, err := os.ReadFile("testdata/localize/sfm_data_expanded.json")
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(args[5], 0o755); err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(args[5], "sfm_data_expanded.json"), data, 0o644)
+		})
+
+	results, err := service.Localize("testdata/localize/query")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Image != "miss.jpg" || results[1].Image != "query.jpg" {
+		t.Fatalf("expected a result per query image, got %+v", results)
+	}
+	if results[0].Pose != nil || results[0].Inliers != 0 {
+		t.Errorf("expected miss.jpg not to be localized, got %+v", results[0])
+	}
+	r := results[1]
+	if r.Pose == nil || r.Pose.Center != [3]float64{0.5, 0.25, -2} {
+		t.Errorf("unexpected pose %+v", r.Pose)
+	}
+	if r.Intrinsic == nil || r.Intrinsic.FocalLength != 520 || r.Intrinsic.Model != "pinhole" {
+		t.Errorf("unexpected intrinsic %+v", r.Intrinsic)
+	}
+	if r.Inliers != 3 {
+		t.Errorf("expected 3 inliers, got %d", r.Inliers)
+	}
+
+	if leftover, _ := filepath.Glob(filepath.Join(matchesDir, "localize*")); len(leftover) != 0 {
+		t.Errorf("expected the localization files to be removed, found %v", leftover)
+	}
+}
+
+func TestLocalize_SingleImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+
+	service := openmvg.NewOpenMVGService(
+		openmvg.OpenMVGConfig{InputDir: "input", OutputDir: "output", MatchesDir: t.TempDir(), ReconstructionDir: t.TempDir()},
+		mockUtils,
+	)
+
+	// A single image is staged in a query directory of its own
+	mockUtils.EXPECT().
+		RunCommand("openMVG_main_SfM_Localization", gomock.Any()).
+		DoAndReturn(func(_ string, args []string) error {
+			entries, err := os.ReadDir(args[9])
+			if err != nil || len(entries) != 1 || entries[0].Name() != "query.jpg" {
+				t.Errorf("expected only query.jpg to be staged, got %v", entries)
+			}
+			return errors.New("command failed")
+		})
+
+	if _, err := service.Localize("testdata/localize/query/query.jpg"); err == nil || !strings.Contains(err.Error(), "failed to localize") {
+		t.Errorf("expected the localizer error, got %v", err)
+	}
+}
@@ -1,12 +1,19 @@
 package openmvs
 
+import "github.com/2024-dissertation/openmvgo/internal/pipeline"
+
 // OpenMVSServiceInterface defines the methods for running OpenMVS commands in sequence.
 //
 //go:generate mockgen -source=./openmvs.go -destination=../../mocks/mock_openmvs.go -package=mocks
 type OpenMVSServiceInterface interface {
-	RunPipeline()
+	RunPipeline() []pipeline.StepResult
+	Steps() []pipeline.Step
 	RunDensifyPointCloud()
+	RunCropPointCloud()
+	RunExportPointCloud()
 	RunReconstructMesh()
 	RunRefineMesh()
+	RunCropMesh()
 	RunTextureMesh()
+	RunGenerateLODs()
 }
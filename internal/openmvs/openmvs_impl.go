@@ -1,24 +1,78 @@
 package openmvs
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 
+	"github.com/2024-dissertation/openmvgo/internal/crop"
+	"github.com/2024-dissertation/openmvgo/internal/geo"
+	"github.com/2024-dissertation/openmvgo/internal/gltf"
+	"github.com/2024-dissertation/openmvgo/internal/las"
+	"github.com/2024-dissertation/openmvgo/internal/obj"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/resources"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/simplify"
+	"github.com/2024-dissertation/openmvgo/internal/texture"
 	"github.com/2024-dissertation/openmvgo/internal/utils"
 )
 
+// Formats the textured mesh can be exported as
+const (
+	OutputFormatOBJ = "obj"
+	OutputFormatGLB = "glb"
+)
+
+// Formats the dense point cloud can be exported as
+const (
+	PointCloudFormatLAS = "las"
+)
+
 // Config object
 type OpenMVSConfig struct {
+	// MaxThreads bounds the threads of every OpenMVS command, 0 uses every
+	// core
 	MaxThreads int
-	OutputDir  string
-	BuildDir   string
+	// Memory is the memory available to DensifyPointCloud in bytes. When
+	// set, the resolution level of the depth maps is raised from the default
+	// until their estimated memory fits.
+	Memory    int64
+	OutputDir string
+	// BuildDir receives every intermediate file and is the working directory
+	// of the OpenMVS commands
+	BuildDir string
+	// SceneFile is the scene exported by openMVG2openMVS, the input of the
+	// pipeline
+	SceneFile    string
+	OutputFormat string
+	// PointCloudFormat exports the dense point cloud when set
+	PointCloudFormat string
+	// GeoreferenceFile is the frame of the scene written by OpenMVG. When it
+	// exists the exported point cloud is written in its CRS.
+	GeoreferenceFile string
+	// LODs generates a decimated copy of the textured mesh per target when set
+	LODs []simplify.Target
+	// Crop removes geometry outside a box or below the ground plane from the
+	// dense point cloud when CropDense is set and from the refined mesh when
+	// CropMesh is set
+	Crop      crop.Options
+	CropDense bool
+	CropMesh  bool
+	// Textures resizes, re-encodes or packs the textures of the exported mesh
+	Textures texture.Options
 }
 
 // Helper function to create an OpenMVSConfig
 func NewOpenMVSConfig(outputDir string, buildDir string, maxThreads int) *OpenMVSConfig {
 	return &OpenMVSConfig{
-		MaxThreads: maxThreads,
-		OutputDir:  outputDir,
-		BuildDir:   buildDir,
+		MaxThreads:   maxThreads,
+		OutputDir:    outputDir,
+		BuildDir:     buildDir,
+		OutputFormat: OutputFormatOBJ,
 	}
 }
 
@@ -26,6 +80,10 @@ func NewOpenMVSConfig(outputDir string, buildDir string, maxThreads int) *OpenMV
 type OpenMVSServiceImpl struct {
 	Utils  utils.UtilsInterface
 	Config *OpenMVSConfig
+	// Observer receives the progress of the pipeline, if set
+	Observer pipeline.Observer
+	// Context parents the trace spans of the pipeline, if set
+	Context context.Context
 }
 
 // Helper function to create a new OpenMVSServiceImpl
@@ -38,53 +96,335 @@ func NewOpenMVSService(config *OpenMVSConfig, utils utils.UtilsInterface) OpenMV
 		utils.Check(fmt.Errorf("failed to ensure input directory"))
 	}
 
+	switch config.OutputFormat {
+	case "", OutputFormatOBJ, OutputFormatGLB:
+	default:
+		utils.Check(fmt.Errorf("unsupported output format %q", config.OutputFormat))
+	}
+
+	if err := config.Textures.Validate(); err != nil {
+		utils.Check(err)
+	}
+
+	switch config.PointCloudFormat {
+	case "", PointCloudFormatLAS:
+	default:
+		utils.Check(fmt.Errorf("unsupported point cloud format %q", config.PointCloudFormat))
+	}
+
+	if config.BuildDir == "" || config.SceneFile == "" {
+		utils.Check(fmt.Errorf("build directory and scene file must be specified"))
+	}
+
+	// Every path is passed to OpenMVS in full, so it does not depend on the
+	// working directory of the process
+	for _, path := range []*string{&config.BuildDir, &config.SceneFile} {
+		abs, err := filepath.Abs(*path)
+		if err != nil {
+			utils.Check(fmt.Errorf("could not resolve %s: %w", *path, err))
+		}
+		*path = abs
+	}
+
+	if err := utils.EnsureDir(config.BuildDir); err != nil {
+		utils.Check(fmt.Errorf("failed to ensure build directory: %w", err))
+	}
+
 	return OpenMVSServiceImpl{
 		Utils:  utils,
 		Config: config,
 	}
 }
 
-// RunPipeline runs the entire OpenMVS pipeline in sequence
-func (s OpenMVSServiceImpl) RunPipeline() {
-	s.RunDensifyPointCloud()
-	s.RunReconstructMesh()
-	s.RunRefineMesh()
-	s.RunTextureMesh()
+// RunPipeline runs the entire OpenMVS pipeline in sequence and returns the
+// results of its steps
+func (s OpenMVSServiceImpl) RunPipeline() []pipeline.StepResult {
+	return pipeline.Run(s.Context, "RunPipeline", s.Steps(), s.Observer)
+}
+
+// Steps returns the steps of RunPipeline, leaving out the optional steps that
+// are not configured
+func (s OpenMVSServiceImpl) Steps() []pipeline.Step {
+	steps := []pipeline.Step{{Name: "densify", Run: s.RunDensifyPointCloud}}
+	if s.Config.CropDense {
+		steps = append(steps, pipeline.Step{Name: "crop_dense", Run: s.RunCropPointCloud})
+	}
+	if s.Config.PointCloudFormat != "" {
+		steps = append(steps, pipeline.Step{Name: "export_pointcloud", Run: s.RunExportPointCloud})
+	}
+	steps = append(steps,
+		pipeline.Step{Name: "mesh", Run: s.RunReconstructMesh},
+		pipeline.Step{Name: "refine", Run: s.RunRefineMesh},
+	)
+	if s.Config.CropMesh {
+		steps = append(steps, pipeline.Step{Name: "crop_mesh", Run: s.RunCropMesh})
+	}
+	steps = append(steps, pipeline.Step{Name: "texture", Run: s.RunTextureMesh})
+	if len(s.Config.LODs) > 0 {
+		steps = append(steps, pipeline.Step{Name: "lods", Run: s.RunGenerateLODs})
+	}
+	return steps
 }
 
 // RunDensifyPointCloud runs the DensifyPointCloud command with the configured parameters
 func (s OpenMVSServiceImpl) RunDensifyPointCloud() {
-	if err := s.Utils.RunCommand("DensifyPointCloud", []string{"scene.mvs", "-o", "scene_dense.mvs", "-w", s.Config.BuildDir, "--max-threads", fmt.Sprintf("%d", s.Config.MaxThreads)}); err != nil {
-		s.Utils.Check(fmt.Errorf("failed to run DensifyPointCloud: %w", err))
+	// DensifyPointCloud reuses the depth maps in its working directory, which
+	// are stale once an extended reconstruction has adjusted the cameras. None
+	// is kept: the adjustment moves every camera and the maps are numbered by
+	// the image index of the scene, which the new images shift.
+	stale, _ := filepath.Glob(filepath.Join(s.Config.BuildDir, "depth*.dmap"))
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			s.Utils.Check(fmt.Errorf("failed to remove stale depth map: %w", err))
+		}
+	}
+
+	args := []string{s.Config.SceneFile, "-o", s.path("scene_dense.mvs"), "-w", s.Config.BuildDir, "--max-threads", fmt.Sprintf("%d", s.Config.MaxThreads)}
+	if level := s.resolutionLevel(); level != resources.DefaultResolutionLevel {
+		args = append(args, "--resolution-level", strconv.Itoa(level))
+	}
+
+	s.run("DensifyPointCloud",
+		args,
+		[]string{s.Config.SceneFile},
+		[]string{s.path("scene_dense.mvs"), s.path("scene_dense.ply")},
+	)
+}
+
+// resolutionLevel returns the resolution level of DensifyPointCloud that fits
+// the depth maps of the posed images in the configured memory
+func (s OpenMVSServiceImpl) resolutionLevel() int {
+	if s.Config.Memory <= 0 {
+		return resources.DefaultResolutionLevel
+	}
+	sfm, err := sfmdata.Load(filepath.Join(filepath.Dir(s.Config.SceneFile), "sfm_data.json"))
+	if err != nil {
+		return resources.DefaultResolutionLevel
+	}
+
+	// Only the images with a reconstructed pose get a depth map
+	posed := map[uint32]bool{}
+	for _, p := range sfm.Poses {
+		posed[p.ID] = true
+	}
+	var images []resources.Image
+	for _, v := range sfm.Views {
+		if posed[v.PoseID] {
+			images = append(images, resources.Image{Width: v.Width, Height: v.Height})
+		}
+	}
+	threads := s.Config.MaxThreads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+
+	level := resources.DensifyResolutionLevel(images, threads, s.Config.Memory)
+	if level != resources.DefaultResolutionLevel {
+		fmt.Printf("→ Densifying at resolution level %d to fit %d images in %s\n", level, len(images), utils.FormatSize(s.Config.Memory))
+	}
+	return level
+}
+
+// RunCropPointCloud crops the dense point cloud, ReconstructMesh and the point
+// cloud export then use the cropped cloud
+func (s OpenMVSServiceImpl) RunCropPointCloud() {
+	s.crop("scene_dense.ply", "scene_dense_crop.ply")
+}
+
+// RunCropMesh crops the refined mesh before it is textured
+func (s OpenMVSServiceImpl) RunCropMesh() {
+	s.crop("scene_dense_mesh_refine.ply", "scene_dense_mesh_refine_crop.ply")
+}
+
+func (s OpenMVSServiceImpl) crop(src, dst string) {
+	// The automatic box and the ground orientation come from the cameras
+	// reconstructed by OpenMVG, exported next to the scene
+	var cameras [][3]float64
+	sfm, err := sfmdata.Load(filepath.Join(filepath.Dir(s.Config.SceneFile), "sfm_data.json"))
+	if err == nil {
+		cameras = sfm.CameraCenters()
+	} else if s.Config.Crop.Box == nil && s.Config.Crop.AutoBox {
+		s.Utils.Check(fmt.Errorf("failed to estimate crop box: %w", err))
+	}
+
+	kept, total, err := crop.PLY(s.path(src), s.path(dst), s.Config.Crop, cameras)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to crop %s: %w", src, err))
 	}
+
+	fmt.Printf("→ Cropped %s: kept %d of %d vertices\n", src, kept, total)
+}
+
+// RunExportPointCloud converts the dense point cloud written by
+// DensifyPointCloud to the configured point cloud format
+func (s OpenMVSServiceImpl) RunExportPointCloud() {
+	src := s.path("scene_dense.ply")
+	if s.Config.CropDense {
+		src = s.path("scene_dense_crop.ply")
+	}
+	dst := filepath.Join(s.Config.OutputDir, "dense."+s.Config.PointCloudFormat)
+
+	opts := las.Options{GeneratingSoftware: "openmvgo"}
+	if georef := s.georeference(); georef != nil {
+		// The points are stored relative to the origin of the frame, which
+		// keeps the absolute CRS coordinates within the integer range
+		offset := georef.Offset()
+		opts.WKT = georef.WKT()
+		opts.Offset = &offset
+		opts.Transform = &georef.Transform
+	}
+	if err := las.Export(src, dst, opts); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to export point cloud: %w", err))
+	}
+
+	fmt.Printf("→ Exported %s\n", dst)
+}
+
+// georeference returns the frame of the scene, nil when it was not
+// georeferenced
+func (s OpenMVSServiceImpl) georeference() *geo.Georeference {
+	if s.Config.GeoreferenceFile == "" {
+		return nil
+	}
+	if _, err := os.Stat(s.Config.GeoreferenceFile); err != nil {
+		return nil
+	}
+	georef, err := geo.ReadGeoreference(s.Config.GeoreferenceFile)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to export point cloud: %w", err))
+		return nil
+	}
+	return georef
 }
 
 // RunReconstructMesh runs the ReconstructMesh command with the configured parameters
 func (s OpenMVSServiceImpl) RunReconstructMesh() {
-	if err := s.Utils.RunCommand("ReconstructMesh", []string{"scene_dense.mvs", "-o", "scene_mesh.ply", "-w", s.Config.BuildDir}); err != nil {
-		s.Utils.Check(fmt.Errorf("failed to run ReconstructMesh: %w", err))
+	args := []string{s.path("scene_dense.mvs"), "-o", s.path("scene_mesh.ply"), "-w", s.Config.BuildDir}
+	inputs := []string{s.path("scene_dense.mvs")}
+	if s.Config.CropDense {
+		// Reconstruct from the cropped cloud instead of the one in the scene
+		args = append(args, "-p", s.path("scene_dense_crop.ply"))
+		inputs = append(inputs, s.path("scene_dense_crop.ply"))
 	}
+
+	args = append(args, "--max-threads", fmt.Sprintf("%d", s.Config.MaxThreads))
+
+	s.run("ReconstructMesh", args, inputs, []string{s.path("scene_mesh.ply")})
 }
 
 // RunRefineMesh runs the RefineMesh command with the configured parameters
 func (s OpenMVSServiceImpl) RunRefineMesh() {
-	if err := s.Utils.RunCommand("RefineMesh", []string{"scene.mvs", "-m", "scene_mesh.ply", "-o", "scene_dense_mesh_refine.mvs", "-w", s.Config.BuildDir, "--scales", "1", "--max-face-area", "16", "--max-threads", fmt.Sprintf("%d", s.Config.MaxThreads)}); err != nil {
-		s.Utils.Check(fmt.Errorf("failed to run RefineMesh: %w", err))
-	}
+	s.run("RefineMesh",
+		[]string{s.Config.SceneFile, "-m", s.path("scene_mesh.ply"), "-o", s.path("scene_dense_mesh_refine.mvs"), "-w", s.Config.BuildDir, "--scales", "1", "--max-face-area", "16", "--max-threads", fmt.Sprintf("%d", s.Config.MaxThreads)},
+		[]string{s.Config.SceneFile, s.path("scene_mesh.ply")},
+		[]string{s.path("scene_dense_mesh_refine.ply")},
+	)
 }
 
 // RunTextureMesh runs the TextureMesh command with the configured parameters
 func (s OpenMVSServiceImpl) RunTextureMesh() {
-	if err := s.Utils.RunCommand("TextureMesh", []string{"scene_dense.mvs", "-m", "scene_dense_mesh_refine.ply", "-o", "scene_dense_mesh_refine_texture.mvs", "-w", s.Config.BuildDir, "--export-type", "obj"}); err != nil {
-		s.Utils.Check(fmt.Errorf("failed to run TextureMesh: %w", err))
+	mesh := "scene_dense_mesh_refine.ply"
+	if s.Config.CropMesh {
+		mesh = "scene_dense_mesh_refine_crop.ply"
 	}
-	s.Utils.CopyFile(
-		fmt.Sprintf("%s/scene_dense_mesh_refine_texture.mtl", s.Config.BuildDir),
-		fmt.Sprintf("%s/final.mtl", s.Config.OutputDir),
-	)
 
-	s.Utils.CopyFile(
-		fmt.Sprintf("%s/scene_dense_mesh_refine_texture.obj", s.Config.BuildDir),
-		fmt.Sprintf("%s/final.obj", s.Config.OutputDir),
+	s.run("TextureMesh",
+		[]string{s.path("scene_dense.mvs"), "-m", s.path(mesh), "-o", s.path("scene_dense_mesh_refine_texture.mvs"), "-w", s.Config.BuildDir, "--export-type", "obj", "--max-threads", fmt.Sprintf("%d", s.Config.MaxThreads)},
+		[]string{s.path("scene_dense.mvs"), s.path(mesh)},
+		[]string{s.path("scene_dense_mesh_refine_texture.obj")},
 	)
+
+	if s.Config.Textures.Enabled() {
+		src := s.path("scene_dense_mesh_refine_texture.obj")
+		if _, err := texture.Process(src, s.texturedMesh(), s.Config.Textures); err != nil {
+			s.Utils.Check(fmt.Errorf("failed to process textures: %w", err))
+		}
+	}
+
+	if err := s.exportMesh(s.texturedMesh(), "final"); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to export textured mesh: %w", err))
+	}
+}
+
+// texturedMesh returns the textured mesh to export, which has processed
+// textures when texture options are configured
+func (s OpenMVSServiceImpl) texturedMesh() string {
+	if s.Config.Textures.Enabled() {
+		return s.path("textures", "scene_dense_mesh_refine_texture.obj")
+	}
+	return s.path("scene_dense_mesh_refine_texture.obj")
+}
+
+// path returns the path of an intermediate file in the build directory
+func (s OpenMVSServiceImpl) path(elem ...string) string {
+	return filepath.Join(append([]string{s.Config.BuildDir}, elem...)...)
+}
+
+// run runs an OpenMVS command once its inputs exist and checks that it wrote
+// its outputs, OpenMVS itself fails on a missing file with little context
+func (s OpenMVSServiceImpl) run(name string, args, inputs, outputs []string) {
+	if err := utils.RequireFiles(inputs); err != nil {
+		s.Utils.Check(fmt.Errorf("cannot run %s: %w", name, err))
+		return
+	}
+
+	if err := s.Utils.RunCommand(name, args); err != nil {
+		s.Utils.Check(fmt.Errorf("failed to run %s: %w", name, err))
+		return
+	}
+
+	if err := utils.RequireFiles(outputs); err != nil {
+		s.Utils.Check(fmt.Errorf("%s did not write its output: %w", name, err))
+	}
+}
+
+// RunGenerateLODs decimates the textured mesh to each configured level of
+// detail and exports the levels next to the full resolution mesh
+func (s OpenMVSServiceImpl) RunGenerateLODs() {
+	texturedMesh := s.texturedMesh()
+
+	mesh, err := simplify.Load(texturedMesh)
+	if err != nil {
+		s.Utils.Check(fmt.Errorf("failed to load textured mesh: %w", err))
+	}
+
+	for i, lod := range simplify.LODs(mesh, s.Config.LODs) {
+		name := fmt.Sprintf("final_lod%d", i+1)
+
+		// Write next to the source so the material library still resolves
+		src := filepath.Join(filepath.Dir(texturedMesh), fmt.Sprintf("scene_dense_mesh_refine_texture_lod%d.obj", i+1))
+		if err := simplify.Write(src, lod); err != nil {
+			s.Utils.Check(fmt.Errorf("failed to write level of detail %s: %w", s.Config.LODs[i], err))
+		}
+
+		fmt.Printf("→ Level of detail %s: %d faces\n", s.Config.LODs[i], len(lod.Faces))
+		if err := s.exportMesh(src, name); err != nil {
+			s.Utils.Check(fmt.Errorf("failed to export level of detail %s: %w", s.Config.LODs[i], err))
+		}
+	}
+}
+
+// exportMesh exports the textured OBJ at src to the output directory as name
+// in the configured output format
+func (s OpenMVSServiceImpl) exportMesh(src, name string) error {
+	if s.Config.OutputFormat == OutputFormatGLB {
+		dst := filepath.Join(s.Config.OutputDir, name+".glb")
+		if err := gltf.Export(src, dst); err != nil {
+			return err
+		}
+		fmt.Printf("→ Exported %s\n", dst)
+		return nil
+	}
+
+	// Export the mesh with its materials and textures, validating that every
+	// referenced file exists
+	files, err := obj.Export(src, s.Config.OutputDir, name)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		fmt.Printf("→ Exported %s\n", f)
+	}
+	return nil
 }
@@ -3,9 +3,22 @@ package openmvs_test
 import (
 	"errors"
 	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/2024-dissertation/openmvgo/internal/crop"
+	"github.com/2024-dissertation/openmvgo/internal/geo"
+	"github.com/2024-dissertation/openmvgo/internal/gltf"
+	"github.com/2024-dissertation/openmvgo/internal/las"
 	"github.com/2024-dissertation/openmvgo/internal/openmvs"
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+	"github.com/2024-dissertation/openmvgo/internal/simplify"
+	"github.com/2024-dissertation/openmvgo/internal/texture"
 	"github.com/2024-dissertation/openmvgo/mocks"
 	"go.uber.org/mock/gomock"
 )
@@ -16,8 +29,12 @@ func TestRunDensifyPointCloud_Success(t *testing.T) {
 
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
 		MaxThreads: 4,
 	}
 
@@ -27,7 +44,7 @@ func TestRunDensifyPointCloud_Success(t *testing.T) {
 	}
 
 	expectedArgs := []string{
-		"scene.mvs", "-o", "scene_dense.mvs",
+		config.SceneFile, "-o", filepath.Join(config.BuildDir, "scene_dense.mvs"),
 		"-w", config.BuildDir,
 		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
 	}
@@ -39,14 +56,98 @@ func TestRunDensifyPointCloud_Success(t *testing.T) {
 	service.RunDensifyPointCloud()
 }
 
+func TestRunDensifyPointCloud_ResolutionLevel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
+	// 300 posed 24 megapixel images do not fit in 16 GiB at the default
+	// resolution level, the view without a pose gets no depth map
+	var views, poses []string
+	for i := 0; i < 301; i++ {
+		views = append(views, fmt.Sprintf(`{"key": %d, "value": {"ptr_wrapper": {"data": {"filename": "%d.jpg", "width": 6000, "height": 4000, "id_view": %d, "id_pose": %d}}}}`, i, i, i, i))
+		if i < 300 {
+			poses = append(poses, fmt.Sprintf(`{"key": %d, "value": {"rotation": [[1,0,0],[0,1,0],[0,0,1]], "center": [0,0,0]}}`, i))
+		}
+	}
+	sfm := fmt.Sprintf(`{"sfm_data_version": "0.3", "views": [%s], "extrinsics": [%s]}`, strings.Join(views, ","), strings.Join(poses, ","))
+	if err := os.WriteFile(filepath.Join(buildDir, "sfm_data.json"), []byte(sfm), 0644); err != nil {
+		t.Fatalf("failed to write sfm_data.json: %v", err)
+	}
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
+		MaxThreads: 16,
+		Memory:     16 << 30,
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	expectedArgs := []string{
+		config.SceneFile, "-o", filepath.Join(config.BuildDir, "scene_dense.mvs"),
+		"-w", config.BuildDir,
+		"--max-threads", "16",
+		"--resolution-level", "3",
+	}
+
+	mockUtils.EXPECT().
+		RunCommand("DensifyPointCloud", expectedArgs).
+		Return(nil)
+
+	service.RunDensifyPointCloud()
+}
+
+func TestRunDensifyPointCloud_StaleDepthMaps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+	for _, name := range []string{"depth0000.dmap", "depth0001.dmap"} {
+		if err := os.WriteFile(filepath.Join(buildDir, name), nil, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &openmvs.OpenMVSConfig{BuildDir: buildDir, SceneFile: filepath.Join(buildDir, "scene.mvs"), MaxThreads: 1},
+	}
+
+	mockUtils.EXPECT().RunCommand("DensifyPointCloud", gomock.Any()).Return(nil)
+
+	service.RunDensifyPointCloud()
+
+	if stale, _ := filepath.Glob(filepath.Join(buildDir, "*.dmap")); len(stale) != 0 {
+		t.Errorf("expected the depth maps to be removed, found %v", stale)
+	}
+	if _, err := os.Stat(filepath.Join(buildDir, "scene.mvs")); err != nil {
+		t.Errorf("expected the scene to be kept: %v", err)
+	}
+}
+
 func TestRunDensifyPointCloud_Error(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
 		MaxThreads: 4,
 	}
 
@@ -56,7 +157,7 @@ func TestRunDensifyPointCloud_Error(t *testing.T) {
 	}
 
 	expectedArgs := []string{
-		"scene.mvs", "-o", "scene_dense.mvs",
+		config.SceneFile, "-o", filepath.Join(config.BuildDir, "scene_dense.mvs"),
 		"-w", config.BuildDir,
 		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
 	}
@@ -78,14 +179,315 @@ func TestRunDensifyPointCloud_Error(t *testing.T) {
 	service.RunDensifyPointCloud()
 }
 
+func TestRunDensifyPointCloud_MissingScene(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	// The scene was exported somewhere else than configured
+	buildDir := t.TempDir()
+	config := openmvs.OpenMVSConfig{
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
+		MaxThreads: 1,
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			expected := fmt.Sprintf("cannot run DensifyPointCloud: %s does not exist", config.SceneFile)
+			if err == nil || err.Error() != expected {
+				t.Errorf("expected error %q, got %v", expected, err)
+			}
+		})
+
+	service.RunDensifyPointCloud()
+}
+
+func TestRunReconstructMesh_MissingOutput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+	if err := os.Remove(filepath.Join(buildDir, "scene_mesh.ply")); err != nil {
+		t.Fatal(err)
+	}
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:  buildDir,
+		SceneFile: filepath.Join(buildDir, "scene.mvs"),
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().RunCommand("ReconstructMesh", gomock.Any()).Return(nil)
+
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			expected := fmt.Sprintf("ReconstructMesh did not write its output: %s does not exist", filepath.Join(buildDir, "scene_mesh.ply"))
+			if err == nil || err.Error() != expected {
+				t.Errorf("expected error %q, got %v", expected, err)
+			}
+		})
+
+	service.RunReconstructMesh()
+}
+
+func TestRunExportPointCloud_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:         t.TempDir(),
+		OutputDir:        t.TempDir(),
+		PointCloudFormat: openmvs.PointCloudFormatLAS,
+	}
+
+	dense := "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nproperty uchar red\nproperty uchar green\nproperty uchar blue\nend_header\n0 0 0 255 0 0\n1 1 1 0 255 0\n"
+	if err := os.WriteFile(filepath.Join(config.BuildDir, "scene_dense.ply"), []byte(dense), 0644); err != nil {
+		t.Fatalf("failed to write dense cloud: %v", err)
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	service.RunExportPointCloud()
+
+	h, err := las.ReadHeader(filepath.Join(config.OutputDir, "dense.las"))
+	if err != nil {
+		t.Fatalf("expected dense.las to be exported: %v", err)
+	}
+	if h.NumberOfPoints != 2 {
+		t.Errorf("expected 2 points, got %d", h.NumberOfPoints)
+	}
+}
+
+func TestRunExportPointCloud_Georeference(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:         t.TempDir(),
+		OutputDir:        t.TempDir(),
+		PointCloudFormat: openmvs.PointCloudFormatLAS,
+	}
+	config.GeoreferenceFile = filepath.Join(config.BuildDir, "georeference.json")
+
+	frame, err := geo.NewFrame(geo.FrameUTM, geo.Position{Latitude: 51.5, Longitude: 0.5, Altitude: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	georef := geo.Georeference{CRS: frame.CRS(), Origin: frame.Origin, Transform: frame.ToCRS()}
+	if err := georef.Write(config.GeoreferenceFile); err != nil {
+		t.Fatal(err)
+	}
+
+	dense := "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n1 2 3\n"
+	if err := os.WriteFile(filepath.Join(config.BuildDir, "scene_dense.ply"), []byte(dense), 0644); err != nil {
+		t.Fatalf("failed to write dense cloud: %v", err)
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	service.RunExportPointCloud()
+
+	h, err := las.ReadHeader(filepath.Join(config.OutputDir, "dense.las"))
+	if err != nil {
+		t.Fatalf("expected dense.las to be exported: %v", err)
+	}
+	if !strings.Contains(h.WKT, `"WGS 84 / UTM zone 31N"`) || !strings.Contains(h.WKT, `AUTHORITY["EPSG","32631"]]`) {
+		t.Errorf("expected the WKT of UTM zone 31N, got %q", h.WKT)
+	}
+	// The points are in absolute CRS coordinates, stored relative to the
+	// origin of the frame
+	offset := georef.Offset()
+	if h.Offset != offset {
+		t.Errorf("expected offset %v, got %v", offset, h.Offset)
+	}
+	for i, want := range [3]float64{1, 2, 3} {
+		if math.Abs(h.Min[i]-offset[i]) > 1e-3 || math.Abs(h.Max[i]-offset[i]-want) > 1e-3 {
+			t.Errorf("expected bounds %v to %v from the origin, got %v to %v", 0, want, h.Min[i]-offset[i], h.Max[i]-offset[i])
+		}
+	}
+}
+
+func TestRunExportPointCloud_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:         t.TempDir(),
+		OutputDir:        t.TempDir(),
+		PointCloudFormat: openmvs.PointCloudFormatLAS,
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "failed to export point cloud") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	service.RunExportPointCloud()
+}
+
+func TestRunCropPointCloud_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:  t.TempDir(),
+		OutputDir: t.TempDir(),
+		Crop:      crop.Options{AutoBox: true, Margin: 0.1},
+		CropDense: true,
+	}
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
+	// Two cameras bound the unit cube, the third point is a stray
+	dense := "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\nend_header\n0.5 0.5 0.5\n0.2 0.8 0.1\n9 9 9\n"
+	sfm := `{"sfm_data_version": "0.3", "extrinsics": [
+		{"key": 0, "value": {"rotation": [[1,0,0],[0,1,0],[0,0,1]], "center": [0,0,0]}},
+		{"key": 1, "value": {"rotation": [[1,0,0],[0,1,0],[0,0,1]], "center": [1,1,1]}}]}`
+	for name, content := range map[string]string{"scene_dense.ply": dense, "sfm_data.json": sfm} {
+		if err := os.WriteFile(filepath.Join(config.BuildDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	service.RunCropPointCloud()
+
+	file, err := ply.Read(filepath.Join(config.BuildDir, "scene_dense_crop.ply"))
+	if err != nil {
+		t.Fatalf("expected scene_dense_crop.ply to be written: %v", err)
+	}
+	if n := file.Element("vertex").Count; n != 2 {
+		t.Errorf("expected 2 vertices after cropping, got %d", n)
+	}
+}
+
+func TestRunCropPointCloud_NoCameras(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:  t.TempDir(),
+		OutputDir: t.TempDir(),
+		Crop:      crop.Options{AutoBox: true},
+		CropDense: true,
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "failed to estimate crop box") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+			panic(err)
+		})
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Check to stop the stage")
+		}
+	}()
+
+	service.RunCropPointCloud()
+}
+
+func TestRunReconstructMesh_Cropped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
+	if err := os.WriteFile(filepath.Join(buildDir, "scene_dense_crop.ply"), []byte("ply"), 0644); err != nil {
+		t.Fatalf("failed to write cropped cloud: %v", err)
+	}
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:  buildDir,
+		SceneFile: filepath.Join(buildDir, "scene.mvs"),
+		CropDense: true,
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	expectedArgs := []string{
+		filepath.Join(config.BuildDir, "scene_dense.mvs"), "-o", filepath.Join(config.BuildDir, "scene_mesh.ply"),
+		"-w", config.BuildDir,
+		"-p", filepath.Join(config.BuildDir, "scene_dense_crop.ply"),
+		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
+	}
+
+	mockUtils.EXPECT().
+		RunCommand("ReconstructMesh", expectedArgs).
+		Return(nil)
+
+	service.RunReconstructMesh()
+}
+
 func TestRunReconstructMesh_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
 		MaxThreads: 4,
 	}
 
@@ -95,8 +497,9 @@ func TestRunReconstructMesh_Success(t *testing.T) {
 	}
 
 	expectedArgs := []string{
-		"scene_dense.mvs", "-o", "scene_mesh.ply",
+		filepath.Join(config.BuildDir, "scene_dense.mvs"), "-o", filepath.Join(config.BuildDir, "scene_mesh.ply"),
 		"-w", config.BuildDir,
+		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
 	}
 
 	mockUtils.EXPECT().
@@ -112,8 +515,12 @@ func TestRunReconstructMesh_Error(t *testing.T) {
 
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
 		MaxThreads: 4,
 	}
 
@@ -123,8 +530,9 @@ func TestRunReconstructMesh_Error(t *testing.T) {
 	}
 
 	expectedArgs := []string{
-		"scene_dense.mvs", "-o", "scene_mesh.ply",
+		filepath.Join(config.BuildDir, "scene_dense.mvs"), "-o", filepath.Join(config.BuildDir, "scene_mesh.ply"),
 		"-w", config.BuildDir,
+		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
 	}
 
 	expectedErr := errors.New("command failed")
@@ -150,8 +558,12 @@ func TestRunRefineMesh_Success(t *testing.T) {
 
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
 		MaxThreads: 4,
 	}
 
@@ -161,7 +573,8 @@ func TestRunRefineMesh_Success(t *testing.T) {
 	}
 
 	expectedArgs := []string{
-		"scene.mvs", "-m", "scene_mesh.ply", "-o", "scene_dense_mesh_refine.mvs",
+		config.SceneFile, "-m", filepath.Join(config.BuildDir, "scene_mesh.ply"),
+		"-o", filepath.Join(config.BuildDir, "scene_dense_mesh_refine.mvs"),
 		"-w", config.BuildDir,
 		"--scales", "1", "--max-face-area", "16",
 		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
@@ -180,8 +593,12 @@ func TestRunRefineMesh_Error(t *testing.T) {
 
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
+	buildDir := t.TempDir()
+	writeScene(t, buildDir)
+
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
+		BuildDir:   buildDir,
+		SceneFile:  filepath.Join(buildDir, "scene.mvs"),
 		MaxThreads: 4,
 	}
 
@@ -191,7 +608,8 @@ func TestRunRefineMesh_Error(t *testing.T) {
 	}
 
 	expectedArgs := []string{
-		"scene.mvs", "-m", "scene_mesh.ply", "-o", "scene_dense_mesh_refine.mvs",
+		config.SceneFile, "-m", filepath.Join(config.BuildDir, "scene_mesh.ply"),
+		"-o", filepath.Join(config.BuildDir, "scene_dense_mesh_refine.mvs"),
 		"-w", config.BuildDir,
 		"--scales", "1", "--max-face-area", "16",
 		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
@@ -221,42 +639,38 @@ func TestRunTextureMesh_Success(t *testing.T) {
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
-		OutputDir:  "/path/to/output",
+		BuildDir:   t.TempDir(),
+		OutputDir:  t.TempDir(),
 		MaxThreads: 4,
 	}
 
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
 	service := openmvs.OpenMVSServiceImpl{
 		Utils:  mockUtils,
 		Config: &config,
 	}
 
 	expectedArgs := []string{
-		"scene_dense.mvs", "-m", "scene_dense_mesh_refine.ply",
-		"-o", "scene_dense_mesh_refine_texture.mvs",
+		filepath.Join(config.BuildDir, "scene_dense.mvs"), "-m", filepath.Join(config.BuildDir, "scene_dense_mesh_refine.ply"),
+		"-o", filepath.Join(config.BuildDir, "scene_dense_mesh_refine_texture.mvs"),
 		"-w", config.BuildDir,
 		"--export-type", "obj",
+		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
 	}
 
 	mockUtils.EXPECT().
 		RunCommand("TextureMesh", expectedArgs).
 		Return(nil)
 
-	mockUtils.EXPECT().
-		CopyFile(
-			fmt.Sprintf("%s/scene_dense_mesh_refine_texture.mtl", config.BuildDir),
-			fmt.Sprintf("%s/final.mtl", config.OutputDir),
-		).
-		Return(nil)
-
-	mockUtils.EXPECT().
-		CopyFile(
-			fmt.Sprintf("%s/scene_dense_mesh_refine_texture.obj", config.BuildDir),
-			fmt.Sprintf("%s/final.obj", config.OutputDir),
-		).
-		Return(nil)
-
 	service.RunTextureMesh()
+
+	for _, name := range []string{"final.obj", "final.mtl", "scene_dense_mesh_refine_texture_material_00_map_Kd.png"} {
+		if _, err := os.Stat(filepath.Join(config.OutputDir, name)); err != nil {
+			t.Errorf("expected %s to be exported: %v", name, err)
+		}
+	}
 }
 
 func TestRunTextureMesh_Error(t *testing.T) {
@@ -266,21 +680,25 @@ func TestRunTextureMesh_Error(t *testing.T) {
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
-		OutputDir:  "/path/to/output",
+		BuildDir:   t.TempDir(),
+		OutputDir:  t.TempDir(),
 		MaxThreads: 4,
 	}
 
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
 	service := openmvs.OpenMVSServiceImpl{
 		Utils:  mockUtils,
 		Config: &config,
 	}
 
 	expectedArgs := []string{
-		"scene_dense.mvs", "-m", "scene_dense_mesh_refine.ply",
-		"-o", "scene_dense_mesh_refine_texture.mvs",
+		filepath.Join(config.BuildDir, "scene_dense.mvs"), "-m", filepath.Join(config.BuildDir, "scene_dense_mesh_refine.ply"),
+		"-o", filepath.Join(config.BuildDir, "scene_dense_mesh_refine_texture.mvs"),
 		"-w", config.BuildDir,
 		"--export-type", "obj",
+		"--max-threads", fmt.Sprintf("%d", config.MaxThreads),
 	}
 
 	expectedErr := errors.New("command failed")
@@ -289,20 +707,6 @@ func TestRunTextureMesh_Error(t *testing.T) {
 		RunCommand("TextureMesh", expectedArgs).
 		Return(expectedErr)
 
-	mockUtils.EXPECT().
-		CopyFile(
-			fmt.Sprintf("%s/scene_dense_mesh_refine_texture.mtl", config.BuildDir),
-			fmt.Sprintf("%s/final.mtl", config.OutputDir),
-		).
-		Return(nil)
-
-	mockUtils.EXPECT().
-		CopyFile(
-			fmt.Sprintf("%s/scene_dense_mesh_refine_texture.obj", config.BuildDir),
-			fmt.Sprintf("%s/final.obj", config.OutputDir),
-		).
-		Return(nil)
-
 	mockUtils.EXPECT().
 		Check(gomock.Any()).
 		Do(func(err error) {
@@ -321,11 +725,14 @@ func TestRunPipeline_Success(t *testing.T) {
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
-		OutputDir:  "/path/to/output",
+		BuildDir:   t.TempDir(),
+		OutputDir:  t.TempDir(),
 		MaxThreads: 4,
 	}
 
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
 	service := openmvs.OpenMVSServiceImpl{
 		Utils:  mockUtils,
 		Config: &config,
@@ -336,8 +743,6 @@ func TestRunPipeline_Success(t *testing.T) {
 	mockUtils.EXPECT().RunCommand("RefineMesh", gomock.Any()).Return(nil)
 	mockUtils.EXPECT().RunCommand("TextureMesh", gomock.Any()).Return(nil)
 
-	mockUtils.EXPECT().CopyFile(gomock.Any(), gomock.Any()).Return(nil).Times(2)
-
 	service.RunPipeline()
 }
 
@@ -348,11 +753,14 @@ func TestRunPipeline_Error(t *testing.T) {
 	mockUtils := mocks.NewMockUtilsInterface(ctrl)
 
 	config := openmvs.OpenMVSConfig{
-		BuildDir:   "/path/to/build",
-		OutputDir:  "/path/to/output",
+		BuildDir:   t.TempDir(),
+		OutputDir:  t.TempDir(),
 		MaxThreads: 4,
 	}
 
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
 	service := openmvs.OpenMVSServiceImpl{
 		Utils:  mockUtils,
 		Config: &config,
@@ -365,8 +773,6 @@ func TestRunPipeline_Error(t *testing.T) {
 	mockUtils.EXPECT().RunCommand("RefineMesh", gomock.Any()).Return(expectedErr)
 	mockUtils.EXPECT().RunCommand("TextureMesh", gomock.Any()).Return(nil)
 
-	mockUtils.EXPECT().CopyFile(gomock.Any(), gomock.Any()).Return(nil).Times(2)
-
 	mockUtils.EXPECT().
 		Check(gomock.Any()).
 		Do(func(err error) {
@@ -378,6 +784,141 @@ func TestRunPipeline_Error(t *testing.T) {
 	service.RunPipeline()
 }
 
+func TestRunTextureMesh_GLB(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:     t.TempDir(),
+		OutputDir:    t.TempDir(),
+		MaxThreads:   4,
+		OutputFormat: openmvs.OutputFormatGLB,
+	}
+
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().RunCommand("TextureMesh", gomock.Any()).Return(nil)
+
+	service.RunTextureMesh()
+
+	if err := gltf.ValidateFile(filepath.Join(config.OutputDir, "final.glb")); err != nil {
+		t.Errorf("expected a valid final.glb: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "final.obj")); !os.IsNotExist(err) {
+		t.Errorf("expected final.obj not to be exported")
+	}
+}
+
+func TestRunTextureMesh_MissingTexture(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:   t.TempDir(),
+		OutputDir:  t.TempDir(),
+		MaxThreads: 4,
+	}
+
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+	if err := os.Remove(filepath.Join(config.BuildDir, "scene_dense_mesh_refine_texture_material_00_map_Kd.png")); err != nil {
+		t.Fatalf("failed to remove texture: %v", err)
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().RunCommand("TextureMesh", gomock.Any()).Return(nil)
+
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "failed to export textured mesh") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+		})
+
+	service.RunTextureMesh()
+}
+
+func TestRunGenerateLODs_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:   t.TempDir(),
+		OutputDir:  t.TempDir(),
+		MaxThreads: 4,
+		LODs:       []simplify.Target{{Faces: 1}, {Ratio: 0.5}},
+	}
+
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	service.RunGenerateLODs()
+
+	for _, name := range []string{"final_lod1.obj", "final_lod1.mtl", "final_lod2.obj", "final_lod2.mtl"} {
+		if _, err := os.Stat(filepath.Join(config.OutputDir, name)); err != nil {
+			t.Errorf("expected %s to be exported: %v", name, err)
+		}
+	}
+}
+
+func TestRunGenerateLODs_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:   t.TempDir(),
+		OutputDir:  t.TempDir(),
+		MaxThreads: 4,
+		LODs:       []simplify.Target{{Faces: 1}},
+	}
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().
+		Check(gomock.Any()).
+		Do(func(err error) {
+			if err == nil || !strings.Contains(err.Error(), "failed to load textured mesh") {
+				t.Errorf("unexpected error passed to Check: %v", err)
+			}
+			panic(err)
+		})
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Check to stop the stage")
+		}
+	}()
+
+	service.RunGenerateLODs()
+}
+
 func TestNewOpenMVSService_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -387,10 +928,12 @@ func TestNewOpenMVSService_Success(t *testing.T) {
 	config := &openmvs.OpenMVSConfig{
 		OutputDir:  "/path/to/output",
 		BuildDir:   "/path/to/build",
+		SceneFile:  "/path/to/build/scene.mvs",
 		MaxThreads: 4,
 	}
 
 	mockUtils.EXPECT().EnsureDir(config.OutputDir).Return(nil)
+	mockUtils.EXPECT().EnsureDir(config.BuildDir).Return(nil)
 
 	service := openmvs.NewOpenMVSService(config, mockUtils)
 
@@ -435,6 +978,34 @@ func TestNewOpenMVSService_FailOutputDir(t *testing.T) {
 	openmvs.NewOpenMVSService(config, mockUtils)
 }
 
+func TestNewOpenMVSService_NoScene(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := &openmvs.OpenMVSConfig{
+		OutputDir: "/path/to/output",
+		BuildDir:  "/path/to/build",
+	}
+
+	mockUtils.EXPECT().EnsureDir(config.OutputDir).Return(nil)
+	mockUtils.EXPECT().Check(gomock.Any()).
+		Do(func(err error) {
+			panic(err)
+		})
+
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || err.Error() != "build directory and scene file must be specified" {
+			t.Errorf("expected a missing scene file error, got %v", r)
+		}
+	}()
+
+	openmvs.NewOpenMVSService(config, mockUtils)
+}
+
 func TestNewOpenMVSService_FailEnsureDir(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -464,3 +1035,135 @@ func TestNewOpenMVSService_FailEnsureDir(t *testing.T) {
 
 	openmvs.NewOpenMVSService(config, mockUtils)
 }
+
+func TestNewOpenMVSService_UnsupportedOutputFormat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := &openmvs.OpenMVSConfig{
+		OutputDir:    "/path/to/output",
+		BuildDir:     "/path/to/build",
+		OutputFormat: "fbx",
+	}
+
+	mockUtils.EXPECT().EnsureDir(config.OutputDir).Return(nil)
+
+	mockUtils.EXPECT().Check(gomock.Any()).
+		Do(func(err error) {
+			panic(err)
+		})
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected panic due to unsupported output format, but did not panic")
+		}
+	}()
+
+	openmvs.NewOpenMVSService(config, mockUtils)
+}
+
+func TestNewOpenMVSService_InvalidTextures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := &openmvs.OpenMVSConfig{
+		OutputDir: "/path/to/output",
+		BuildDir:  "/path/to/build",
+		Textures:  texture.Options{Format: "webp"},
+	}
+
+	mockUtils.EXPECT().EnsureDir(config.OutputDir).Return(nil)
+
+	mockUtils.EXPECT().Check(gomock.Any()).
+		Do(func(err error) {
+			panic(err)
+		})
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected panic due to unsupported texture format, but did not panic")
+		}
+	}()
+
+	openmvs.NewOpenMVSService(config, mockUtils)
+}
+
+func TestRunTextureMesh_ProcessTextures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+
+	config := openmvs.OpenMVSConfig{
+		BuildDir:  t.TempDir(),
+		OutputDir: t.TempDir(),
+		Textures:  texture.Options{MaxSize: 4, Format: texture.FormatJPEG},
+	}
+
+	writeTexturedMesh(t, config.BuildDir)
+	config.SceneFile = filepath.Join(config.BuildDir, "scene.mvs")
+
+	// Replace the placeholder texture with a real 8x8 image
+	f, err := os.Create(filepath.Join(config.BuildDir, "scene_dense_mesh_refine_texture_material_00_map_Kd.png"))
+	if err != nil {
+		t.Fatalf("failed to create texture: %v", err)
+	}
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatalf("failed to encode texture: %v", err)
+	}
+	f.Close()
+
+	service := openmvs.OpenMVSServiceImpl{
+		Utils:  mockUtils,
+		Config: &config,
+	}
+
+	mockUtils.EXPECT().RunCommand("TextureMesh", gomock.Any()).Return(nil)
+
+	service.RunTextureMesh()
+
+	for _, name := range []string{"final.obj", "final.mtl", "scene_dense_mesh_refine_texture_material_00_map_Kd.jpg"} {
+		if _, err := os.Stat(filepath.Join(config.OutputDir, name)); err != nil {
+			t.Errorf("expected %s to be exported: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "scene_dense_mesh_refine_texture_material_00_map_Kd.png")); !os.IsNotExist(err) {
+		t.Errorf("expected the original texture not to be exported")
+	}
+}
+
+// writeScene writes placeholders for the scene and the files the OpenMVS
+// commands produce before texturing into dir
+func writeScene(t *testing.T, dir string) {
+	t.Helper()
+
+	for _, name := range []string{"scene.mvs", "scene_dense.mvs", "scene_dense.ply", "scene_mesh.ply", "scene_dense_mesh_refine.mvs", "scene_dense_mesh_refine.ply"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+// writeTexturedMesh writes the scene and the files TextureMesh produces into
+// dir
+func writeTexturedMesh(t *testing.T, dir string) {
+	t.Helper()
+
+	writeScene(t, dir)
+
+	files := map[string]string{
+		"scene_dense_mesh_refine_texture.obj":                    "mtllib scene_dense_mesh_refine_texture.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nusemtl material_00\nf 1/1 2/2 3/3\n",
+		"scene_dense_mesh_refine_texture.mtl":                    "newmtl material_00\nKd 1 1 1\nmap_Kd scene_dense_mesh_refine_texture_material_00_map_Kd.png\n",
+		"scene_dense_mesh_refine_texture_material_00_map_Kd.png": "png",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
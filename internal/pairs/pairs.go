@@ -0,0 +1,273 @@
+package pairs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+// Pair strategies
+const (
+	StrategyExhaustive = "exhaustive"
+	StrategyContiguous = "contiguous"
+	StrategyGPS        = "gps"
+	StrategyFile       = "file"
+)
+
+// Options select how image pairs are chosen for matching
+type Options struct {
+	// Strategy is one of the Strategy constants, exhaustive when empty
+	Strategy string
+	// Window is the number of following images each image is paired with by
+	// the contiguous strategy
+	Window int
+	// Neighbours is the number of nearest images by GPS position each image
+	// is paired with by the gps strategy
+	Neighbours int
+	// File lists the pairs for the file strategy, see Parse
+	File string
+}
+
+// Validate reports missing or invalid options of the strategy
+func (o Options) Validate() error {
+	switch o.Strategy {
+	case "", StrategyExhaustive:
+	case StrategyContiguous:
+		if o.Window < 1 {
+			return fmt.Errorf("the contiguous pair strategy needs a window of at least 1")
+		}
+	case StrategyGPS:
+		if o.Neighbours < 1 {
+			return fmt.Errorf("the gps pair strategy needs at least 1 neighbour")
+		}
+	case StrategyFile:
+		if o.File == "" {
+			return fmt.Errorf("the file pair strategy needs a pairs file")
+		}
+	default:
+		return fmt.Errorf("unknown pair strategy %q", o.Strategy)
+	}
+	return nil
+}
+
+// Pair is an unordered pair of view ids, stored with I < J
+type Pair struct {
+	I, J uint32
+}
+
+// Set is a set of pairs
+type Set map[Pair]struct{}
+
+// Add inserts the pair of a and b, ignoring a view paired with itself
+func (s Set) Add(a, b uint32) {
+	if a == b {
+		return
+	}
+	if a > b {
+		a, b = b, a
+	}
+	s[Pair{a, b}] = struct{}{}
+}
+
+// Sorted returns the pairs in order
+func (s Set) Sorted() []Pair {
+	out := make([]Pair, 0, len(s))
+	for p := range s {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].I != out[j].I {
+			return out[i].I < out[j].I
+		}
+		return out[i].J < out[j].J
+	})
+	return out
+}
+
+// Exhaustive pairs every view with every other view
+func Exhaustive(ids []uint32) Set {
+	s := Set{}
+	for i := range ids {
+		for j := i + 1; j < len(ids); j++ {
+			s.Add(ids[i], ids[j])
+		}
+	}
+	return s
+}
+
+// Contiguous pairs every view with the window views that follow it, for
+// images taken in sequence such as video frames
+func Contiguous(ids []uint32, window int) Set {
+	s := Set{}
+	for i := range ids {
+		for j := i + 1; j <= i+window && j < len(ids); j++ {
+			s.Add(ids[i], ids[j])
+		}
+	}
+	return s
+}
+
+// Nearest pairs every view with its k nearest views by position
+func Nearest(positions map[uint32][3]float64, k int) Set {
+	ids := make([]uint32, 0, len(positions))
+	for id := range positions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	s := Set{}
+	others := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		p := positions[id]
+		others = others[:0]
+		for _, o := range ids {
+			if o != id {
+				others = append(others, o)
+			}
+		}
+		dist := func(o uint32) float64 {
+			q := positions[o]
+			dx, dy, dz := p[0]-q[0], p[1]-q[1], p[2]-q[2]
+			return dx*dx + dy*dy + dz*dz
+		}
+		sort.SliceStable(others, func(i, j int) bool { return dist(others[i]) < dist(others[j]) })
+		for _, o := range others[:min(k, len(others))] {
+			s.Add(id, o)
+		}
+	}
+	return s
+}
+
+// ParseFile reads a pairs file, see Parse
+func ParseFile(path string, sfm *sfmdata.SfMData) (Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pairs file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	s, err := Parse(f, sfm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse reads pairs in the OpenMVG text format, where every line pairs its
+// first view with each of the others. Views are given by id or by image file
+// name. Empty lines and lines starting with # are ignored.
+func Parse(r io.Reader, sfm *sfmdata.SfMData) (Set, error) {
+	ids := map[uint32]bool{}
+	for _, v := range sfm.Views {
+		ids[v.ID] = true
+	}
+	view := func(token string) (uint32, error) {
+		if id, err := strconv.ParseUint(token, 10, 32); err == nil {
+			if !ids[uint32(id)] {
+				return 0, fmt.Errorf("unknown view %d", id)
+			}
+			return uint32(id), nil
+		}
+		if v := sfm.ViewByFilename(token); v != nil {
+			return v.ID, nil
+		}
+		return 0, fmt.Errorf("unknown image %q", token)
+	}
+
+	s := Set{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected at least two views", line)
+		}
+
+		first, err := view(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for _, f := range fields[1:] {
+			other, err := view(f)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			s.Add(first, other)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write saves the pairs in the format OpenMVG reads for the file extension,
+// cereal portable binary for .bin and text otherwise
+func Write(path string, s Set) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create pairs file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if filepath.Ext(path) == ".bin" {
+		err = writeBinary(w, s)
+	} else {
+		err = writeText(w, s)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write pairs file %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// writeText writes one line per view listing the views it is paired with
+func writeText(w io.Writer, s Set) error {
+	pairs := s.Sorted()
+	for i := 0; i < len(pairs); {
+		line := []string{strconv.FormatUint(uint64(pairs[i].I), 10)}
+		j := i
+		for ; j < len(pairs) && pairs[j].I == pairs[i].I; j++ {
+			line = append(line, strconv.FormatUint(uint64(pairs[j].J), 10))
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(line, " ")); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
+
+// writeBinary writes the std::set<std::pair<uint32, uint32>> serialisation
+// of a cereal portable binary archive: an endianness flag, the 64 bit set
+// size and the pairs
+func writeBinary(w io.Writer, s Set) error {
+	pairs := s.Sorted()
+	if err := binary.Write(w, binary.LittleEndian, uint8(1)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(pairs))); err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		if err := binary.Write(w, binary.LittleEndian, [2]uint32{p.I, p.J}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
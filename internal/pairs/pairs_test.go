@@ -0,0 +1,109 @@
+package pairs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+func TestStrategies(t *testing.T) {
+	ids := []uint32{0, 1, 2, 3}
+
+	if got := pairs.Exhaustive(ids).Sorted(); len(got) != 6 {
+		t.Errorf("expected 6 exhaustive pairs, got %v", got)
+	}
+
+	want := []pairs.Pair{{0, 1}, {0, 2}, {1, 2}, {1, 3}, {2, 3}}
+	if got := pairs.Contiguous(ids, 2).Sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Two clusters far apart are not paired with each other
+	positions := map[uint32][3]float64{
+		0: {0, 0, 0}, 1: {1, 0, 0}, 2: {0, 1, 0},
+		3: {100, 0, 0}, 4: {101, 0, 0}, 5: {100, 1, 0},
+	}
+	want = []pairs.Pair{{0, 1}, {0, 2}, {1, 2}, {3, 4}, {3, 5}, {4, 5}}
+	if got := pairs.Nearest(positions, 2).Sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	sfm := &sfmdata.SfMData{Views: []sfmdata.View{
+		{ID: 0, Filename: "a.jpg"}, {ID: 1, Filename: "b.jpg"}, {ID: 2, Filename: "c.jpg"},
+	}}
+
+	s, err := pairs.Parse(strings.NewReader("# pairs\n0 1 2\n\nc.jpg a.jpg b.jpg\n1 1\n"), sfm)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []pairs.Pair{{0, 1}, {0, 2}, {1, 2}}
+	if got := s.Sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	for _, input := range []string{"0\n", "0 7\n", "0 d.jpg\n"} {
+		if _, err := pairs.Parse(strings.NewReader(input), sfm); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	s := pairs.Contiguous([]uint32{0, 1, 2}, 2)
+	dir := t.TempDir()
+
+	txt := filepath.Join(dir, "pairs.txt")
+	if err := pairs.Write(txt, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(txt); string(data) != "0 1 2\n1 2\n" {
+		t.Errorf("unexpected text pairs %q", data)
+	}
+
+	bin := filepath.Join(dir, "pairs.bin")
+	if err := pairs.Write(bin, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var want bytes.Buffer
+	want.WriteByte(1)
+	binary.Write(&want, binary.LittleEndian, uint64(3))
+	binary.Write(&want, binary.LittleEndian, []uint32{0, 1, 0, 2, 1, 2})
+	if data, _ := os.ReadFile(bin); !bytes.Equal(data, want.Bytes()) {
+		t.Errorf("unexpected binary pairs %v", data)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	valid := []pairs.Options{
+		{},
+		{Strategy: pairs.StrategyContiguous, Window: 5},
+		{Strategy: pairs.StrategyGPS, Neighbours: 8},
+		{Strategy: pairs.StrategyFile, File: "pairs.txt"},
+	}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", o, err)
+		}
+	}
+
+	invalid := []pairs.Options{
+		{Strategy: "vocabulary"},
+		{Strategy: pairs.StrategyContiguous},
+		{Strategy: pairs.StrategyGPS},
+		{Strategy: pairs.StrategyFile},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%+v: expected error", o)
+		}
+	}
+}
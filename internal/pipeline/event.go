@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/toolout"
+)
+
+// EventType is the kind of a progress event
+type EventType string
+
+const (
+	StageStarted  EventType = "stage_started"
+	StageProgress EventType = "stage_progress"
+	StageFinished EventType = "stage_finished"
+	StageFailed   EventType = "stage_failed"
+)
+
+// Event reports the progress of a pipeline stage
+type Event struct {
+	Type  EventType `json:"type"`
+	Stage string    `json:"stage"`
+	Time  time.Time `json:"time"`
+	// Percent is the completion of the current task of the stage, parsed
+	// from the console output of the tools
+	Percent float64 `json:"percent,omitempty"`
+	// Duration is the time the stage took, once it finished or failed
+	Duration time.Duration `json:"duration_ns,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	// Result is the result of the stage once it finished or failed
+	Result *StepResult `json:"result,omitempty"`
+	// Context carries the span of the stage once it started
+	Context context.Context `json:"-"`
+}
+
+// Observer receives the progress events of a pipeline. It is called from
+// the goroutine running the pipeline and must not block.
+type Observer func(Event)
+
+// Observers returns an observer passing events to each of observers that
+// is set
+func Observers(observers ...Observer) Observer {
+	return func(e Event) {
+		for _, observe := range observers {
+			if observe != nil {
+				observe(e)
+			}
+		}
+	}
+}
+
+// maxLine bounds the console output buffered while looking for a
+// percentage
+const maxLine = 4096
+
+// percentRe matches the progress of OpenMVS, as in
+// "Estimated depth-maps 12/50 (24.00%, 1s, ETA 3s)...", and the bracketed
+// percentages of OpenMVG loggers such as "[ 40%]"
+var percentRe = regexp.MustCompile(`[(\[]\s*(\d{1,3}(?:\.\d+)?)%`)
+
+// Tracker turns the console output of the tools into StageProgress events
+// for the current stage, and into the metrics of its result. Stage events
+// must be passed through Observe so that it knows the current stage, and
+// the output of the commands written to it, usually through
+// utils.UtilsImpl.Output.
+type Tracker struct {
+	observe Observer
+
+	mu     sync.Mutex
+	stage  string
+	parser *toolout.Parser
+	line   []byte
+	// stars counts the marks of an OpenMVG progress display, -1 outside
+	// of one
+	stars   int
+	percent int
+}
+
+// NewTracker returns a tracker reporting to observe
+func NewTracker(observe Observer) *Tracker {
+	return &Tracker{observe: observe, stars: -1, percent: -1}
+}
+
+// Observe passes a stage event on, and starts tracking the progress of the
+// stage when it starts
+func (t *Tracker) Observe(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case e.Type == StageStarted:
+		t.stage = e.Stage
+		t.parser = toolout.NewParser("")
+		t.line = t.line[:0]
+		t.stars = -1
+		t.percent = -1
+	case e.Result != nil && e.Stage == t.stage:
+		t.endLine()
+		e.Result.Metrics = t.parser.Metrics()
+	}
+	t.observe(e)
+}
+
+// Write parses console output, it never fails
+func (t *Tracker) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range p {
+		switch {
+		case b == '\n' || b == '\r':
+			t.endLine()
+		case b == '*' && t.stars >= 0:
+			// OpenMVG draws 51 marks under a 0 to 100% scale
+			t.stars++
+			t.report(float64(t.stars) * 2)
+		case len(t.line) < maxLine:
+			t.line = append(t.line, b)
+		}
+	}
+	return len(p), nil
+}
+
+func (t *Tracker) endLine() {
+	line := t.line
+	t.line = t.line[:0]
+	if t.parser != nil {
+		t.parser.Line(string(line))
+	}
+
+	switch {
+	case t.stars > 0:
+		// The marks end with the task
+		t.stars = -1
+	case bytes.HasPrefix(bytes.TrimSpace(line), []byte("0%")) && bytes.HasSuffix(bytes.TrimSpace(line), []byte("100%")):
+		// The scale of an OpenMVG progress display, the marks follow
+		// the ruler on the next line
+		t.stars = 0
+	default:
+		m := percentRe.FindAllSubmatch(line, -1)
+		if m == nil {
+			return
+		}
+		if percent, err := strconv.ParseFloat(string(m[len(m)-1][1]), 64); err == nil {
+			t.report(percent)
+		}
+	}
+}
+
+// report emits a StageProgress event when the percentage changed by at
+// least one point
+func (t *Tracker) report(percent float64) {
+	percent = min(percent, 100)
+	if t.stage == "" || int(percent) == t.percent {
+		return
+	}
+	t.percent = int(percent)
+	t.observe(Event{Type: StageProgress, Stage: t.stage, Time: time.Now(), Percent: percent})
+}
@@ -0,0 +1,118 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+)
+
+func record(events *[]pipeline.Event) pipeline.Observer {
+	return func(e pipeline.Event) {
+		*events = append(*events, e)
+	}
+}
+
+func TestRunStep(t *testing.T) {
+	var events []pipeline.Event
+	pipeline.RunStep(context.Background(), pipeline.Step{Name: "features", Run: func() {}}, record(&events))
+
+	if len(events) != 2 || events[0].Type != pipeline.StageStarted || events[1].Type != pipeline.StageFinished {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if events[1].Stage != "features" || events[1].Duration < 0 {
+		t.Errorf("unexpected finished event %+v", events[1])
+	}
+}
+
+func TestRunStep_Failed(t *testing.T) {
+	var events []pipeline.Event
+	failure := errors.New("failed to run openMVG_main_ComputeFeatures")
+	defer func() {
+		if r := recover(); r != failure {
+			t.Errorf("expected the panic to be passed on, got %v", r)
+		}
+		if len(events) != 2 || events[1].Type != pipeline.StageFailed || events[1].Error != failure.Error() {
+			t.Errorf("unexpected events %+v", events)
+		}
+	}()
+
+	pipeline.RunStep(context.Background(), pipeline.Step{Name: "features", Run: func() { panic(failure) }}, record(&events))
+}
+
+func TestTracker_OpenMVS(t *testing.T) {
+	var events []pipeline.Event
+	tracker := pipeline.NewTracker(record(&events))
+	tracker.Observe(pipeline.Event{Type: pipeline.StageStarted, Stage: "densify"})
+
+	// OpenMVS rewrites its progress line with carriage returns
+	for i := 1; i <= 4; i++ {
+		fmt.Fprintf(tracker, "Estimated depth-maps %d/4 (%d.00%%, 1s, ETA %ds)...\r", i, i*25, 4-i)
+	}
+	fmt.Fprint(tracker, "Estimated depth-maps 4/4 (100.00%, 4s, ETA 0s)...\n")
+
+	var percents []float64
+	for _, e := range events[1:] {
+		if e.Type != pipeline.StageProgress || e.Stage != "densify" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		percents = append(percents, e.Percent)
+	}
+	if fmt.Sprint(percents) != "[25 50 75 100]" {
+		t.Errorf("unexpected progress %v", percents)
+	}
+}
+
+func TestTracker_OpenMVG(t *testing.T) {
+	var events []pipeline.Event
+	tracker := pipeline.NewTracker(record(&events))
+	tracker.Observe(pipeline.Event{Type: pipeline.StageStarted, Stage: "features"})
+
+	fmt.Fprint(tracker, "\n - EXTRACT FEATURES -\n0%   10   20   30   40   50   60   70   80   90   100%\n|----|----|----|----|----|----|----|----|----|----|\n")
+	for range 51 {
+		// The marks are written as the task goes, without newlines
+		fmt.Fprint(tracker, "*")
+	}
+	fmt.Fprint(tracker, "\nTask done in (s): 2.0\n")
+
+	// Each mark is 2%, the last one closes the display
+	if len(events) != 51 {
+		t.Fatalf("expected an event per percentage, got %d", len(events)-1)
+	}
+	if events[1].Percent != 2 || events[25].Percent != 50 || events[50].Percent != 100 {
+		t.Errorf("unexpected progress %+v", events)
+	}
+}
+
+func TestTracker_NoStage(t *testing.T) {
+	var events []pipeline.Event
+	tracker := pipeline.NewTracker(record(&events))
+
+	// Output outside of a stage is ignored
+	fmt.Fprint(tracker, strings.Repeat("x", 10000)+" (50%)\n")
+	if len(events) != 0 {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestTracker_Result(t *testing.T) {
+	var events []pipeline.Event
+	tracker := pipeline.NewTracker(record(&events))
+
+	result := pipeline.RunStep(context.Background(), pipeline.Step{Name: "reconstruction", Run: func() {
+		fmt.Fprint(tracker, "→ Running: openMVG_main_SfM [--sfm_engine INCREMENTAL]\n")
+		fmt.Fprint(tracker, "-- #Camera calibrated: 11 from 12 input images.\n-- #Tracks, #3D points: 4589")
+	}}, tracker.Observe)
+
+	// The last line has no newline yet when the step finishes
+	if result.Metrics.RegisteredViews != 11 || result.Metrics.SparsePoints != 4589 {
+		t.Errorf("unexpected metrics %+v", result.Metrics)
+	}
+	last := events[len(events)-1]
+	if last.Result == nil || *last.Result != result {
+		t.Errorf("expected the finished event to carry the result, got %+v", last)
+	}
+}
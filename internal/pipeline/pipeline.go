@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/toolout"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Step is a named stage of a pipeline. Steps exchange data through files
+// only, so a pipeline can be resumed from any step once the previous ones
+// have run.
+type Step struct {
+	Name string
+	Run  func()
+}
+
+// StepResult is the outcome of a step
+type StepResult struct {
+	Step     string        `json:"step"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+	// Metrics are parsed from the output of the commands of the step by
+	// the Tracker observing it
+	Metrics toolout.Metrics `json:"metrics"`
+}
+
+// tracer is looked up on use, so that it follows the tracer provider set by
+// the tracing package
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/2024-dissertation/openmvgo/internal/pipeline")
+}
+
+// Run runs the steps in order, reporting them to observe when it is set,
+// and returns their results. The pipeline and each of its steps are traced
+// as spans under ctx.
+func Run(ctx context.Context, name string, steps []Step, observe Observer) []StepResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracer().Start(ctx, name, trace.WithAttributes(attribute.Int("openmvgo.steps", len(steps))))
+	defer func() {
+		if r := recover(); r != nil {
+			span.SetStatus(codes.Error, fmt.Sprint(r))
+			span.End()
+			panic(r)
+		}
+		span.End()
+	}()
+
+	results := make([]StepResult, 0, len(steps))
+	for _, step := range steps {
+		results = append(results, RunStep(ctx, step, observe))
+	}
+	return results
+}
+
+// RunStep runs a step, reporting when it starts and when it finishes or
+// fails to observe when it is set. Steps fail by panicking, like the
+// services do when a check fails, and the panic is passed on. The result
+// is sent with the finished or failed event, for observers to complete,
+// and its metrics are added to the span of the step.
+func RunStep(ctx context.Context, step Step, observe Observer) (result StepResult) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if observe == nil {
+		observe = func(Event) {}
+	}
+
+	ctx, span := tracer().Start(ctx, step.Name, trace.WithAttributes(attribute.String("openmvgo.step", step.Name)))
+	start := time.Now()
+	observe(Event{Type: StageStarted, Stage: step.Name, Time: start, Context: ctx})
+	defer func() {
+		e := Event{Type: StageFinished, Stage: step.Name, Time: time.Now()}
+		e.Duration = e.Time.Sub(start)
+		e.Result = &StepResult{Step: step.Name, Duration: e.Duration}
+		r := recover()
+		if r != nil {
+			e.Type = StageFailed
+			e.Error = fmt.Sprint(r)
+			e.Result.Error = e.Error
+			span.SetStatus(codes.Error, e.Error)
+		}
+		observe(e)
+		span.SetAttributes(metricAttributes(e.Result.Metrics)...)
+		span.End()
+		if r != nil {
+			panic(r)
+		}
+		result = *e.Result
+	}()
+
+	step.Run()
+	return StepResult{}
+}
+
+// metricAttributes returns the metrics that were found as span attributes,
+// named after their JSON fields
+func metricAttributes(m toolout.Metrics) []attribute.KeyValue {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var values map[string]float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(values))
+	for name, value := range values {
+		attrs = append(attrs, attribute.Float64("openmvgo.metrics."+name, value))
+	}
+	return attrs
+}
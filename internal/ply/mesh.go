@@ -0,0 +1,151 @@
+package ply
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Positions returns the x, y and z properties of the vertex element
+func (f *File) Positions() ([][3]float64, error) {
+	v := f.Element("vertex")
+	if v == nil {
+		return nil, fmt.Errorf("missing vertex element")
+	}
+
+	cols, err := scalarColumns(v, "x", "y", "z")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([][3]float64, v.Count)
+	for i := range out {
+		out[i] = [3]float64{cols[0][i], cols[1][i], cols[2][i]}
+	}
+	return out, nil
+}
+
+// Normals returns the nx, ny and nz properties of the vertex element, or nil
+// when the file has no normals
+func (f *File) Normals() [][3]float64 {
+	v := f.Element("vertex")
+	if v == nil {
+		return nil
+	}
+
+	cols, err := scalarColumns(v, "nx", "ny", "nz")
+	if err != nil {
+		return nil
+	}
+
+	out := make([][3]float64, v.Count)
+	for i := range out {
+		out[i] = [3]float64{cols[0][i], cols[1][i], cols[2][i]}
+	}
+	return out
+}
+
+// Colors returns the red, green and blue properties of the vertex element,
+// or nil when the file has no colors
+func (f *File) Colors() [][3]uint8 {
+	v := f.Element("vertex")
+	if v == nil {
+		return nil
+	}
+
+	cols, err := scalarColumns(v, "red", "green", "blue")
+	if err != nil {
+		if cols, err = scalarColumns(v, "diffuse_red", "diffuse_green", "diffuse_blue"); err != nil {
+			return nil
+		}
+	}
+
+	out := make([][3]uint8, v.Count)
+	for i := range out {
+		out[i] = [3]uint8{uint8(cols[0][i]), uint8(cols[1][i]), uint8(cols[2][i])}
+	}
+	return out
+}
+
+// Faces returns the vertex indices of every face, or nil when the file has
+// no faces
+func (f *File) Faces() [][]int {
+	p := f.faceProperty("vertex_indices", "vertex_index")
+	if p == nil {
+		return nil
+	}
+
+	out := make([][]int, len(p.Lists))
+	for i, list := range p.Lists {
+		face := make([]int, len(list))
+		for j, v := range list {
+			face[j] = int(v)
+		}
+		out[i] = face
+	}
+	return out
+}
+
+// FaceTexCoords returns the per face texture coordinates written by OpenMVS,
+// as u, v pairs for each face corner, or nil when the file has none
+func (f *File) FaceTexCoords() [][]float64 {
+	p := f.faceProperty("texcoord")
+	if p == nil {
+		return nil
+	}
+	return p.Lists
+}
+
+// FaceTextures returns the per face texture index written by OpenMVS when a
+// mesh uses more than one texture, or nil when the file has none
+func (f *File) FaceTextures() []int {
+	face := f.Element("face")
+	if face == nil {
+		return nil
+	}
+	p := face.Property("texnumber")
+	if p == nil || p.IsList() {
+		return nil
+	}
+
+	out := make([]int, len(p.Values))
+	for i, v := range p.Values {
+		out[i] = int(v)
+	}
+	return out
+}
+
+// TextureFiles returns the files named by TextureFile comments, in order
+func (f *File) TextureFiles() []string {
+	var out []string
+	for _, c := range f.Comments {
+		if rest, ok := strings.CutPrefix(c, "TextureFile "); ok {
+			out = append(out, strings.TrimSpace(rest))
+		}
+	}
+	return out
+}
+
+func (f *File) faceProperty(names ...string) *Property {
+	face := f.Element("face")
+	if face == nil {
+		return nil
+	}
+	for _, name := range names {
+		if p := face.Property(name); p != nil && p.IsList() {
+			return p
+		}
+	}
+	return nil
+}
+
+func scalarColumns(e *Element, names ...string) ([][]float64, error) {
+	cols := make([][]float64, len(names))
+	for i, name := range names {
+		p := e.Property(name)
+		if p == nil || p.IsList() {
+			return nil, fmt.Errorf("element %s has no scalar property %s", e.Name, name)
+		}
+		cols[i] = p.Values
+	}
+	return cols, nil
+}
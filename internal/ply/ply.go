@@ -0,0 +1,137 @@
+package ply
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is the encoding of the element data following the header
+type Format string
+
+const (
+	ASCII              Format = "ascii"
+	BinaryLittleEndian Format = "binary_little_endian"
+	BinaryBigEndian    Format = "binary_big_endian"
+)
+
+// Property is a single column of an element. Scalar properties store one
+// value per row in Values; list properties store one slice per row in Lists.
+type Property struct {
+	Name string
+	// Type is the PLY type of the values, e.g. float or uchar
+	Type string
+	// CountType is the PLY type of the list length and is empty for scalars
+	CountType string
+	Values    []float64
+	Lists     [][]float64
+}
+
+// IsList reports whether the property holds a list per row
+func (p *Property) IsList() bool {
+	return p.CountType != ""
+}
+
+// Element is a named group of rows such as vertex or face
+type Element struct {
+	Name       string
+	Count      int
+	Properties []*Property
+}
+
+// Property returns the property with the given name or nil
+func (e *Element) Property(name string) *Property {
+	for _, p := range e.Properties {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// AddProperty appends a scalar property with one value per row
+func (e *Element) AddProperty(name, typ string, values []float64) *Property {
+	p := &Property{Name: name, Type: typ, Values: values}
+	e.Properties = append(e.Properties, p)
+	return p
+}
+
+// AddListProperty appends a list property with one list per row
+func (e *Element) AddListProperty(name, countType, typ string, lists [][]float64) *Property {
+	p := &Property{Name: name, Type: typ, CountType: countType, Lists: lists}
+	e.Properties = append(e.Properties, p)
+	return p
+}
+
+// Filter keeps only the rows for which keep returns true
+func (e *Element) Filter(keep func(row int) bool) {
+	n := 0
+	for row := 0; row < e.Count; row++ {
+		if !keep(row) {
+			continue
+		}
+		for _, p := range e.Properties {
+			if p.IsList() {
+				p.Lists[n] = p.Lists[row]
+			} else {
+				p.Values[n] = p.Values[row]
+			}
+		}
+		n++
+	}
+	for _, p := range e.Properties {
+		if p.IsList() {
+			p.Lists = p.Lists[:n]
+		} else {
+			p.Values = p.Values[:n]
+		}
+	}
+	e.Count = n
+}
+
+// File is a parsed PLY file
+type File struct {
+	Format   Format
+	Comments []string
+	Elements []*Element
+}
+
+// Element returns the element with the given name or nil
+func (f *File) Element(name string) *Element {
+	for _, e := range f.Elements {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// AddElement appends an empty element with count rows
+func (f *File) AddElement(name string, count int) *Element {
+	e := &Element{Name: name, Count: count}
+	f.Elements = append(f.Elements, e)
+	return e
+}
+
+// typeSizes maps every PLY type name, including the sized aliases, to its
+// size in bytes
+var typeSizes = map[string]int{
+	"char": 1, "int8": 1,
+	"uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2,
+	"ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4,
+	"uint": 4, "uint32": 4,
+	"float": 4, "float32": 4,
+	"double": 8, "float64": 8,
+}
+
+func checkType(typ string) error {
+	if _, ok := typeSizes[typ]; !ok {
+		return fmt.Errorf("unknown property type %q", typ)
+	}
+	return nil
+}
+
+func isFloat(typ string) bool {
+	return strings.HasPrefix(typ, "float") || typ == "double"
+}
@@ -0,0 +1,123 @@
+package ply_test
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+)
+
+const asciiMesh = `ply
+format ascii 1.0
+comment TextureFile mesh_map_Kd.jpg
+element vertex 3
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+element face 1
+property list uchar uint vertex_indices
+property list uchar float texcoord
+end_header
+0 0 0 255 0 0
+1 0 0 0 255 0
+0 1 0 0 0 255
+3 0 1 2 6 0 0 1 0 0 1
+`
+
+func TestDecodeASCII(t *testing.T) {
+	file, err := ply.Decode(bufio.NewReader(strings.NewReader(asciiMesh)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	positions, err := file.Positions()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(positions[1], [3]float64{1, 0, 0}) {
+		t.Errorf("unexpected position %v", positions[1])
+	}
+
+	if colors := file.Colors(); colors[2] != [3]uint8{0, 0, 255} {
+		t.Errorf("unexpected color %v", colors[2])
+	}
+
+	if faces := file.Faces(); !reflect.DeepEqual(faces, [][]int{{0, 1, 2}}) {
+		t.Errorf("unexpected faces %v", faces)
+	}
+
+	if uvs := file.FaceTexCoords(); len(uvs) != 1 || len(uvs[0]) != 6 {
+		t.Errorf("unexpected texcoords %v", uvs)
+	}
+
+	if textures := file.TextureFiles(); !reflect.DeepEqual(textures, []string{"mesh_map_Kd.jpg"}) {
+		t.Errorf("unexpected texture files %v", textures)
+	}
+
+	if file.Normals() != nil {
+		t.Errorf("expected no normals")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	src, err := ply.Decode(bufio.NewReader(strings.NewReader(asciiMesh)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, format := range []ply.Format{ply.ASCII, ply.BinaryLittleEndian, ply.BinaryBigEndian} {
+		src.Format = format
+
+		var buf bytes.Buffer
+		if err := ply.Encode(&buf, src); err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+
+		got, err := ply.Decode(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+
+		if !reflect.DeepEqual(got, src) {
+			t.Errorf("%s: round trip mismatch:\n got %+v\nwant %+v", format, got, src)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	file, err := ply.Decode(bufio.NewReader(strings.NewReader(asciiMesh)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vertex := file.Element("vertex")
+	vertex.Filter(func(row int) bool { return row != 1 })
+
+	if vertex.Count != 2 {
+		t.Fatalf("expected 2 vertices, got %d", vertex.Count)
+	}
+	if got := vertex.Property("red").Values; !reflect.DeepEqual(got, []float64{255, 0}) {
+		t.Errorf("unexpected red values %v", got)
+	}
+
+	file.Format = ply.BinaryLittleEndian
+	path := filepath.Join(t.TempDir(), "filtered.ply")
+	if err := ply.Write(path, file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header, err := ply.ReadHeader(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if header.Format != ply.BinaryLittleEndian || header.Element("vertex").Count != 2 {
+		t.Errorf("unexpected header %+v", header.Element("vertex"))
+	}
+}
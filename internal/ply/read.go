@@ -0,0 +1,264 @@
+package ply
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Read parses the PLY file at path
+func Read(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ply file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	file, err := Decode(bufio.NewReaderSize(f, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ply file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// ReadHeader parses only the header of the PLY file at path. Element counts
+// and property declarations are populated but no values are read.
+func ReadHeader(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ply file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	file, err := decodeHeader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ply header %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Decode parses a PLY stream
+func Decode(r *bufio.Reader) (*File, error) {
+	file, err := decodeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range file.Elements {
+		for _, p := range e.Properties {
+			if p.IsList() {
+				p.Lists = make([][]float64, e.Count)
+			} else {
+				p.Values = make([]float64, e.Count)
+			}
+		}
+	}
+
+	switch file.Format {
+	case ASCII:
+		err = decodeASCII(r, file)
+	case BinaryLittleEndian:
+		err = decodeBinary(r, file, binary.LittleEndian)
+	case BinaryBigEndian:
+		err = decodeBinary(r, file, binary.BigEndian)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func decodeHeader(r *bufio.Reader) (*File, error) {
+	magic, err := r.ReadString('\n')
+	if err != nil || strings.TrimSpace(magic) != "ply" {
+		return nil, fmt.Errorf("missing ply magic")
+	}
+
+	file := &File{}
+	var current *Element
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unterminated header: %w", err)
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid format line %q", strings.TrimSpace(line))
+			}
+			file.Format = Format(fields[1])
+			if file.Format != ASCII && file.Format != BinaryLittleEndian && file.Format != BinaryBigEndian {
+				return nil, fmt.Errorf("unsupported format %q", fields[1])
+			}
+		case "comment", "obj_info":
+			file.Comments = append(file.Comments, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0])))
+		case "element":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("invalid element line %q", strings.TrimSpace(line))
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("invalid element count %q", fields[2])
+			}
+			current = file.AddElement(fields[1], count)
+		case "property":
+			if current == nil {
+				return nil, fmt.Errorf("property declared before any element")
+			}
+			p, err := parseProperty(fields)
+			if err != nil {
+				return nil, err
+			}
+			current.Properties = append(current.Properties, p)
+		case "end_header":
+			if file.Format == "" {
+				return nil, fmt.Errorf("missing format line")
+			}
+			return file, nil
+		default:
+			return nil, fmt.Errorf("unexpected header line %q", strings.TrimSpace(line))
+		}
+	}
+}
+
+func parseProperty(fields []string) (*Property, error) {
+	if len(fields) == 5 && fields[1] == "list" {
+		if err := checkType(fields[2]); err != nil {
+			return nil, err
+		}
+		if err := checkType(fields[3]); err != nil {
+			return nil, err
+		}
+		return &Property{Name: fields[4], CountType: fields[2], Type: fields[3]}, nil
+	}
+
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid property line %q", strings.Join(fields, " "))
+	}
+	if err := checkType(fields[1]); err != nil {
+		return nil, err
+	}
+	return &Property{Name: fields[2], Type: fields[1]}, nil
+}
+
+func decodeASCII(r *bufio.Reader, file *File) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for _, e := range file.Elements {
+		for row := 0; row < e.Count; row++ {
+			if !scanner.Scan() {
+				return fmt.Errorf("element %s: expected %d rows, got %d", e.Name, e.Count, row)
+			}
+			fields := strings.Fields(scanner.Text())
+			pos := 0
+			next := func() (float64, error) {
+				if pos >= len(fields) {
+					return 0, fmt.Errorf("element %s row %d: not enough values", e.Name, row)
+				}
+				v, err := strconv.ParseFloat(fields[pos], 64)
+				pos++
+				return v, err
+			}
+
+			for _, p := range e.Properties {
+				if !p.IsList() {
+					v, err := next()
+					if err != nil {
+						return err
+					}
+					p.Values[row] = v
+					continue
+				}
+
+				n, err := next()
+				if err != nil {
+					return err
+				}
+				list := make([]float64, int(n))
+				for i := range list {
+					if list[i], err = next(); err != nil {
+						return err
+					}
+				}
+				p.Lists[row] = list
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+func decodeBinary(r io.Reader, file *File, order binary.ByteOrder) error {
+	buf := make([]byte, 8)
+	read := func(typ string) (float64, error) {
+		size := typeSizes[typ]
+		if _, err := io.ReadFull(r, buf[:size]); err != nil {
+			return 0, err
+		}
+		return decodeValue(buf[:size], typ, order), nil
+	}
+
+	for _, e := range file.Elements {
+		for row := 0; row < e.Count; row++ {
+			for _, p := range e.Properties {
+				if !p.IsList() {
+					v, err := read(p.Type)
+					if err != nil {
+						return fmt.Errorf("element %s row %d: %w", e.Name, row, err)
+					}
+					p.Values[row] = v
+					continue
+				}
+
+				n, err := read(p.CountType)
+				if err != nil {
+					return fmt.Errorf("element %s row %d: %w", e.Name, row, err)
+				}
+				list := make([]float64, int(n))
+				for i := range list {
+					if list[i], err = read(p.Type); err != nil {
+						return fmt.Errorf("element %s row %d: %w", e.Name, row, err)
+					}
+				}
+				p.Lists[row] = list
+			}
+		}
+	}
+
+	return nil
+}
+
+func decodeValue(b []byte, typ string, order binary.ByteOrder) float64 {
+	switch typ {
+	case "char", "int8":
+		return float64(int8(b[0]))
+	case "uchar", "uint8":
+		return float64(b[0])
+	case "short", "int16":
+		return float64(int16(order.Uint16(b)))
+	case "ushort", "uint16":
+		return float64(order.Uint16(b))
+	case "int", "int32":
+		return float64(int32(order.Uint32(b)))
+	case "uint", "uint32":
+		return float64(order.Uint32(b))
+	case "float", "float32":
+		return float64(math.Float32frombits(order.Uint32(b)))
+	default:
+		return math.Float64frombits(order.Uint64(b))
+	}
+}
@@ -0,0 +1,184 @@
+package ply
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Write encodes file to path using file.Format, defaulting to binary little endian
+func Write(path string, file *File) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create ply file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	if err := Encode(w, file); err != nil {
+		return fmt.Errorf("failed to write ply file %s: %w", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write ply file %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Encode writes file to w
+func Encode(w io.Writer, file *File) error {
+	format := file.Format
+	if format == "" {
+		format = BinaryLittleEndian
+	}
+
+	if err := validate(file); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "ply\nformat %s 1.0\n", format); err != nil {
+		return err
+	}
+	for _, c := range file.Comments {
+		if _, err := fmt.Fprintf(w, "comment %s\n", c); err != nil {
+			return err
+		}
+	}
+	for _, e := range file.Elements {
+		if _, err := fmt.Fprintf(w, "element %s %d\n", e.Name, e.Count); err != nil {
+			return err
+		}
+		for _, p := range e.Properties {
+			var err error
+			if p.IsList() {
+				_, err = fmt.Fprintf(w, "property list %s %s %s\n", p.CountType, p.Type, p.Name)
+			} else {
+				_, err = fmt.Fprintf(w, "property %s %s\n", p.Type, p.Name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := io.WriteString(w, "end_header\n"); err != nil {
+		return err
+	}
+
+	switch format {
+	case ASCII:
+		return encodeASCII(w, file)
+	case BinaryBigEndian:
+		return encodeBinary(w, file, binary.BigEndian)
+	default:
+		return encodeBinary(w, file, binary.LittleEndian)
+	}
+}
+
+func validate(file *File) error {
+	for _, e := range file.Elements {
+		for _, p := range e.Properties {
+			if err := checkType(p.Type); err != nil {
+				return fmt.Errorf("element %s property %s: %w", e.Name, p.Name, err)
+			}
+			n := len(p.Values)
+			if p.IsList() {
+				if err := checkType(p.CountType); err != nil {
+					return fmt.Errorf("element %s property %s: %w", e.Name, p.Name, err)
+				}
+				n = len(p.Lists)
+			}
+			if n != e.Count {
+				return fmt.Errorf("element %s property %s has %d rows, expected %d", e.Name, p.Name, n, e.Count)
+			}
+		}
+	}
+	return nil
+}
+
+func encodeASCII(w io.Writer, file *File) error {
+	var line []byte
+	for _, e := range file.Elements {
+		for row := 0; row < e.Count; row++ {
+			line = line[:0]
+			for i, p := range e.Properties {
+				if i > 0 {
+					line = append(line, ' ')
+				}
+				if !p.IsList() {
+					line = appendASCII(line, p.Values[row], p.Type)
+					continue
+				}
+				list := p.Lists[row]
+				line = strconv.AppendInt(line, int64(len(list)), 10)
+				for _, v := range list {
+					line = append(line, ' ')
+					line = appendASCII(line, v, p.Type)
+				}
+			}
+			line = append(line, '\n')
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendASCII(b []byte, v float64, typ string) []byte {
+	if isFloat(typ) {
+		bits := 64
+		if typ != "double" && typ != "float64" {
+			bits = 32
+		}
+		return strconv.AppendFloat(b, v, 'g', -1, bits)
+	}
+	return strconv.AppendInt(b, int64(v), 10)
+}
+
+func encodeBinary(w io.Writer, file *File, order binary.AppendByteOrder) error {
+	var buf []byte
+	for _, e := range file.Elements {
+		for row := 0; row < e.Count; row++ {
+			buf = buf[:0]
+			for _, p := range e.Properties {
+				if !p.IsList() {
+					buf = appendBinary(buf, p.Values[row], p.Type, order)
+					continue
+				}
+				list := p.Lists[row]
+				buf = appendBinary(buf, float64(len(list)), p.CountType, order)
+				for _, v := range list {
+					buf = appendBinary(buf, v, p.Type, order)
+				}
+			}
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendBinary(b []byte, v float64, typ string, order binary.AppendByteOrder) []byte {
+	switch typ {
+	case "char", "int8":
+		return append(b, byte(int8(v)))
+	case "uchar", "uint8":
+		return append(b, byte(v))
+	case "short", "int16":
+		return order.AppendUint16(b, uint16(int16(v)))
+	case "ushort", "uint16":
+		return order.AppendUint16(b, uint16(v))
+	case "int", "int32":
+		return order.AppendUint32(b, uint32(int32(v)))
+	case "uint", "uint32":
+		return order.AppendUint32(b, uint32(v))
+	case "float", "float32":
+		return order.AppendUint32(b, math.Float32bits(float32(v)))
+	default:
+		return order.AppendUint64(b, math.Float64bits(v))
+	}
+}
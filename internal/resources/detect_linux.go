@@ -0,0 +1,71 @@
+//go:build linux
+
+package resources
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is where cgroup v2 is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// availableMemory returns MemAvailable of /proc/meminfo in bytes
+func availableMemory() int64 {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "MemAvailable:"); ok {
+			kb, _ := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// cgroupCPUs returns the CPU quota of the cgroup of openmvgo rounded up to
+// whole CPUs, 0 when it has none
+func cgroupCPUs() int {
+	fields := strings.Fields(readCgroup("cpu.max"))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || period <= 0 {
+		return 0
+	}
+	return int(math.Ceil(quota / period))
+}
+
+// cgroupMemory returns the memory the cgroup of openmvgo can still use in
+// bytes, 0 when it has no limit
+func cgroupMemory() int64 {
+	limit, err := strconv.ParseInt(readCgroup("memory.max"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	current, _ := strconv.ParseInt(readCgroup("memory.current"), 10, 64)
+	return max(limit-current, 0)
+}
+
+// readCgroup returns a file of the cgroup v2 of openmvgo, empty when it
+// cannot be read
+func readCgroup(name string) string {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			value, _ := os.ReadFile(filepath.Join(cgroupRoot, path, name))
+			return strings.TrimSpace(string(value))
+		}
+	}
+	return ""
+}
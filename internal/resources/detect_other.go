@@ -0,0 +1,18 @@
+//go:build !linux
+
+package resources
+
+// availableMemory is not detected on this platform
+func availableMemory() int64 {
+	return 0
+}
+
+// cgroupCPUs is 0, cgroups are specific to Linux
+func cgroupCPUs() int {
+	return 0
+}
+
+// cgroupMemory is 0, cgroups are specific to Linux
+func cgroupMemory() int64 {
+	return 0
+}
@@ -0,0 +1,131 @@
+// Package resources detects the CPUs and memory available to openmvgo and
+// budgets them across the commands of the pipelines
+package resources
+
+import (
+	"math"
+	"runtime"
+	"strconv"
+)
+
+// System is the CPUs and memory available to openmvgo
+type System struct {
+	CPUs int
+	// Memory is the available memory in bytes, 0 when unknown
+	Memory int64
+}
+
+// Detect returns the CPUs and available memory of the host, bounded by the
+// CPU quota and memory limit of the cgroup of openmvgo when it has some
+func Detect() System {
+	sys := System{CPUs: runtime.NumCPU(), Memory: availableMemory()}
+	if quota := cgroupCPUs(); quota > 0 && quota < sys.CPUs {
+		sys.CPUs = quota
+	}
+	if limit := cgroupMemory(); limit > 0 && (sys.Memory == 0 || limit < sys.Memory) {
+		sys.Memory = limit
+	}
+	return sys
+}
+
+// Budget is the share of the system given to a pipeline. Its commands run
+// one at a time, each can use all of it.
+type Budget struct {
+	// Threads is the number of threads of every command
+	Threads int
+	// Memory is the memory of a command in bytes, 0 when unknown
+	Memory int64
+}
+
+// Plan shares the system between pipelines running at once. maxThreads and
+// maxMemory override the share when they are set.
+func Plan(sys System, pipelines int, maxThreads int, maxMemory int64) Budget {
+	pipelines = max(pipelines, 1)
+	b := Budget{Threads: max(sys.CPUs/pipelines, 1), Memory: sys.Memory / int64(pipelines)}
+	if maxThreads > 0 {
+		b.Threads = maxThreads
+	}
+	if maxMemory > 0 && (b.Memory == 0 || maxMemory < b.Memory) {
+		b.Memory = maxMemory
+	}
+	return b
+}
+
+// Env returns the environment bounding the threads of the OpenMP commands,
+// which have no thread option
+func (b Budget) Env() []string {
+	return []string{"OMP_NUM_THREADS=" + strconv.Itoa(b.Threads)}
+}
+
+// Image is the size of an image in pixels
+type Image struct {
+	Width  int
+	Height int
+}
+
+// Defaults of DensifyPointCloud
+const (
+	DefaultResolutionLevel = 1
+	maxResolutionLevel     = 4
+	// The images are scaled to at most maxResolution and at least
+	// minResolution pixels on their longest side
+	maxResolution = 2560
+	minResolution = 640
+)
+
+// Rough upper estimates of the memory of DensifyPointCloud per pixel of the
+// scaled images: each thread holds an image with its neighbours and the
+// buffers of its depth map, and the fusion holds every depth map with its
+// normals and confidence
+const (
+	threadBytesPerPixel = 64
+	fusionBytesPerPixel = 32
+	// headroom leaves part of the memory to the scene and the system
+	headroom = 0.8
+)
+
+// DensifyResolutionLevel returns the resolution level at which the depth maps
+// of the images are estimated within memory: the default level of
+// DensifyPointCloud, raised until the estimated memory fits or the images
+// stop shrinking
+func DensifyResolutionLevel(images []Image, threads int, memory int64) int {
+	if memory <= 0 || len(images) == 0 {
+		return DefaultResolutionLevel
+	}
+
+	budget := int64(headroom * float64(memory))
+	level := DefaultResolutionLevel
+	for level < maxResolutionLevel && DensifyMemory(images, threads, level) > budget {
+		if DensifyMemory(images, threads, level+1) == DensifyMemory(images, threads, level) {
+			// The images are at the minimum resolution already
+			break
+		}
+		level++
+	}
+	return level
+}
+
+// DensifyMemory estimates the memory of DensifyPointCloud in bytes when it
+// estimates the depth maps of the images at a resolution level with threads
+func DensifyMemory(images []Image, threads int, level int) int64 {
+	var total, largest float64
+	for _, image := range images {
+		pixels := scaledPixels(image, level)
+		total += pixels
+		largest = max(largest, pixels)
+	}
+	return int64(total*fusionBytesPerPixel + float64(max(threads, 1))*largest*threadBytesPerPixel)
+}
+
+// scaledPixels returns the pixels of an image scaled like DensifyPointCloud
+// does at a resolution level
+func scaledPixels(image Image, level int) float64 {
+	longest := float64(max(image.Width, image.Height))
+	if longest == 0 {
+		return 0
+	}
+	scaled := longest / math.Pow(2, float64(level))
+	scaled = max(min(scaled, maxResolution), min(minResolution, longest))
+	scale := scaled / longest
+	return float64(image.Width) * float64(image.Height) * scale * scale
+}
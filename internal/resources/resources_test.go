@@ -0,0 +1,94 @@
+package resources_test
+
+import (
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/resources"
+)
+
+func TestPlan(t *testing.T) {
+	sys := resources.System{CPUs: 16, Memory: 64 << 30}
+	for _, tc := range []struct {
+		name       string
+		pipelines  int
+		maxThreads int
+		maxMemory  int64
+		want       resources.Budget
+	}{
+		{"whole system", 1, 0, 0, resources.Budget{Threads: 16, Memory: 64 << 30}},
+		{"shared between workers", 3, 0, 0, resources.Budget{Threads: 5, Memory: 64 << 30 / 3}},
+		{"more workers than CPUs", 32, 0, 0, resources.Budget{Threads: 1, Memory: 2 << 30}},
+		{"max threads", 1, 4, 0, resources.Budget{Threads: 4, Memory: 64 << 30}},
+		{"max memory below the share", 1, 0, 12 << 30, resources.Budget{Threads: 16, Memory: 12 << 30}},
+		{"max memory above the share", 4, 0, 32 << 30, resources.Budget{Threads: 4, Memory: 16 << 30}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := resources.Plan(sys, tc.pipelines, tc.maxThreads, tc.maxMemory); got != tc.want {
+				t.Errorf("Plan() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	// The memory limit stands in for undetected memory
+	if got := resources.Plan(resources.System{CPUs: 2}, 1, 0, 8<<30); got.Memory != 8<<30 {
+		t.Errorf("Plan() memory = %d, want the limit", got.Memory)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if sys := resources.Detect(); sys.CPUs < 1 || sys.Memory < 0 {
+		t.Errorf("Detect() = %+v", sys)
+	}
+}
+
+func images(n, width, height int) []resources.Image {
+	list := make([]resources.Image, n)
+	for i := range list {
+		list[i] = resources.Image{Width: width, Height: height}
+	}
+	return list
+}
+
+func TestDensifyResolutionLevel(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		images  []resources.Image
+		threads int
+		memory  int64
+		want    int
+	}{
+		{"unknown memory", images(300, 6000, 4000), 16, 0, resources.DefaultResolutionLevel},
+		{"enough memory", images(50, 4000, 3000), 8, 64 << 30, resources.DefaultResolutionLevel},
+		{"tight memory", images(300, 6000, 4000), 16, 16 << 30, 3},
+		{"few threads", images(40, 6000, 4000), 8, 2 << 30, 3},
+		{"many threads", images(40, 6000, 4000), 64, 2 << 30, 4},
+		{"minimum resolution", images(20, 640, 480), 4, 1 << 20, resources.DefaultResolutionLevel},
+		{"highest level", images(5000, 6000, 4000), 16, 1 << 30, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := resources.DensifyResolutionLevel(tc.images, tc.threads, tc.memory); got != tc.want {
+				t.Errorf("DensifyResolutionLevel() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDensifyMemory(t *testing.T) {
+	list := images(100, 6000, 4000)
+	// The longest side is capped at 2560 pixels, the full resolution needs
+	// no more memory than the first level
+	if resources.DensifyMemory(list, 8, 0) != resources.DensifyMemory(list, 8, 1) {
+		t.Error("the longest side is not capped")
+	}
+	previous := resources.DensifyMemory(list, 8, 1)
+	for level := 2; level <= 4; level++ {
+		m := resources.DensifyMemory(list, 8, level)
+		if m >= previous {
+			t.Errorf("level %d needs %d bytes, no less than level %d", level, m, level-1)
+		}
+		previous = m
+	}
+	if resources.DensifyMemory(list, 16, 1) <= resources.DensifyMemory(list, 8, 1) {
+		t.Error("more threads do not need more memory")
+	}
+}
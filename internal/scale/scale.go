@@ -0,0 +1,323 @@
+package scale
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+)
+
+// Observation is a pixel position of a point in one image
+type Observation struct {
+	Image string
+	X, Y  float64
+}
+
+// Point is a named point either given in model coordinates or observed in
+// two or more images, in which case it is triangulated
+type Point struct {
+	Name         string
+	Position     *[3]float64
+	Observations []Observation
+}
+
+// Distance is a known real world distance between two points
+type Distance struct {
+	A, B   string
+	Length float64
+}
+
+// Constraints are the points and distances a reconstruction is scaled with
+type Constraints struct {
+	Points    map[string]*Point
+	Distances []Distance
+}
+
+// Residual reports how well one distance agrees with the chosen scale
+type Residual struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// Model is the distance in reconstruction units before scaling
+	Model float64 `json:"model"`
+	// Expected is the real world distance
+	Expected float64 `json:"expected"`
+	// Error is the scaled distance minus the expected distance
+	Error float64 `json:"error"`
+}
+
+// Result is the scale applied to a reconstruction
+type Result struct {
+	Scale     float64    `json:"scale"`
+	Residuals []Residual `json:"residuals"`
+}
+
+// ErrMarkersUnsupported is returned for marker rows, markers have to be
+// detected by an external tool and listed as point observations
+var ErrMarkersUnsupported = errors.New("automatic marker detection is not supported, list marker corners as point rows instead")
+
+// ParseFile reads constraints from a CSV file with one row per fact:
+//
+//	point,<name>,<image>,<x>,<y>     pixel observation of a point
+//	xyz,<name>,<x>,<y>,<z>           point in reconstruction coordinates
+//	distance,<a>,<b>,<meters>        known distance between two points
+//
+// Empty lines and lines starting with # are ignored.
+func ParseFile(path string) (*Constraints, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scale constraints %s: %w", path, err)
+	}
+	defer f.Close()
+
+	c, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse reads constraints in the format described by ParseFile
+func Parse(r io.Reader) (*Constraints, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	c := &Constraints{Points: map[string]*Point{}}
+	point := func(name string) *Point {
+		if p, ok := c.Points[name]; ok {
+			return p
+		}
+		p := &Point{Name: name}
+		c.Points[name] = p
+		return p
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		kind := strings.ToLower(strings.TrimSpace(record[0]))
+		switch kind {
+		case "point":
+			if len(record) != 5 {
+				return nil, fmt.Errorf("line %d: point needs name, image, x and y", line)
+			}
+			v, err := parseFloats(record[3:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			p := point(record[1])
+			p.Observations = append(p.Observations, Observation{Image: record[2], X: v[0], Y: v[1]})
+		case "xyz":
+			if len(record) != 5 {
+				return nil, fmt.Errorf("line %d: xyz needs name, x, y and z", line)
+			}
+			v, err := parseFloats(record[2:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			point(record[1]).Position = &[3]float64{v[0], v[1], v[2]}
+		case "distance":
+			if len(record) != 4 {
+				return nil, fmt.Errorf("line %d: distance needs two point names and a length", line)
+			}
+			v, err := parseFloats(record[3:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if v[0] <= 0 {
+				return nil, fmt.Errorf("line %d: distance must be positive", line)
+			}
+			c.Distances = append(c.Distances, Distance{A: record[1], B: record[2], Length: v[0]})
+		case "aruco", "marker", "scalebar":
+			return nil, fmt.Errorf("line %d: %w", line, ErrMarkersUnsupported)
+		default:
+			return nil, fmt.Errorf("line %d: unknown row type %q", line, record[0])
+		}
+	}
+
+	if len(c.Distances) == 0 {
+		return nil, fmt.Errorf("no distances given")
+	}
+	for _, d := range c.Distances {
+		for _, name := range []string{d.A, d.B} {
+			if _, ok := c.Points[name]; !ok {
+				return nil, fmt.Errorf("distance references unknown point %q", name)
+			}
+		}
+	}
+	return c, nil
+}
+
+// ParsePoints parses "x1,y1,z1,x2,y2,z2=length", a distance between two
+// points in reconstruction coordinates
+func ParsePoints(s string) (*Constraints, error) {
+	coords, length, ok := strings.Cut(s, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid scale %q, expected x1,y1,z1,x2,y2,z2=length", s)
+	}
+	v, err := parseFloats(strings.Split(coords+","+length, ","))
+	if err != nil || len(v) != 7 || v[6] <= 0 {
+		return nil, fmt.Errorf("invalid scale %q, expected x1,y1,z1,x2,y2,z2=length", s)
+	}
+
+	return &Constraints{
+		Points: map[string]*Point{
+			"a": {Name: "a", Position: &[3]float64{v[0], v[1], v[2]}},
+			"b": {Name: "b", Position: &[3]float64{v[3], v[4], v[5]}},
+		},
+		Distances: []Distance{{A: "a", B: "b", Length: v[6]}},
+	}, nil
+}
+
+// Estimate locates every constrained point in the reconstruction and returns
+// the scale that best fits the known distances in the least squares sense
+func Estimate(sfm *sfmdata.SfMData, c *Constraints) (*Result, error) {
+	positions := map[string][3]float64{}
+	for name, p := range c.Points {
+		if p.Position != nil {
+			positions[name] = *p.Position
+			continue
+		}
+		x, err := Triangulate(sfm, p.Observations)
+		if err != nil {
+			return nil, fmt.Errorf("point %s: %w", name, err)
+		}
+		positions[name] = x
+	}
+
+	// Minimise sum (s*d - L)^2 over the distances, giving s = sum(dL) / sum(d^2)
+	var num, den float64
+	res := &Result{}
+	for _, d := range c.Distances {
+		model := transform.Distance(positions[d.A], positions[d.B])
+		if model == 0 {
+			return nil, fmt.Errorf("points %s and %s coincide", d.A, d.B)
+		}
+		num += model * d.Length
+		den += model * model
+		res.Residuals = append(res.Residuals, Residual{A: d.A, B: d.B, Model: model, Expected: d.Length})
+	}
+
+	res.Scale = num / den
+	for i := range res.Residuals {
+		r := &res.Residuals[i]
+		r.Error = res.Scale*r.Model - r.Expected
+	}
+	return res, nil
+}
+
+// Similarity returns the transform that applies the scale
+func (r *Result) Similarity() transform.Similarity {
+	return transform.Scaling(r.Scale)
+}
+
+// Triangulate returns the point closest in the least squares sense to the
+// viewing rays of the observations
+func Triangulate(sfm *sfmdata.SfMData, observations []Observation) ([3]float64, error) {
+	var a [3][3]float64
+	var b [3]float64
+	rays := 0
+
+	for _, o := range observations {
+		origin, dir, err := Ray(sfm, o)
+		if err != nil {
+			return [3]float64{}, err
+		}
+
+		// Accumulate (I - d d^T) for the normal equations
+		for i := range 3 {
+			for j := range 3 {
+				m := -dir[i] * dir[j]
+				if i == j {
+					m++
+				}
+				a[i][j] += m
+				b[i] += m * origin[j]
+			}
+		}
+		rays++
+	}
+
+	if rays < 2 {
+		return [3]float64{}, fmt.Errorf("at least 2 observations are needed, got %d", rays)
+	}
+	return solve(a, b)
+}
+
+// Ray returns the camera center and unit viewing direction in world
+// coordinates of a pixel observation
+func Ray(sfm *sfmdata.SfMData, o Observation) ([3]float64, [3]float64, error) {
+	view := sfm.ViewByFilename(o.Image)
+	if view == nil {
+		return [3]float64{}, [3]float64{}, fmt.Errorf("image %s is not part of the reconstruction", o.Image)
+	}
+	pose := sfm.Pose(view.PoseID)
+	if pose == nil {
+		return [3]float64{}, [3]float64{}, fmt.Errorf("image %s was not registered", o.Image)
+	}
+	intrinsic := sfm.Intrinsic(view.IntrinsicID)
+	if intrinsic == nil {
+		return [3]float64{}, [3]float64{}, fmt.Errorf("image %s has no intrinsic", o.Image)
+	}
+
+	x, y, err := intrinsic.Undistort(o.X, o.Y)
+	if err != nil {
+		return [3]float64{}, [3]float64{}, fmt.Errorf("image %s: %w", o.Image, err)
+	}
+
+	// Rotation maps world to camera, so its transpose maps the camera ray back
+	dir := transform.MulVec(transform.Transpose(pose.Rotation), [3]float64{x, y, 1})
+	l := math.Sqrt(dir[0]*dir[0] + dir[1]*dir[1] + dir[2]*dir[2])
+	return pose.Center, [3]float64{dir[0] / l, dir[1] / l, dir[2] / l}, nil
+}
+
+// solve returns x with a x = b using Cramer's rule
+func solve(a [3][3]float64, b [3]float64) ([3]float64, error) {
+	det := determinant(a)
+	if math.Abs(det) < 1e-12 {
+		return [3]float64{}, fmt.Errorf("the viewing rays are parallel")
+	}
+
+	var x [3]float64
+	for i := range 3 {
+		m := a
+		for r := range 3 {
+			m[r][i] = b[r]
+		}
+		x[i] = determinant(m) / det
+	}
+	return x, nil
+}
+
+func determinant(m [3][3]float64) float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+func parseFloats(fields []string) ([]float64, error) {
+	out := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,153 @@
+package scale_test
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/scale"
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+)
+
+func TestParse(t *testing.T) {
+	input := `# scale bar on the floor
+point, left, IMG_0001.JPG, 100, 200
+point, left, IMG_0002.JPG, 110, 210
+xyz, right, 1, 2, 3
+distance, left, right, 0.5
+`
+	c, err := scale.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p := c.Points["left"]; p == nil || len(p.Observations) != 2 || p.Observations[1].X != 110 {
+		t.Errorf("unexpected point %+v", p)
+	}
+	if p := c.Points["right"]; p == nil || *p.Position != [3]float64{1, 2, 3} {
+		t.Errorf("unexpected point %+v", p)
+	}
+	if len(c.Distances) != 1 || c.Distances[0].Length != 0.5 {
+		t.Errorf("unexpected distances %+v", c.Distances)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"no distances":  "xyz,a,0,0,0\n",
+		"unknown point": "xyz,a,0,0,0\ndistance,a,b,1\n",
+		"bad number":    "xyz,a,0,x,0\n",
+		"negative":      "xyz,a,0,0,0\nxyz,b,1,0,0\ndistance,a,b,-1\n",
+		"unknown row":   "plane,a\n",
+	}
+	for name, input := range tests {
+		if _, err := scale.Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	_, err := scale.Parse(strings.NewReader("aruco,4x4,0.1\n"))
+	if !errors.Is(err, scale.ErrMarkersUnsupported) {
+		t.Errorf("expected ErrMarkersUnsupported, got %v", err)
+	}
+}
+
+func TestParsePoints(t *testing.T) {
+	c, err := scale.ParsePoints("0,0,0,3,4,0=10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := scale.Estimate(&sfmdata.SfMData{}, c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Scale != 2 || res.Residuals[0].Model != 5 || res.Residuals[0].Error != 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+
+	for _, s := range []string{"0,0,0,3,4,0", "0,0,0,3,4=10", "0,0,0,3,4,0=0"} {
+		if _, err := scale.ParsePoints(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestEstimate_Residuals(t *testing.T) {
+	// Two distances that disagree, the scale lands between them
+	c, err := scale.Parse(strings.NewReader(`xyz,a,0,0,0
+xyz,b,1,0,0
+xyz,c,0,2,0
+distance,a,b,1
+distance,a,c,3
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := scale.Estimate(&sfmdata.SfMData{}, c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// s = (1*1 + 2*3) / (1 + 4)
+	if math.Abs(res.Scale-1.4) > 1e-12 {
+		t.Errorf("expected scale 1.4, got %g", res.Scale)
+	}
+	if math.Abs(res.Residuals[0].Error-0.4) > 1e-12 || math.Abs(res.Residuals[1].Error+0.2) > 1e-12 {
+		t.Errorf("unexpected residuals %+v", res.Residuals)
+	}
+}
+
+func TestTriangulate(t *testing.T) {
+	sfm := &sfmdata.SfMData{
+		Views: []sfmdata.View{
+			{ID: 0, Filename: "left.jpg", IntrinsicID: 0, PoseID: 0},
+			{ID: 1, Filename: "right.jpg", IntrinsicID: 0, PoseID: 1},
+			{ID: 2, Filename: "lost.jpg", IntrinsicID: 0, PoseID: sfmdata.UndefinedID},
+		},
+		Intrinsics: []sfmdata.Intrinsic{
+			{ID: 0, Model: "pinhole", FocalLength: 1000, PrincipalPoint: [2]float64{500, 400}},
+		},
+		Poses: []sfmdata.Pose{
+			{ID: 0, Rotation: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, Center: [3]float64{0, 0, 0}},
+			// Looking down the x axis from the side
+			{ID: 1, Rotation: [3][3]float64{{0, 0, -1}, {0, 1, 0}, {1, 0, 0}}, Center: [3]float64{-4, 0, 5}},
+		},
+	}
+
+	target := [3]float64{0.5, -0.25, 5}
+	project := func(p sfmdata.Pose) scale.Observation {
+		var cam [3]float64
+		for i := range 3 {
+			for j := range 3 {
+				cam[i] += p.Rotation[i][j] * (target[j] - p.Center[j])
+			}
+		}
+		return scale.Observation{X: 1000*cam[0]/cam[2] + 500, Y: 1000*cam[1]/cam[2] + 400}
+	}
+
+	left, right := project(sfm.Poses[0]), project(sfm.Poses[1])
+	left.Image, right.Image = "left.jpg", "right.jpg"
+
+	x, err := scale.Triangulate(sfm, []scale.Observation{left, right})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range 3 {
+		if math.Abs(x[i]-target[i]) > 1e-9 {
+			t.Fatalf("expected %v, got %v", target, x)
+		}
+	}
+
+	if _, err := scale.Triangulate(sfm, []scale.Observation{left}); err == nil {
+		t.Errorf("expected error for a single observation")
+	}
+	if _, err := scale.Triangulate(sfm, []scale.Observation{left, {Image: "lost.jpg"}}); err == nil {
+		t.Errorf("expected error for an unregistered image")
+	}
+	if _, err := scale.Triangulate(sfm, []scale.Observation{left, {Image: "missing.jpg"}}); err == nil {
+		t.Errorf("expected error for an unknown image")
+	}
+}
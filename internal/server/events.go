@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+)
+
+// eventBuffer bounds the events waiting for a slow client, further events
+// are dropped
+const eventBuffer = 64
+
+// message is a server-sent event
+type message struct {
+	name string
+	data any
+}
+
+// subscribe returns the events of a job, until the job is done or
+// unsubscribe is called
+func (s *Server) subscribe(id string) (events <-chan message, unsubscribe func()) {
+	ch := make(chan message, eventBuffer)
+	s.eventsMu.Lock()
+	if s.subscribers[id] == nil {
+		s.subscribers[id] = map[chan message]struct{}{}
+	}
+	s.subscribers[id][ch] = struct{}{}
+	s.eventsMu.Unlock()
+
+	return ch, func() {
+		s.eventsMu.Lock()
+		defer s.eventsMu.Unlock()
+		if _, ok := s.subscribers[id][ch]; ok {
+			delete(s.subscribers[id], ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends an event to the subscribers of a job
+func (s *Server) publish(id string, m message) {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+
+	for ch := range s.subscribers[id] {
+		select {
+		case ch <- m:
+		default:
+		}
+	}
+}
+
+// observer publishes the pipeline events of a job
+func (s *Server) observer(id string) pipeline.Observer {
+	return func(e pipeline.Event) {
+		s.publish(id, message{name: string(e.Type), data: e})
+	}
+}
+
+// announce publishes the state of a job, and ends the streams of its
+// subscribers once it is done
+func (s *Server) announce(job *Job) {
+	s.publish(job.ID, message{name: "job", data: job})
+	if !job.Done() {
+		return
+	}
+
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	for ch := range s.subscribers[job.ID] {
+		close(ch)
+	}
+	delete(s.subscribers, job.ID)
+}
+
+// handleEvents streams the state and pipeline events of a job as
+// server-sent events, starting with its current state
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	// Subscribe first so that no event is missed after reading the job
+	events, unsubscribe := s.subscribe(id)
+	defer unsubscribe()
+	job, ok := s.Job(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	writeEvent(w, message{name: "job", data: job})
+	flusher.Flush()
+	if job.Done() {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stopped:
+			return
+		case m, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, m)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, m message) {
+	data, err := json.Marshal(m.data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.name, data)
+}
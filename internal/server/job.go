@@ -0,0 +1,253 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/crop"
+	"github.com/2024-dissertation/openmvgo/internal/geo"
+	"github.com/2024-dissertation/openmvgo/internal/grouping"
+	"github.com/2024-dissertation/openmvgo/internal/openmvg"
+	"github.com/2024-dissertation/openmvgo/internal/openmvs"
+	"github.com/2024-dissertation/openmvgo/internal/pairs"
+	"github.com/2024-dissertation/openmvgo/internal/simplify"
+	"github.com/2024-dissertation/openmvgo/internal/texture"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+	// StatusDeadLetter is a job that failed every attempt it was allowed
+	StatusDeadLetter = "dead_letter"
+)
+
+// Stage statuses
+const (
+	StageRunning = "running"
+	StageDone    = "done"
+	StageFailed  = "failed"
+)
+
+// Job is a reconstruction submitted to the server
+type Job struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Path is the server local image directory, empty when the images were
+	// uploaded with the job
+	Path   string `json:"path,omitempty"`
+	Config Config `json:"config"`
+	// Step is the stage the job is running or ran last
+	Step string `json:"step,omitempty"`
+	// StepsCompleted counts the stages the job has completed
+	StepsCompleted int `json:"steps_completed"`
+	// Stages are the stages the job has started, in pipeline order. An
+	// attempt skips the stages a previous attempt completed.
+	Stages []Stage `json:"stages"`
+	// Attempts counts the attempts at running the job
+	Attempts int `json:"attempts"`
+	// Error is the failure of the latest attempt
+	Error string `json:"error,omitempty"`
+	// Trace is the trace context of the request that submitted the job,
+	// which parents the spans of its attempts
+	Trace map[string]string `json:"trace,omitempty"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// NextAttemptAt is when a job waiting to be retried is run again
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// Stage is the state of a stage of a job
+type Stage struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// stage returns the stage with the name, adding it when the job has not
+// started it yet
+func (j *Job) stage(name string) *Stage {
+	for i := range j.Stages {
+		if j.Stages[i].Name == name {
+			return &j.Stages[i]
+		}
+	}
+	j.Stages = append(j.Stages, Stage{Name: name})
+	return &j.Stages[len(j.Stages)-1]
+}
+
+// Done reports whether the job has finished, successfully or not
+func (j *Job) Done() bool {
+	switch j.Status {
+	case StatusSucceeded, StatusFailed, StatusCanceled, StatusDeadLetter:
+		return true
+	}
+	return false
+}
+
+// permanentError is a failure that retrying the job cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that retrying the job cannot fix, the
+// job fails without further attempts
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Config holds the pipeline options a job can set, named like the CLI flags.
+// Options that need files on the server, such as scale or control point
+// files, are left to the CLI.
+type Config struct {
+	MaxThreads       int    `json:"max_threads,omitempty"`
+	OutputFormat     string `json:"output_format,omitempty"`
+	ExportPointCloud string `json:"export_pointcloud,omitempty"`
+	LOD              string `json:"lod,omitempty"`
+	CropBox          string `json:"crop_box,omitempty"`
+	CropAuto         bool   `json:"crop_auto,omitempty"`
+	CropGround       bool   `json:"crop_ground,omitempty"`
+	CropStages       string `json:"crop_stages,omitempty"`
+	TextureSize      int    `json:"texture_size,omitempty"`
+	TextureFormat    string `json:"texture_format,omitempty"`
+	TextureQuality   int    `json:"texture_quality,omitempty"`
+	TextureAtlas     bool   `json:"texture_atlas,omitempty"`
+	Georeference     string `json:"georeference,omitempty"`
+	SfMEngine        string `json:"sfm_engine,omitempty"`
+	PairStrategy     string `json:"pair_strategy,omitempty"`
+	PairWindow       int    `json:"pair_window,omitempty"`
+	PairNeighbours   int    `json:"pair_neighbours,omitempty"`
+	GroupBy          string `json:"group_by,omitempty"`
+	Intrinsics       string `json:"intrinsics,omitempty"`
+}
+
+// Validate reports options the pipeline would reject, so that a job is
+// refused when it is submitted rather than failing later
+func (c Config) Validate() error {
+	if c.MaxThreads < 0 {
+		return fmt.Errorf("max_threads must be positive, got %d", c.MaxThreads)
+	}
+	switch c.OutputFormat {
+	case "", openmvs.OutputFormatOBJ, openmvs.OutputFormatGLB:
+	default:
+		return fmt.Errorf("unsupported output format %q", c.OutputFormat)
+	}
+	switch c.ExportPointCloud {
+	case "", openmvs.PointCloudFormatLAS:
+	default:
+		return fmt.Errorf("unsupported point cloud format %q", c.ExportPointCloud)
+	}
+	switch c.Georeference {
+	case "", geo.FrameENU, geo.FrameUTM:
+	default:
+		return fmt.Errorf("unknown georeference frame %q, expected enu or utm", c.Georeference)
+	}
+	if c.PairStrategy == pairs.StrategyFile || c.GroupBy == grouping.GroupByFile {
+		return fmt.Errorf("file based pairs and grouping are not supported by the server")
+	}
+
+	if _, err := c.lods(); err != nil {
+		return err
+	}
+	if _, err := c.crop(); err != nil {
+		return err
+	}
+	if _, _, err := c.cropStages(); err != nil {
+		return err
+	}
+	for _, err := range []error{c.textures().Validate(), c.pairs().Validate(), c.grouping().Validate(), c.engine().Validate()} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxThreads returns the threads the job asked for, or those of the budget
+func (c Config) maxThreads(budget int) int {
+	if c.MaxThreads == 0 {
+		return budget
+	}
+	return c.MaxThreads
+}
+
+func (c Config) lods() ([]simplify.Target, error) {
+	if c.LOD == "" {
+		return nil, nil
+	}
+	return simplify.ParseTargets(c.LOD)
+}
+
+func (c Config) crop() (crop.Options, error) {
+	opts := crop.Options{AutoBox: c.CropAuto, Ground: c.CropGround}
+	if c.CropBox != "" {
+		box, err := crop.ParseBox(c.CropBox)
+		if err != nil {
+			return opts, err
+		}
+		opts.Box = &box
+	}
+	return opts, nil
+}
+
+// cropStages returns whether the dense point cloud and the mesh are cropped,
+// the dense point cloud only by default
+func (c Config) cropStages() (dense, mesh bool, err error) {
+	if c.CropStages == "" {
+		return true, false, nil
+	}
+	for _, stage := range strings.Split(c.CropStages, ",") {
+		switch strings.TrimSpace(stage) {
+		case "dense":
+			dense = true
+		case "mesh":
+			mesh = true
+		default:
+			return false, false, fmt.Errorf("unknown crop stage %q", stage)
+		}
+	}
+	return dense, mesh, nil
+}
+
+func (c Config) textures() texture.Options {
+	quality := c.TextureQuality
+	if quality == 0 {
+		quality = texture.DefaultQuality
+	}
+	return texture.Options{MaxSize: c.TextureSize, Format: c.TextureFormat, Quality: quality, Atlas: c.TextureAtlas}
+}
+
+func (c Config) pairs() pairs.Options {
+	opts := pairs.Options{Strategy: strings.ToLower(c.PairStrategy), Window: c.PairWindow, Neighbours: c.PairNeighbours}
+	if opts.Window == 0 {
+		opts.Window = 10
+	}
+	if opts.Neighbours == 0 {
+		opts.Neighbours = 10
+	}
+	return opts
+}
+
+func (c Config) grouping() grouping.Options {
+	intrinsics := strings.ToLower(c.Intrinsics)
+	if intrinsics == "" {
+		intrinsics = grouping.IntrinsicsShared
+	}
+	return grouping.Options{GroupBy: strings.ToLower(c.GroupBy), Intrinsics: intrinsics}
+}
+
+func (c Config) engine() openmvg.EngineOptions {
+	return openmvg.EngineOptions{Name: strings.ToUpper(c.SfMEngine)}
+}
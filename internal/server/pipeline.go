@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/2024-dissertation/openmvgo/internal/manifest"
+	"github.com/2024-dissertation/openmvgo/internal/metrics"
+	"github.com/2024-dissertation/openmvgo/internal/openmvg"
+	"github.com/2024-dissertation/openmvgo/internal/openmvs"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/resources"
+	"github.com/2024-dissertation/openmvgo/internal/tracing"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"github.com/2024-dissertation/openmvgo/internal/workspace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// StageFunc runs a named stage of a job, unless a previous attempt at the job
+// completed it. It returns the failure of the stage.
+type StageFunc func(name string, run func()) error
+
+// Runner runs the pipeline of a job as a sequence of stages, writing its
+// artifacts to dirs.Output. It must return as soon as a stage fails and
+// stop when ctx is canceled. Stages must be resumable: a retry runs the
+// stages after the last completed one on the same work directory. The
+// progress of the stages is reported to observe, which streams it to the
+// clients.
+type Runner func(ctx context.Context, job Job, dirs Dirs, stage StageFunc, observe pipeline.Observer) error
+
+// RunnerOptions configure the PipelineRunner
+type RunnerOptions struct {
+	// CameraDB is the camera sensor database, downloaded for each job when
+	// empty
+	CameraDB string
+	// CameraDBURL is where the camera sensor database is downloaded from,
+	// that of OpenMVG when empty
+	CameraDBURL string
+	// Limits bound the resources of every command
+	Limits utils.Limits
+	// Budget is the share of the CPUs and memory of a job, the threads of
+	// its commands unless the job sets max_threads
+	Budget resources.Budget
+	// Metrics records the commands, if set
+	Metrics *metrics.Registry
+}
+
+// PipelineRunner runs the OpenMVG and OpenMVS pipelines like the CLI does
+func PipelineRunner(opts RunnerOptions) Runner {
+	return func(ctx context.Context, job Job, dirs Dirs, stage StageFunc, observe pipeline.Observer) (err error) {
+		input := job.Path
+		if input == "" {
+			input = dirs.Images
+		}
+		if _, err := os.Stat(input); err != nil {
+			// Retrying will not bring the images back
+			return Permanent(fmt.Errorf("cannot read the images: %w", err))
+		}
+
+		ws, err := workspace.New(dirs.Work)
+		if err != nil {
+			return err
+		}
+		// The spans of the job continue the trace of its submission
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(job.Trace))
+		ctx, span := tracing.Start(ctx, "job", attribute.String("openmvgo.job.id", job.ID), attribute.Int("openmvgo.job.attempt", job.Attempts))
+		defer func() {
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+
+		commands := tracing.NewCommands(ctx)
+		tracker := pipeline.NewTracker(pipeline.Observers(observe, commands.Observe))
+		// The config was validated when the job was submitted
+		c := job.Config
+		lods, _ := c.lods()
+		cropOptions, _ := c.crop()
+		cropDense, cropMesh, _ := c.cropStages()
+		threads := c.maxThreads(opts.Budget.Threads)
+
+		budget := resources.Budget{Threads: threads, Memory: opts.Budget.Memory}
+		u := &utils.UtilsImpl{LogDir: ws.Logs, Context: ctx, Output: tracker, Limits: opts.Limits, Env: budget.Env(), OnCommand: func(s utils.CommandStats) {
+			opts.Metrics.ObserveCommand(s)
+			commands.OnCommand(s)
+		}}
+
+		db := opts.CameraDB
+		openmvgConfig := openmvg.NewOpenMVGConfig(input, ws.MVS, &db)
+		openmvgConfig.CameraDBURL = opts.CameraDBURL
+		openmvgConfig.MatchesDir = ws.Matches
+		openmvgConfig.ReconstructionDir = ws.Reconstruction
+		openmvgConfig.Georeference = c.Georeference
+		openmvgConfig.Pairs = c.pairs()
+		openmvgConfig.Grouping = c.grouping()
+		openmvgConfig.Engine = c.engine()
+		openmvgConfig.Threads = threads
+		openmvgService := openmvg.NewOpenMVGService(openmvgConfig, u)
+
+		openmvsConfig := openmvs.NewOpenMVSConfig(dirs.Output, ws.MVS, threads)
+		openmvsConfig.Memory = budget.Memory
+		openmvsConfig.SceneFile = openmvgService.Config.SceneFile()
+		openmvsConfig.GeoreferenceFile = openmvgService.Config.GeoreferenceFile()
+		if c.OutputFormat != "" {
+			openmvsConfig.OutputFormat = c.OutputFormat
+		}
+		openmvsConfig.PointCloudFormat = c.ExportPointCloud
+		openmvsConfig.LODs = lods
+		openmvsConfig.Crop = cropOptions
+		openmvsConfig.CropDense = cropOptions.Enabled() && cropDense
+		openmvsConfig.CropMesh = cropOptions.Enabled() && cropMesh
+		openmvsConfig.Textures = c.textures()
+		openmvsService := openmvs.NewOpenMVSService(openmvsConfig, u)
+
+		// The download runs on every attempt, outside of the stages, and
+		// failing it is worth a retry unlike the panics of a broken runner
+		if err := runSafely(openmvgService.PopulateTmpDir); err != nil {
+			return err
+		}
+		if opts.CameraDB == "" {
+			defer os.Remove(*openmvgService.Config.CameraDBFile)
+		}
+
+		// The manifest lists the results of the steps run by this attempt,
+		// those of the stages resumed from a previous attempt are lost
+		var results []pipeline.StepResult
+		steps := append(openmvgService.SequentialSteps(), openmvsService.Steps()...)
+		steps = append(steps, pipeline.Step{Name: "publish", Run: func() {
+			u.Check(publish(openmvgService.Config, *openmvsConfig, ws, dirs.Output, results))
+		}})
+		for _, step := range steps {
+			err := stage(step.Name, func() {
+				results = append(results, pipeline.RunStep(ctx, step, tracker.Observe))
+			})
+			var limitErr *utils.LimitError
+			if errors.As(err, &limitErr) {
+				// The command exceeds the same limits on every attempt
+				return Permanent(err)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// publish copies the sidecars and logs of a run to the output directory and
+// writes its manifest
+func publish(config openmvg.OpenMVGConfig, openmvsConfig openmvs.OpenMVSConfig, ws *workspace.Workspace, outputDir string, steps []pipeline.StepResult) error {
+	u := utils.NewUtils()
+	for _, path := range config.Sidecars() {
+		if err := u.CopyFile(path, filepath.Join(outputDir, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+
+	logs, err := filepath.Glob(filepath.Join(ws.Logs, "*.log"))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(outputDir, "logs"), 0o755); err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if err := u.CopyFile(log, filepath.Join(outputDir, "logs", filepath.Base(log))); err != nil {
+			return err
+		}
+	}
+
+	m, err := manifest.Build(outputDir)
+	if err != nil {
+		return err
+	}
+	m.Steps = steps
+	if m.Tools, err = manifest.ToolsFromLogs(ws.Logs); err != nil {
+		return err
+	}
+	config.CameraDBFile = nil
+	run := struct {
+		OpenMVG openmvg.OpenMVGConfig
+		OpenMVS openmvs.OpenMVSConfig
+	}{config, openmvsConfig}
+	if err := m.SetConfig(run); err != nil {
+		return err
+	}
+	return m.Write(filepath.Join(outputDir, manifest.FileName))
+}
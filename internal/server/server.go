@@ -0,0 +1,650 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/manifest"
+	"github.com/2024-dissertation/openmvgo/internal/metrics"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Defaults of the server options
+const (
+	DefaultQueueSize   = 100
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = 30 * time.Second
+)
+
+// maxBackoff caps the delay between two attempts
+const maxBackoff = time.Hour
+
+// Options configure the server
+type Options struct {
+	// DataDir keeps the jobs, their uploads and their artifacts
+	DataDir string
+	// Workers is the number of jobs run at once, defaults to 1
+	Workers int
+	// QueueSize bounds the jobs waiting for a worker, defaults to
+	// DefaultQueueSize
+	QueueSize int
+	// MaxAttempts is the number of attempts at a job before it is moved to
+	// the dead letter state, defaults to DefaultMaxAttempts
+	MaxAttempts int
+	// Backoff is the delay before the second attempt at a job, doubled for
+	// each further attempt. Defaults to DefaultBackoff.
+	Backoff time.Duration
+	// Runner runs the pipeline of a job
+	Runner Runner
+	// Metrics records the jobs and is served at /metrics, if set
+	Metrics *metrics.Registry
+}
+
+// Server runs reconstruction jobs submitted over HTTP
+type Server struct {
+	opts  Options
+	store *Store
+	// wake tells an idle worker that the queue changed
+	wake chan struct{}
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	wg      sync.WaitGroup
+	// stopped is closed when the workers stop, ending the event streams
+	stopped <-chan struct{}
+
+	eventsMu    sync.Mutex
+	subscribers map[string]map[chan message]struct{}
+}
+
+// New returns a server with the jobs kept in the data directory. Jobs that
+// were running when the server stopped are queued again and resume from
+// their last completed stage.
+func New(opts Options) (*Server, error) {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.Runner == nil {
+		return nil, fmt.Errorf("a runner must be specified")
+	}
+
+	store, err := OpenStore(opts.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		opts:        opts,
+		store:       store,
+		wake:        make(chan struct{}, 1),
+		cancels:     map[string]context.CancelFunc{},
+		subscribers: map[string]map[chan message]struct{}{},
+	}
+
+	opts.Metrics.WatchQueue(store.QueueLen)
+
+	jobs, err := store.List()
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to load jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if job.Status != StatusRunning {
+			continue
+		}
+		_, err := store.Update(job.ID, func(j *Job) error {
+			s.retry(j, fmt.Errorf("the server stopped during attempt %d", j.Attempts))
+			return nil
+		})
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Close closes the job database, once the workers have stopped
+func (s *Server) Close() error {
+	return s.store.Close()
+}
+
+// Start starts the workers, which stop when ctx is done. A job interrupted
+// that way is queued again and resumes from its last completed stage.
+func (s *Server) Start(ctx context.Context) {
+	s.stopped = ctx.Done()
+	for range s.opts.Workers {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.work(ctx)
+		}()
+	}
+}
+
+// Wait waits for the workers to stop
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Server) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := s.store.Dequeue(time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to dequeue a job: %v\n", err)
+		}
+		if job != nil {
+			s.announce(job)
+			s.run(ctx, job)
+			continue
+		}
+
+		// Sleep until the next job is due or a job is submitted
+		wait := time.Minute
+		if due, ok := s.store.NextDue(); ok {
+			wait = min(wait, max(time.Until(due), 0))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// notify wakes an idle worker
+func (s *Server) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Job returns a job
+func (s *Server) Job(id string) (Job, bool) {
+	job, err := s.store.Get(id)
+	if err != nil {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (s *Server) run(ctx context.Context, job *Job) {
+	s.opts.Metrics.JobStarted()
+	jobCtx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancels[job.ID] = cancel
+	s.mu.Unlock()
+
+	dirs := s.store.Dirs(job.ID)
+	var err error
+	if len(job.Stages) == 0 {
+		// Nothing to resume, start from clean directories
+		err = errors.Join(os.RemoveAll(dirs.Work), os.RemoveAll(dirs.Output))
+	}
+	if err == nil {
+		err = os.MkdirAll(dirs.Output, 0o755)
+	}
+	if err == nil {
+		// A panic outside of a stage is a bug of the runner, which a retry
+		// would not fix
+		panicErr := runSafely(func() {
+			err = s.opts.Runner(jobCtx, *job, dirs, func(name string, run func()) error {
+				return s.runStage(job.ID, name, run)
+			}, pipeline.Observers(s.observer(job.ID), s.opts.Metrics.ObserveStep))
+		})
+		if panicErr != nil {
+			err = Permanent(panicErr)
+		}
+	}
+	if err == nil {
+		err = s.saveManifest(job.ID, dirs)
+	}
+
+	cancel()
+	s.mu.Lock()
+	delete(s.cancels, job.ID)
+	s.mu.Unlock()
+	s.opts.Metrics.JobStopped()
+
+	updated, updateErr := s.store.Update(job.ID, func(j *Job) error {
+		now := time.Now().UTC()
+		switch {
+		case j.Status == StatusCanceled:
+			j.FinishedAt = &now
+		case ctx.Err() != nil:
+			// Interrupted by the server stopping, which is not the fault
+			// of the job
+			j.Status = StatusQueued
+			j.Attempts--
+			j.StartedAt = nil
+		case err == nil:
+			j.Status = StatusSucceeded
+			j.Error = ""
+			j.FinishedAt = &now
+		default:
+			s.retry(j, err)
+		}
+		return nil
+	})
+	if updateErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save job %s: %v\n", job.ID, updateErr)
+	} else {
+		if updated.Done() {
+			s.opts.Metrics.JobFinished(updated.Status)
+		}
+		s.announce(updated)
+	}
+	s.notify()
+}
+
+// retry queues a failed job again after a backoff, unless the failure is
+// permanent or the job has used all its attempts
+func (s *Server) retry(j *Job, err error) {
+	now := time.Now().UTC()
+	j.Error = err.Error()
+	switch {
+	case errors.As(err, &permanentError{}):
+		j.Status = StatusFailed
+		j.FinishedAt = &now
+	case j.Attempts >= s.opts.MaxAttempts:
+		j.Status = StatusDeadLetter
+		j.FinishedAt = &now
+	default:
+		next := now.Add(s.backoff(j.Attempts))
+		j.Status = StatusQueued
+		j.NextAttemptAt = &next
+	}
+}
+
+// backoff returns the delay after the attempt
+func (s *Server) backoff(attempt int) time.Duration {
+	delay := s.opts.Backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// runStage runs a stage of a job and records its outcome, unless a previous
+// attempt completed it
+func (s *Server) runStage(id, name string, run func()) error {
+	skip := false
+	_, err := s.store.Update(id, func(j *Job) error {
+		st := j.stage(name)
+		if st.Status == StageDone {
+			skip = true
+			return nil
+		}
+		now := time.Now().UTC()
+		st.Status = StageRunning
+		st.Attempts++
+		st.Error = ""
+		st.StartedAt = &now
+		st.FinishedAt = nil
+		j.Step = name
+		return nil
+	})
+	if err != nil || skip {
+		return err
+	}
+
+	err = runSafely(run)
+
+	_, updateErr := s.store.Update(id, func(j *Job) error {
+		now := time.Now().UTC()
+		st := j.stage(name)
+		st.FinishedAt = &now
+		if err != nil {
+			st.Status = StageFailed
+			st.Error = err.Error()
+			return nil
+		}
+		st.Status = StageDone
+		j.StepsCompleted++
+		return nil
+	})
+	return errors.Join(err, updateErr)
+}
+
+// runSafely runs a function and turns a panic, like those of the services
+// failing a check, into an error
+func runSafely(run func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	run()
+	return nil
+}
+
+// saveManifest keeps the manifest the runner wrote to the output directory
+func (s *Server) saveManifest(id string, dirs Dirs) error {
+	m, err := manifest.Load(filepath.Join(dirs.Output, manifest.FileName))
+	if err != nil {
+		return fmt.Errorf("the job wrote no manifest: %w", err)
+	}
+	return s.store.SaveManifest(id, m)
+}
+
+// Submit queues a new job
+func (s *Server) Submit(job *Job) error {
+	job.CreatedAt = time.Now().UTC()
+	if err := s.store.Create(job, s.opts.QueueSize); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Cancel stops a queued or running job
+func (s *Server) Cancel(id string) (Job, error) {
+	job, err := s.store.Update(id, func(j *Job) error {
+		if j.Done() {
+			return fmt.Errorf("job %s has already %s", id, j.Status)
+		}
+		j.Status = StatusCanceled
+		if j.StartedAt == nil || j.NextAttemptAt != nil {
+			// Not running, the worker records when a running job stopped
+			now := time.Now().UTC()
+			j.FinishedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return Job{}, err
+	}
+
+	s.mu.Lock()
+	if cancel, ok := s.cancels[id]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+	if job.FinishedAt != nil {
+		s.announce(job)
+	}
+	return *job, nil
+}
+
+// Handler returns the HTTP API of the server
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.handleSubmit)
+	mux.HandleFunc("GET /jobs", s.handleList)
+	mux.HandleFunc("GET /jobs/{id}", s.handleGet)
+	mux.HandleFunc("DELETE /jobs/{id}", s.handleCancel)
+	mux.HandleFunc("GET /jobs/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /jobs/{id}/artifacts", s.handleArtifacts)
+	mux.HandleFunc("GET /jobs/{id}/artifacts/{path...}", s.handleDownload)
+	if s.opts.Metrics != nil {
+		mux.Handle("GET /metrics", s.opts.Metrics.Handler())
+	}
+	return mux
+}
+
+// submission is the JSON body of a job using server local images
+type submission struct {
+	Path   string `json:"path"`
+	Config Config `json:"config"`
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	job := &Job{ID: id}
+	trace := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header)), trace)
+	if len(trace) > 0 {
+		job.Trace = trace
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		if err := s.receiveUpload(r, job); err != nil {
+			os.RemoveAll(s.store.JobDir(id))
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	case "application/json":
+		var sub submission
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+			return
+		}
+		if !filepath.IsAbs(sub.Path) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("path must be an absolute directory on the server"))
+			return
+		}
+		if info, err := os.Stat(sub.Path); err != nil || !info.IsDir() {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%s is not a directory", sub.Path))
+			return
+		}
+		job.Path = sub.Path
+		job.Config = sub.Config
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("expected a multipart upload or a JSON job"))
+		return
+	}
+
+	if err := job.Config.Validate(); err != nil {
+		os.RemoveAll(s.store.JobDir(id))
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.Submit(job); errors.Is(err, errQueueFull) {
+		os.RemoveAll(s.store.JobDir(id))
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	snapshot, _ := s.Job(id)
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJSON(w, http.StatusCreated, snapshot)
+}
+
+// receiveUpload saves the images parts of a multipart upload to the images
+// directory of the job and reads its config part
+func (s *Server) receiveUpload(r *http.Request, job *Job) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	dir := s.store.Dirs(job.ID).Images
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	images := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch part.FormName() {
+		case "config":
+			if err := json.NewDecoder(part).Decode(&job.Config); err != nil {
+				return fmt.Errorf("invalid config: %w", err)
+			}
+		case "images":
+			name := filepath.Base(part.FileName())
+			if name == "." || name == string(filepath.Separator) || strings.HasPrefix(name, ".") {
+				return fmt.Errorf("invalid image name %q", part.FileName())
+			}
+			if err := saveFile(filepath.Join(dir, name), part); err != nil {
+				return err
+			}
+			images++
+		}
+		part.Close()
+	}
+
+	if images == 0 {
+		return fmt.Errorf("no images were uploaded")
+	}
+	return nil
+}
+
+func saveFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save %s: %w", filepath.Base(path), err)
+	}
+	return f.Close()
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.store.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []*Job{}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.Job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	job, err := s.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// artifact is a manifest entry with the URL it is downloaded from
+type artifact struct {
+	manifest.Artifact
+	URL string `json:"url"`
+}
+
+// artifacts returns the manifest of a succeeded job
+func (s *Server) artifacts(id string) (*manifest.Manifest, int, error) {
+	job, ok := s.Job(id)
+	if !ok {
+		return nil, http.StatusNotFound, errNotFound
+	}
+	if job.Status != StatusSucceeded {
+		return nil, http.StatusConflict, fmt.Errorf("job %s is %s, artifacts are available once it succeeded", id, job.Status)
+	}
+	m, err := s.store.Manifest(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return m, http.StatusOK, nil
+}
+
+func (s *Server) handleArtifacts(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	m, status, err := s.artifacts(id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	list := []artifact{{
+		Artifact: manifest.Artifact{Path: manifest.FileName, Role: manifest.RoleReport, Format: "json"},
+		URL:      fmt.Sprintf("/jobs/%s/artifacts/%s", id, manifest.FileName),
+	}}
+	for _, a := range m.Artifacts {
+		list = append(list, artifact{Artifact: a, URL: fmt.Sprintf("/jobs/%s/artifacts/%s", id, a.Path)})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	id, path := r.PathValue("id"), r.PathValue("path")
+	m, status, err := s.artifacts(id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	// Only the files listed in the manifest are served
+	listed := path == manifest.FileName
+	for _, a := range m.Artifacts {
+		listed = listed || a.Path == path
+	}
+	if !listed {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s has no artifact %s", id, path))
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(s.store.Dirs(id).Output, filepath.FromSlash(path)))
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
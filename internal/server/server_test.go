@@ -0,0 +1,530 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/manifest"
+	"github.com/2024-dissertation/openmvgo/internal/metrics"
+	"github.com/2024-dissertation/openmvgo/internal/openmvg"
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/server"
+	"github.com/2024-dissertation/openmvgo/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// fakeRunner writes a mesh and its manifest in two stages
+func fakeRunner(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+	if err := stage("reconstruction", func() {}); err != nil {
+		return err
+	}
+	return stage("publish", func() {
+		if err := os.WriteFile(filepath.Join(dirs.Output, "final.obj"), []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), 0o644); err != nil {
+			panic(err)
+		}
+		m, err := manifest.Build(dirs.Output)
+		if err != nil {
+			panic(err)
+		}
+		if err := m.Write(filepath.Join(dirs.Output, manifest.FileName)); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// blockingRunner runs until the job is canceled
+func blockingRunner(started chan<- string) server.Runner {
+	return func(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+		return stage("densify", func() {
+			started <- job.ID
+			<-ctx.Done()
+		})
+	}
+}
+
+func startServer(t *testing.T, dataDir string, runner server.Runner) (*httptest.Server, context.CancelFunc, *server.Server) {
+	t.Helper()
+
+	return startServerWith(t, server.Options{DataDir: dataDir, Runner: runner})
+}
+
+func startServerWith(t *testing.T, opts server.Options) (*httptest.Server, context.CancelFunc, *server.Server) {
+	t.Helper()
+
+	srv, err := server.New(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.Start(ctx)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+		srv.Wait()
+		srv.Close()
+	})
+	return ts, cancel, srv
+}
+
+func submitPath(t *testing.T, url, path string, config string) *http.Response {
+	t.Helper()
+
+	body := `{"path": "` + path + `", "config": ` + config + `}`
+	resp, err := http.Post(url+"/jobs", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return resp
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+
+	defer resp.Body.Close()
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return v
+}
+
+// waitFor polls the job until it has the status
+func waitFor(t *testing.T, url, id, status string) server.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url + "/jobs/" + id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		job := decode[server.Job](t, resp)
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected job %s to be %s, it is %s", id, status, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubmit_Path(t *testing.T) {
+	ts, _, _ := startServer(t, t.TempDir(), fakeRunner)
+
+	resp := submitPath(t, ts.URL, t.TempDir(), `{"output_format": "obj", "max_threads": 2}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	job := decode[server.Job](t, resp)
+	if job.Config.MaxThreads != 2 {
+		t.Errorf("expected the config to be kept, got %+v", job.Config)
+	}
+
+	job = waitFor(t, ts.URL, job.ID, server.StatusSucceeded)
+	if job.Step != "publish" || job.StepsCompleted != 2 || len(job.Stages) != 2 || job.Attempts != 1 || job.FinishedAt == nil {
+		t.Errorf("unexpected progress %+v", job)
+	}
+
+	resp, err := http.Get(ts.URL + "/jobs/" + job.ID + "/artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := decode[[]struct {
+		Path     string `json:"path"`
+		Role     string `json:"role"`
+		Vertices *int   `json:"vertices"`
+		URL      string `json:"url"`
+	}](t, resp)
+	if len(artifacts) != 2 || artifacts[1].Path != "final.obj" || artifacts[1].Role != manifest.RoleMesh || *artifacts[1].Vertices != 3 {
+		t.Fatalf("unexpected artifacts %+v", artifacts)
+	}
+
+	resp, err = http.Get(ts.URL + artifacts[1].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(data), "v 0 0 0") {
+		t.Errorf("unexpected download %d %q", resp.StatusCode, data)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs/" + job.ID + "/artifacts/../job.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Errorf("expected only listed artifacts to be served")
+	}
+}
+
+func TestSubmit_Upload(t *testing.T) {
+	dataDir := t.TempDir()
+	ts, _, _ := startServer(t, dataDir, fakeRunner)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("config", `{"sfm_engine": "global"}`)
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		part, err := mw.CreateFormFile("images", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(name))
+	}
+	mw.Close()
+
+	resp, err := http.Post(ts.URL+"/jobs", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	job := decode[server.Job](t, resp)
+	if job.Path != "" || job.Config.SfMEngine != "global" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if _, err := os.Stat(filepath.Join(dataDir, "jobs", job.ID, "images", name)); err != nil {
+			t.Errorf("expected %s to be saved: %v", name, err)
+		}
+	}
+	waitFor(t, ts.URL, job.ID, server.StatusSucceeded)
+}
+
+func TestSubmit_Invalid(t *testing.T) {
+	ts, _, _ := startServer(t, t.TempDir(), fakeRunner)
+
+	tests := map[string]*http.Response{
+		"relative path":  submitPath(t, ts.URL, "images", `{}`),
+		"missing path":   submitPath(t, ts.URL, filepath.Join(t.TempDir(), "missing"), `{}`),
+		"bad format":     submitPath(t, ts.URL, t.TempDir(), `{"output_format": "fbx"}`),
+		"bad engine":     submitPath(t, ts.URL, t.TempDir(), `{"sfm_engine": "magic"}`),
+		"pairs file":     submitPath(t, ts.URL, t.TempDir(), `{"pair_strategy": "file"}`),
+		"bad crop stage": submitPath(t, ts.URL, t.TempDir(), `{"crop_auto": true, "crop_stages": "texture"}`),
+		"invalid config": submitPath(t, ts.URL, t.TempDir(), `[]`),
+	}
+	for name, resp := range tests {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	started := make(chan string, 1)
+	ts, _, _ := startServer(t, t.TempDir(), blockingRunner(started))
+
+	running := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	queued := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	<-started
+
+	for _, id := range []string{queued.ID, running.ID} {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/jobs/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200 canceling %s, got %d", id, resp.StatusCode)
+		}
+	}
+
+	// The worker records when the running job stopped
+	deadline := time.Now().Add(5 * time.Second)
+	for job := waitFor(t, ts.URL, running.ID, server.StatusCanceled); job.FinishedAt == nil; job = waitFor(t, ts.URL, running.ID, server.StatusCanceled) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the running job to record when it stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitFor(t, ts.URL, queued.ID, server.StatusCanceled)
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/jobs/"+running.ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 canceling a finished job, got %d", resp.StatusCode)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	dataDir := t.TempDir()
+	started := make(chan string, 1)
+	ts, stop, srv := startServer(t, dataDir, blockingRunner(started))
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	<-started
+
+	// Stopping the workers interrupts the job, which is queued again
+	stop()
+	srv.Wait()
+	if j, _ := srv.Job(job.ID); j.Status != server.StatusQueued || j.Attempts != 0 {
+		t.Fatalf("expected the interrupted job to be queued, got %s after %d attempts", j.Status, j.Attempts)
+	}
+	srv.Close()
+
+	ts, _, _ = startServer(t, dataDir, fakeRunner)
+	waitFor(t, ts.URL, job.ID, server.StatusSucceeded)
+}
+
+func TestRunner_Panic(t *testing.T) {
+	panicking := func(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+		panic(os.ErrNotExist)
+	}
+	ts, _, _ := startServer(t, t.TempDir(), panicking)
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	job = waitFor(t, ts.URL, job.ID, server.StatusFailed)
+	if job.Error != os.ErrNotExist.Error() {
+		t.Errorf("expected the panic to be reported, got %q", job.Error)
+	}
+
+	resp, err := http.Get(ts.URL + "/jobs/" + job.ID + "/artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for the artifacts of a failed job, got %d", resp.StatusCode)
+	}
+}
+
+func TestRetry_ResumesFailedStage(t *testing.T) {
+	var runs sync.Map
+	count := func(name string) int {
+		n, _ := runs.LoadOrStore(name, new(atomic.Int32))
+		return int(n.(*atomic.Int32).Add(1))
+	}
+	// The mesh stage fails on its first attempt only
+	flaky := func(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+		if err := stage("densify", func() { count("densify") }); err != nil {
+			return err
+		}
+		if err := stage("mesh", func() {
+			if count("mesh") == 1 {
+				panic(errors.New("ReconstructMesh crashed"))
+			}
+		}); err != nil {
+			return err
+		}
+		return fakeRunner(ctx, job, dirs, stage, observe)
+	}
+	ts, _, _ := startServerWith(t, server.Options{DataDir: t.TempDir(), Runner: flaky, Backoff: time.Millisecond})
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	job = waitFor(t, ts.URL, job.ID, server.StatusSucceeded)
+	if job.Attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", job.Attempts)
+	}
+	if n, _ := runs.Load("densify"); n.(*atomic.Int32).Load() != 1 {
+		t.Errorf("expected the completed stage not to run again, it ran %d times", n.(*atomic.Int32).Load())
+	}
+	for _, stage := range job.Stages {
+		attempts := 1
+		if stage.Name == "mesh" {
+			attempts = 2
+		}
+		if stage.Status != server.StageDone || stage.Attempts != attempts {
+			t.Errorf("unexpected stage %+v", stage)
+		}
+	}
+}
+
+func TestRetry_DeadLetter(t *testing.T) {
+	failing := func(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+		return stage("densify", func() { panic(errors.New("DensifyPointCloud crashed")) })
+	}
+	ts, _, _ := startServerWith(t, server.Options{DataDir: t.TempDir(), Runner: failing, MaxAttempts: 2, Backoff: time.Millisecond})
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	job = waitFor(t, ts.URL, job.ID, server.StatusDeadLetter)
+	if job.Attempts != 2 || job.Stages[0].Attempts != 2 || job.Stages[0].Status != server.StageFailed {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if job.Error != "DensifyPointCloud crashed" || job.FinishedAt == nil {
+		t.Errorf("expected the last failure to be reported, got %q", job.Error)
+	}
+}
+
+func TestRetry_FailedCommand(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockUtils := mocks.NewMockUtilsInterface(ctrl)
+	mockUtils.EXPECT().EnsureDir(gomock.Any()).Return(nil).AnyTimes()
+	mockUtils.EXPECT().RunCommand("openMVG_main_ComputeFeatures", gomock.Any()).
+		Return(errors.New("exit status 1")).AnyTimes()
+	mockUtils.EXPECT().Check(gomock.Any()).Do(func(err error) {
+		if err != nil {
+			panic(err)
+		}
+	}).AnyTimes()
+
+	failing := func(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+		return stage("features", func() {
+			service := openmvg.NewOpenMVGService(openmvg.OpenMVGConfig{InputDir: job.Path, OutputDir: dirs.Output}, mockUtils)
+			service.RunSfMComputeFeatures()
+		})
+	}
+	ts, _, _ := startServerWith(t, server.Options{DataDir: t.TempDir(), Runner: failing, MaxAttempts: 1, Backoff: time.Millisecond})
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	job = waitFor(t, ts.URL, job.ID, server.StatusDeadLetter)
+	if job.Stages[0].Status != server.StageFailed || job.StepsCompleted != 0 {
+		t.Errorf("expected the stage of the failed command to fail, got %+v", job.Stages[0])
+	}
+	if !strings.Contains(job.Error, "openMVG_main_ComputeFeatures") {
+		t.Errorf("expected the failed command to be reported, got %q", job.Error)
+	}
+}
+
+func TestPipelineRunner_RetriesCameraDBDownload(t *testing.T) {
+	var downloads atomic.Int32
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if downloads.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "Canon;Canon EOS 5D;35.8\n")
+	}))
+	defer db.Close()
+
+	runner := server.PipelineRunner(server.RunnerOptions{CameraDBURL: db.URL + "/sensor_width_camera_database.txt"})
+	ts, _, _ := startServerWith(t, server.Options{DataDir: t.TempDir(), Runner: runner, MaxAttempts: 2, Backoff: time.Millisecond})
+
+	// The first download fails and is retried, the second attempt goes on
+	// to the commands, which fail on the empty image directory
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	job = waitFor(t, ts.URL, job.ID, server.StatusDeadLetter)
+	if job.Attempts != 2 || downloads.Load() != 2 {
+		t.Errorf("expected the failed download to be retried, got %d attempts and %d downloads", job.Attempts, downloads.Load())
+	}
+	if len(job.Stages) == 0 {
+		t.Errorf("expected the retry to run the stages, got %+v", job)
+	}
+}
+
+func TestRetry_Permanent(t *testing.T) {
+	failing := func(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+		return server.Permanent(errors.New("the images are gone"))
+	}
+	ts, _, _ := startServerWith(t, server.Options{DataDir: t.TempDir(), Runner: failing, Backoff: time.Millisecond})
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	job = waitFor(t, ts.URL, job.ID, server.StatusFailed)
+	if job.Attempts != 1 || job.Error != "the images are gone" {
+		t.Errorf("expected a single attempt, got %+v", job)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	runner := func(ctx context.Context, job server.Job, dirs server.Dirs, stage server.StageFunc, observe pipeline.Observer) error {
+		err := stage("densify", func() {
+			started <- job.ID
+			<-release
+			pipeline.RunStep(ctx, pipeline.Step{Name: "densify", Run: func() {
+				observe(pipeline.Event{Type: pipeline.StageProgress, Stage: "densify", Percent: 50})
+			}}, observe)
+		})
+		if err != nil {
+			return err
+		}
+		return fakeRunner(ctx, job, dirs, stage, observe)
+	}
+	ts, _, _ := startServer(t, t.TempDir(), runner)
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	<-started
+
+	resp, err := http.Get(ts.URL + "/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	var names []string
+	var last server.Job
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, name)
+			if len(names) == 1 {
+				// The current state comes first
+				close(release)
+			}
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && names[len(names)-1] == "job" {
+			if err := json.Unmarshal([]byte(data), &last); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	want := []string{"job", "stage_started", "stage_progress", "stage_finished", "job"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("expected events %v, got %v", want, names)
+	}
+	if last.Status != server.StatusSucceeded {
+		t.Errorf("expected the stream to end with the succeeded job, got %s", last.Status)
+	}
+
+	// A finished job only reports its state
+	resp, err = http.Get(ts.URL + "/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Count(string(data), "event: ") != 1 {
+		t.Errorf("expected a single event for a finished job, got %q", data)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.New()
+	ts, _, _ := startServerWith(t, server.Options{DataDir: t.TempDir(), Runner: fakeRunner, Metrics: reg})
+
+	job := decode[server.Job](t, submitPath(t, ts.URL, t.TempDir(), `{}`))
+	waitFor(t, ts.URL, job.ID, server.StatusSucceeded)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{`openmvgo_jobs_total{status="succeeded"} 1`, "openmvgo_active_jobs 0", "openmvgo_queue_depth 0"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in the metrics", want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/manifest"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket = []byte("jobs")
+	// queueBucket indexes the queued jobs by when they are due, see queueKey
+	queueBucket     = []byte("queue")
+	manifestsBucket = []byte("manifests")
+)
+
+var (
+	errNotFound  = errors.New("job not found")
+	errQueueFull = errors.New("the job queue is full")
+)
+
+// Store keeps the jobs, their queue and their manifests in a bbolt database
+// in Dir, and the files of each job in a directory of its own
+type Store struct {
+	Dir string
+	db  *bolt.DB
+}
+
+// OpenStore opens the store in dir, creating it if needed. A store can only
+// be opened by one server at a time.
+func OpenStore(dir string) (*Store, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(abs, "jobs"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	db, err := bolt.Open(filepath.Join(abs, "jobs.db"), 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job database, is another server using %s? %w", dir, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, queueBucket, manifestsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open job database: %w", err)
+	}
+	return &Store{Dir: abs, db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Dirs are the directories of a job
+type Dirs struct {
+	// Images receives the uploaded images
+	Images string
+	// Work is the work directory of the pipeline
+	Work string
+	// Output receives the artifacts
+	Output string
+}
+
+// JobDir returns the directory of a job
+func (s *Store) JobDir(id string) string {
+	return filepath.Join(s.Dir, "jobs", id)
+}
+
+// Dirs returns the directories of a job
+func (s *Store) Dirs(id string) Dirs {
+	dir := s.JobDir(id)
+	return Dirs{
+		Images: filepath.Join(dir, "images"),
+		Work:   filepath.Join(dir, "work"),
+		Output: filepath.Join(dir, "output"),
+	}
+}
+
+// queueKey orders queued jobs by when they are due, then by id
+func queueKey(job *Job) []byte {
+	due := job.CreatedAt
+	if job.NextAttemptAt != nil {
+		due = *job.NextAttemptAt
+	}
+	return fmt.Appendf(nil, "%020d/%s", due.UnixNano(), job.ID)
+}
+
+// put writes job, keeping the queue index in step with its status. old is
+// the previous state of the job, nil for a new job.
+func put(tx *bolt.Tx, old, job *Job) error {
+	queue := tx.Bucket(queueBucket)
+	if old != nil && old.Status == StatusQueued {
+		if err := queue.Delete(queueKey(old)); err != nil {
+			return err
+		}
+	}
+	if job.Status == StatusQueued {
+		if err := queue.Put(queueKey(job), []byte(job.ID)); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+}
+
+func get(tx *bolt.Tx, id string) (*Job, error) {
+	data := tx.Bucket(jobsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, errNotFound
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// Create adds a queued job, unless limit jobs are queued already
+func (s *Store) Create(job *Job, limit int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(queueBucket).Stats().KeyN >= limit {
+			return errQueueFull
+		}
+		job.Status = StatusQueued
+		return put(tx, nil, job)
+	})
+}
+
+// Get returns a job
+func (s *Store) Get(id string) (*Job, error) {
+	var job *Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = get(tx, id)
+		return err
+	})
+	return job, err
+}
+
+// Update applies fn to a job and saves it, unless fn fails
+func (s *Store) Update(id string, fn func(job *Job) error) (*Job, error) {
+	var job *Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		old, err := get(tx, id)
+		if err != nil {
+			return err
+		}
+		j := *old
+		j.Stages = append([]Stage(nil), old.Stages...)
+		if err := fn(&j); err != nil {
+			return err
+		}
+		job = &j
+		return put(tx, old, job)
+	})
+	return job, err
+}
+
+// List returns every job, oldest first
+func (s *Store) List() ([]*Job, error) {
+	var jobs []*Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("failed to read job %s: %w", k, err)
+			}
+			jobs = append(jobs, &job)
+			return nil
+		})
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, err
+}
+
+// Dequeue starts the attempt at the queued job that is due first, if one is
+// due at now
+func (s *Store) Dequeue(now time.Time) (*Job, error) {
+	var job *Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		k, v := tx.Bucket(queueBucket).Cursor().First()
+		if k == nil || dueAt(k).After(now) {
+			return nil
+		}
+		old, err := get(tx, string(v))
+		if err != nil {
+			return err
+		}
+
+		j := *old
+		started := now.UTC()
+		j.Status = StatusRunning
+		j.Attempts++
+		j.StartedAt = &started
+		j.NextAttemptAt = nil
+		job = &j
+		return put(tx, old, job)
+	})
+	return job, err
+}
+
+// QueueLen returns the number of queued jobs
+func (s *Store) QueueLen() int {
+	var n int
+	s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(queueBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// NextDue returns when the first queued job is due
+func (s *Store) NextDue() (time.Time, bool) {
+	var due time.Time
+	var ok bool
+	s.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(queueBucket).Cursor().First(); k != nil {
+			due, ok = dueAt(k), true
+		}
+		return nil
+	})
+	return due, ok
+}
+
+func dueAt(key []byte) time.Time {
+	nanos, _ := strconv.ParseInt(string(key[:bytes.IndexByte(key, '/')]), 10, 64)
+	return time.Unix(0, nanos)
+}
+
+// SaveManifest keeps the manifest of the artifacts of a job
+func (s *Store) SaveManifest(id string, m *manifest.Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(manifestsBucket).Put([]byte(id), data)
+	})
+}
+
+// Manifest returns the manifest of the artifacts of a job
+func (s *Store) Manifest(id string) (*manifest.Manifest, error) {
+	var m *manifest.Manifest
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(manifestsBucket).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("job %s has no artifacts", id)
+		}
+		m = &manifest.Manifest{}
+		return json.Unmarshal(data, m)
+	})
+	return m, err
+}
@@ -0,0 +1,121 @@
+package sfmdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// undistortIterations bounds the fixed point iteration that inverts lens
+// distortion, which converges in a few steps for real lenses
+const undistortIterations = 20
+
+// ViewByFilename returns the view of the image with the given file name or nil
+func (s *SfMData) ViewByFilename(name string) *View {
+	for i := range s.Views {
+		if s.Views[i].Filename == name {
+			return &s.Views[i]
+		}
+	}
+	return nil
+}
+
+// Intrinsic returns the intrinsic with the given id or nil
+func (s *SfMData) Intrinsic(id uint32) *Intrinsic {
+	for i := range s.Intrinsics {
+		if s.Intrinsics[i].ID == id {
+			return &s.Intrinsics[i]
+		}
+	}
+	return nil
+}
+
+// Undistort converts a pixel position to normalised camera coordinates with
+// the lens distortion removed
+func (in *Intrinsic) Undistort(u, v float64) (float64, float64, error) {
+	if in.FocalLength == 0 {
+		return 0, 0, fmt.Errorf("intrinsic %d has no focal length", in.ID)
+	}
+	xd := (u - in.PrincipalPoint[0]) / in.FocalLength
+	yd := (v - in.PrincipalPoint[1]) / in.FocalLength
+
+	distort, err := in.distortion()
+	if err != nil {
+		return 0, 0, err
+	}
+	if distort == nil {
+		return xd, yd, nil
+	}
+
+	x, y := xd, yd
+	for range undistortIterations {
+		dx, dy := distort(x, y)
+		x, y = x-(dx-xd), y-(dy-yd)
+	}
+	return x, y, nil
+}
+
+// distortion returns the distortion function of the camera model, or nil for
+// a model without distortion
+func (in *Intrinsic) distortion() (func(x, y float64) (float64, float64), error) {
+	params := func(key string, n int) ([]float64, error) {
+		var v []float64
+		if err := json.Unmarshal(in.Data[key], &v); err != nil || len(v) != n {
+			return nil, fmt.Errorf("intrinsic %d: expected %d %s parameters", in.ID, n, key)
+		}
+		return v, nil
+	}
+	radial := func(k []float64, r2 float64) float64 {
+		f, p := 1.0, 1.0
+		for _, c := range k {
+			p *= r2
+			f += c * p
+		}
+		return f
+	}
+
+	switch in.Model {
+	case "pinhole":
+		return nil, nil
+	case "pinhole_radial_k1", "pinhole_radial_k3":
+		key, n := "disto_k1", 1
+		if in.Model == "pinhole_radial_k3" {
+			key, n = "disto_k3", 3
+		}
+		k, err := params(key, n)
+		if err != nil {
+			return nil, err
+		}
+		return func(x, y float64) (float64, float64) {
+			f := radial(k, x*x+y*y)
+			return x * f, y * f
+		}, nil
+	case "pinhole_brown_t2":
+		k, err := params("disto_t2", 5)
+		if err != nil {
+			return nil, err
+		}
+		return func(x, y float64) (float64, float64) {
+			r2 := x*x + y*y
+			f := radial(k[:3], r2)
+			t1, t2 := k[3], k[4]
+			return x*f + 2*t1*x*y + t2*(r2+2*x*x), y*f + 2*t2*x*y + t1*(r2+2*y*y)
+		}, nil
+	case "fisheye":
+		k, err := params("fisheye", 4)
+		if err != nil {
+			return nil, err
+		}
+		return func(x, y float64) (float64, float64) {
+			r := math.Hypot(x, y)
+			if r < 1e-12 {
+				return x, y
+			}
+			theta := math.Atan(r)
+			f := radial(k, theta*theta) * theta / r
+			return x * f, y * f
+		}, nil
+	default:
+		return nil, fmt.Errorf("camera model %q is not supported", in.Model)
+	}
+}
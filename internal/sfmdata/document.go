@@ -0,0 +1,621 @@
+package sfmdata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+)
+
+// Document is an sfm_data.json file kept as an ordered JSON tree, so it can
+// be edited and written back without disturbing fields this package does not
+// model or the member order cereal expects
+type Document struct {
+	Root *Node
+}
+
+// Node is a JSON value. Objects keep their members in order, numbers keep
+// their original text until they are changed.
+type Node struct {
+	Kind    Kind
+	Members []Member
+	Items   []*Node
+	Value   any
+}
+
+// Member is a named object member
+type Member struct {
+	Key   string
+	Value *Node
+}
+
+// Kind is the JSON type of a node
+type Kind int
+
+const (
+	Null Kind = iota
+	Bool
+	Number
+	String
+	Array
+	Object
+)
+
+// ReadDocument reads the sfm_data.json file at path
+func ReadDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sfm data %s: %w", path, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := decodeNode(dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sfm data %s: %w", path, err)
+	}
+	return &Document{Root: root}, nil
+}
+
+func decodeNode(dec *json.Decoder) (*Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			n := &Node{Kind: Object}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.Members = append(n.Members, Member{Key: key.(string), Value: value})
+			}
+			_, err := dec.Token()
+			return n, err
+		case '[':
+			n := &Node{Kind: Array}
+			for dec.More() {
+				item, err := decodeNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.Items = append(n.Items, item)
+			}
+			_, err := dec.Token()
+			return n, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", v)
+	case json.Number:
+		return &Node{Kind: Number, Value: v}, nil
+	case string:
+		return &Node{Kind: String, Value: v}, nil
+	case bool:
+		return &Node{Kind: Bool, Value: v}, nil
+	default:
+		return &Node{Kind: Null}, nil
+	}
+}
+
+// Write saves the document to path
+func (d *Document) Write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create sfm data %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	if err := encodeNode(w, d.Root, 0); err != nil {
+		return fmt.Errorf("failed to write sfm data %s: %w", path, err)
+	}
+	w.WriteString("\n")
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write sfm data %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func encodeNode(w *bufio.Writer, n *Node, depth int) error {
+	indent := func(d int) {
+		w.WriteByte('\n')
+		for range d {
+			w.WriteString("    ")
+		}
+	}
+
+	switch n.Kind {
+	case Object:
+		if len(n.Members) == 0 {
+			_, err := w.WriteString("{}")
+			return err
+		}
+		w.WriteByte('{')
+		for i, m := range n.Members {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			indent(depth + 1)
+			key, _ := json.Marshal(m.Key)
+			w.Write(key)
+			w.WriteString(": ")
+			if err := encodeNode(w, m.Value, depth+1); err != nil {
+				return err
+			}
+		}
+		indent(depth)
+		return w.WriteByte('}')
+	case Array:
+		if len(n.Items) == 0 {
+			_, err := w.WriteString("[]")
+			return err
+		}
+		w.WriteByte('[')
+		for i, item := range n.Items {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			indent(depth + 1)
+			if err := encodeNode(w, item, depth+1); err != nil {
+				return err
+			}
+		}
+		indent(depth)
+		return w.WriteByte(']')
+	case Null:
+		_, err := w.WriteString("null")
+		return err
+	default:
+		b, err := json.Marshal(n.Value)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+}
+
+// Field returns the member of an object node with the given key or nil
+func (n *Node) Field(key string) *Node {
+	if n == nil || n.Kind != Object {
+		return nil
+	}
+	for _, m := range n.Members {
+		if m.Key == key {
+			return m.Value
+		}
+	}
+	return nil
+}
+
+// Path follows keys through nested objects, returning nil if any is missing
+func (n *Node) Path(keys ...string) *Node {
+	for _, k := range keys {
+		n = n.Field(k)
+	}
+	return n
+}
+
+// Set replaces or appends the member key of an object node
+func (n *Node) Set(key string, value *Node) {
+	for i, m := range n.Members {
+		if m.Key == key {
+			n.Members[i].Value = value
+			return
+		}
+	}
+	n.Members = append(n.Members, Member{Key: key, Value: value})
+}
+
+// Float returns the value of a number node
+func (n *Node) Float() (float64, error) {
+	if n == nil || n.Kind != Number {
+		return 0, fmt.Errorf("expected a number")
+	}
+	return n.Value.(json.Number).Float64()
+}
+
+// Vec3 returns the values of a 3 element number array
+func (n *Node) Vec3() ([3]float64, error) {
+	var v [3]float64
+	if n == nil || n.Kind != Array || len(n.Items) != 3 {
+		return v, fmt.Errorf("expected an array of 3 numbers")
+	}
+	for i, item := range n.Items {
+		f, err := item.Float()
+		if err != nil {
+			return v, err
+		}
+		v[i] = f
+	}
+	return v, nil
+}
+
+// Mat3 returns the values of a 3 by 3 nested number array
+func (n *Node) Mat3() ([3][3]float64, error) {
+	var m [3][3]float64
+	if n == nil || n.Kind != Array || len(n.Items) != 3 {
+		return m, fmt.Errorf("expected a 3x3 matrix")
+	}
+	for i, row := range n.Items {
+		v, err := row.Vec3()
+		if err != nil {
+			return m, err
+		}
+		m[i] = v
+	}
+	return m, nil
+}
+
+// NumberNode returns a number node holding v. Integral values are written
+// without an exponent so that ids stay readable as integers.
+func NumberNode(v float64) *Node {
+	if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+		return &Node{Kind: Number, Value: json.Number(strconv.FormatInt(int64(v), 10))}
+	}
+	return &Node{Kind: Number, Value: json.Number(strconv.FormatFloat(v, 'g', -1, 64))}
+}
+
+// Vec3Node returns an array node holding v
+func Vec3Node(v [3]float64) *Node {
+	return &Node{Kind: Array, Items: []*Node{NumberNode(v[0]), NumberNode(v[1]), NumberNode(v[2])}}
+}
+
+// Mat3Node returns a nested array node holding m
+func Mat3Node(m [3][3]float64) *Node {
+	return &Node{Kind: Array, Items: []*Node{Vec3Node(m[0]), Vec3Node(m[1]), Vec3Node(m[2])}}
+}
+
+// Transform applies t to every camera pose, landmark and control point
+func (d *Document) Transform(t transform.Similarity) error {
+	for _, e := range d.Root.Field("extrinsics").items() {
+		pose := e.Field("value")
+		rotation, err := pose.Field("rotation").Mat3()
+		if err != nil {
+			return fmt.Errorf("extrinsic rotation: %w", err)
+		}
+		center, err := pose.Field("center").Vec3()
+		if err != nil {
+			return fmt.Errorf("extrinsic center: %w", err)
+		}
+		pose.Set("rotation", Mat3Node(t.ApplyRotation(rotation)))
+		pose.Set("center", Vec3Node(t.Apply(center)))
+	}
+
+	for _, section := range []string{"structure", "control_points"} {
+		for _, e := range d.Root.Field(section).items() {
+			landmark := e.Field("value")
+			x, err := landmark.Field("X").Vec3()
+			if err != nil {
+				return fmt.Errorf("%s position: %w", section, err)
+			}
+			landmark.Set("X", Vec3Node(t.Apply(x)))
+		}
+	}
+
+	return nil
+}
+
+// ControlPoint is a surveyed point with its observations, stored in the
+// control_points section of sfm_data
+type ControlPoint struct {
+	ID           uint32
+	Position     [3]float64
+	Observations []ControlObservation
+}
+
+// ControlObservation is a pixel position of a control point in a view
+type ControlObservation struct {
+	ViewID uint32
+	X, Y   float64
+}
+
+// SetControlPoints replaces the control_points section of the document
+func (d *Document) SetControlPoints(points []ControlPoint) {
+	section := &Node{Kind: Array}
+	for _, p := range points {
+		observations := &Node{Kind: Array}
+		for _, o := range p.Observations {
+			observations.Items = append(observations.Items, &Node{Kind: Object, Members: []Member{
+				{Key: "key", Value: NumberNode(float64(o.ViewID))},
+				{Key: "value", Value: &Node{Kind: Object, Members: []Member{
+					{Key: "id_feat", Value: NumberNode(0)},
+					{Key: "x", Value: &Node{Kind: Array, Items: []*Node{NumberNode(o.X), NumberNode(o.Y)}}},
+				}}},
+			}})
+		}
+		section.Items = append(section.Items, &Node{Kind: Object, Members: []Member{
+			{Key: "key", Value: NumberNode(float64(p.ID))},
+			{Key: "value", Value: &Node{Kind: Object, Members: []Member{
+				{Key: "X", Value: Vec3Node(p.Position)},
+				{Key: "observations", Value: observations},
+			}}},
+		}})
+	}
+	d.Root.Set("control_points", section)
+}
+
+// SetViewIntrinsics points views at other intrinsics, keyed by view id
+func (d *Document) SetViewIntrinsics(intrinsics map[uint32]uint32) error {
+	for _, e := range d.Root.Field("views").items() {
+		data := e.Path("value", "ptr_wrapper", "data")
+		id, err := data.Field("id_view").Float()
+		if err != nil {
+			return fmt.Errorf("view id: %w", err)
+		}
+		if intrinsic, ok := intrinsics[uint32(id)]; ok {
+			data.Set("id_intrinsic", NumberNode(float64(intrinsic)))
+		}
+	}
+	return nil
+}
+
+// SetViewRigs places views in rigs, keyed by view id, as the id_rig and
+// id_sub_pose fields of the views. Each view keeps its own pose: OpenMVG reads
+// no rig constraints, and sharing the pose of a shot would place the cameras
+// of the rig at the same spot.
+func (d *Document) SetViewRigs(rigs map[uint32]ViewRig) error {
+	for _, e := range d.Root.Field("views").items() {
+		data := e.Path("value", "ptr_wrapper", "data")
+		id, err := data.Field("id_view").Float()
+		if err != nil {
+			return fmt.Errorf("view id: %w", err)
+		}
+		if rig, ok := rigs[uint32(id)]; ok {
+			data.Set("id_rig", NumberNode(float64(rig.Rig)))
+			data.Set("id_sub_pose", NumberNode(float64(rig.SubPose)))
+		}
+	}
+	return nil
+}
+
+// RemoveUnusedIntrinsics drops intrinsics no view refers to. Cereal names a
+// polymorphic type at its first occurrence only, so the name moves to the
+// first remaining intrinsic of each type.
+func (d *Document) RemoveUnusedIntrinsics() error {
+	used := map[uint32]bool{}
+	for _, e := range d.Root.Field("views").items() {
+		id, err := e.Path("value", "ptr_wrapper", "data", "id_intrinsic").Float()
+		if err != nil {
+			return fmt.Errorf("view intrinsic: %w", err)
+		}
+		used[uint32(id)] = true
+	}
+
+	section := d.Root.Field("intrinsics")
+	names := map[uint32]*Node{}
+	declared := map[uint32]bool{}
+	var kept []*Node
+	for _, e := range section.items() {
+		value := e.Field("value")
+		pid, err := value.Field("polymorphic_id").Float()
+		if err != nil {
+			return fmt.Errorf("intrinsic type: %w", err)
+		}
+		typeID := uint32(pid) &^ polymorphicNew
+		if uint32(pid)&polymorphicNew != 0 {
+			names[typeID] = value.Field("polymorphic_name")
+		}
+
+		key, err := e.Field("key").Float()
+		if err != nil {
+			return fmt.Errorf("intrinsic key: %w", err)
+		}
+		if !used[uint32(key)] {
+			continue
+		}
+
+		members := make([]Member, 0, len(value.Members))
+		for _, m := range value.Members {
+			if m.Key == "polymorphic_name" {
+				continue
+			}
+			if m.Key == "polymorphic_id" {
+				id := typeID
+				if !declared[typeID] {
+					id |= polymorphicNew
+				}
+				members = append(members, Member{Key: m.Key, Value: NumberNode(float64(id))})
+				if !declared[typeID] {
+					members = append(members, Member{Key: "polymorphic_name", Value: names[typeID]})
+				}
+				continue
+			}
+			members = append(members, m)
+		}
+		value.Members = members
+		declared[typeID] = true
+		kept = append(kept, e)
+	}
+	if section != nil {
+		section.Items = kept
+	}
+	return nil
+}
+
+// AppendViews adds the views and intrinsics of other, typically the image
+// listing of new images, to the document. The views are numbered after the
+// views and poses of the document, with their images under localPath
+// relative to the document root path, and the ids of the new views are
+// returned. Cereal numbers polymorphic types and shared pointers per file, so
+// both are renumbered to follow those of the document.
+func (d *Document) AppendViews(other *Document, localPath string) ([]uint32, error) {
+	types, nextType, err := polymorphicTypes(d.Root.Field("views").items(), d.Root.Field("intrinsics").items())
+	if err != nil {
+		return nil, err
+	}
+	otherTypes := map[uint32]string{}
+	for _, e := range append(other.Root.Field("views").items(), other.Root.Field("intrinsics").items()...) {
+		pid, err := e.Path("value", "polymorphic_id").Float()
+		if err != nil {
+			return nil, fmt.Errorf("polymorphic id: %w", err)
+		}
+		if uint32(pid)&polymorphicNew != 0 {
+			name, _ := e.Path("value", "polymorphic_name").Value.(string)
+			otherTypes[uint32(pid)&^polymorphicNew] = name
+		}
+	}
+
+	var nextPointer, nextView, nextIntrinsic uint32
+	for _, e := range d.Root.Field("views").items() {
+		data := e.Path("value", "ptr_wrapper", "data")
+		for _, key := range []string{"id_view", "id_pose"} {
+			id, err := data.Field(key).Float()
+			if err != nil {
+				return nil, fmt.Errorf("view %s: %w", key, err)
+			}
+			if uint32(id) != UndefinedID {
+				nextView = max(nextView, uint32(id)+1)
+			}
+		}
+	}
+	for _, e := range d.Root.Field("intrinsics").items() {
+		key, err := e.Field("key").Float()
+		if err != nil {
+			return nil, fmt.Errorf("intrinsic key: %w", err)
+		}
+		nextIntrinsic = max(nextIntrinsic, uint32(key)+1)
+	}
+	for _, e := range append(d.Root.Field("views").items(), d.Root.Field("intrinsics").items()...) {
+		id, err := e.Path("value", "ptr_wrapper", "id").Float()
+		if err != nil {
+			return nil, fmt.Errorf("pointer id: %w", err)
+		}
+		nextPointer = max(nextPointer, uint32(id)&^polymorphicNew+1)
+	}
+
+	// retype renumbers the polymorphic id and pointer of an appended entry
+	retype := func(value *Node) error {
+		pid, err := value.Field("polymorphic_id").Float()
+		if err != nil {
+			return fmt.Errorf("polymorphic id: %w", err)
+		}
+		members := make([]Member, 0, len(value.Members)+1)
+		for _, m := range value.Members {
+			switch m.Key {
+			case "polymorphic_name":
+				continue
+			case "polymorphic_id":
+				// Ids without the new bit above it mark types that need no
+				// registration, such as the plain View
+				if uint32(pid)&polymorphicNew == 0 && uint32(pid) >= polymorphicNew>>1 {
+					members = append(members, m)
+					continue
+				}
+				name := otherTypes[uint32(pid)&^polymorphicNew]
+				if id, ok := types[name]; ok {
+					members = append(members, Member{Key: m.Key, Value: NumberNode(float64(id))})
+					continue
+				}
+				types[name] = nextType
+				members = append(members,
+					Member{Key: m.Key, Value: NumberNode(float64(nextType | polymorphicNew))},
+					Member{Key: "polymorphic_name", Value: &Node{Kind: String, Value: name}})
+				nextType++
+			case "ptr_wrapper":
+				m.Value.Set("id", NumberNode(float64(nextPointer|polymorphicNew)))
+				nextPointer++
+				members = append(members, m)
+			default:
+				members = append(members, m)
+			}
+		}
+		value.Members = members
+		return nil
+	}
+
+	intrinsics := map[uint32]uint32{}
+	views, section := d.Root.Field("views"), d.Root.Field("intrinsics")
+	if views == nil || section == nil {
+		return nil, fmt.Errorf("missing views or intrinsics")
+	}
+	for _, e := range other.Root.Field("intrinsics").items() {
+		key, err := e.Field("key").Float()
+		if err != nil {
+			return nil, fmt.Errorf("intrinsic key: %w", err)
+		}
+		if err := retype(e.Field("value")); err != nil {
+			return nil, err
+		}
+		intrinsics[uint32(key)] = nextIntrinsic
+		e.Set("key", NumberNode(float64(nextIntrinsic)))
+		nextIntrinsic++
+		section.Items = append(section.Items, e)
+	}
+
+	var ids []uint32
+	for _, e := range other.Root.Field("views").items() {
+		if err := retype(e.Field("value")); err != nil {
+			return nil, err
+		}
+		data := e.Path("value", "ptr_wrapper", "data")
+		intrinsic, err := data.Field("id_intrinsic").Float()
+		if err != nil {
+			return nil, fmt.Errorf("view intrinsic: %w", err)
+		}
+		if id, ok := intrinsics[uint32(intrinsic)]; ok {
+			data.Set("id_intrinsic", NumberNode(float64(id)))
+		}
+		e.Set("key", NumberNode(float64(nextView)))
+		data.Set("id_view", NumberNode(float64(nextView)))
+		data.Set("id_pose", NumberNode(float64(nextView)))
+		data.Set("local_path", &Node{Kind: String, Value: localPath})
+		ids = append(ids, nextView)
+		nextView++
+		views.Items = append(views.Items, e)
+	}
+	return ids, nil
+}
+
+// polymorphicTypes returns the polymorphic types registered by entries by
+// name and the next free type id
+func polymorphicTypes(sections ...[]*Node) (map[string]uint32, uint32, error) {
+	types := map[string]uint32{}
+	var next uint32 = 1
+	for _, entries := range sections {
+		for _, e := range entries {
+			pid, err := e.Path("value", "polymorphic_id").Float()
+			if err != nil {
+				return nil, 0, fmt.Errorf("polymorphic id: %w", err)
+			}
+			if uint32(pid)&polymorphicNew == 0 {
+				continue
+			}
+			name, _ := e.Path("value", "polymorphic_name").Value.(string)
+			types[name] = uint32(pid) &^ polymorphicNew
+			next = max(next, types[name]+1)
+		}
+	}
+	return types, next, nil
+}
+
+// Decode parses the document into the typed view of the scene
+func (d *Document) Decode() (*SfMData, error) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := encodeNode(w, d.Root, 0); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return Decode(buf.Bytes())
+}
+
+func (n *Node) items() []*Node {
+	if n == nil || n.Kind != Array {
+		return nil
+	}
+	return n.Items
+}
@@ -0,0 +1,222 @@
+package sfmdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// UndefinedID marks a view without a pose or intrinsic
+const UndefinedID = 1<<32 - 1
+
+// polymorphicNew is set on the first polymorphic_id cereal writes for a type,
+// later objects of the same type reference it by the remaining bits
+const polymorphicNew = 1 << 31
+
+// View is an image of the scene
+type View struct {
+	ID          uint32
+	LocalPath   string
+	Filename    string
+	Width       int
+	Height      int
+	IntrinsicID uint32
+	PoseID      uint32
+	// Rig is nil unless the view belongs to a rig
+	Rig *ViewRig
+}
+
+// ViewRig places a view in a rig: the shot of the rig it was taken in and
+// the camera of the rig, its sub-pose, that took it
+type ViewRig struct {
+	Rig     uint32
+	SubPose uint32
+}
+
+// Intrinsic is a camera model. Data keeps every field of the model so that
+// distortion parameters of any model are available.
+type Intrinsic struct {
+	ID             uint32
+	Model          string
+	Width          int
+	Height         int
+	FocalLength    float64
+	PrincipalPoint [2]float64
+	Data           map[string]json.RawMessage
+}
+
+// Pose is a camera pose, Rotation maps world to camera coordinates and Center
+// is the camera position in world coordinates
+type Pose struct {
+	ID       uint32
+	Rotation [3][3]float64
+	Center   [3]float64
+}
+
+// SfMData is the scene description OpenMVG writes as sfm_data.json
+type SfMData struct {
+	Version    string
+	RootPath   string
+	Views      []View
+	Intrinsics []Intrinsic
+	Poses      []Pose
+	// Observations counts the landmarks observed by each view
+	Observations map[uint32]int
+}
+
+type document struct {
+	Version    string  `json:"sfm_data_version"`
+	RootPath   string  `json:"root_path"`
+	Views      []entry `json:"views"`
+	Intrinsics []entry `json:"intrinsics"`
+	Extrinsics []struct {
+		Key   uint32 `json:"key"`
+		Value struct {
+			Rotation [3][3]float64 `json:"rotation"`
+			Center   [3]float64    `json:"center"`
+		} `json:"value"`
+	} `json:"extrinsics"`
+	Structure []struct {
+		Value struct {
+			Observations []struct {
+				Key uint32 `json:"key"`
+			} `json:"observations"`
+		} `json:"value"`
+	} `json:"structure"`
+}
+
+// entry is a key and polymorphic shared pointer as serialised by cereal
+type entry struct {
+	Key   uint32 `json:"key"`
+	Value struct {
+		PolymorphicID   uint32 `json:"polymorphic_id"`
+		PolymorphicName string `json:"polymorphic_name"`
+		PtrWrapper      struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"ptr_wrapper"`
+	} `json:"value"`
+}
+
+// Load reads an sfm_data.json file
+func Load(path string) (*SfMData, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sfm data %s: %w", path, err)
+	}
+
+	sfm, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sfm data %s: %w", path, err)
+	}
+	return sfm, nil
+}
+
+// Decode parses the JSON serialisation of sfm_data
+func Decode(data []byte) (*SfMData, error) {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	sfm := &SfMData{Version: doc.Version, RootPath: doc.RootPath, Observations: map[uint32]int{}}
+
+	for _, e := range doc.Views {
+		var v struct {
+			LocalPath   string  `json:"local_path"`
+			Filename    string  `json:"filename"`
+			Width       int     `json:"width"`
+			Height      int     `json:"height"`
+			IDView      uint32  `json:"id_view"`
+			IDIntrinsic uint32  `json:"id_intrinsic"`
+			IDPose      uint32  `json:"id_pose"`
+			IDRig       *uint32 `json:"id_rig"`
+			IDSubPose   *uint32 `json:"id_sub_pose"`
+		}
+		if err := json.Unmarshal(e.Value.PtrWrapper.Data, &v); err != nil {
+			return nil, fmt.Errorf("view %d: %w", e.Key, err)
+		}
+		var rig *ViewRig
+		if v.IDRig != nil && v.IDSubPose != nil {
+			rig = &ViewRig{Rig: *v.IDRig, SubPose: *v.IDSubPose}
+		}
+		sfm.Views = append(sfm.Views, View{
+			ID:          v.IDView,
+			LocalPath:   v.LocalPath,
+			Filename:    v.Filename,
+			Width:       v.Width,
+			Height:      v.Height,
+			IntrinsicID: v.IDIntrinsic,
+			PoseID:      v.IDPose,
+			Rig:         rig,
+		})
+	}
+
+	names := map[uint32]string{}
+	for _, e := range doc.Intrinsics {
+		model := e.Value.PolymorphicName
+		if e.Value.PolymorphicID&polymorphicNew != 0 {
+			names[e.Value.PolymorphicID&^polymorphicNew] = model
+		} else if model == "" {
+			model = names[e.Value.PolymorphicID]
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(e.Value.PtrWrapper.Data, &fields); err != nil {
+			return nil, fmt.Errorf("intrinsic %d: %w", e.Key, err)
+		}
+		var common struct {
+			Width          int        `json:"width"`
+			Height         int        `json:"height"`
+			FocalLength    float64    `json:"focal_length"`
+			PrincipalPoint [2]float64 `json:"principal_point"`
+		}
+		if err := json.Unmarshal(e.Value.PtrWrapper.Data, &common); err != nil {
+			return nil, fmt.Errorf("intrinsic %d: %w", e.Key, err)
+		}
+
+		sfm.Intrinsics = append(sfm.Intrinsics, Intrinsic{
+			ID:             e.Key,
+			Model:          model,
+			Width:          common.Width,
+			Height:         common.Height,
+			FocalLength:    common.FocalLength,
+			PrincipalPoint: common.PrincipalPoint,
+			Data:           fields,
+		})
+	}
+
+	for _, e := range doc.Extrinsics {
+		sfm.Poses = append(sfm.Poses, Pose{ID: e.Key, Rotation: e.Value.Rotation, Center: e.Value.Center})
+	}
+
+	for _, landmark := range doc.Structure {
+		for _, o := range landmark.Value.Observations {
+			sfm.Observations[o.Key]++
+		}
+	}
+
+	sort.Slice(sfm.Views, func(i, j int) bool { return sfm.Views[i].ID < sfm.Views[j].ID })
+	sort.Slice(sfm.Poses, func(i, j int) bool { return sfm.Poses[i].ID < sfm.Poses[j].ID })
+
+	return sfm, nil
+}
+
+// Pose returns the pose with the given id or nil
+func (s *SfMData) Pose(id uint32) *Pose {
+	for i := range s.Poses {
+		if s.Poses[i].ID == id {
+			return &s.Poses[i]
+		}
+	}
+	return nil
+}
+
+// CameraCenters returns the position of every reconstructed camera
+func (s *SfMData) CameraCenters() [][3]float64 {
+	centers := make([][3]float64, 0, len(s.Poses))
+	for _, p := range s.Poses {
+		centers = append(centers, p.Center)
+	}
+	return centers
+}
@@ -0,0 +1,292 @@
+package sfmdata_test
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/sfmdata"
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+)
+
+func TestLoad(t *testing.T) {
+	sfm, err := sfmdata.Load("testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sfm.Version != "0.3" || sfm.RootPath != "/data/images" {
+		t.Errorf("unexpected header %q %q", sfm.Version, sfm.RootPath)
+	}
+
+	if len(sfm.Views) != 3 {
+		t.Fatalf("expected 3 views, got %d", len(sfm.Views))
+	}
+	if v := sfm.Views[2]; v.Filename != "IMG_0003.JPG" || v.IntrinsicID != 1 || v.PoseID != sfmdata.UndefinedID {
+		t.Errorf("unexpected view %+v", v)
+	}
+
+	if len(sfm.Intrinsics) != 2 {
+		t.Fatalf("expected 2 intrinsics, got %d", len(sfm.Intrinsics))
+	}
+	// The second intrinsic references the polymorphic type of the first
+	for _, in := range sfm.Intrinsics {
+		if in.Model != "pinhole_radial_k3" {
+			t.Errorf("intrinsic %d: expected pinhole_radial_k3, got %q", in.ID, in.Model)
+		}
+	}
+	if in := sfm.Intrinsics[0]; in.FocalLength != 3200.5 || in.PrincipalPoint != [2]float64{2000, 1500} || in.Data["disto_k3"] == nil {
+		t.Errorf("unexpected intrinsic %+v", in)
+	}
+
+	centers := sfm.CameraCenters()
+	if len(centers) != 2 || centers[1] != [3]float64{2, -0.5, 3} {
+		t.Errorf("unexpected camera centers %v", centers)
+	}
+	if p := sfm.Pose(1); p == nil || p.Rotation[0][2] != -1 {
+		t.Errorf("unexpected pose %+v", p)
+	}
+	if sfm.Pose(sfmdata.UndefinedID) != nil {
+		t.Errorf("expected no pose for an undefined id")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	if _, err := sfmdata.Load("testdata/missing.json"); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+	if _, err := sfmdata.Decode([]byte(`{"views": [{"key": 0, "value": {"ptr_wrapper": {"data": 5}}}]}`)); err == nil {
+		t.Errorf("expected error for a malformed view")
+	}
+}
+
+func TestDocument_Transform(t *testing.T) {
+	doc, err := sfmdata.ReadDocument("testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := doc.Transform(transform.Scaling(2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sfm_data.json")
+	if err := doc.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sfm, err := sfmdata.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load transformed document: %v", err)
+	}
+	if c := sfm.CameraCenters(); c[0] != [3]float64{-4, 1, 2} || c[1] != [3]float64{4, -1, 6} {
+		t.Errorf("expected scaled camera centers, got %v", c)
+	}
+	if sfm.Intrinsics[1].Model != "pinhole_radial_k3" || sfm.Views[0].Filename != "IMG_0001.JPG" {
+		t.Errorf("expected untouched fields to survive, got %+v", sfm.Intrinsics[1])
+	}
+
+	// Members keep their order, cereal relies on it for polymorphic pointers
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read document: %v", err)
+	}
+	if i, j := bytes.Index(data, []byte(`"polymorphic_id"`)), bytes.Index(data, []byte(`"ptr_wrapper"`)); i < 0 || i > j {
+		t.Errorf("expected polymorphic_id before ptr_wrapper")
+	}
+}
+
+func TestUndistort(t *testing.T) {
+	sfm, err := sfmdata.Load("testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	in := sfm.Intrinsic(0)
+
+	// Distort a known point with k1=0.01, k2=-0.002 and check it is recovered
+	x, y := 0.3, -0.2
+	r2 := x*x + y*y
+	f := 1 + 0.01*r2 - 0.002*r2*r2
+	u := x*f*in.FocalLength + in.PrincipalPoint[0]
+	v := y*f*in.FocalLength + in.PrincipalPoint[1]
+
+	gx, gy, err := in.Undistort(u, v)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(gx-x) > 1e-9 || math.Abs(gy-y) > 1e-9 {
+		t.Errorf("expected (%g, %g), got (%g, %g)", x, y, gx, gy)
+	}
+
+	unknown := sfmdata.Intrinsic{FocalLength: 1, Model: "spherical"}
+	if _, _, err := unknown.Undistort(0, 0); err == nil {
+		t.Errorf("expected unsupported model error")
+	}
+}
+
+func TestDocument_SetControlPoints(t *testing.T) {
+	doc, err := sfmdata.ReadDocument("testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doc.SetControlPoints([]sfmdata.ControlPoint{{
+		ID:           7,
+		Position:     [3]float64{1, 2, 3},
+		Observations: []sfmdata.ControlObservation{{ViewID: 1, X: 10.5, Y: 20}},
+	}})
+
+	path := filepath.Join(t.TempDir(), "sfm_data.json")
+	if err := doc.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	doc, err = sfmdata.ReadDocument(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	points := doc.Root.Field("control_points")
+	if points == nil || len(points.Items) != 1 {
+		t.Fatalf("expected 1 control point, got %+v", points)
+	}
+	if x, err := points.Items[0].Path("value", "X").Vec3(); err != nil || x != [3]float64{1, 2, 3} {
+		t.Errorf("unexpected position %v: %v", x, err)
+	}
+	obs := points.Items[0].Path("value", "observations")
+	if view, _ := obs.Items[0].Field("key").Float(); view != 1 {
+		t.Errorf("expected an observation of view 1, got %v", view)
+	}
+	if u, _ := obs.Items[0].Path("value", "x").Items[0].Float(); u != 10.5 {
+		t.Errorf("expected x 10.5, got %v", u)
+	}
+}
+
+func TestDocument_RemoveUnusedIntrinsics(t *testing.T) {
+	doc, err := sfmdata.ReadDocument("testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Move every view onto the second intrinsic, which refers to the type
+	// declared by the first
+	if err := doc.SetViewIntrinsics(map[uint32]uint32{0: 1, 1: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := doc.RemoveUnusedIntrinsics(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sfm_data.json")
+	if err := doc.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sfm, err := sfmdata.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sfm.Intrinsics) != 1 || sfm.Intrinsics[0].ID != 1 || sfm.Intrinsics[0].Model != "pinhole_radial_k3" {
+		t.Fatalf("expected only intrinsic 1 with its type declared, got %+v", sfm.Intrinsics)
+	}
+	for _, v := range sfm.Views {
+		if v.IntrinsicID != 1 {
+			t.Errorf("view %d: expected intrinsic 1, got %d", v.ID, v.IntrinsicID)
+		}
+	}
+}
+
+func TestDocument_AppendViews(t *testing.T) {
+	doc, err := sfmdata.ReadDocument("testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listing, err := sfmdata.ReadDocument("testdata/listing.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids, err := doc.AppendViews(listing, "../new/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("expected the new view to be 3, got %v", ids)
+	}
+
+	path := filepath.Join(t.TempDir(), "sfm_data.json")
+	if err := doc.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sfm, err := sfmdata.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v := sfm.Views[3]
+	if v.ID != 3 || v.PoseID != 3 || v.IntrinsicID != 2 || v.LocalPath != "../new/" || v.Filename != "IMG_0101.JPG" {
+		t.Errorf("unexpected appended view %+v", v)
+	}
+	if in := sfm.Intrinsic(2); in == nil || in.Model != "pinhole" || in.FocalLength != 3000 {
+		t.Errorf("expected the appended pinhole intrinsic, got %+v", in)
+	}
+	if in := sfm.Intrinsic(1); in == nil || in.Model != "pinhole_radial_k3" {
+		t.Errorf("expected intrinsic 1 to keep its type, got %+v", in)
+	}
+
+	// Both new types are declared after the type of the document and every
+	// shared pointer stays unique
+	out, err := sfmdata.ReadDocument(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	view := out.Root.Field("views").Items[3].Field("value")
+	intrinsic := out.Root.Field("intrinsics").Items[2].Field("value")
+	for _, c := range []struct {
+		value *sfmdata.Node
+		id    float64
+		name  string
+	}{{view, 1<<31 | 3, "view_priors"}, {intrinsic, 1<<31 | 2, "pinhole"}} {
+		if id, _ := c.value.Field("polymorphic_id").Float(); id != c.id || c.value.Field("polymorphic_name").Value != c.name {
+			t.Errorf("expected %s declared as %v, got %v", c.name, c.id, id)
+		}
+	}
+	pointers := map[float64]bool{}
+	for _, section := range []string{"views", "intrinsics"} {
+		for _, e := range out.Root.Field(section).Items {
+			id, _ := e.Path("value", "ptr_wrapper", "id").Float()
+			if pointers[id] {
+				t.Errorf("pointer id %v used twice", id)
+			}
+			pointers[id] = true
+		}
+	}
+}
+
+func TestDocument_SetViewRigs(t *testing.T) {
+	doc, err := sfmdata.ReadDocument("testdata/sfm_data.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := doc.SetViewRigs(map[uint32]sfmdata.ViewRig{0: {Rig: 0, SubPose: 0}, 1: {Rig: 0, SubPose: 1}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sfm_data.json")
+	if err := doc.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sfm, err := sfmdata.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, want := range []*sfmdata.ViewRig{{Rig: 0, SubPose: 0}, {Rig: 0, SubPose: 1}, nil} {
+		v := sfm.Views[i]
+		if (v.Rig == nil) != (want == nil) || (want != nil && *v.Rig != *want) {
+			t.Errorf("view %d: expected rig %+v, got %+v", v.ID, want, v.Rig)
+		}
+	}
+}
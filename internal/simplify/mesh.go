@@ -0,0 +1,304 @@
+package simplify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/obj"
+	"github.com/2024-dissertation/openmvgo/internal/ply"
+)
+
+// Triangle references three positions and, for textured meshes, the texture
+// coordinate of each corner. UV is -1 for corners without a coordinate.
+type Triangle struct {
+	V        [3]int
+	UV       [3]int
+	Material int
+}
+
+// Mesh is a triangle mesh whose corners index positions and texture
+// coordinates separately, so texture seams share positions
+type Mesh struct {
+	Positions [][3]float64
+	UVs       [][2]float64
+	Faces     []Triangle
+	// Materials are the material names used by the faces, indexed by Triangle.Material
+	Materials []string
+	// MaterialLibs are the mtllib references of an OBJ source
+	MaterialLibs []string
+	// TextureFiles are the TextureFile comments of a PLY source
+	TextureFiles []string
+}
+
+// Load reads an OBJ or PLY mesh, triangulating polygons
+func Load(path string) (*Mesh, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".obj":
+		return loadOBJ(path)
+	case ".ply":
+		return loadPLY(path)
+	default:
+		return nil, fmt.Errorf("unsupported mesh format %s", path)
+	}
+}
+
+// Write saves the mesh as OBJ or PLY depending on the extension of path. OBJ
+// files keep the material libraries of the source, PLY files keep its
+// texture files.
+func Write(path string, m *Mesh) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".obj":
+		return writeOBJ(path, m)
+	case ".ply":
+		return writePLY(path, m)
+	default:
+		return fmt.Errorf("unsupported mesh format %s", path)
+	}
+}
+
+func loadOBJ(path string) (*Mesh, error) {
+	model, err := obj.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Mesh{
+		Positions:    model.Positions,
+		UVs:          model.TexCoords,
+		MaterialLibs: model.MaterialLibs,
+	}
+
+	materials := map[string]int{}
+	for i, face := range model.Faces {
+		mat, ok := materials[face.Material]
+		if !ok {
+			mat = len(m.Materials)
+			materials[face.Material] = mat
+			m.Materials = append(m.Materials, face.Material)
+		}
+
+		for _, fv := range face.Vertices {
+			if fv.Position < 0 || fv.Position >= len(m.Positions) || fv.TexCoord >= len(m.UVs) {
+				return nil, fmt.Errorf("%s: face %d references missing vertex data", path, i+1)
+			}
+		}
+
+		for j := 1; j+1 < len(face.Vertices); j++ {
+			a, b, c := face.Vertices[0], face.Vertices[j], face.Vertices[j+1]
+			m.Faces = append(m.Faces, Triangle{
+				V:        [3]int{a.Position, b.Position, c.Position},
+				UV:       [3]int{a.TexCoord, b.TexCoord, c.TexCoord},
+				Material: mat,
+			})
+		}
+	}
+
+	return m, nil
+}
+
+func loadPLY(path string) (*Mesh, error) {
+	file, err := ply.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := file.Positions()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	m := &Mesh{Positions: positions, TextureFiles: file.TextureFiles()}
+	texcoords := file.FaceTexCoords()
+	texnumbers := file.FaceTextures()
+
+	for i, face := range file.Faces() {
+		for _, v := range face {
+			if v < 0 || v >= len(positions) {
+				return nil, fmt.Errorf("%s: face %d references missing vertex %d", path, i, v)
+			}
+		}
+
+		mat := 0
+		if texnumbers != nil {
+			mat = texnumbers[i]
+		}
+
+		// PLY stores texture coordinates per face corner, give each its own UV
+		uvs := make([]int, len(face))
+		for c := range face {
+			uvs[c] = -1
+			if texcoords != nil && len(texcoords[i]) >= 2*len(face) {
+				uvs[c] = len(m.UVs)
+				m.UVs = append(m.UVs, [2]float64{texcoords[i][2*c], texcoords[i][2*c+1]})
+			}
+		}
+
+		for j := 1; j+1 < len(face); j++ {
+			m.Faces = append(m.Faces, Triangle{
+				V:        [3]int{face[0], face[j], face[j+1]},
+				UV:       [3]int{uvs[0], uvs[j], uvs[j+1]},
+				Material: mat,
+			})
+		}
+	}
+
+	if len(m.UVs) > 0 {
+		m.weldUVs()
+	}
+
+	return m, nil
+}
+
+// weldUVs merges identical texture coordinates so that faces sharing a
+// position and coordinate are recognised as the same texture chart
+func (m *Mesh) weldUVs() {
+	index := map[[2]float64]int{}
+	var uvs [][2]float64
+	for f := range m.Faces {
+		for c, uv := range m.Faces[f].UV {
+			if uv < 0 {
+				continue
+			}
+			idx, ok := index[m.UVs[uv]]
+			if !ok {
+				idx = len(uvs)
+				index[m.UVs[uv]] = idx
+				uvs = append(uvs, m.UVs[uv])
+			}
+			m.Faces[f].UV[c] = idx
+		}
+	}
+	m.UVs = uvs
+}
+
+// compact drops positions and texture coordinates no face references
+func (m *Mesh) compact() *Mesh {
+	out := &Mesh{
+		Materials:    m.Materials,
+		MaterialLibs: m.MaterialLibs,
+		TextureFiles: m.TextureFiles,
+		Faces:        make([]Triangle, 0, len(m.Faces)),
+	}
+
+	posMap := map[int]int{}
+	uvMap := map[int]int{}
+	for _, f := range m.Faces {
+		t := f
+		for c := 0; c < 3; c++ {
+			p, ok := posMap[f.V[c]]
+			if !ok {
+				p = len(out.Positions)
+				posMap[f.V[c]] = p
+				out.Positions = append(out.Positions, m.Positions[f.V[c]])
+			}
+			t.V[c] = p
+
+			if f.UV[c] >= 0 {
+				u, ok := uvMap[f.UV[c]]
+				if !ok {
+					u = len(out.UVs)
+					uvMap[f.UV[c]] = u
+					out.UVs = append(out.UVs, m.UVs[f.UV[c]])
+				}
+				t.UV[c] = u
+			}
+		}
+		out.Faces = append(out.Faces, t)
+	}
+
+	return out
+}
+
+func writeOBJ(path string, m *Mesh) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create obj file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	if len(m.MaterialLibs) > 0 {
+		fmt.Fprintf(w, "mtllib %s\n", strings.Join(m.MaterialLibs, " "))
+	}
+	for _, p := range m.Positions {
+		fmt.Fprintf(w, "v %g %g %g\n", p[0], p[1], p[2])
+	}
+	for _, uv := range m.UVs {
+		fmt.Fprintf(w, "vt %g %g\n", uv[0], uv[1])
+	}
+
+	current := -1
+	for _, t := range m.Faces {
+		if t.Material != current && t.Material < len(m.Materials) && m.Materials[t.Material] != "" {
+			fmt.Fprintf(w, "usemtl %s\n", m.Materials[t.Material])
+		}
+		current = t.Material
+
+		w.WriteString("f")
+		for c := 0; c < 3; c++ {
+			if t.UV[c] >= 0 {
+				fmt.Fprintf(w, " %d/%d", t.V[c]+1, t.UV[c]+1)
+			} else {
+				fmt.Fprintf(w, " %d", t.V[c]+1)
+			}
+		}
+		w.WriteString("\n")
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write obj file %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func writePLY(path string, m *Mesh) error {
+	file := &ply.File{Format: ply.BinaryLittleEndian}
+	for _, tex := range m.TextureFiles {
+		file.Comments = append(file.Comments, "TextureFile "+tex)
+	}
+
+	vertex := file.AddElement("vertex", len(m.Positions))
+	for axis, name := range []string{"x", "y", "z"} {
+		values := make([]float64, len(m.Positions))
+		for i, p := range m.Positions {
+			values[i] = p[axis]
+		}
+		vertex.AddProperty(name, "float", values)
+	}
+
+	face := file.AddElement("face", len(m.Faces))
+	indices := make([][]float64, len(m.Faces))
+	for i, t := range m.Faces {
+		indices[i] = []float64{float64(t.V[0]), float64(t.V[1]), float64(t.V[2])}
+	}
+	face.AddListProperty("vertex_indices", "uchar", "int", indices)
+
+	if len(m.UVs) > 0 {
+		texcoords := make([][]float64, len(m.Faces))
+		for i, t := range m.Faces {
+			list := make([]float64, 0, 6)
+			for _, uv := range t.UV {
+				if uv < 0 {
+					list = append(list, 0, 0)
+					continue
+				}
+				list = append(list, m.UVs[uv][0], m.UVs[uv][1])
+			}
+			texcoords[i] = list
+		}
+		face.AddListProperty("texcoord", "uchar", "float", texcoords)
+	}
+
+	if len(m.TextureFiles) > 1 {
+		texnumbers := make([]float64, len(m.Faces))
+		for i, t := range m.Faces {
+			texnumbers[i] = float64(t.Material)
+		}
+		face.AddProperty("texnumber", "int", texnumbers)
+	}
+
+	return ply.Write(path, file)
+}
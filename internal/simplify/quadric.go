@@ -0,0 +1,63 @@
+package simplify
+
+import "math"
+
+// quadric is the symmetric 4x4 error matrix of Garland and Heckbert, stored
+// as its upper triangle
+type quadric [10]float64
+
+// planeQuadric returns the quadric of the plane through p with unit normal n,
+// scaled by weight
+func planeQuadric(n, p [3]float64, weight float64) quadric {
+	a, b, c := n[0], n[1], n[2]
+	d := -(a*p[0] + b*p[1] + c*p[2])
+	return quadric{
+		a * a * weight, a * b * weight, a * c * weight, a * d * weight,
+		b * b * weight, b * c * weight, b * d * weight,
+		c * c * weight, c * d * weight,
+		d * d * weight,
+	}
+}
+
+func (q *quadric) add(o quadric) {
+	for i := range q {
+		q[i] += o[i]
+	}
+}
+
+// eval returns the squared distance error of placing a vertex at p
+func (q quadric) eval(p [3]float64) float64 {
+	x, y, z := p[0], p[1], p[2]
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func length(a [3]float64) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+func normalize(a [3]float64) ([3]float64, float64) {
+	l := length(a)
+	if l == 0 {
+		return a, 0
+	}
+	return [3]float64{a[0] / l, a[1] / l, a[2] / l}, l
+}
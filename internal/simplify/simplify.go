@@ -0,0 +1,415 @@
+package simplify
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// boundaryWeight scales the constraint planes that keep open boundaries in place
+const boundaryWeight = 1000
+
+// cornerDot pins boundary vertices where the boundary turns by more than ~25 degrees
+const cornerDot = 0.9
+
+// minNormalDot rejects collapses that rotate a surviving face by more than ~80 degrees
+const minNormalDot = 0.2
+
+// Target is a level of detail expressed as an absolute face count or as a
+// ratio of the source face count
+type Target struct {
+	Faces int
+	Ratio float64
+}
+
+// Resolve returns the face count of the target for a mesh of total faces
+func (t Target) Resolve(total int) int {
+	if t.Ratio > 0 {
+		return int(math.Round(float64(total) * t.Ratio))
+	}
+	return t.Faces
+}
+
+func (t Target) String() string {
+	if t.Ratio > 0 {
+		return strconv.FormatFloat(t.Ratio, 'g', -1, 64)
+	}
+	return strconv.Itoa(t.Faces)
+}
+
+// ParseTargets parses a comma separated list such as "100000,20000,5000" or
+// "0.5,0.1". Values below one are ratios, anything else is a face count.
+func ParseTargets(s string) ([]Target, error) {
+	var targets []Target
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid level of detail %q", part)
+		}
+
+		if v < 1 {
+			targets = append(targets, Target{Ratio: v})
+			continue
+		}
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("invalid level of detail %q, face counts must be whole numbers", part)
+		}
+		targets = append(targets, Target{Faces: int(v)})
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no levels of detail in %q", s)
+	}
+	return targets, nil
+}
+
+// Simplify reduces m to at most target faces using quadric error metrics.
+// Vertices are collapsed onto one of their neighbours, so texture coordinates
+// are carried over unchanged. Collapses that would tear a texture seam, move
+// an open boundary, flip a face or make the mesh non manifold are rejected,
+// so the result may keep more faces than requested.
+func Simplify(m *Mesh, target int) *Mesh {
+	s := newSimplifier(m)
+	s.run(target)
+	return s.snapshot()
+}
+
+// LODs simplifies m progressively to each target, largest first, returning
+// one mesh per target in the order given
+func LODs(m *Mesh, targets []Target) []*Mesh {
+	order := make([]int, len(targets))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return targets[b].Resolve(len(m.Faces)) - targets[a].Resolve(len(m.Faces))
+	})
+
+	s := newSimplifier(m)
+	out := make([]*Mesh, len(targets))
+	for _, i := range order {
+		s.run(targets[i].Resolve(len(m.Faces)))
+		out[i] = s.snapshot()
+	}
+	return out
+}
+
+type candidate struct {
+	cost       float64
+	from, to   int
+	verF, verT int
+}
+
+type queue []candidate
+
+func (q queue) Len() int           { return len(q) }
+func (q queue) Less(i, j int) bool { return q[i].cost < q[j].cost }
+func (q queue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x any)        { *q = append(*q, x.(candidate)) }
+func (q *queue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+type simplifier struct {
+	mesh     *Mesh
+	removed  []bool
+	vfaces   [][]int
+	quadrics []quadric
+	version  []int
+	dead     []bool
+	boundary []bool
+	pinned   []bool
+	live     int
+	queue    queue
+}
+
+func newSimplifier(m *Mesh) *simplifier {
+	s := &simplifier{
+		mesh: &Mesh{
+			Positions:    m.Positions,
+			UVs:          m.UVs,
+			Faces:        slices.Clone(m.Faces),
+			Materials:    m.Materials,
+			MaterialLibs: m.MaterialLibs,
+			TextureFiles: m.TextureFiles,
+		},
+		removed:  make([]bool, len(m.Faces)),
+		vfaces:   make([][]int, len(m.Positions)),
+		quadrics: make([]quadric, len(m.Positions)),
+		version:  make([]int, len(m.Positions)),
+		dead:     make([]bool, len(m.Positions)),
+		boundary: make([]bool, len(m.Positions)),
+		pinned:   make([]bool, len(m.Positions)),
+		live:     len(m.Faces),
+	}
+
+	edgeFaces := map[[2]int][]int{}
+	for f, t := range s.mesh.Faces {
+		for c := 0; c < 3; c++ {
+			s.vfaces[t.V[c]] = append(s.vfaces[t.V[c]], f)
+			edgeFaces[edgeKey(t.V[c], t.V[(c+1)%3])] = append(edgeFaces[edgeKey(t.V[c], t.V[(c+1)%3])], f)
+		}
+
+		n, area := s.faceNormal(t)
+		if area == 0 {
+			continue
+		}
+		q := planeQuadric(n, m.Positions[t.V[0]], area)
+		for _, v := range t.V {
+			s.quadrics[v].add(q)
+		}
+	}
+
+	// Constrain open boundaries with planes perpendicular to their face
+	boundaryEdges := map[int][][3]float64{}
+	for e, faces := range edgeFaces {
+		if len(faces) != 1 {
+			continue
+		}
+		s.boundary[e[0]], s.boundary[e[1]] = true, true
+		dir, _ := normalize(sub(m.Positions[e[1]], m.Positions[e[0]]))
+		boundaryEdges[e[0]] = append(boundaryEdges[e[0]], dir)
+		boundaryEdges[e[1]] = append(boundaryEdges[e[1]], dir)
+
+		n, area := s.faceNormal(s.mesh.Faces[faces[0]])
+		if area == 0 {
+			continue
+		}
+		edge := sub(m.Positions[e[1]], m.Positions[e[0]])
+		perp, l := normalize(cross(edge, n))
+		if l == 0 {
+			continue
+		}
+		q := planeQuadric(perp, m.Positions[e[0]], boundaryWeight*dot(edge, edge))
+		s.quadrics[e[0]].add(q)
+		s.quadrics[e[1]].add(q)
+	}
+
+	// Only vertices on a straight run of boundary may slide along it, corners
+	// and vertices where several boundary loops meet stay in place
+	for v, dirs := range boundaryEdges {
+		s.pinned[v] = len(dirs) != 2 || math.Abs(dot(dirs[0], dirs[1])) < cornerDot
+	}
+
+	for e := range edgeFaces {
+		s.push(e[0], e[1])
+	}
+
+	return s
+}
+
+func edgeKey(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
+
+// faceNormal returns the unit normal and area of t at current positions
+func (s *simplifier) faceNormal(t Triangle) ([3]float64, float64) {
+	p := s.mesh.Positions
+	n, l := normalize(cross(sub(p[t.V[1]], p[t.V[0]]), sub(p[t.V[2]], p[t.V[0]])))
+	return n, l / 2
+}
+
+// push queues the cheaper direction of collapsing edge a-b
+func (s *simplifier) push(a, b int) {
+	q := s.quadrics[a]
+	q.add(s.quadrics[b])
+
+	// Collapsing a onto b keeps b's position and vice versa
+	from, to := a, b
+	cost := q.eval(s.mesh.Positions[b])
+	if alt := q.eval(s.mesh.Positions[a]); alt < cost {
+		from, to, cost = b, a, alt
+	}
+
+	heap.Push(&s.queue, candidate{
+		cost: cost, from: from, to: to,
+		verF: s.version[from], verT: s.version[to],
+	})
+}
+
+func (s *simplifier) run(target int) {
+	for s.live > target && s.queue.Len() > 0 {
+		c := heap.Pop(&s.queue).(candidate)
+		if s.dead[c.from] || s.dead[c.to] || s.version[c.from] != c.verF || s.version[c.to] != c.verT {
+			continue
+		}
+
+		uvs, ok := s.check(c.from, c.to)
+		if !ok {
+			// Try the opposite direction, which may not tear a seam
+			if uvs, ok = s.check(c.to, c.from); !ok {
+				continue
+			}
+			c.from, c.to = c.to, c.from
+		}
+
+		s.collapse(c.from, c.to, uvs)
+	}
+}
+
+// check reports whether vertex v can be collapsed onto u. On success it
+// returns the texture coordinate each surviving face of v must use for u.
+func (s *simplifier) check(v, u int) (map[int]int, bool) {
+	var shared, moving []int
+	for _, f := range s.vfaces[v] {
+		if s.removed[f] {
+			continue
+		}
+		if slices.Contains(s.mesh.Faces[f].V[:], u) {
+			shared = append(shared, f)
+		} else {
+			moving = append(moving, f)
+		}
+	}
+	if len(shared) == 0 {
+		return nil, false
+	}
+
+	// Boundary vertices may only slide along the boundary
+	if s.pinned[v] || (s.boundary[v] && len(shared) != 1) {
+		return nil, false
+	}
+
+	// Link condition: the vertices adjacent to both ends must be exactly the
+	// apexes of the faces sharing the edge, otherwise the mesh pinches
+	if len(s.commonNeighbours(v, u)) != len(shared) {
+		return nil, false
+	}
+
+	// Every texture chart v belongs to must also contain u, otherwise the
+	// collapse would drag a chart across a seam
+	uvs := map[int]int{}
+	for _, f := range moving {
+		wedge := s.corner(f, v).uv
+		if _, ok := uvs[wedge]; ok {
+			continue
+		}
+		found := false
+		for _, g := range shared {
+			if s.corner(g, v).uv == wedge {
+				uvs[wedge] = s.corner(g, u).uv
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	// Reject collapses that fold a surviving face over
+	for _, f := range moving {
+		before, area := s.faceNormal(s.mesh.Faces[f])
+		t := s.mesh.Faces[f]
+		t.V[s.corner(f, v).index] = u
+		after, newArea := s.faceNormal(t)
+		if newArea == 0 || (area > 0 && dot(before, after) < minNormalDot) {
+			return nil, false
+		}
+	}
+
+	return uvs, true
+}
+
+type corner struct {
+	index int
+	uv    int
+}
+
+func (s *simplifier) corner(f, v int) corner {
+	t := s.mesh.Faces[f]
+	for c := 0; c < 3; c++ {
+		if t.V[c] == v {
+			return corner{index: c, uv: t.UV[c]}
+		}
+	}
+	return corner{index: -1, uv: -1}
+}
+
+func (s *simplifier) neighbours(v int) map[int]bool {
+	out := map[int]bool{}
+	for _, f := range s.vfaces[v] {
+		if s.removed[f] {
+			continue
+		}
+		for _, w := range s.mesh.Faces[f].V {
+			if w != v {
+				out[w] = true
+			}
+		}
+	}
+	return out
+}
+
+func (s *simplifier) commonNeighbours(a, b int) []int {
+	na := s.neighbours(a)
+	var out []int
+	for w := range s.neighbours(b) {
+		if na[w] && w != a {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func (s *simplifier) collapse(v, u int, uvs map[int]int) {
+	var faces []int
+	for _, f := range s.vfaces[u] {
+		if !s.removed[f] {
+			faces = append(faces, f)
+		}
+	}
+
+	for _, f := range s.vfaces[v] {
+		if s.removed[f] {
+			continue
+		}
+		t := &s.mesh.Faces[f]
+		if slices.Contains(t.V[:], u) {
+			s.removed[f] = true
+			s.live--
+			continue
+		}
+		c := s.corner(f, v)
+		t.V[c.index] = u
+		t.UV[c.index] = uvs[c.uv]
+		faces = append(faces, f)
+	}
+
+	// Drop faces removed by this collapse from u's list
+	s.vfaces[u] = slices.DeleteFunc(faces, func(f int) bool { return s.removed[f] })
+	s.vfaces[v] = nil
+	s.dead[v] = true
+	s.quadrics[u].add(s.quadrics[v])
+	s.version[u]++
+
+	for w := range s.neighbours(u) {
+		s.push(u, w)
+	}
+}
+
+// snapshot returns the live faces as a compact mesh
+func (s *simplifier) snapshot() *Mesh {
+	out := *s.mesh
+	out.Faces = make([]Triangle, 0, s.live)
+	for f, t := range s.mesh.Faces {
+		if !s.removed[f] {
+			out.Faces = append(out.Faces, t)
+		}
+	}
+	return out.compact()
+}
@@ -0,0 +1,153 @@
+package simplify_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/simplify"
+)
+
+// grid returns an n by n quad grid in the z=0 plane split into two texture
+// charts down the middle column, so the seam shares positions but not UVs
+func grid(n int) *simplify.Mesh {
+	m := &simplify.Mesh{Materials: []string{"material_00"}}
+	idx := func(x, y int) int { return y*(n+1) + x }
+
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			m.Positions = append(m.Positions, [3]float64{float64(x), float64(y), 0})
+		}
+	}
+
+	// Chart 0 covers x <= n/2 and chart 1 covers x >= n/2, packed into the
+	// lower and upper half of the texture
+	uv := map[[3]int]int{}
+	uvFor := func(x, y, chart int) int {
+		k := [3]int{x, y, chart}
+		if i, ok := uv[k]; ok {
+			return i
+		}
+		uv[k] = len(m.UVs)
+		m.UVs = append(m.UVs, [2]float64{float64(x) / float64(n), float64(y)/float64(n)*0.4 + float64(chart)/2})
+		return uv[k]
+	}
+
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			chart := 0
+			if x >= n/2 {
+				chart = 1
+			}
+			a, b, c, d := idx(x, y), idx(x+1, y), idx(x+1, y+1), idx(x, y+1)
+			ua, ub, uc, ud := uvFor(x, y, chart), uvFor(x+1, y, chart), uvFor(x+1, y+1, chart), uvFor(x, y+1, chart)
+			m.Faces = append(m.Faces,
+				simplify.Triangle{V: [3]int{a, b, c}, UV: [3]int{ua, ub, uc}},
+				simplify.Triangle{V: [3]int{a, c, d}, UV: [3]int{ua, uc, ud}},
+			)
+		}
+	}
+
+	return m
+}
+
+func TestSimplify(t *testing.T) {
+	src := grid(16)
+
+	out := simplify.Simplify(src, 100)
+
+	if len(out.Faces) > 100 {
+		t.Errorf("expected at most 100 faces, got %d", len(out.Faces))
+	}
+	if len(out.Faces) < 10 {
+		t.Errorf("expected the seam and boundary to limit simplification, got %d faces", len(out.Faces))
+	}
+
+	// The corners of the open boundary must survive
+	corners := map[[3]float64]bool{{0, 0, 0}: false, {16, 0, 0}: false, {0, 16, 0}: false, {16, 16, 0}: false}
+	for _, p := range out.Positions {
+		if _, ok := corners[p]; ok {
+			corners[p] = true
+		}
+		if p[2] != 0 {
+			t.Errorf("vertex %v left the plane", p)
+		}
+	}
+	for p, found := range corners {
+		if !found {
+			t.Errorf("boundary corner %v was removed", p)
+		}
+	}
+
+	// No face may mix the two texture charts
+	for i, f := range out.Faces {
+		charts := map[bool]bool{}
+		for _, uv := range f.UV {
+			if uv < 0 || uv >= len(out.UVs) {
+				t.Fatalf("face %d has invalid uv %d", i, uv)
+			}
+			charts[out.UVs[uv][1] >= 0.5] = true
+		}
+		if len(charts) != 1 {
+			t.Errorf("face %d spans a texture seam", i)
+		}
+	}
+}
+
+func TestLODs(t *testing.T) {
+	src := grid(16)
+
+	targets, err := simplify.ParseTargets("0.5, 200")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lods := simplify.LODs(src, targets)
+	if len(lods) != 2 {
+		t.Fatalf("expected 2 levels, got %d", len(lods))
+	}
+
+	if len(lods[0].Faces) > 256 || len(lods[1].Faces) > 200 || len(lods[1].Faces) > len(lods[0].Faces) {
+		t.Errorf("unexpected face counts %d and %d", len(lods[0].Faces), len(lods[1].Faces))
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	targets, err := simplify.ParseTargets("100000,20000,0.05")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []simplify.Target{{Faces: 100000}, {Faces: 20000}, {Ratio: 0.05}}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("expected %v, got %v", want, targets)
+	}
+
+	for _, bad := range []string{"", "abc", "-5", "1.5"} {
+		if _, err := simplify.ParseTargets(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestWriteLoad(t *testing.T) {
+	src := grid(2)
+	src.MaterialLibs = []string{"grid.mtl"}
+
+	for _, name := range []string{"grid.obj", "grid.ply"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := simplify.Write(path, src); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		got, err := simplify.Load(path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		if len(got.Positions) != len(src.Positions) || len(got.Faces) != len(src.Faces) || len(got.UVs) != len(src.UVs) {
+			t.Errorf("%s: expected %d positions, %d faces and %d uvs, got %d, %d and %d", name,
+				len(src.Positions), len(src.Faces), len(src.UVs), len(got.Positions), len(got.Faces), len(got.UVs))
+		}
+	}
+}
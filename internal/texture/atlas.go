@@ -0,0 +1,76 @@
+package texture
+
+import (
+	"image"
+	"math"
+	"slices"
+)
+
+// padding is the number of pixels each atlas tile is extended by on every
+// side, so filtering and mipmapping do not sample neighbouring tiles
+const padding = 2
+
+// tile is the placement of one texture inside an atlas, X and Y are the top
+// left corner of the texture excluding padding
+type tile struct {
+	X, Y, W, H int
+}
+
+// pack arranges rectangles of the given sizes on shelves, tallest first, and
+// returns their placement and the atlas size
+func pack(sizes []image.Point) ([]tile, int, int) {
+	area, widest := 0, 0
+	for _, s := range sizes {
+		area += (s.X + 2*padding) * (s.Y + 2*padding)
+		widest = max(widest, s.X+2*padding)
+	}
+	width := max(widest, int(math.Ceil(math.Sqrt(float64(area)))))
+
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return sizes[b].Y - sizes[a].Y })
+
+	tiles := make([]tile, len(sizes))
+	x, y, shelf, used := 0, 0, 0, 0
+	for _, i := range order {
+		w, h := sizes[i].X+2*padding, sizes[i].Y+2*padding
+		if x+w > width {
+			x, y, shelf = 0, y+shelf, 0
+		}
+		tiles[i] = tile{X: x + padding, Y: y + padding, W: sizes[i].X, H: sizes[i].Y}
+		x += w
+		shelf = max(shelf, h)
+		used = max(used, x)
+	}
+
+	return tiles, used, y + shelf
+}
+
+// compose draws every image into its tile, extending the edge pixels into the
+// padding
+func compose(images []*image.NRGBA, tiles []tile, w, h int) *image.NRGBA {
+	atlas := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i, img := range images {
+		t := tiles[i]
+		for y := -padding; y < t.H+padding; y++ {
+			sy := min(max(y, 0), t.H-1)
+			for x := -padding; x < t.W+padding; x++ {
+				sx := min(max(x, 0), t.W-1)
+				copy(atlas.Pix[(t.Y+y)*atlas.Stride+(t.X+x)*4:][:4], img.Pix[sy*img.Stride+sx*4:][:4])
+			}
+		}
+	}
+	return atlas
+}
+
+// remap converts a texture coordinate of a tile to the matching atlas
+// coordinate. OBJ coordinates have their origin at the bottom left while
+// tiles are placed from the top left.
+func (t tile) remap(uv [2]float64, w, h int) [2]float64 {
+	return [2]float64{
+		(float64(t.X) + uv[0]*float64(t.W)) / float64(w),
+		1 - (float64(t.Y)+(1-uv[1])*float64(t.H))/float64(h),
+	}
+}
@@ -0,0 +1,135 @@
+package texture
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Image formats textures can be written as
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+func load(path string) (*image.NRGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open texture %s: %w", path, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode texture %s: %w", path, err)
+	}
+	return toNRGBA(img), nil
+}
+
+func save(path string, img image.Image, format string, quality int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create texture %s: %w", path, err)
+	}
+	defer f.Close()
+
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: quality})
+	default:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(f, img)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode texture %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// formatOf returns the format a texture at path is written as when no format
+// is configured
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return FormatJPEG
+	default:
+		return FormatPNG
+	}
+}
+
+func extension(format string) string {
+	if format == FormatJPEG {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Rect, img, b.Min, draw.Src)
+	return out
+}
+
+// fit returns the size of a w by h image scaled down by factor and further
+// until neither side exceeds limit. A limit of zero means no limit.
+func fit(w, h int, factor float64, limit int) (int, int) {
+	if limit > 0 && float64(w)*factor > float64(limit) {
+		factor = float64(limit) / float64(w)
+	}
+	if limit > 0 && float64(h)*factor > float64(limit) {
+		factor = float64(limit) / float64(h)
+	}
+	if factor >= 1 {
+		return w, h
+	}
+	return max(1, int(float64(w)*factor)), max(1, int(float64(h)*factor))
+}
+
+// resize scales src down to w by h, averaging the source pixels covered by
+// each destination pixel
+func resize(src *image.NRGBA, w, h int) *image.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw == w && sh == h {
+		return src
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max(y0+1, (y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max(x0+1, (x+1)*sw/w)
+
+			// Weight color by alpha so transparent pixels do not bleed
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					pa := uint64(p[3])
+					r += uint64(p[0]) * pa
+					g += uint64(p[1]) * pa
+					b += uint64(p[2]) * pa
+					a += pa
+					n++
+				}
+			}
+
+			d := out.Pix[y*out.Stride+x*4 : y*out.Stride+x*4+4]
+			if a > 0 {
+				d[0], d[1], d[2] = uint8(r/a), uint8(g/a), uint8(b/a)
+			}
+			d[3] = uint8(a / n)
+		}
+	}
+	return out
+}
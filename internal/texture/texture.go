@@ -0,0 +1,288 @@
+package texture
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/2024-dissertation/openmvgo/internal/obj"
+)
+
+// DefaultQuality is the JPEG quality used when none is configured
+const DefaultQuality = 90
+
+// atlasMaterial names the single material that replaces every textured
+// material when textures are merged into an atlas
+const atlasMaterial = "atlas"
+
+// Options controls how textures are post processed
+type Options struct {
+	// MaxSize limits the width and height of every texture, or of the atlas
+	// when Atlas is set. Zero keeps the original size.
+	MaxSize int
+	// Format re-encodes textures as FormatJPEG or FormatPNG, empty keeps the
+	// format of each source texture
+	Format string
+	// Quality is the JPEG quality from 1 to 100, defaults to DefaultQuality
+	Quality int
+	// Atlas merges the diffuse textures of every material into one image
+	Atlas bool
+}
+
+// Enabled reports whether the options change the textures at all
+func (o Options) Enabled() bool {
+	return o.MaxSize > 0 || o.Format != "" || o.Atlas
+}
+
+// Validate checks the options are supported
+func (o Options) Validate() error {
+	switch o.Format {
+	case "", FormatJPEG, FormatPNG:
+	default:
+		return fmt.Errorf("unsupported texture format %q", o.Format)
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("texture quality must be between 1 and 100, got %d", o.Quality)
+	}
+	if o.MaxSize < 0 {
+		return fmt.Errorf("texture size must be positive, got %d", o.MaxSize)
+	}
+	return nil
+}
+
+// Process writes the textured OBJ at src to dst with its textures resized,
+// re-encoded and optionally merged into an atlas. The material library and
+// textures are written next to dst and every written path is returned.
+func Process(src, dst string, opts Options) ([]string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Quality == 0 {
+		opts.Quality = DefaultQuality
+	}
+
+	model, err := obj.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	libs, err := obj.Validate(model)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(dst)
+	name := strings.TrimSuffix(filepath.Base(dst), filepath.Ext(dst))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	// Merge every library into one, resolving texture paths so they can be
+	// loaded regardless of which library referenced them
+	lib := &obj.MaterialLibrary{Path: filepath.Join(dir, name+".mtl")}
+	for _, l := range libs {
+		for _, mat := range l.Materials {
+			maps := map[string]string{}
+			for key, ref := range mat.Maps {
+				maps[key] = resolve(filepath.Dir(l.Path), ref)
+			}
+			mat.Maps = maps
+			lib.Materials = append(lib.Materials, mat)
+		}
+	}
+
+	var written []string
+	if opts.Atlas {
+		written, err = buildAtlas(model, lib, dir, name, opts)
+	} else {
+		written, err = convert(lib, dir, opts)
+	}
+	if err != nil {
+		return written, err
+	}
+
+	if err := obj.WriteMTL(lib.Path, lib); err != nil {
+		return written, err
+	}
+	written = append(written, lib.Path)
+
+	model.MaterialLibs = []string{filepath.Base(lib.Path)}
+	if err := obj.Write(dst, model); err != nil {
+		return written, err
+	}
+	return append(written, dst), nil
+}
+
+// convert resizes and re-encodes every texture of lib on its own
+func convert(lib *obj.MaterialLibrary, dir string, opts Options) ([]string, error) {
+	var written []string
+	names := map[string]string{}
+	taken := map[string]bool{}
+
+	for _, mat := range lib.Materials {
+		for key, path := range mat.Maps {
+			if name, ok := names[path]; ok {
+				mat.Maps[key] = name
+				continue
+			}
+
+			img, err := load(path)
+			if err != nil {
+				return written, err
+			}
+			w, h := fit(img.Rect.Dx(), img.Rect.Dy(), 1, opts.MaxSize)
+			img = resize(img, w, h)
+
+			format := opts.Format
+			if format == "" {
+				format = formatOf(path)
+			}
+			stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			name := uniqueName(stem, extension(format), taken)
+
+			dst := filepath.Join(dir, name)
+			if err := save(dst, img, format, opts.Quality); err != nil {
+				return written, err
+			}
+			written = append(written, dst)
+
+			names[path] = name
+			mat.Maps[key] = name
+		}
+	}
+	return written, nil
+}
+
+// buildAtlas packs the diffuse texture of every material into one image and
+// points their faces at a single material using it. Other texture maps of
+// those materials are dropped.
+func buildAtlas(model *obj.Model, lib *obj.MaterialLibrary, dir, name string, opts Options) ([]string, error) {
+	var paths []string
+	index := map[string]int{}
+	textured := map[string]int{}
+	var rest []obj.Material
+	for _, mat := range lib.Materials {
+		path, ok := mat.Maps["map_Kd"]
+		if !ok {
+			rest = append(rest, mat)
+			continue
+		}
+		if _, ok := index[path]; !ok {
+			index[path] = len(paths)
+			paths = append(paths, path)
+		}
+		textured[mat.Name] = index[path]
+	}
+	if len(paths) == 0 {
+		return convert(lib, dir, opts)
+	}
+
+	sources := make([]*image.NRGBA, len(paths))
+	for i, path := range paths {
+		img, err := load(path)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = img
+	}
+
+	// Shrink every texture by the same factor until the atlas fits
+	var images []*image.NRGBA
+	var tiles []tile
+	var w, h int
+	for factor := 1.0; ; factor *= 0.9 {
+		images = make([]*image.NRGBA, len(sources))
+		sizes := make([]image.Point, len(sources))
+		for i, src := range sources {
+			sw, sh := src.Rect.Dx(), src.Rect.Dy()
+			sizes[i].X, sizes[i].Y = fit(sw, sh, factor, 0)
+		}
+		tiles, w, h = pack(sizes)
+		if opts.MaxSize == 0 || (w <= opts.MaxSize && h <= opts.MaxSize) {
+			for i, src := range sources {
+				images[i] = resize(src, sizes[i].X, sizes[i].Y)
+			}
+			break
+		}
+		if factor < 1e-3 {
+			return nil, fmt.Errorf("%d textures do not fit an atlas of %d pixels", len(sources), opts.MaxSize)
+		}
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = formatOf(paths[0])
+	}
+	atlasName := name + "_atlas" + extension(format)
+	dst := filepath.Join(dir, atlasName)
+	if err := save(dst, compose(images, tiles, w, h), format, opts.Quality); err != nil {
+		return nil, err
+	}
+
+	// Texture coordinates may be shared between faces of different
+	// materials, so each is remapped once per tile it is used with
+	type key struct{ uv, tile int }
+	remapped := map[key]int{}
+	var texcoords [][2]float64
+	for f := range model.Faces {
+		face := &model.Faces[f]
+		t, ok := textured[face.Material]
+		if !ok {
+			t = -1
+		}
+		for v := range face.Vertices {
+			uv := face.Vertices[v].TexCoord
+			if uv < 0 {
+				continue
+			}
+			k := key{uv, t}
+			idx, ok := remapped[k]
+			if !ok {
+				idx = len(texcoords)
+				remapped[k] = idx
+				coord := model.TexCoords[uv]
+				if t >= 0 {
+					coord = tiles[t].remap(coord, w, h)
+				}
+				texcoords = append(texcoords, coord)
+			}
+			face.Vertices[v].TexCoord = idx
+		}
+		if t >= 0 {
+			face.Material = atlasMaterial
+		}
+	}
+	model.TexCoords = texcoords
+
+	// Materials without a diffuse texture keep their other maps
+	written, err := convert(&obj.MaterialLibrary{Materials: rest}, dir, opts)
+	if err != nil {
+		return written, err
+	}
+
+	lib.Materials = append([]obj.Material{{
+		Name:    atlasMaterial,
+		Diffuse: [3]float64{1, 1, 1},
+		Maps:    map[string]string{"map_Kd": atlasName},
+	}}, rest...)
+
+	return append(written, dst), nil
+}
+
+func uniqueName(stem, ext string, taken map[string]bool) string {
+	name := stem + ext
+	for i := 1; taken[name]; i++ {
+		name = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
+	taken[name] = true
+	return name
+}
+
+func resolve(dir, ref string) string {
+	ref = filepath.FromSlash(strings.ReplaceAll(ref, "\\", "/"))
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(dir, ref)
+}
@@ -0,0 +1,149 @@
+package texture_test
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/obj"
+	"github.com/2024-dissertation/openmvgo/internal/texture"
+)
+
+// writeMesh writes two textured triangles, one red with a 64x32 texture and
+// one blue with a 32x32 texture, and returns the OBJ path
+func writeMesh(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	for name, tex := range map[string]struct {
+		w, h int
+		c    color.NRGBA
+	}{
+		"red.png":  {64, 32, color.NRGBA{255, 0, 0, 255}},
+		"blue.png": {32, 32, color.NRGBA{0, 0, 255, 255}},
+	} {
+		img := image.NewNRGBA(image.Rect(0, 0, tex.w, tex.h))
+		for i := 0; i < len(img.Pix); i += 4 {
+			copy(img.Pix[i:], []uint8{tex.c.R, tex.c.G, tex.c.B, tex.c.A})
+		}
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatalf("failed to encode %s: %v", name, err)
+		}
+		f.Close()
+	}
+
+	files := map[string]string{
+		"mesh.obj": "mtllib mesh.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0.1 0.1\nvt 0.9 0.1\nvt 0.1 0.9\n" +
+			"usemtl red\nf 1/1 2/2 3/3\nusemtl blue\nf 1/1 3/3 2/2\n",
+		"mesh.mtl": "newmtl red\nKd 1 1 1\nmap_Kd red.png\nnewmtl blue\nKd 1 1 1\nmap_Kd blue.png\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "mesh.obj")
+}
+
+func decode(t *testing.T, path string) image.Image {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", path, err)
+	}
+	return img
+}
+
+func TestProcess_Resize(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "final.obj")
+
+	_, err := texture.Process(writeMesh(t), dst, texture.Options{MaxSize: 16, Format: texture.FormatJPEG, Quality: 80})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	model, err := obj.Parse(dst)
+	if err != nil {
+		t.Fatalf("failed to parse output: %v", err)
+	}
+	libs, err := obj.Validate(model)
+	if err != nil {
+		t.Fatalf("output is invalid: %v", err)
+	}
+
+	mat, ok := libs[0].Material("red")
+	if !ok || mat.Maps["map_Kd"] != "red.jpg" {
+		t.Fatalf("expected red to use red.jpg, got %+v", mat)
+	}
+
+	img := decode(t, filepath.Join(filepath.Dir(dst), "red.jpg"))
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("expected a 16x8 texture, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestProcess_Atlas(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "final.obj")
+
+	_, err := texture.Process(writeMesh(t), dst, texture.Options{Atlas: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	model, err := obj.Parse(dst)
+	if err != nil {
+		t.Fatalf("failed to parse output: %v", err)
+	}
+	libs, err := obj.Validate(model)
+	if err != nil {
+		t.Fatalf("output is invalid: %v", err)
+	}
+	if len(libs[0].Materials) != 1 || libs[0].Materials[0].Maps["map_Kd"] != "final_atlas.png" {
+		t.Fatalf("expected a single atlas material, got %+v", libs[0].Materials)
+	}
+
+	atlas := decode(t, filepath.Join(filepath.Dir(dst), "final_atlas.png"))
+	b := atlas.Bounds()
+
+	// Every remapped coordinate must sample the texture its face used
+	want := []color.NRGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}
+	for i, face := range model.Faces {
+		if face.Material != "atlas" {
+			t.Errorf("face %d: expected the atlas material, got %q", i, face.Material)
+		}
+		for _, fv := range face.Vertices {
+			uv := model.TexCoords[fv.TexCoord]
+			x := int(uv[0] * float64(b.Dx()))
+			y := int((1 - uv[1]) * float64(b.Dy()))
+			got := color.NRGBAModel.Convert(atlas.At(x, y)).(color.NRGBA)
+			if got != want[i] {
+				t.Errorf("face %d: uv %v samples %v, expected %v", i, uv, got, want[i])
+			}
+		}
+	}
+}
+
+func TestProcess_Invalid(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "final.obj")
+
+	if _, err := texture.Process(writeMesh(t), dst, texture.Options{Format: "webp"}); err == nil {
+		t.Errorf("expected an unsupported format to be rejected")
+	}
+	if _, err := texture.Process(writeMesh(t), dst, texture.Options{Quality: 101}); err == nil {
+		t.Errorf("expected an out of range quality to be rejected")
+	}
+}
@@ -0,0 +1,103 @@
+package toolout
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CountFeatures counts the images and features of the .feat files
+// openMVG_main_ComputeFeatures writes to dir, one line per feature
+func CountFeatures(dir string) (images int, features int, err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.feat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, path := range paths {
+		n, err := countLines(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		images++
+		features += n
+	}
+	return images, features, nil
+}
+
+// countLines counts the non-empty lines of a file
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// CountMatches counts the matches of a .bin matches file, as written by
+// openMVG_main_ComputeMatches and openMVG_main_GeometricFilter
+func CountMatches(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := readMatches(bufio.NewReader(f))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read matches %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// readMatches reads a map of image pairs to matches in the cereal portable
+// binary format: an endianness byte, then the number of pairs and for each
+// pair the two view ids, the number of matches and two feature ids per match.
+// Sizes are 64 bits and ids 32 bits.
+func readMatches(r io.Reader) (int, error) {
+	var endianness uint8
+	if err := binary.Read(r, binary.LittleEndian, &endianness); err != nil {
+		return 0, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if endianness == 0 {
+		order = binary.BigEndian
+	}
+
+	var pairs uint64
+	if err := binary.Read(r, order, &pairs); err != nil {
+		return 0, err
+	}
+	total := 0
+	for range pairs {
+		var pair struct {
+			I, J    uint32
+			Matches uint64
+		}
+		if err := binary.Read(r, order, &pair); err != nil {
+			return 0, err
+		}
+		// Each match is two 32 bit feature ids
+		if _, err := io.CopyN(io.Discard, r, int64(pair.Matches)*8); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		total += int(pair.Matches)
+	}
+	return total, nil
+}
@@ -0,0 +1,225 @@
+// Package toolout extracts the metrics OpenMVG and OpenMVS print to their
+// console, such as registered views or mesh sizes, and the feature and match
+// counts of the files they write.
+package toolout
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Metrics are the numbers found in the output of the commands of a step.
+// A metric the commands did not print or write is left at zero.
+type Metrics struct {
+	// Images is the number of images the commands read
+	Images int `json:"images,omitempty"`
+	// Features is the number of features detected over the images
+	Features         int     `json:"features,omitempty"`
+	FeaturesPerImage float64 `json:"features_per_image,omitempty"`
+	PutativeMatches  int     `json:"putative_matches,omitempty"`
+	FilteredMatches  int     `json:"filtered_matches,omitempty"`
+	RegisteredViews  int     `json:"registered_views,omitempty"`
+	// SparsePoints is the number of tracks of the SfM reconstruction
+	SparsePoints int `json:"sparse_points,omitempty"`
+	// RMSE is the root mean square reprojection error of the SfM
+	// reconstruction, in pixels
+	RMSE        float64 `json:"rmse,omitempty"`
+	DensePoints int     `json:"dense_points,omitempty"`
+	// Vertices and Faces are the size of the last mesh written
+	Vertices int `json:"vertices,omitempty"`
+	Faces    int `json:"faces,omitempty"`
+}
+
+// IsZero tells if no metric was found
+func (m Metrics) IsZero() bool {
+	return m == Metrics{}
+}
+
+// commandPrefix starts the line utils.RunCommand writes before the output
+// of a command
+const commandPrefix = "→ Running: "
+
+// rule sets metrics from the submatches of a line
+type rule struct {
+	re  *regexp.Regexp
+	set func(m *Metrics, match []string)
+}
+
+var (
+	listingRules = []rule{
+		// "usable #File(s) listed in sfm_data: 12"
+		{regexp.MustCompile(`usable #File\(s\) listed in sfm_data: (\d+)`), func(m *Metrics, s []string) {
+			m.Images = atoi(s[1])
+		}},
+	}
+	sfmRules = []rule{
+		// "-- #Camera calibrated: 11 from 12 input images."
+		{regexp.MustCompile(`#Camera calibrated: (\d+) from (\d+) input images`), func(m *Metrics, s []string) {
+			m.RegisteredViews = atoi(s[1])
+			m.Images = atoi(s[2])
+		}},
+		// "-- #Tracks, #3D points: 4589"
+		{regexp.MustCompile(`#Tracks, #3D points: (\d+)`), func(m *Metrics, s []string) {
+			m.SparsePoints = atoi(s[1])
+		}},
+		// "RMSE residual: 0.412"
+		{regexp.MustCompile(`RMSE residual: ([\d.]+)`), func(m *Metrics, s []string) {
+			m.RMSE = atof(s[1])
+		}},
+	}
+	openMVSRules = []rule{
+		// "Scene loaded in 1s (12 images (1 calibrations) with a total of ..."
+		{regexp.MustCompile(`Scene loaded .*?\((\d+) images`), func(m *Metrics, s []string) {
+			m.Images = atoi(s[1])
+		}},
+		// "Densifying point-cloud completed: 1234567 points (5m12s)"
+		{regexp.MustCompile(`Densifying point-cloud completed: (\d+) points`), func(m *Metrics, s []string) {
+			m.DensePoints = atoi(s[1])
+		}},
+		// "Mesh reconstruction completed: 123456 vertices, 246912 faces (12s)",
+		// and the same for the refinement and texturing
+		{regexp.MustCompile(`Mesh \w+ completed: (\d+) vertices, (\d+) faces`), func(m *Metrics, s []string) {
+			m.Vertices = atoi(s[1])
+			m.Faces = atoi(s[2])
+		}},
+	}
+)
+
+// rules are the parsers of the tools, by command name
+var rules = map[string][]rule{
+	"openMVG_main_SfMInit_ImageListing": listingRules,
+	"openMVG_main_SfM":                  sfmRules,
+	"openMVG_main_SfM_Localization":     sfmRules,
+	"DensifyPointCloud":                 openMVSRules,
+	"ReconstructMesh":                   openMVSRules,
+	"RefineMesh":                        openMVSRules,
+	"TextureMesh":                       openMVSRules,
+}
+
+// fileRules set the metrics of the tools that print no counts from the
+// files they write, found with the -o argument of the command
+var fileRules = map[string]func(m *Metrics, output string){
+	"openMVG_main_ComputeFeatures": func(m *Metrics, dir string) {
+		if images, features, err := CountFeatures(dir); err == nil {
+			m.Images, m.Features = images, features
+		}
+	},
+	"openMVG_main_ComputeMatches": func(m *Metrics, path string) {
+		if n, err := CountMatches(path); err == nil {
+			m.PutativeMatches = n
+		}
+	},
+	"openMVG_main_GeometricFilter": func(m *Metrics, path string) {
+		if n, err := CountMatches(path); err == nil {
+			m.FilteredMatches = n
+		}
+	},
+}
+
+// output is a file written by a command, read by a file rule
+type output struct {
+	set  func(m *Metrics, output string)
+	path string
+}
+
+// Parser extracts metrics from console output fed line by line. The output
+// of each command starts with the line utils.RunCommand writes before
+// running it, which selects the rules of the command.
+type Parser struct {
+	rules   []rule
+	metrics Metrics
+	outputs []output
+}
+
+// NewParser returns a parser for the output of tool, or for output that
+// names its commands when tool is empty
+func NewParser(tool string) *Parser {
+	return &Parser{rules: rules[tool]}
+}
+
+// Line parses a line of output
+func (p *Parser) Line(line string) {
+	if command, ok := strings.CutPrefix(line, commandPrefix); ok {
+		name, args, _ := strings.Cut(command, " ")
+		name = filepath.Base(name)
+		p.rules = rules[name]
+		if set, ok := fileRules[name]; ok {
+			if path := outputArg(args); path != "" {
+				p.outputs = append(p.outputs, output{set: set, path: path})
+			}
+		}
+		return
+	}
+	for _, r := range p.rules {
+		if m := r.re.FindStringSubmatch(line); m != nil {
+			r.set(&p.metrics, m)
+		}
+	}
+}
+
+// Metrics returns the metrics found so far, reading the files written by
+// the commands seen
+func (p *Parser) Metrics() Metrics {
+	m := p.metrics
+	for _, o := range p.outputs {
+		o.set(&m, o.path)
+	}
+	if m.Images > 0 && m.Features > 0 {
+		m.FeaturesPerImage = float64(m.Features) / float64(m.Images)
+	}
+	return m
+}
+
+// Parse reads the output of tool, such as a <tool>.log file of the work
+// directory
+func Parse(tool string, r io.Reader) (Metrics, error) {
+	p := NewParser(tool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	// OpenMVS rewrites its progress lines with carriage returns
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		p.Line(scanner.Text())
+	}
+	return p.Metrics(), scanner.Err()
+}
+
+// outputRe matches the -o argument of a command as utils.RunCommand prints
+// its arguments, "[-i in.json -o out -m SIFT]"
+var outputRe = regexp.MustCompile(`(?:^\[| )-o (.+?)(?: -\w|\]$)`)
+
+// outputArg returns the -o argument of a command, or "" without one
+func outputArg(args string) string {
+	m := outputRe.FindStringSubmatch(args)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// scanLines splits on newlines and carriage returns
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func atof(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
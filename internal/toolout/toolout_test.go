@@ -0,0 +1,111 @@
+package toolout_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/toolout"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]toolout.Metrics{
+		"openMVG_main_SfMInit_ImageListing": {Images: 12},
+		"openMVG_main_SfM":                  {Images: 12, RegisteredViews: 11, SparsePoints: 4589, RMSE: 0.412},
+		"DensifyPointCloud":                 {Images: 12, DensePoints: 1234567},
+		"ReconstructMesh":                   {Images: 12, Vertices: 210456, Faces: 418720},
+		"RefineMesh":                        {Images: 12, Vertices: 198230, Faces: 394180},
+		"TextureMesh":                       {Images: 12, Vertices: 198230, Faces: 394180},
+	}
+
+	for tool, want := range tests {
+		t.Run(tool, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tool+".log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := toolout.Parse(tool, f)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != want {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+// writeMatches writes a matches file in the cereal portable binary format
+// OpenMVG uses, with the given number of matches per pair
+func writeMatches(t *testing.T, path string, pairs ...uint64) {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteByte(1)
+	binary.Write(&buf, binary.LittleEndian, uint64(len(pairs)))
+	for i, n := range pairs {
+		binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(i), uint32(i + 1)})
+		binary.Write(&buf, binary.LittleEndian, n)
+		for j := range n {
+			binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(j), uint32(j)})
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParser_Commands(t *testing.T) {
+	// The features and matches are counted from the files the commands
+	// write, named by their -o argument
+	dir := t.TempDir()
+	writeMatches(t, filepath.Join(dir, "matches.putative.bin"), 4, 3)
+	writeMatches(t, filepath.Join(dir, "matches.f.bin"), 2, 0)
+
+	output := strings.Join([]string{
+		"→ Running: openMVG_main_ComputeFeatures [-i /work/matches/sfm_data.json -o testdata/features -m SIFT]",
+		" - EXTRACT FEATURES -",
+		"→ Running: openMVG_main_ComputeMatches [-i /work/matches/sfm_data.json -p /work/matches/pairs.bin -o " + dir + "/matches.putative.bin]",
+		"→ Running: openMVG_main_GeometricFilter [-i /work/matches/sfm_data.json -m " + dir + "/matches.putative.bin -g f -o " + dir + "/matches.f.bin]",
+	}, "\n")
+
+	got, err := toolout.Parse("", strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := toolout.Metrics{Images: 2, Features: 5, FeaturesPerImage: 2.5, PutativeMatches: 7, FilteredMatches: 2}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCountMatches_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "matches.bin")
+	writeMatches(t, path, 5)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-4], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := toolout.CountMatches(path); err == nil {
+		t.Errorf("expected error for a truncated file")
+	}
+	if _, err := toolout.CountMatches(filepath.Join(t.TempDir(), "missing.bin")); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
+
+func TestParser_UnknownTool(t *testing.T) {
+	p := toolout.NewParser("")
+	p.Line("→ Running: Tests []")
+	p.Line("#Camera calibrated: 11 from 12 input images.")
+	if m := p.Metrics(); !m.IsZero() {
+		t.Errorf("expected no metrics for an unknown tool, got %+v", m)
+	}
+}
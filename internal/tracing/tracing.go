@@ -0,0 +1,146 @@
+// Package tracing exports the spans of the pipelines with OTLP. Tracing is
+// disabled unless an endpoint is configured, the spans then go to the no-op
+// tracer of OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the default service name of the spans
+const ServiceName = "openmvgo"
+
+// Options configure the export of the spans
+type Options struct {
+	// Endpoint is the host and port of an OTLP/HTTP collector, such as
+	// localhost:4318, or a URL. Tracing is disabled when it is empty.
+	Endpoint string
+	// Insecure sends the spans over plain HTTP
+	Insecure bool
+	// ServiceName defaults to ServiceName
+	ServiceName string
+}
+
+// Setup exports the spans as configured and returns a function flushing
+// and stopping the export, which does nothing when tracing is disabled
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exportOpts []otlptracehttp.Option
+	if strings.Contains(opts.Endpoint, "://") {
+		exportOpts = append(exportOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	} else {
+		exportOpts = append(exportOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+	}
+	if opts.Insecure {
+		exportOpts = append(exportOpts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, exportOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+
+	provider := NewProvider(sdktrace.WithBatcher(exporter), opts.ServiceName)
+	Install(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider sending the spans to a processor,
+// such as sdktrace.WithSyncer of an in-memory exporter in tests
+func NewProvider(processor sdktrace.TracerProviderOption, serviceName string) *sdktrace.TracerProvider {
+	if serviceName == "" {
+		serviceName = ServiceName
+	}
+	return sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+}
+
+// Install makes provider the global tracer provider, and propagates the
+// W3C trace context
+func Install(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// tracer is looked up on use, like that of the pipelines
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/2024-dissertation/openmvgo/internal/tracing")
+}
+
+// Start starts a span of openmvgo, such as that of a run or a job
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Commands records the commands run by the steps as spans under the span of
+// their step. It observes the steps and receives the commands through
+// utils.UtilsImpl.OnCommand.
+type Commands struct {
+	mu sync.Mutex
+	// base parents the commands run outside of a step
+	base context.Context
+	ctx  context.Context
+}
+
+// NewCommands returns commands traced under ctx outside of a step
+func NewCommands(ctx context.Context) *Commands {
+	return &Commands{base: ctx, ctx: ctx}
+}
+
+// Observe follows the span of the current step
+func (c *Commands) Observe(e pipeline.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch e.Type {
+	case pipeline.StageStarted:
+		if e.Context != nil {
+			c.ctx = e.Context
+		}
+	case pipeline.StageFinished, pipeline.StageFailed:
+		c.ctx = c.base
+	}
+}
+
+// OnCommand records a finished command
+func (c *Commands) OnCommand(s utils.CommandStats) {
+	c.mu.Lock()
+	ctx := c.ctx
+	c.mu.Unlock()
+
+	_, span := tracer().Start(ctx, s.Name,
+		trace.WithTimestamp(s.Start),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("process.executable.name", s.Name),
+			attribute.StringSlice("process.command_args", s.Args),
+			attribute.Int("process.exit.code", s.ExitCode),
+			attribute.Float64("openmvgo.cpu.user_seconds", s.UserTime.Seconds()),
+			attribute.Float64("openmvgo.cpu.system_seconds", s.SystemTime.Seconds()),
+			attribute.Int64("openmvgo.memory.peak_rss_bytes", s.PeakRSS),
+		),
+	)
+	if s.Err != nil {
+		span.RecordError(s.Err)
+		span.SetStatus(codes.Error, s.Err.Error())
+	}
+	span.End(trace.WithTimestamp(s.Start.Add(s.Duration)))
+}
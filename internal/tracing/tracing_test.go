@@ -0,0 +1,104 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/pipeline"
+	"github.com/2024-dissertation/openmvgo/internal/tracing"
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setup(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(sdktrace.WithSyncer(exporter), "")
+	tracing.Install(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return exporter
+}
+
+// spans returns the ended spans by name
+func spans(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		byName[s.Name] = s
+	}
+	return byName
+}
+
+func TestPipelineSpans(t *testing.T) {
+	exporter := setup(t)
+
+	ctx, run := tracing.Start(context.Background(), "run")
+	func() {
+		defer func() { recover() }()
+		pipeline.Run(ctx, "RunPipeline", []pipeline.Step{
+			{Name: "densify", Run: func() {}},
+			{Name: "mesh", Run: func() { panic(errors.New("out of memory")) }},
+			{Name: "texture", Run: func() {}},
+		}, nil)
+	}()
+	run.End()
+
+	got := spans(exporter)
+	if len(got) != 4 {
+		t.Fatalf("got %d spans, want run, RunPipeline, densify and mesh", len(got))
+	}
+	if got["RunPipeline"].Parent.SpanID() != got["run"].SpanContext.SpanID() {
+		t.Error("RunPipeline is not traced under run")
+	}
+	for _, step := range []string{"densify", "mesh"} {
+		if got[step].Parent.SpanID() != got["RunPipeline"].SpanContext.SpanID() {
+			t.Errorf("%s is not traced under RunPipeline", step)
+		}
+	}
+	if got["densify"].Status.Code == codes.Error {
+		t.Error("densify has an error status")
+	}
+	for _, name := range []string{"mesh", "RunPipeline"} {
+		if s := got[name].Status; s.Code != codes.Error || s.Description != "out of memory" {
+			t.Errorf("%s status = %+v, want the error", name, s)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	exporter := setup(t)
+
+	ctx, run := tracing.Start(context.Background(), "run")
+	commands := tracing.NewCommands(ctx)
+	start := time.Now().Add(-time.Minute)
+	commands.OnCommand(utils.CommandStats{Name: "openMVG_main_SfMInit_ImageListing", Start: start, Duration: time.Second})
+	pipeline.RunStep(ctx, pipeline.Step{Name: "features", Run: func() {
+		commands.OnCommand(utils.CommandStats{
+			Name:     "openMVG_main_ComputeFeatures",
+			Args:     []string{"-i", "sfm_data.json"},
+			Start:    start,
+			Duration: 30 * time.Second,
+			ExitCode: 1,
+			Err:      errors.New("exit status 1"),
+		})
+	}}, commands.Observe)
+	run.End()
+
+	got := spans(exporter)
+	if got["openMVG_main_SfMInit_ImageListing"].Parent.SpanID() != got["run"].SpanContext.SpanID() {
+		t.Error("command outside of a step is not traced under run")
+	}
+	features := got["openMVG_main_ComputeFeatures"]
+	if features.Parent.SpanID() != got["features"].SpanContext.SpanID() {
+		t.Error("command is not traced under its step")
+	}
+	if !features.StartTime.Equal(start) || features.EndTime.Sub(features.StartTime) != 30*time.Second {
+		t.Errorf("command span runs from %v to %v, want the timing of the command", features.StartTime, features.EndTime)
+	}
+	if features.Status.Code != codes.Error {
+		t.Errorf("command status = %+v, want an error", features.Status)
+	}
+}
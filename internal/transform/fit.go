@@ -0,0 +1,176 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+)
+
+// jacobiSweeps bounds the eigenvalue iteration, a 4x4 matrix converges in
+// well under ten sweeps
+const jacobiSweeps = 50
+
+// Fit returns the similarity that best maps src onto dst in the least squares
+// sense, using Horn's closed form quaternion solution. At least 3 point pairs
+// that are not collinear are needed.
+func Fit(src, dst [][3]float64) (Similarity, error) {
+	if len(src) != len(dst) {
+		return Similarity{}, fmt.Errorf("expected the same number of points, got %d and %d", len(src), len(dst))
+	}
+	if len(src) < 3 {
+		return Similarity{}, fmt.Errorf("at least 3 point pairs are needed, got %d", len(src))
+	}
+
+	cs, cd := centroid(src), centroid(dst)
+
+	// Cross covariance of the centred point sets
+	var m [3][3]float64
+	var spread float64
+	for i := range src {
+		a, b := sub(src[i], cs), sub(dst[i], cd)
+		for r := range 3 {
+			for c := range 3 {
+				m[r][c] += a[r] * b[c]
+			}
+		}
+		spread += dot(a, a)
+	}
+	if spread < 1e-12 {
+		return Similarity{}, fmt.Errorf("the source points coincide")
+	}
+
+	sxx, sxy, sxz := m[0][0], m[0][1], m[0][2]
+	syx, syy, syz := m[1][0], m[1][1], m[1][2]
+	szx, szy, szz := m[2][0], m[2][1], m[2][2]
+	n := [4][4]float64{
+		{sxx + syy + szz, syz - szy, szx - sxz, sxy - syx},
+		{syz - szy, sxx - syy - szz, sxy + syx, szx + sxz},
+		{szx - sxz, sxy + syx, -sxx + syy - szz, syz + szy},
+		{sxy - syx, szx + sxz, syz + szy, -sxx - syy + szz},
+	}
+
+	values, vectors := eigen4(n)
+	best := 0
+	for i := 1; i < 4; i++ {
+		if values[i] > values[best] {
+			best = i
+		}
+	}
+	// A degenerate configuration leaves the rotation about some axis free
+	sorted := values
+	for i := range 4 {
+		for j := i + 1; j < 4; j++ {
+			if sorted[j] > sorted[i] {
+				sorted[i], sorted[j] = sorted[j], sorted[i]
+			}
+		}
+	}
+	if sorted[0]-sorted[1] < 1e-9*math.Max(1, math.Abs(sorted[0])) {
+		return Similarity{}, fmt.Errorf("the points are collinear")
+	}
+
+	q := [4]float64{vectors[0][best], vectors[1][best], vectors[2][best], vectors[3][best]}
+	rot := quaternionMatrix(q)
+
+	var num float64
+	for i := range src {
+		num += dot(sub(dst[i], cd), MulVec(rot, sub(src[i], cs)))
+	}
+	scale := num / spread
+
+	rc := MulVec(rot, cs)
+	return Similarity{
+		Scale:       scale,
+		Rotation:    rot,
+		Translation: [3]float64{cd[0] - scale*rc[0], cd[1] - scale*rc[1], cd[2] - scale*rc[2]},
+	}, nil
+}
+
+// RMSE returns the root mean square distance between t applied to src and dst
+func RMSE(t Similarity, src, dst [][3]float64) float64 {
+	if len(src) == 0 {
+		return 0
+	}
+	var sum float64
+	for i := range src {
+		d := Distance(t.Apply(src[i]), dst[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(src)))
+}
+
+// quaternionMatrix returns the rotation of the unit quaternion (w, x, y, z)
+func quaternionMatrix(q [4]float64) [3][3]float64 {
+	w, x, y, z := q[0], q[1], q[2], q[3]
+	return [3][3]float64{
+		{w*w + x*x - y*y - z*z, 2 * (x*y - w*z), 2 * (x*z + w*y)},
+		{2 * (x*y + w*z), w*w - x*x + y*y - z*z, 2 * (y*z - w*x)},
+		{2 * (x*z - w*y), 2 * (y*z + w*x), w*w - x*x - y*y + z*z},
+	}
+}
+
+// eigen4 returns the eigenvalues and eigenvectors, as columns, of a symmetric
+// matrix using cyclic Jacobi rotations
+func eigen4(a [4][4]float64) ([4]float64, [4][4]float64) {
+	v := [4][4]float64{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+
+	for range jacobiSweeps {
+		var off float64
+		for p := range 4 {
+			for q := p + 1; q < 4; q++ {
+				off += a[p][q] * a[p][q]
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+
+		for p := range 4 {
+			for q := p + 1; q < 4; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := range 4 {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := range 4 {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := range 4 {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+
+	return [4]float64{a[0][0], a[1][1], a[2][2], a[3][3]}, v
+}
+
+func centroid(points [][3]float64) [3]float64 {
+	var c [3]float64
+	for _, p := range points {
+		c[0] += p[0]
+		c[1] += p[1]
+		c[2] += p[2]
+	}
+	n := float64(len(points))
+	return [3]float64{c[0] / n, c[1] / n, c[2] / n}
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
@@ -0,0 +1,110 @@
+package transform
+
+import "math"
+
+// Similarity maps a point p to Scale * Rotation * p + Translation
+type Similarity struct {
+	Scale       float64
+	Rotation    [3][3]float64
+	Translation [3]float64
+}
+
+// Identity returns the similarity that leaves points unchanged
+func Identity() Similarity {
+	return Similarity{Scale: 1, Rotation: identity}
+}
+
+// Scaling returns the similarity that scales points about the origin
+func Scaling(s float64) Similarity {
+	return Similarity{Scale: s, Rotation: identity}
+}
+
+var identity = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+// Apply transforms the point p
+func (t Similarity) Apply(p [3]float64) [3]float64 {
+	r := MulVec(t.Rotation, p)
+	return [3]float64{
+		t.Scale*r[0] + t.Translation[0],
+		t.Scale*r[1] + t.Translation[1],
+		t.Scale*r[2] + t.Translation[2],
+	}
+}
+
+// ApplyRotation returns the world to camera rotation of a camera after the
+// scene is transformed, given its rotation before
+func (t Similarity) ApplyRotation(r [3][3]float64) [3][3]float64 {
+	return Mul(r, Transpose(t.Rotation))
+}
+
+// Then returns the similarity that applies t followed by u
+func (t Similarity) Then(u Similarity) Similarity {
+	return Similarity{
+		Scale:       u.Scale * t.Scale,
+		Rotation:    Mul(u.Rotation, t.Rotation),
+		Translation: u.Apply(t.Translation),
+	}
+}
+
+// Inverse returns the similarity that undoes t
+func (t Similarity) Inverse() Similarity {
+	rt := Transpose(t.Rotation)
+	back := MulVec(rt, t.Translation)
+	return Similarity{
+		Scale:       1 / t.Scale,
+		Rotation:    rt,
+		Translation: [3]float64{-back[0] / t.Scale, -back[1] / t.Scale, -back[2] / t.Scale},
+	}
+}
+
+// Matrix returns t as a row major 4x4 homogeneous matrix
+func (t Similarity) Matrix() [4][4]float64 {
+	var m [4][4]float64
+	for i := range 3 {
+		for j := range 3 {
+			m[i][j] = t.Scale * t.Rotation[i][j]
+		}
+		m[i][3] = t.Translation[i]
+	}
+	m[3][3] = 1
+	return m
+}
+
+// Mul returns the matrix product a * b
+func Mul(a, b [3][3]float64) [3][3]float64 {
+	var out [3][3]float64
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				out[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return out
+}
+
+// MulVec returns the product of m and the column vector v
+func MulVec(m [3][3]float64, v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// Transpose returns the transpose of m
+func Transpose(m [3][3]float64) [3][3]float64 {
+	var out [3][3]float64
+	for i := range 3 {
+		for j := range 3 {
+			out[i][j] = m[j][i]
+		}
+	}
+	return out
+}
+
+// Distance returns the euclidean distance between a and b
+func Distance(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
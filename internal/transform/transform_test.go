@@ -0,0 +1,100 @@
+package transform_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/transform"
+)
+
+func near(a, b [3]float64) bool {
+	for i := range 3 {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+// rotZ rotates by 90 degrees about Z
+var rotZ = [3][3]float64{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}}
+
+func TestSimilarity(t *testing.T) {
+	s := transform.Similarity{Scale: 2, Rotation: rotZ, Translation: [3]float64{1, 2, 3}}
+
+	p := [3]float64{1, 0, 0}
+	if got := s.Apply(p); !near(got, [3]float64{1, 4, 3}) {
+		t.Errorf("expected [1 4 3], got %v", got)
+	}
+
+	if got := s.Inverse().Apply(s.Apply(p)); !near(got, p) {
+		t.Errorf("inverse did not restore %v, got %v", p, got)
+	}
+
+	u := transform.Scaling(0.5)
+	if got := s.Then(u).Apply(p); !near(got, u.Apply(s.Apply(p))) {
+		t.Errorf("composition does not match sequential application: %v", got)
+	}
+
+	m := s.Matrix()
+	if m[1][0] != 2 || m[0][3] != 1 || m[3][3] != 1 {
+		t.Errorf("unexpected matrix %v", m)
+	}
+}
+
+func TestApplyRotation(t *testing.T) {
+	s := transform.Similarity{Scale: 3, Rotation: rotZ, Translation: [3]float64{5, 0, 0}}
+
+	// A camera looking down its Z axis at the origin from (0,0,-4)
+	cam := transform.Identity().Rotation
+	center := [3]float64{0, 0, -4}
+	x := [3]float64{1, 2, 0}
+
+	project := func(r [3][3]float64, c, p [3]float64) [3]float64 {
+		v := transform.MulVec(r, [3]float64{p[0] - c[0], p[1] - c[1], p[2] - c[2]})
+		return [3]float64{v[0] / v[2], v[1] / v[2], 1}
+	}
+
+	before := project(cam, center, x)
+	after := project(s.ApplyRotation(cam), s.Apply(center), s.Apply(x))
+	if !near(before, after) {
+		t.Errorf("projection changed from %v to %v", before, after)
+	}
+}
+
+func TestFit(t *testing.T) {
+	want := transform.Similarity{Scale: 2.5, Rotation: rotZ, Translation: [3]float64{10, -3, 7}}
+
+	src := [][3]float64{{0, 0, 0}, {1, 0, 0}, {0, 2, 0}, {0, 0, 3}, {1, 1, 1}}
+	dst := make([][3]float64, len(src))
+	for i, p := range src {
+		dst[i] = want.Apply(p)
+	}
+
+	got, err := transform.Fit(src, dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(got.Scale-want.Scale) > 1e-9 || !near(got.Translation, want.Translation) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	for i := range 3 {
+		if !near(got.Rotation[i], want.Rotation[i]) {
+			t.Errorf("expected rotation %v, got %v", want.Rotation, got.Rotation)
+			break
+		}
+	}
+	if rmse := transform.RMSE(got, src, dst); rmse > 1e-9 {
+		t.Errorf("expected an exact fit, got rmse %g", rmse)
+	}
+}
+
+func TestFit_Degenerate(t *testing.T) {
+	if _, err := transform.Fit([][3]float64{{0, 0, 0}, {1, 0, 0}}, [][3]float64{{0, 0, 0}, {1, 0, 0}}); err == nil {
+		t.Errorf("expected error for 2 points")
+	}
+	line := [][3]float64{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}}
+	if _, err := transform.Fit(line, line); err == nil {
+		t.Errorf("expected error for collinear points")
+	}
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// RequireFiles reports the first path that is missing, a directory or empty.
+// The tools often fail on a missing file with little context, or exit
+// successfully without writing their output.
+func RequireFiles(paths []string) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			return fmt.Errorf("%s does not exist", path)
+		case err != nil:
+			return err
+		case info.IsDir():
+			return fmt.Errorf("%s is a directory", path)
+		case info.Size() == 0:
+			return fmt.Errorf("%s is empty", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resources a command can exceed
+const (
+	ResourceMemory  = "memory"
+	ResourceCPUTime = "CPU time"
+)
+
+// Limits bound the resources of every command run, the zero value leaves
+// them unbounded. They are only enforced on Linux.
+type Limits struct {
+	// Memory bounds the memory of a command in bytes. It is enforced with
+	// the memory controller of cgroup v2 when the cgroup of openmvgo
+	// delegates it, and bounds the address space with setrlimit otherwise.
+	Memory int64
+	// CPUTime bounds the user and system CPU time of a command, with
+	// setrlimit, to whole seconds
+	CPUTime time.Duration
+}
+
+// IsZero reports whether no limit is set
+func (l Limits) IsZero() bool {
+	return l.Memory <= 0 && l.CPUTime <= 0
+}
+
+// LimitError is the failure of a command killed for exceeding one of its
+// limits. Retrying the command with the same limits fails again.
+type LimitError struct {
+	Name string
+	Args []string
+	// Resource is ResourceMemory or ResourceCPUTime
+	Resource string
+	Limits   Limits
+	// Err is the failure of the command
+	Err error
+}
+
+func (e *LimitError) Error() string {
+	limit := e.Limits.CPUTime.String()
+	if e.Resource == ResourceMemory {
+		limit = FormatSize(e.Limits.Memory)
+	}
+	return fmt.Sprintf("command exceeded its %s limit of %s: %s %v: %v", e.Resource, limit, e.Name, e.Args, e.Err)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+var sizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+// ParseSize parses a size in bytes with an optional binary unit, such as
+// 512M, 16G or 1.5GiB
+func ParseSize(s string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(s))
+	number = strings.TrimSuffix(strings.TrimSuffix(number, "B"), "I")
+
+	scale := 1.0
+	if i := strings.LastIndexAny(number, "KMGT"); i >= 0 && i == len(number)-1 {
+		scale = math.Pow(1024, float64(strings.IndexByte("KMGT", number[i])+1))
+		number = number[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected bytes or a number followed by K, M, G or T", s)
+	}
+	return int64(n * scale), nil
+}
+
+// FormatSize formats a size in bytes with a binary unit, such as 1.5 GiB
+func FormatSize(n int64) string {
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + sizeUnits[unit]
+}
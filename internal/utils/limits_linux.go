@@ -0,0 +1,240 @@
+//go:build linux
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupRoot is where cgroup v2 is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// limiter enforces the limits of a command
+type limiter struct {
+	limits Limits
+	// cgroup is the directory of the cgroup of the command, when its memory
+	// is bounded by cgroup v2
+	cgroup string
+	dir    *os.File
+	// output is the end of the output of the command, when its memory is
+	// bounded by setrlimit
+	output *tail
+}
+
+// newLimiter prepares cmd to run in its own cgroup when the memory is
+// bounded and cgroup v2 delegates the memory controller, and falls back on
+// setrlimit otherwise
+func newLimiter(cmd *exec.Cmd, limits Limits) (*limiter, error) {
+	l := &limiter{limits: limits}
+	if limits.Memory <= 0 {
+		return l, nil
+	}
+
+	parent, err := delegatedCgroup()
+	if err != nil {
+		fmt.Printf("→ Bounding the address space instead of the memory: %v\n", err)
+		l.capture(cmd)
+		return l, nil
+	}
+	if l.cgroup, err = os.MkdirTemp(parent, "openmvgo-"); err != nil {
+		fmt.Printf("→ Bounding the address space instead of the memory: %v\n", err)
+		l.cgroup = ""
+		l.capture(cmd)
+		return l, nil
+	}
+
+	// The tools run no other processes worth keeping once one is killed,
+	// and swapping would only delay the kill
+	files := []struct{ name, value string }{
+		{"memory.max", strconv.FormatInt(limits.Memory, 10)},
+		{"memory.swap.max", "0"},
+		{"memory.oom.group", "1"},
+	}
+	for _, f := range files {
+		err := os.WriteFile(filepath.Join(l.cgroup, f.name), []byte(f.value), 0o644)
+		if err != nil && (f.name == "memory.max" || !errors.Is(err, os.ErrNotExist)) {
+			l.close()
+			return nil, fmt.Errorf("failed to configure cgroup %s: %w", l.cgroup, err)
+		}
+	}
+	if l.dir, err = os.Open(l.cgroup); err != nil {
+		l.close()
+		return nil, fmt.Errorf("failed to open cgroup %s: %w", l.cgroup, err)
+	}
+
+	// The command starts in the cgroup, before it can allocate anything
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(l.dir.Fd())
+	return l, nil
+}
+
+// capture keeps the end of the output of cmd, in which the tools report the
+// allocations the address space limit failed
+func (l *limiter) capture(cmd *exec.Cmd) {
+	l.output = &tail{}
+	cmd.Stdout = io.MultiWriter(cmd.Stdout, l.output)
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, l.output)
+}
+
+// delegatedCgroup returns the cgroup in which the cgroups of the commands
+// are created: that of openmvgo or its parent, whichever has the memory
+// controller enabled for its children. Systemd units with Delegate=yes
+// usually move their main process to a child cgroup for this.
+func delegatedCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("cgroup v2 is not available: %w", err)
+	}
+	var own string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			own = filepath.Join(cgroupRoot, path)
+		}
+	}
+	if own == "" {
+		return "", errors.New("cgroup v2 is not available")
+	}
+
+	for _, dir := range []string{own, filepath.Dir(own)} {
+		controllers, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+		if err == nil && slices.Contains(strings.Fields(string(controllers)), "memory") {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("the memory controller is not delegated to %s", own)
+}
+
+// started bounds the resources that the cgroup does not. The command runs
+// for a moment before, the tools allocate little on start.
+func (l *limiter) started(p *os.Process) error {
+	if l.limits.Memory > 0 && l.cgroup == "" {
+		limit := uint64(l.limits.Memory)
+		if err := unix.Prlimit(p.Pid, unix.RLIMIT_AS, &unix.Rlimit{Cur: limit, Max: limit}, nil); err != nil {
+			return fmt.Errorf("failed to bound the address space: %w", err)
+		}
+	}
+	if l.limits.CPUTime > 0 {
+		// SIGXCPU at the limit, and SIGKILL a second later for the commands
+		// that handle it
+		seconds := uint64(math.Ceil(l.limits.CPUTime.Seconds()))
+		if err := unix.Prlimit(p.Pid, unix.RLIMIT_CPU, &unix.Rlimit{Cur: seconds, Max: seconds + 1}, nil); err != nil {
+			return fmt.Errorf("failed to bound the CPU time: %w", err)
+		}
+	}
+	return nil
+}
+
+// breached returns the resource that a failed command exceeded, if any
+func (l *limiter) breached(state *os.ProcessState, stats CommandStats) string {
+	if state == nil {
+		return ""
+	}
+	status, _ := state.Sys().(syscall.WaitStatus)
+
+	if l.limits.CPUTime > 0 && status.Signaled() {
+		cpu := stats.UserTime + stats.SystemTime
+		if status.Signal() == syscall.SIGXCPU || (status.Signal() == syscall.SIGKILL && cpu >= l.limits.CPUTime) {
+			return ResourceCPUTime
+		}
+	}
+
+	if l.limits.Memory <= 0 {
+		return ""
+	}
+	if l.cgroup != "" {
+		if l.oomKills() > 0 {
+			return ResourceMemory
+		}
+		return ""
+	}
+	// Without a cgroup, the tools fail to allocate once they run out of
+	// address space: they abort on an uncaught std::bad_alloc, which the C++
+	// runtime reports, or report it themselves and exit. Other crashes,
+	// aborts included, are not the fault of the limit.
+	if status.Signaled() && status.Signal() == syscall.SIGKILL {
+		return ResourceMemory
+	}
+	if l.output != nil && l.output.allocationFailed() {
+		return ResourceMemory
+	}
+	return ""
+}
+
+// tailSize is the end of the output searched for allocation failures
+const tailSize = 4096
+
+// allocationFailures are the reports of failed allocations in the output of
+// the tools, in lower case
+var allocationFailures = []string{"bad_alloc", "out of memory", "cannot allocate memory", "failed to allocate"}
+
+// tail keeps the end of the output of a command. Its stdout and stderr are
+// copied concurrently.
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > tailSize {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-tailSize:]...)
+	}
+	return len(p), nil
+}
+
+// allocationFailed reports whether the output reports a failed allocation
+func (t *tail) allocationFailed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	output := strings.ToLower(string(t.buf))
+	return slices.ContainsFunc(allocationFailures, func(s string) bool {
+		return strings.Contains(output, s)
+	})
+}
+
+// oomKills returns the number of processes the memory limit of the cgroup
+// killed
+func (l *limiter) oomKills() int {
+	data, err := os.ReadFile(filepath.Join(l.cgroup, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			n, _ := strconv.Atoi(strings.TrimSpace(value))
+			return n
+		}
+	}
+	return 0
+}
+
+// close removes the cgroup of the command once it exited
+func (l *limiter) close() error {
+	if l.dir != nil {
+		l.dir.Close()
+	}
+	if l.cgroup == "" {
+		return nil
+	}
+	return os.Remove(l.cgroup)
+}
@@ -0,0 +1,93 @@
+package utils_test
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+)
+
+func TestRunCommand_CPUTimeLimit(t *testing.T) {
+	var stats utils.CommandStats
+	u := &utils.UtilsImpl{
+		Limits:    utils.Limits{CPUTime: time.Second},
+		OnCommand: func(s utils.CommandStats) { stats = s },
+	}
+
+	err := u.RunCommand("sh", []string{"-c", "while :; do :; done"})
+	var limitErr *utils.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("RunCommand() = %v, want a *LimitError", err)
+	}
+	if limitErr.Resource != utils.ResourceCPUTime {
+		t.Errorf("exceeded %s, want %s", limitErr.Resource, utils.ResourceCPUTime)
+	}
+	// The CPU time is accounted in ticks, it can fall a little short of the
+	// limit
+	if cpu := stats.UserTime + stats.SystemTime; cpu < time.Second/2 {
+		t.Errorf("command used %v of CPU time, want about the limit", cpu)
+	}
+	if !errors.As(stats.Err, &limitErr) {
+		t.Errorf("stats.Err = %v, want the *LimitError", stats.Err)
+	}
+}
+
+func TestRunCommand_WithinLimits(t *testing.T) {
+	u := &utils.UtilsImpl{Limits: utils.Limits{Memory: 1 << 30, CPUTime: time.Minute}}
+	if err := u.RunCommand("true", nil); err != nil {
+		t.Fatalf("RunCommand() = %v", err)
+	}
+
+	err := u.RunCommand("false", nil)
+	var limitErr *utils.LimitError
+	if err == nil || errors.As(err, &limitErr) {
+		t.Fatalf("RunCommand() = %v, want a failure within the limits", err)
+	}
+}
+
+func TestRunCommand_MemoryLimit(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	u := &utils.UtilsImpl{Limits: utils.Limits{Memory: 256 << 20}}
+
+	// The allocation either fails and is reported, or is killed by the
+	// memory limit of the cgroup
+	err := u.RunCommand("python3", []string{"-c", `import sys
+try:
+    b"a" * (1 << 30)
+except MemoryError:
+    sys.exit("out of memory")`})
+	var limitErr *utils.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("RunCommand() = %v, want a *LimitError", err)
+	}
+	if limitErr.Resource != utils.ResourceMemory {
+		t.Errorf("exceeded %s, want %s", limitErr.Resource, utils.ResourceMemory)
+	}
+}
+
+func TestRunCommand_CrashWithinMemoryLimit(t *testing.T) {
+	u := &utils.UtilsImpl{Limits: utils.Limits{Memory: 1 << 30}}
+
+	// A crash is retried like any failure, it did not exceed the limit
+	err := u.RunCommand("sh", []string{"-c", "kill -SEGV $$"})
+	var limitErr *utils.LimitError
+	if err == nil || errors.As(err, &limitErr) {
+		t.Fatalf("RunCommand() = %v, want a failure within the limits", err)
+	}
+}
+
+func TestRunCommand_AbortWithinMemoryLimit(t *testing.T) {
+	u := &utils.UtilsImpl{Limits: utils.Limits{Memory: 1 << 30}}
+
+	// An abort without a failed allocation in the output, such as a failed
+	// assertion, did not exceed the limit
+	err := u.RunCommand("sh", []string{"-c", "echo 'Assertion failed' >&2; kill -ABRT $$"})
+	var limitErr *utils.LimitError
+	if err == nil || errors.As(err, &limitErr) {
+		t.Fatalf("RunCommand() = %v, want a failure within the limits", err)
+	}
+}
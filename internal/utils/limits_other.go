@@ -0,0 +1,29 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// limiter enforces the limits of a command
+type limiter struct{}
+
+// newLimiter fails, the limits are not enforced on this platform
+func newLimiter(cmd *exec.Cmd, limits Limits) (*limiter, error) {
+	return nil, errors.New("resource limits are only supported on Linux")
+}
+
+func (l *limiter) started(p *os.Process) error {
+	return nil
+}
+
+func (l *limiter) breached(state *os.ProcessState, stats CommandStats) string {
+	return ""
+}
+
+func (l *limiter) close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/2024-dissertation/openmvgo/internal/utils"
+)
+
+func TestParseSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64
+	}{
+		{"4096", 4096},
+		{"512K", 512 << 10},
+		{"512M", 512 << 20},
+		{"16G", 16 << 30},
+		{"16g", 16 << 30},
+		{"1.5GiB", 3 << 29},
+		{"2 TB", 2 << 40},
+	} {
+		got, err := utils.ParseSize(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "G", "-1G", "12X", "twelve"} {
+		if _, err := utils.ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) succeeded", in)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		512:      "512 B",
+		16 << 30: "16 GiB",
+		3 << 29:  "1.5 GiB",
+	} {
+		if got := utils.FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// peakRSS returns the maximum resident set size of a finished process
+func peakRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		// Reported in bytes, and in kilobytes elsewhere
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"os"
+	"time"
+)
+
+// CommandStats is the resource usage of a finished command
+type CommandStats struct {
+	Name  string
+	Args  []string
+	Start time.Time
+	// Duration is the wall time of the command
+	Duration time.Duration
+	// UserTime and SystemTime are the CPU time of the command
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// PeakRSS is the peak resident set size in bytes, 0 when the platform
+	// does not report it
+	PeakRSS int64
+	// ExitCode is -1 when the command did not start or was killed
+	ExitCode int
+	Err      error
+}
+
+// newCommandStats reads the usage of a command once it ran
+func newCommandStats(name string, args []string, start time.Time, state *os.ProcessState, err error) CommandStats {
+	s := CommandStats{Name: name, Args: args, Start: start, Duration: time.Since(start), ExitCode: -1, Err: err}
+	if state == nil {
+		// The command did not start
+		return s
+	}
+	s.UserTime = state.UserTime()
+	s.SystemTime = state.SystemTime()
+	s.PeakRSS = peakRSS(state)
+	s.ExitCode = state.ExitCode()
+	return s
+}
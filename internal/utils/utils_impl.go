@@ -1,20 +1,43 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 )
 
-type UtilsImpl struct{}
+type UtilsImpl struct {
+	// LogDir receives a <command>.log file per command run, if set
+	LogDir string
+	// Context kills the running command when it is done, if set
+	Context context.Context
+	// Output also receives the output of every command, if set
+	Output io.Writer
+	// OnCommand receives the resource usage of every command, if set
+	OnCommand func(CommandStats)
+	// Limits bound the resources of every command, a command exceeding
+	// them fails with a *LimitError
+	Limits Limits
+	// Env is added to the environment of every command, if set
+	Env []string
+}
 
 func NewUtils() UtilsInterface {
 	return &UtilsImpl{}
 }
 
+// NewUtilsWithLogs returns utils that also keep the output of every command
+// in logDir
+func NewUtilsWithLogs(logDir string) UtilsInterface {
+	return &UtilsImpl{LogDir: logDir}
+}
+
 func (u *UtilsImpl) Check(e error) {
 	if e != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", e)
@@ -25,17 +48,85 @@ func (u *UtilsImpl) Check(e error) {
 // RunCommand runs a command with arguments and prints its stdout/stderr in real-time.
 func (u *UtilsImpl) RunCommand(name string, args []string) error {
 	cmd := exec.Command(name, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if u.Context != nil {
+		cmd = exec.CommandContext(u.Context, name, args...)
+	}
+	if len(u.Env) > 0 {
+		cmd.Env = append(os.Environ(), u.Env...)
+	}
+	stdout := []io.Writer{os.Stdout}
+	stderr := []io.Writer{os.Stderr}
+
+	if u.LogDir != "" {
+		log, err := os.OpenFile(filepath.Join(u.LogDir, filepath.Base(name)+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log for %s: %w", name, err)
+		}
+		defer log.Close()
+		fmt.Fprintf(log, "→ Running: %s %v\n", name, args)
+		stdout = append(stdout, log)
+		stderr = append(stderr, log)
+	}
+	if u.Output != nil {
+		// The header tells the parsers of the output which command runs
+		fmt.Fprintf(u.Output, "→ Running: %s %v\n", name, args)
+		stdout = append(stdout, u.Output)
+		stderr = append(stderr, u.Output)
+	}
+	cmd.Stdout = io.MultiWriter(stdout...)
+	cmd.Stderr = io.MultiWriter(stderr...)
+
+	var limiter *limiter
+	if !u.Limits.IsZero() {
+		var err error
+		if limiter, err = newLimiter(cmd, u.Limits); err != nil {
+			return fmt.Errorf("failed to limit %s: %w", name, err)
+		}
+		defer limiter.close()
+	}
 
 	fmt.Printf("→ Running: %s %v\n", name, args)
-	err := cmd.Run()
+	start := time.Now()
+	err := run(cmd, limiter)
+	stats := newCommandStats(filepath.Base(name), args, start, cmd.ProcessState, err)
+	// A command killed on cancellation did not exceed its limits
+	var exitErr *exec.ExitError
+	if limiter != nil && errors.As(err, &exitErr) && (u.Context == nil || u.Context.Err() == nil) {
+		if resource := limiter.breached(cmd.ProcessState, stats); resource != "" {
+			err = &LimitError{Name: name, Args: args, Resource: resource, Limits: u.Limits, Err: err}
+			stats.Err = err
+		}
+	}
+	if u.OnCommand != nil {
+		u.OnCommand(stats)
+	}
+
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("command failed: %s %v: %w", name, args, err)
 	}
 	return nil
 }
 
+// run runs a command, bounding its resources once it started when limiter
+// is set
+func run(cmd *exec.Cmd, limiter *limiter) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if limiter != nil {
+		if err := limiter.started(cmd.Process); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+	}
+	return cmd.Wait()
+}
+
 // EnsureDir creates the directory (and parent dirs) if it doesn't exist.
 func (u *UtilsImpl) EnsureDir(path string) error {
 	abs, err := filepath.Abs(path)
@@ -0,0 +1,195 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Cleanup policies
+const (
+	// CleanupAlways removes the workspace when the run ends
+	CleanupAlways = "always"
+	// CleanupOnSuccess keeps the workspace of a failed run for inspection
+	CleanupOnSuccess = "on-success"
+	// CleanupNever keeps the workspace
+	CleanupNever = "never"
+)
+
+// marker identifies a directory as a workspace, so that Clean never removes
+// anything else
+const marker = ".openmvgo-workspace"
+
+// tempPattern names the workspaces created by Temp
+const tempPattern = "openmvgo-*"
+
+// Workspace is the directory holding the intermediate files of a run
+type Workspace struct {
+	Root string
+	// Matches holds the image listing, features and matches of OpenMVG
+	Matches string
+	// Reconstruction holds the OpenMVG reconstruction
+	Reconstruction string
+	// MVS holds the exported scene and the OpenMVS files
+	MVS string
+	// Logs holds the output of every command of the run
+	Logs string
+}
+
+// New creates the workspace layout in root, or reuses the one there
+func New(root string) (*Workspace, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if entries, err := os.ReadDir(abs); err == nil && len(entries) > 0 && !isWorkspace(abs) {
+		return nil, fmt.Errorf("%s is not empty and not a workspace", root)
+	}
+
+	w := layout(abs)
+	for _, dir := range []string{w.Matches, w.Reconstruction, w.MVS, w.Logs} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create workspace: %w", err)
+		}
+	}
+	if err := w.Touch(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Temp creates a workspace in a new directory of the system temporary
+// directory
+func Temp() (*Workspace, error) {
+	root, err := os.MkdirTemp("", tempPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return New(root)
+}
+
+// Open returns the existing workspace in root
+func Open(root string) (*Workspace, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if !isWorkspace(abs) {
+		return nil, fmt.Errorf("%s is not a workspace", root)
+	}
+	w := layout(abs)
+	if err := w.Touch(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func layout(root string) *Workspace {
+	return &Workspace{
+		Root:           root,
+		Matches:        filepath.Join(root, "matches"),
+		Reconstruction: filepath.Join(root, "reconstruction"),
+		MVS:            filepath.Join(root, "mvs"),
+		Logs:           filepath.Join(root, "logs"),
+	}
+}
+
+func isWorkspace(root string) bool {
+	_, err := os.Stat(filepath.Join(root, marker))
+	return err == nil
+}
+
+// Touch marks the workspace as in use now
+func (w *Workspace) Touch() error {
+	path := filepath.Join(w.Root, marker)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); errors.Is(err, os.ErrNotExist) {
+		err = os.WriteFile(path, nil, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to mark workspace: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to mark workspace: %w", err)
+	}
+	return nil
+}
+
+// ValidatePolicy reports an unknown cleanup policy
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case CleanupAlways, CleanupOnSuccess, CleanupNever:
+		return nil
+	}
+	return fmt.Errorf("unknown cleanup policy %q, expected always, on-success or never", policy)
+}
+
+// Cleanup removes the workspace as the policy says for a run that succeeded
+// or failed, and reports whether it was removed
+func (w *Workspace) Cleanup(policy string, success bool) (bool, error) {
+	if policy == CleanupNever || (policy == CleanupOnSuccess && !success) {
+		return false, nil
+	}
+	if err := os.RemoveAll(w.Root); err != nil {
+		return false, fmt.Errorf("failed to remove workspace: %w", err)
+	}
+	return true, nil
+}
+
+// LastUsed returns when the workspace was last opened or written to
+func (w *Workspace) LastUsed() (time.Time, error) {
+	var last time.Time
+	paths := []string{filepath.Join(w.Root, marker), w.Matches, w.Reconstruction, w.MVS, w.Logs}
+	logs, _ := filepath.Glob(filepath.Join(w.Logs, "*"))
+	for _, path := range append(paths, logs...) {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
+
+// Stale returns the workspaces directly in dir that were last used before
+// cutoff, dir itself included
+func Stale(dir string, cutoff time.Time) ([]*Workspace, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{abs}
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			candidates = append(candidates, filepath.Join(abs, e.Name()))
+		}
+	}
+
+	var stale []*Workspace
+	for _, root := range candidates {
+		if !isWorkspace(root) {
+			continue
+		}
+		w := layout(root)
+		last, err := w.LastUsed()
+		if err != nil {
+			return nil, err
+		}
+		if last.Before(cutoff) {
+			stale = append(stale, w)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Root < stale[j].Root })
+	return stale, nil
+}
@@ -0,0 +1,125 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/2024-dissertation/openmvgo/internal/workspace"
+)
+
+func TestNew(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "work")
+	w, err := workspace.New(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, dir := range []string{w.Matches, w.Reconstruction, w.MVS, w.Logs} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("expected directory %s", dir)
+		}
+	}
+
+	// Reopening keeps the files of the previous run
+	if err := os.WriteFile(filepath.Join(w.Matches, "sfm_data.json"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workspace.New(root); err != nil {
+		t.Fatalf("unexpected error reusing workspace: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(w.Matches, "sfm_data.json")); err != nil {
+		t.Errorf("expected previous files to be kept: %v", err)
+	}
+	if _, err := workspace.Open(root); err != nil {
+		t.Errorf("unexpected error opening workspace: %v", err)
+	}
+}
+
+func TestNew_NotEmpty(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "photo.jpg"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workspace.New(root); err == nil {
+		t.Error("expected an error for a directory that is not a workspace")
+	}
+	if _, err := workspace.Open(root); err == nil {
+		t.Error("expected an error opening a directory that is not a workspace")
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	tests := []struct {
+		policy  string
+		success bool
+		removed bool
+	}{
+		{workspace.CleanupAlways, true, true},
+		{workspace.CleanupAlways, false, true},
+		{workspace.CleanupOnSuccess, true, true},
+		{workspace.CleanupOnSuccess, false, false},
+		{workspace.CleanupNever, true, false},
+		{workspace.CleanupNever, false, false},
+	}
+	for _, tt := range tests {
+		w, err := workspace.New(filepath.Join(t.TempDir(), "work"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		removed, err := w.Cleanup(tt.policy, tt.success)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, statErr := os.Stat(w.Root)
+		if removed != tt.removed || os.IsNotExist(statErr) != tt.removed {
+			t.Errorf("%s with success %v: expected removed %v, got %v", tt.policy, tt.success, tt.removed, removed)
+		}
+	}
+
+	if err := workspace.ValidatePolicy("sometimes"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestStale(t *testing.T) {
+	dir := t.TempDir()
+	old, err := workspace.New(filepath.Join(dir, "old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workspace.New(filepath.Join(dir, "recent")); err != nil {
+		t.Fatal(err)
+	}
+	// Directories that are not workspaces are never reported
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-48 * time.Hour)
+	for _, path := range []string{filepath.Join(old.Root, ".openmvgo-workspace"), old.Matches, old.Reconstruction, old.MVS, old.Logs} {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stale, err := workspace.Stale(dir, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stale) != 1 || stale[0].Root != old.Root {
+		t.Errorf("expected only %s to be stale, got %+v", old.Root, stale)
+	}
+
+	// Writing a log counts as activity
+	if err := os.WriteFile(filepath.Join(old.Logs, "openMVG_main_SfM.log"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stale, err = workspace.Stale(dir, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("expected no stale workspace, got %+v", stale)
+	}
+}
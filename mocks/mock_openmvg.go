@@ -12,6 +12,8 @@ package mocks
 import (
 	reflect "reflect"
 
+	openmvg "github.com/2024-dissertation/openmvgo/internal/openmvg"
+	pipeline "github.com/2024-dissertation/openmvgo/internal/pipeline"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -39,6 +41,35 @@ func (m *MockOpenMVGServiceInterface) EXPECT() *MockOpenMVGServiceInterfaceMockR
 	return m.recorder
 }
 
+// ExtendSteps mocks base method.
+func (m *MockOpenMVGServiceInterface) ExtendSteps() []pipeline.Step {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtendSteps")
+	ret0, _ := ret[0].([]pipeline.Step)
+	return ret0
+}
+
+// ExtendSteps indicates an expected call of ExtendSteps.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) ExtendSteps() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtendSteps", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).ExtendSteps))
+}
+
+// Localize mocks base method.
+func (m *MockOpenMVGServiceInterface) Localize(query string) ([]openmvg.Localization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Localize", query)
+	ret0, _ := ret[0].([]openmvg.Localization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Localize indicates an expected call of Localize.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) Localize(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Localize", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).Localize), query)
+}
+
 // PopulateTmpDir mocks base method.
 func (m *MockOpenMVGServiceInterface) PopulateTmpDir() {
 	m.ctrl.T.Helper()
@@ -99,6 +130,66 @@ func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMComputeSfMDataColor() *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMComputeSfMDataColor", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMComputeSfMDataColor))
 }
 
+// RunSfMControlPointRegistration mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMControlPointRegistration() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMControlPointRegistration")
+}
+
+// RunSfMControlPointRegistration indicates an expected call of RunSfMControlPointRegistration.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMControlPointRegistration() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMControlPointRegistration", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMControlPointRegistration))
+}
+
+// RunSfMExportJSON mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMExportJSON() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMExportJSON")
+}
+
+// RunSfMExportJSON indicates an expected call of RunSfMExportJSON.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMExportJSON() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMExportJSON", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMExportJSON))
+}
+
+// RunSfMExtendImageListing mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMExtendImageListing() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMExtendImageListing")
+}
+
+// RunSfMExtendImageListing indicates an expected call of RunSfMExtendImageListing.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMExtendImageListing() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMExtendImageListing", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMExtendImageListing))
+}
+
+// RunSfMExtendMatches mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMExtendMatches() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMExtendMatches")
+}
+
+// RunSfMExtendMatches indicates an expected call of RunSfMExtendMatches.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMExtendMatches() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMExtendMatches", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMExtendMatches))
+}
+
+// RunSfMExtendReconstruction mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMExtendReconstruction() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMExtendReconstruction")
+}
+
+// RunSfMExtendReconstruction indicates an expected call of RunSfMExtendReconstruction.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMExtendReconstruction() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMExtendReconstruction", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMExtendReconstruction))
+}
+
 // RunSfMGeometricFilter mocks base method.
 func (m *MockOpenMVGServiceInterface) RunSfMGeometricFilter() {
 	m.ctrl.T.Helper()
@@ -111,6 +202,30 @@ func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMGeometricFilter() *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMGeometricFilter", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMGeometricFilter))
 }
 
+// RunSfMGeoreference mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMGeoreference() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMGeoreference")
+}
+
+// RunSfMGeoreference indicates an expected call of RunSfMGeoreference.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMGeoreference() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMGeoreference", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMGeoreference))
+}
+
+// RunSfMGroupIntrinsics mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMGroupIntrinsics() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMGroupIntrinsics")
+}
+
+// RunSfMGroupIntrinsics indicates an expected call of RunSfMGroupIntrinsics.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMGroupIntrinsics() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMGroupIntrinsics", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMGroupIntrinsics))
+}
+
 // RunSfMInitImageListing mocks base method.
 func (m *MockOpenMVGServiceInterface) RunSfMInitImageListing() {
 	m.ctrl.T.Helper()
@@ -123,6 +238,18 @@ func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMInitImageListing() *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMInitImageListing", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMInitImageListing))
 }
 
+// RunSfMInjectControlPoints mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMInjectControlPoints() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMInjectControlPoints")
+}
+
+// RunSfMInjectControlPoints indicates an expected call of RunSfMInjectControlPoints.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMInjectControlPoints() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMInjectControlPoints", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMInjectControlPoints))
+}
+
 // RunSfMPairGenerator mocks base method.
 func (m *MockOpenMVGServiceInterface) RunSfMPairGenerator() {
 	m.ctrl.T.Helper()
@@ -147,10 +274,52 @@ func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMReconstruction() *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMReconstruction", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMReconstruction))
 }
 
+// RunSfMScale mocks base method.
+func (m *MockOpenMVGServiceInterface) RunSfMScale() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunSfMScale")
+}
+
+// RunSfMScale indicates an expected call of RunSfMScale.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) RunSfMScale() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunSfMScale", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).RunSfMScale))
+}
+
+// SequentialSteps mocks base method.
+func (m *MockOpenMVGServiceInterface) SequentialSteps() []pipeline.Step {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SequentialSteps")
+	ret0, _ := ret[0].([]pipeline.Step)
+	return ret0
+}
+
+// SequentialSteps indicates an expected call of SequentialSteps.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) SequentialSteps() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SequentialSteps", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).SequentialSteps))
+}
+
+// SfMExtendPipeline mocks base method.
+func (m *MockOpenMVGServiceInterface) SfMExtendPipeline() []pipeline.StepResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SfMExtendPipeline")
+	ret0, _ := ret[0].([]pipeline.StepResult)
+	return ret0
+}
+
+// SfMExtendPipeline indicates an expected call of SfMExtendPipeline.
+func (mr *MockOpenMVGServiceInterfaceMockRecorder) SfMExtendPipeline() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SfMExtendPipeline", reflect.TypeOf((*MockOpenMVGServiceInterface)(nil).SfMExtendPipeline))
+}
+
 // SfMSequentialPipeline mocks base method.
-func (m *MockOpenMVGServiceInterface) SfMSequentialPipeline() {
+func (m *MockOpenMVGServiceInterface) SfMSequentialPipeline() []pipeline.StepResult {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SfMSequentialPipeline")
+	ret := m.ctrl.Call(m, "SfMSequentialPipeline")
+	ret0, _ := ret[0].([]pipeline.StepResult)
+	return ret0
 }
 
 // SfMSequentialPipeline indicates an expected call of SfMSequentialPipeline.
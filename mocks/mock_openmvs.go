@@ -12,6 +12,7 @@ package mocks
 import (
 	reflect "reflect"
 
+	pipeline "github.com/2024-dissertation/openmvgo/internal/pipeline"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -39,6 +40,30 @@ func (m *MockOpenMVSServiceInterface) EXPECT() *MockOpenMVSServiceInterfaceMockR
 	return m.recorder
 }
 
+// RunCropMesh mocks base method.
+func (m *MockOpenMVSServiceInterface) RunCropMesh() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunCropMesh")
+}
+
+// RunCropMesh indicates an expected call of RunCropMesh.
+func (mr *MockOpenMVSServiceInterfaceMockRecorder) RunCropMesh() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunCropMesh", reflect.TypeOf((*MockOpenMVSServiceInterface)(nil).RunCropMesh))
+}
+
+// RunCropPointCloud mocks base method.
+func (m *MockOpenMVSServiceInterface) RunCropPointCloud() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunCropPointCloud")
+}
+
+// RunCropPointCloud indicates an expected call of RunCropPointCloud.
+func (mr *MockOpenMVSServiceInterfaceMockRecorder) RunCropPointCloud() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunCropPointCloud", reflect.TypeOf((*MockOpenMVSServiceInterface)(nil).RunCropPointCloud))
+}
+
 // RunDensifyPointCloud mocks base method.
 func (m *MockOpenMVSServiceInterface) RunDensifyPointCloud() {
 	m.ctrl.T.Helper()
@@ -51,10 +76,36 @@ func (mr *MockOpenMVSServiceInterfaceMockRecorder) RunDensifyPointCloud() *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunDensifyPointCloud", reflect.TypeOf((*MockOpenMVSServiceInterface)(nil).RunDensifyPointCloud))
 }
 
+// RunExportPointCloud mocks base method.
+func (m *MockOpenMVSServiceInterface) RunExportPointCloud() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunExportPointCloud")
+}
+
+// RunExportPointCloud indicates an expected call of RunExportPointCloud.
+func (mr *MockOpenMVSServiceInterfaceMockRecorder) RunExportPointCloud() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunExportPointCloud", reflect.TypeOf((*MockOpenMVSServiceInterface)(nil).RunExportPointCloud))
+}
+
+// RunGenerateLODs mocks base method.
+func (m *MockOpenMVSServiceInterface) RunGenerateLODs() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RunGenerateLODs")
+}
+
+// RunGenerateLODs indicates an expected call of RunGenerateLODs.
+func (mr *MockOpenMVSServiceInterfaceMockRecorder) RunGenerateLODs() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunGenerateLODs", reflect.TypeOf((*MockOpenMVSServiceInterface)(nil).RunGenerateLODs))
+}
+
 // RunPipeline mocks base method.
-func (m *MockOpenMVSServiceInterface) RunPipeline() {
+func (m *MockOpenMVSServiceInterface) RunPipeline() []pipeline.StepResult {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "RunPipeline")
+	ret := m.ctrl.Call(m, "RunPipeline")
+	ret0, _ := ret[0].([]pipeline.StepResult)
+	return ret0
 }
 
 // RunPipeline indicates an expected call of RunPipeline.
@@ -98,3 +149,17 @@ func (mr *MockOpenMVSServiceInterfaceMockRecorder) RunTextureMesh() *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunTextureMesh", reflect.TypeOf((*MockOpenMVSServiceInterface)(nil).RunTextureMesh))
 }
+
+// Steps mocks base method.
+func (m *MockOpenMVSServiceInterface) Steps() []pipeline.Step {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Steps")
+	ret0, _ := ret[0].([]pipeline.Step)
+	return ret0
+}
+
+// Steps indicates an expected call of Steps.
+func (mr *MockOpenMVSServiceInterfaceMockRecorder) Steps() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Steps", reflect.TypeOf((*MockOpenMVSServiceInterface)(nil).Steps))
+}